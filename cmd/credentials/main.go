@@ -0,0 +1,93 @@
+// The credentials command creates the credentials with which users sign
+// in to authorize IndieAuth clients. Its output goes into the credentials
+// of the user in the settings; nothing is stored by the command itself.
+//
+// Usage:
+//
+//	credentials password < password.txt
+//	credentials -user username totp
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/indieauth"
+	"github.com/sabertoot/server/internal/plog"
+)
+
+func main() {
+	username := flag.String("user", "", "Sabertoot username of the authenticator app account")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: credentials [-user username] password|totp")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "password":
+		err = hashPassword()
+	case "totp":
+		if *username == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = createTOTPSecret(*username)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		plog.Fatal(err.Error())
+	}
+}
+
+// hashPassword reads the password from the first line of
+// the standard input, so that it doesn't end up in the history.
+func hashPassword() error {
+	fmt.Fprintln(os.Stderr, "Password:")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("error reading password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < 8 {
+		return fmt.Errorf("the password has to be at least 8 characters long")
+	}
+
+	hash, err := indieauth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(`"credentials": { "passwordHash": %q }`+"\n", hash)
+	return nil
+}
+
+func createTOTPSecret(username string) error {
+	// The domain names the account in authenticator apps,
+	// but the command works without settings as well.
+	issuer := "Sabertoot"
+	if settings, err := config.Load(); err == nil && settings.Server != nil && settings.Server.Domain != "" {
+		issuer = settings.Server.Domain
+	}
+
+	secret, err := indieauth.NewTOTPSecret()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(`"credentials": { "totpSecret": %q }`+"\n", secret)
+	fmt.Printf("Add this URI to your authenticator app, e.g. as a QR code:\n%s\n", indieauth.TOTPURI(secret, issuer, username))
+	return nil
+}
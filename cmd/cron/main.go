@@ -3,20 +3,23 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"path"
-	"strconv"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/sabertoot/server/internal/activitypub"
 	"github.com/sabertoot/server/internal/config"
 	"github.com/sabertoot/server/internal/data"
-	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/delivery"
 	"github.com/sabertoot/server/internal/plog"
-	"github.com/sabertoot/server/internal/twitter"
-	"github.com/sabertoot/server/internal/uid"
+	"github.com/sabertoot/server/internal/source"
+
+	// Sources register themselves on import.
+	_ "github.com/sabertoot/server/internal/bluesky"
+	_ "github.com/sabertoot/server/internal/directory"
+	_ "github.com/sabertoot/server/internal/feed"
+	_ "github.com/sabertoot/server/internal/mastodon"
+	_ "github.com/sabertoot/server/internal/twitter"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -41,6 +44,10 @@ func main() {
 	select {}
 }
 
+// Rate limits which are reset within this time are waited for,
+// otherwise the harvest of the source gets deferred to a later run.
+const maxRateLimitSleep = 2 * time.Minute
+
 func harvest(ctx context.Context, settings *config.Settings) {
 	plog.Infof("Initialising SQLite database: %s", settings.SQLite.DSN)
 
@@ -67,226 +74,206 @@ func harvest(ctx context.Context, settings *config.Settings) {
 
 	plog.Info("Successfully initialised SQL tables.")
 
-	harvestTweets(ctx, dataService, settings)
+	if err = os.MkdirAll(settings.Storage.MediaDirectory(), 0755); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	pubFactory := activitypub.NewFactory(settings.Server.PublicBaseURL)
+	plog.Debugf("Registered source types: %s", strings.Join(source.Types(), ", "))
+
+	harvestSources(ctx, dataService, pubFactory, settings)
 
 	interval := settings.Cron.Interval()
 	for {
 		select {
 		case <-ctx.Done():
 			plog.Info("Scheduled task stopped.")
+			return
 		case <-time.After(interval):
-			harvestTweets(ctx, dataService, settings)
+			harvestSources(ctx, dataService, pubFactory, settings)
 		}
 	}
 }
 
-func tryGet[T any](m map[string]any, key string) (T, bool) {
-	var parsed T
-	v, ok := m[key]
-	if !ok {
-		return parsed, false
-	}
-	parsed, ok = v.(T)
-	return parsed, ok
-}
+func harvestSources(
+	ctx context.Context,
+	dataService *data.Service,
+	pubFactory *activitypub.Factory,
+	settings *config.Settings,
+) {
+	accounts := settings.FediverseAccounts()
 
-func mustGet[T any](m map[string]any, key string) (T, error) {
-	var parsed T
-	v, ok := m[key]
-	if !ok {
-		return parsed, fmt.Errorf("cannot find key '%s' in map", key)
-	}
-	parsed, ok = v.(T)
-	if !ok {
-		return parsed, fmt.Errorf("cannot parse value for key %s", key)
+	for _, user := range settings.Users {
+		env := &source.Env{
+			Settings:    settings,
+			DataService: dataService,
+			User:        user,
+			Accounts:    accounts,
+		}
+		for _, cfg := range user.Sources {
+			harvestSource(ctx, env, pubFactory, cfg)
+		}
 	}
-	return parsed, nil
 }
 
-func parseTweet(userID uid.UserID, tweet map[string]any) (*data.Toot, error) {
-	buffer, err := json.Marshal(tweet)
-	if err != nil {
-		return nil, fmt.Errorf("error serialising tweet data: %w", err)
-	}
+func harvestSource(
+	ctx context.Context,
+	env *source.Env,
+	pubFactory *activitypub.Factory,
+	cfg *config.Source,
+) {
+	user := env.User
 
-	id, err := mustGet[string](tweet, "id")
+	cursor, err := env.DataService.SourceCursor(ctx, user.ID, cfg.Key())
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving `id` value: %w", err)
+		plog.Error(err.Error())
+		return
 	}
 
-	createdAtValue, err := mustGet[string](tweet, "created_at")
-	if err != nil {
-		return nil, fmt.Errorf("Error retrieving `created_at` value: %w", err)
+	if cursor.IsDeferred() {
+		plog.Infof("Harvesting %s source of %s is deferred until %s", cfg.Key(), user.Username, cursor.DeferredUntil.Format(time.RFC3339))
+		return
 	}
-	// 2023-01-03T13:57:22.000Z
 
-	createdAt, err := time.Parse(time.RFC3339, createdAtValue)
+	src, err := source.New(env, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing `created_at` value: %w", err)
+		plog.Error(err.Error())
+		return
 	}
 
-	text, err := mustGet[string](tweet, "text")
-	if err != nil {
-		return nil, fmt.Errorf("Error retrieving `text` value: %w", err)
-	}
+	plog.Infof("Harvesting %s source of %s", cfg.Key(), user.Username)
+	harvestPages(ctx, env, pubFactory, cfg, src, cursor)
 
-	sourceID, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing tweet ID: %w", err)
+	if reconciler, ok := src.(source.Reconciler); ok {
+		reconcileSource(ctx, env, pubFactory, cfg, reconciler)
 	}
-
-	tootID := uid.New(userID, uid.Twitter, sourceID)
-
-	return &data.Toot{
-		ID:           tootID,
-		UserID:       userID,
-		CreatedAt:    createdAt,
-		TextOriginal: text,
-		TextHTML:     "ToDo",
-		SourceType:   uid.Twitter,
-		SourceID:     id,
-		SourceData:   string(buffer),
-	}, nil
 }
 
-func harvestTweets(ctx context.Context, dataService *data.Service, settings *config.Settings) {
-	for _, user := range settings.Users {
-		plog.Infof("Collecting tweets for %s", user.Twitter.Username)
-
-		sinceId, err := dataService.LatestTweetID(ctx, user.ID)
-		if err != nil {
-			plog.Error(err.Error())
-			continue
-		}
-		plog.Infof("Latest tweet ID: %s", sinceId)
-
-		nextToken := ""
-		for {
-			result, err := twitter.GetTweetsByUser(
-				ctx,
-				user.Twitter.Username,
-				user.Twitter.Token,
-				user.StartDate,
-				sinceId,
-				nextToken)
-			if err != nil {
-				plog.Error(err.Error())
-				continue
-			}
-
-			// Parse and check meta data:
-			// ---
-			meta, err := mustGet[map[string]any](result, "meta")
-			if err != nil {
-				plog.Error(err.Error())
-				break
-			}
-
-			resultCount, err := mustGet[float64](meta, "result_count")
-			if err != nil {
-				plog.Error(err.Error())
-				break
+// harvestPages fetches all pages which are available right away. Pages
+// arrive from newest to oldest, so they're buffered and saved once the
+// harvest stops, which puts the beginnings of threads first.
+func harvestPages(
+	ctx context.Context,
+	env *source.Env,
+	pubFactory *activitypub.Factory,
+	cfg *config.Source,
+	src source.Source,
+	cursor *data.SourceCursor,
+) {
+	pages := []*source.Page{}
+	next := cursor.Cursor
+	for {
+		page, err := src.Fetch(ctx, next)
+
+		if reset, ok := source.RetryAfter(err); ok {
+			wait := time.Until(reset) + time.Second
+			if wait > maxRateLimitSleep {
+				// The pages so far are saved, so that the
+				// deferred harvest continues from here.
+				cursor.DeferredUntil = reset
+				savePages(ctx, env, pubFactory, cfg, src, cursor, pages)
+				plog.Warningf("Rate limit exhausted, deferring %s source of %s until %s", cfg.Key(), env.User.Username, reset.Format(time.RFC3339))
+				return
 			}
-
-			plog.Debugf("Result count: %d", int(resultCount))
-			if resultCount == 0 {
-				break
+			plog.Infof("Rate limit exhausted, waiting %s", wait.Round(time.Second))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
 			}
-
-			// Parse and save tweets:
-			// ---
-			elements, err := mustGet[[]any](result, "data")
-			if err != nil {
-				plog.Error(err.Error())
-				break
+			continue
+		}
+		if err != nil {
+			// The next run retries the same page.
+			plog.Error(err.Error())
+			if len(pages) > 0 {
+				savePages(ctx, env, pubFactory, cfg, src, cursor, pages)
 			}
+			return
+		}
 
-			for _, elem := range elements {
-				toot, err := parseTweet(user.ID, elem.(map[string]any))
-				if err != nil {
-					plog.Error(err.Error())
-					continue
-				}
-
-				err = dataService.SaveToot(ctx, toot)
-				if err != nil {
-					plog.Errorf("Error saving toot: %s", err.Error())
-					continue
-				}
-				plog.Infof("Toot saved: %s", toot.ID)
-			}
+		pages = append(pages, page)
+		next = page.Cursor
 
-			// Parse user data:
-			// ---
-			includes, err := mustGet[map[string]any](result, "includes")
-			if err != nil {
-				plog.Error(err.Error())
-				break
-			}
+		if !page.More {
+			cursor.DeferredUntil = time.Time{}
+			savePages(ctx, env, pubFactory, cfg, src, cursor, pages)
+			return
+		}
+	}
+}
 
-			users, err := mustGet[[]any](includes, "users")
-			if err != nil {
-				plog.Error(err.Error())
-				break
-			}
+// savePages saves the items of the pages from oldest to newest
+// and then stores the cursor of the last page.
+func savePages(
+	ctx context.Context,
+	env *source.Env,
+	pubFactory *activitypub.Factory,
+	cfg *config.Source,
+	src source.Source,
+	cursor *data.SourceCursor,
+	pages []*source.Page,
+) {
+	for i := len(pages) - 1; i >= 0; i-- {
+		for _, item := range pages[i].Items {
+			saveItem(ctx, env, pubFactory, cfg, src, item)
+		}
+	}
 
-			// Find all profile images:
-			// ---
-			profileImageURLs := make(map[string]string)
-			for _, elem := range users {
-				twitterUser := elem.(map[string]any)
+	if len(pages) > 0 {
+		cursor.Cursor = pages[len(pages)-1].Cursor
+	}
+	cursor.UpdatedAt = time.Now().UTC()
+	if err := env.DataService.SaveSourceCursor(ctx, cursor); err != nil {
+		plog.Error(err.Error())
+	}
+}
 
-				profileImageURL, ok := tryGet[string](twitterUser, "profile_image_url")
-				if !ok || len(profileImageURL) == 0 {
-					continue
-				}
+// saveItem stores a fetched item as a new toot and delivers it to the
+// user's followers. Items which have been harvested before update
+// their toot if they have been edited.
+func saveItem(
+	ctx context.Context,
+	env *source.Env,
+	pubFactory *activitypub.Factory,
+	cfg *config.Source,
+	src source.Source,
+	item source.Item,
+) {
+	dataService := env.DataService
+	user := env.User
+
+	toot, err := src.Toot(ctx, item)
+	if err != nil {
+		plog.Error(err.Error())
+		return
+	}
+	toot.SourceName = cfg.Key()
 
-				username, ok := tryGet[string](twitterUser, "username")
-				if !ok {
-					continue
-				}
+	existing, err := dataService.Toot(ctx, toot.ID)
+	if err != nil {
+		plog.Error(err.Error())
+		return
+	}
 
-				if strings.Contains(profileImageURL, "_normal.") {
-					profileImageURL = strings.Replace(profileImageURL, "_normal", "", 1)
-				}
+	if existing != nil {
+		updateToot(ctx, dataService, pubFactory, user, existing, toot)
+		return
+	}
 
-				profileImageURLs[username] = profileImageURL
-			}
+	toot.Media = src.DownloadMedia(ctx, item, toot)
 
-			// Download profile images:
-			// ---
-			for _, user := range settings.Users {
-				if profileImageURL, ok := profileImageURLs[user.Twitter.Username]; ok {
-					plog.Debugf("Profile image found for user %s: %s", user.Username, profileImageURL)
-
-					ext := ".jpg"
-					parsedURL, err := url.Parse(profileImageURL)
-					if err == nil {
-						actualExt := path.Ext(parsedURL.Path)
-						if len(actualExt) > 0 {
-							ext = actualExt
-						}
-					}
-
-					profileImagePath := settings.Storage.ProfileImageFullFilePath(user.ID, ext)
-					err = download.File(ctx, profileImageURL, profileImagePath)
-					if err != nil {
-						plog.Error(err.Error())
-						continue
-					}
-
-					plog.Infof("Profile image downloaded for user %s: %s", user.Username, profileImagePath)
-				}
-			}
+	err = dataService.SaveToot(ctx, toot)
+	if err != nil {
+		plog.Errorf("Error saving toot: %s", err.Error())
+		return
+	}
+	plog.Infof("Toot saved: %s", toot.ID)
 
-			// Get token to next page:
-			// ---
-			tokenValue, ok := tryGet[string](meta, "next_token")
-			if !ok {
-				plog.Debug("No more tweets to collect.")
-				break
-			}
-			nextToken = tokenValue
-		}
+	activity := pubFactory.NewPublish(user, toot)
+	err = delivery.EnqueueForFollowers(ctx, dataService, user.ID, activity)
+	if err != nil {
+		plog.Errorf("Error queueing toot for delivery: %s", err.Error())
 	}
 }
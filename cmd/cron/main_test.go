@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// post is an item of threadSource, which replies to the post with
+// the source ID in InReplyTo.
+type post struct {
+	ID        uint64
+	InReplyTo uint64
+}
+
+// threadSource serves its pages from newest to oldest,
+// and the cursor is the index of the next page.
+type threadSource struct {
+	env   *source.Env
+	pages [][]*post
+}
+
+func (s *threadSource) Fetch(ctx context.Context, cursor string) (*source.Page, error) {
+	index := 0
+	if cursor != "" {
+		fmt.Sscan(cursor, &index)
+	}
+	page := &source.Page{Cursor: fmt.Sprint(index + 1), More: index+1 < len(s.pages)}
+	for _, p := range s.pages[index] {
+		page.Items = append(page.Items, p)
+	}
+	return page, nil
+}
+
+func (s *threadSource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	p := item.(*post)
+	userID := s.env.User.ID
+	toot := &data.Toot{
+		ID:           uid.New(userID, uid.Twitter, p.ID),
+		UserID:       userID,
+		CreatedAt:    time.Unix(int64(p.ID), 0).UTC(),
+		TextOriginal: fmt.Sprint(p.ID),
+		TextHTML:     fmt.Sprintf("<p>%d</p>", p.ID),
+		SourceType:   uid.Twitter,
+		SourceID:     fmt.Sprint(p.ID),
+		Kind:         data.KindPost,
+	}
+	if p.InReplyTo != 0 {
+		parentID, err := s.env.DataService.SourceTootID(ctx, uid.New(userID, uid.Twitter, p.InReplyTo), userID, uid.Twitter, fmt.Sprint(p.InReplyTo))
+		if err != nil {
+			return nil, err
+		}
+		toot.InReplyToID = parentID
+	}
+	return toot, nil
+}
+
+func (s *threadSource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	return nil
+}
+
+func Test_HarvestPages_ThreadAcrossPages(t *testing.T) {
+	ctx := context.Background()
+	env := sourcetest.NewEnv(t)
+	dataService, user := env.DataService, env.User
+	cfg := &config.Source{Type: "thread"}
+
+	// The second page holds the start of the thread
+	// which continues on the first page.
+	src := &threadSource{env: env, pages: [][]*post{
+		{{ID: 3, InReplyTo: 2}},
+		{{ID: 1}, {ID: 2, InReplyTo: 1}},
+	}}
+	cursor := &data.SourceCursor{UserID: user.ID, SourceName: cfg.Key()}
+
+	harvestPages(ctx, env, activitypub.NewFactory("https://sabertoot.example"), cfg, src, cursor)
+
+	for id, parent := range map[uint64]uint64{2: 1, 3: 2} {
+		toot, err := dataService.Toot(ctx, uid.New(user.ID, uid.Twitter, id))
+		if err != nil || toot == nil {
+			t.Fatalf("toot %d not found: %v", id, err)
+		}
+		if expected := uid.New(user.ID, uid.Twitter, parent); toot.InReplyToID != expected {
+			t.Errorf("expected toot %d to reply to %s, got %q", id, expected, toot.InReplyToID)
+		}
+	}
+
+	saved, err := dataService.SourceCursor(ctx, user.ID, cfg.Key())
+	if err != nil || saved.Cursor != "2" {
+		t.Errorf("unexpected cursor: %+v %v", saved, err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/delivery"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// reconcileSource checks recently harvested toots for edits and
+// deletions at their source and propagates the changes to the
+// user's followers.
+func reconcileSource(
+	ctx context.Context,
+	env *source.Env,
+	pubFactory *activitypub.Factory,
+	cfg *config.Source,
+	reconciler source.Reconciler,
+) {
+	dataService := env.DataService
+	user := env.User
+
+	since := time.Now().UTC().Add(-env.Settings.Cron.ReconcilePeriod())
+	toots, err := dataService.SourceToots(ctx, user.ID, cfg.Key(), since)
+	if err != nil {
+		plog.Error(err.Error())
+		return
+	}
+
+	changes, err := reconciler.Reconcile(ctx, toots)
+	if err != nil {
+		// Changes which have been found so far are still applied.
+		plog.Error(err.Error())
+	}
+	if changes == nil {
+		return
+	}
+
+	existing := make(map[uid.TootID]*data.Toot)
+	for _, toot := range toots {
+		existing[toot.ID] = toot
+	}
+
+	for _, toot := range changes.Deleted {
+		deleteToot(ctx, dataService, pubFactory, user, toot)
+	}
+
+	for _, toot := range changes.Updated {
+		if previous, ok := existing[toot.ID]; ok {
+			updateToot(ctx, dataService, pubFactory, user, previous, toot)
+		}
+	}
+}
+
+// updateToot replaces an existing toot with a newer version from
+// its source and sends an Update to the user's followers.
+func updateToot(
+	ctx context.Context,
+	dataService *data.Service,
+	pubFactory *activitypub.Factory,
+	user *config.User,
+	existing *data.Toot,
+	toot *data.Toot,
+) {
+	if existing.IsDeleted() {
+		plog.Infof("Skipping update of deleted toot %s", existing.ID)
+		return
+	}
+	if existing.IsRepost() || !contentChanged(existing, toot) {
+		return
+	}
+
+	// The new version keeps the publishing date, the media files
+	// and the position in a thread of the original.
+	toot.CreatedAt = existing.CreatedAt
+	toot.Media = keptMedia(existing, toot.Media)
+	toot.InReplyToID = existing.InReplyToID
+	toot.UpdatedAt = time.Now().UTC()
+
+	if err := dataService.UpdateToot(ctx, toot); err != nil {
+		plog.Errorf("Error updating toot: %s", err.Error())
+		return
+	}
+	plog.Infof("Toot updated: %s", toot.ID)
+
+	update := pubFactory.NewUpdate(user, toot)
+	if err := delivery.EnqueueForFollowers(ctx, dataService, user.ID, update); err != nil {
+		plog.Errorf("Error queueing toot update for delivery: %s", err.Error())
+	}
+}
+
+// contentChanged returns true if the new version of a toot looks
+// different. Most sources keep the ID of a post when it's edited,
+// so the ID doesn't tell. Media is only compared if the source
+// lists the media of the new version.
+func contentChanged(existing *data.Toot, toot *data.Toot) bool {
+	if existing.TextHTML != toot.TextHTML ||
+		existing.Summary != toot.Summary ||
+		existing.Sensitive != toot.Sensitive ||
+		existing.Title != toot.Title ||
+		existing.Language != toot.Language ||
+		len(existing.Tags) != len(toot.Tags) {
+		return true
+	}
+	for i, tag := range existing.Tags {
+		if *tag != *toot.Tags[i] {
+			return true
+		}
+	}
+	return toot.Media != nil && mediaChanged(existing.Media, toot.Media)
+}
+
+// mediaChanged compares the media of two versions of a toot by where
+// it's from and its alt text, because the media of a new version only
+// gets listed by its source and isn't downloaded.
+func mediaChanged(existing []*data.Media, media []*data.Media) bool {
+	if len(existing) != len(media) {
+		return true
+	}
+	for i, m := range existing {
+		if m.SourceURL != media[i].SourceURL || m.AltText != media[i].AltText {
+			return true
+		}
+	}
+	return false
+}
+
+// keptMedia returns the media of the new version of a toot, which
+// reuses the files of the original. Sources which don't list the
+// media of a new version keep all of it. Media which has been added
+// by an edit has no file yet and is skipped.
+func keptMedia(existing *data.Toot, media []*data.Media) []*data.Media {
+	if media == nil {
+		return existing.Media
+	}
+
+	bySourceURL := make(map[string]*data.Media)
+	for _, m := range existing.Media {
+		bySourceURL[m.SourceURL] = m
+	}
+	kept := []*data.Media{}
+	for _, m := range media {
+		previous, ok := bySourceURL[m.SourceURL]
+		if !ok {
+			plog.Warningf("Skipping media %s which has been added to toot %s", m.SourceURL, existing.ID)
+			continue
+		}
+		delete(bySourceURL, m.SourceURL)
+		updated := *previous
+		updated.AltText = m.AltText
+		kept = append(kept, &updated)
+	}
+	return kept
+}
+
+// deleteToot marks a toot as deleted and sends a Delete to the user's followers.
+func deleteToot(
+	ctx context.Context,
+	dataService *data.Service,
+	pubFactory *activitypub.Factory,
+	user *config.User,
+	toot *data.Toot,
+) {
+	toot.DeletedAt = time.Now().UTC()
+	if err := dataService.DeleteToot(ctx, toot.ID, toot.DeletedAt); err != nil {
+		plog.Errorf("Error deleting toot: %s", err.Error())
+		return
+	}
+	plog.Infof("Toot deleted: %s", toot.ID)
+
+	del := pubFactory.NewWithdraw(user, toot)
+	if err := delivery.EnqueueForFollowers(ctx, dataService, user.ID, del); err != nil {
+		plog.Errorf("Error queueing toot deletion for delivery: %s", err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func Test_UpdateToot(t *testing.T) {
+	ctx := context.Background()
+	env := sourcetest.NewEnv(t)
+	pubFactory := activitypub.NewFactory("https://sabertoot.example")
+
+	newToot := func(html string) *data.Toot {
+		return &data.Toot{
+			ID:         uid.New(env.User.ID, uid.Feed, 1),
+			UserID:     env.User.ID,
+			CreatedAt:  time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+			TextHTML:   html,
+			SourceType: uid.Feed,
+			SourceID:   "https://blog.example/posts/1",
+			Tags:       []*data.Tag{},
+			Kind:       data.KindPost,
+		}
+	}
+	existing := newToot("<p>Hello</p>")
+	if err := env.DataService.SaveToot(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unchanged post isn't updated.
+	updateToot(ctx, env.DataService, pubFactory, env.User, existing, newToot("<p>Hello</p>"))
+	toot, err := env.DataService.Toot(ctx, existing.ID)
+	if err != nil || toot.IsUpdated() {
+		t.Fatalf("expected the toot not to be updated: %+v %v", toot, err)
+	}
+
+	// Edits are found by their content, as the source ID stays the same.
+	updateToot(ctx, env.DataService, pubFactory, env.User, toot, newToot("<p>Hello again</p>"))
+	toot, err = env.DataService.Toot(ctx, existing.ID)
+	if err != nil || !toot.IsUpdated() || toot.TextHTML != "<p>Hello again</p>" {
+		t.Errorf("expected the toot to be updated: %+v %v", toot, err)
+	}
+}
+
+func Test_UpdateToot_Media(t *testing.T) {
+	ctx := context.Background()
+	env := sourcetest.NewEnv(t)
+	pubFactory := activitypub.NewFactory("https://sabertoot.example")
+
+	newToot := func(media ...*data.Media) *data.Toot {
+		return &data.Toot{
+			ID:         uid.New(env.User.ID, uid.Twitter, 1),
+			UserID:     env.User.ID,
+			CreatedAt:  time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+			TextHTML:   "<p>Photos</p>",
+			SourceType: uid.Twitter,
+			SourceID:   "1",
+			Tags:       []*data.Tag{},
+			Kind:       data.KindPost,
+			Media:      media,
+		}
+	}
+	existing := newToot(
+		&data.Media{Type: data.MediaPhoto, MIMEType: "image/jpeg", FileName: "1-0.jpg", SourceURL: "https://pbs.example/1.jpg", AltText: "A cat"},
+		&data.Media{Type: data.MediaPhoto, MIMEType: "image/jpeg", FileName: "1-1.jpg", SourceURL: "https://pbs.example/2.jpg"},
+	)
+	if err := env.DataService.SaveToot(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits of alt texts and removed media get saved, while
+	// the files of the original are kept.
+	updateToot(ctx, env.DataService, pubFactory, env.User, existing, newToot(
+		&data.Media{SourceURL: "https://pbs.example/2.jpg", AltText: "A dog"},
+		&data.Media{SourceURL: "https://pbs.example/3.jpg", AltText: "Not downloaded"},
+	))
+	toot, err := env.DataService.Toot(ctx, existing.ID)
+	if err != nil || !toot.IsUpdated() {
+		t.Fatalf("expected the toot to be updated: %+v %v", toot, err)
+	}
+	if len(toot.Media) != 1 || toot.Media[0].FileName != "1-1.jpg" || toot.Media[0].AltText != "A dog" || toot.Media[0].MIMEType != "image/jpeg" {
+		t.Errorf("unexpected media: %+v", toot.Media)
+	}
+}
+
+func Test_ContentChanged(t *testing.T) {
+	existing := &data.Toot{
+		TextHTML: "<p>Hello</p>",
+		Language: "en",
+		Tags:     []*data.Tag{{Type: data.TagHashtag, Name: "#go"}},
+		Media:    []*data.Media{{FileName: "1-0.jpg", SourceURL: "https://pbs.example/1.jpg", AltText: "A cat"}},
+	}
+	listed := func(media ...*data.Media) func(toot *data.Toot) {
+		return func(toot *data.Toot) { toot.Media = append([]*data.Media{}, media...) }
+	}
+
+	testCases := []struct {
+		Name     string
+		Edit     func(toot *data.Toot)
+		Expected bool
+	}{
+		{Name: "Unchanged", Edit: func(toot *data.Toot) {}},
+		{Name: "Text", Edit: func(toot *data.Toot) { toot.TextHTML = "<p>Hello again</p>" }, Expected: true},
+		{Name: "Content warning", Edit: func(toot *data.Toot) { toot.Summary = "Spoiler" }, Expected: true},
+		{Name: "Title", Edit: func(toot *data.Toot) { toot.Title = "Hello" }, Expected: true},
+		{Name: "Language", Edit: func(toot *data.Toot) { toot.Language = "de" }, Expected: true},
+		{Name: "Tags", Edit: func(toot *data.Toot) { toot.Tags = []*data.Tag{{Type: data.TagHashtag, Name: "#golang"}} }, Expected: true},
+		{Name: "Source ID", Edit: func(toot *data.Toot) { toot.SourceID = "2" }},
+		{Name: "Same media", Edit: listed(&data.Media{SourceURL: "https://pbs.example/1.jpg", AltText: "A cat"})},
+		{Name: "Alt text", Edit: listed(&data.Media{SourceURL: "https://pbs.example/1.jpg", AltText: "A dog"}), Expected: true},
+		{Name: "Added media", Edit: listed(existing.Media[0], &data.Media{SourceURL: "https://pbs.example/2.jpg"}), Expected: true},
+		{Name: "Removed media", Edit: listed(), Expected: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			toot := *existing
+			toot.Tags = []*data.Tag{{Type: data.TagHashtag, Name: "#go"}}
+			// Sources which don't list media keep it.
+			toot.Media = nil
+			testCase.Edit(&toot)
+			if actual := contentChanged(existing, &toot); actual != testCase.Expected {
+				t.Errorf("Expected %t, Actual %t", testCase.Expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sabertoot/server/internal/twitter"
+)
+
+// archive is a Twitter data archive as it can be downloaded
+// from the account settings. It is a zip file which holds the
+// account data as JavaScript files and the media in folders.
+type archive struct {
+	closer io.Closer
+	files  map[string]*zip.File
+}
+
+func openArchive(filePath string) (*archive, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive: %w", err)
+	}
+	a := newArchive(&reader.Reader)
+	a.closer = reader
+	return a, nil
+}
+
+// newArchive returns an archive of the files of a zip reader.
+func newArchive(reader *zip.Reader) *archive {
+	files := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+	return &archive{files: files}
+}
+
+func (a *archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// has returns true if the archive contains the given file.
+func (a *archive) has(name string) bool {
+	_, ok := a.files[name]
+	return ok
+}
+
+func (a *archive) readFile(name string) ([]byte, error) {
+	file, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("archive does not contain %s", name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// extractFile copies a file from the archive to the given path.
+func (a *archive) extractFile(name string, filePath string) error {
+	content, err := a.readFile(name)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// readData deserialises one of the archive's data files. These are
+// JavaScript files which assign a JSON array to a global variable:
+//
+//	window.YTD.tweets.part0 = [ ... ]
+func (a *archive) readData(name string, v any) error {
+	content, err := a.readFile(name)
+	if err != nil {
+		return err
+	}
+	start := bytes.IndexByte(content, '=')
+	if start < 0 {
+		return fmt.Errorf("unexpected format of %s", name)
+	}
+	if err = json.Unmarshal(content[start+1:], v); err != nil {
+		return fmt.Errorf("error deserialising %s: %w", name, err)
+	}
+	return nil
+}
+
+// tweetFiles returns the names of all files which contain tweets.
+// Older archives call the file tweet.js and large archives split
+// the tweets into additional tweets-part1.js, tweets-part2.js, etc.
+func (a *archive) tweetFiles() []string {
+	names := []string{}
+	for name := range a.files {
+		base := path.Base(name)
+		if path.Dir(name) != "data" || path.Ext(base) != ".js" {
+			continue
+		}
+		if base == "tweets.js" || base == "tweet.js" ||
+			strings.HasPrefix(base, "tweets-part") || strings.HasPrefix(base, "tweet-part") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mediaFile returns the name of the archived file of a tweet's
+// media or an empty string if the archive does not contain it.
+func (a *archive) mediaFile(tweetID string, mediaURL string) string {
+	for _, dir := range []string{"data/tweets_media", "data/tweet_media"} {
+		name := fmt.Sprintf("%s/%s-%s", dir, tweetID, path.Base(mediaURL))
+		if a.has(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+type archivedAccount struct {
+	Account struct {
+		AccountID          string `json:"accountId"`
+		Username           string `json:"username"`
+		AccountDisplayName string `json:"accountDisplayName"`
+	} `json:"account"`
+}
+
+type archivedProfile struct {
+	Profile struct {
+		AvatarMediaURL string `json:"avatarMediaUrl"`
+	} `json:"profile"`
+}
+
+// archivedTweet is a tweet in the format of the Twitter API v1.1,
+// which is what the archive uses.
+type archivedTweet struct {
+	ID                string            `json:"id_str"`
+	CreatedAt         string            `json:"created_at"`
+	FullText          string            `json:"full_text"`
+	Retweeted         bool              `json:"retweeted"`
+	InReplyToStatusID string            `json:"in_reply_to_status_id_str"`
+	InReplyToUserID   string            `json:"in_reply_to_user_id_str"`
+	Entities          archivedEntities  `json:"entities"`
+	ExtendedEntities  *archivedEntities `json:"extended_entities"`
+	EditInfo          *struct {
+		Edit *struct {
+			InitialTweetID string `json:"initialTweetId"`
+		} `json:"edit"`
+	} `json:"edit_info"`
+
+	// The tweet as it was found in the archive.
+	raw json.RawMessage
+}
+
+type archivedEntities struct {
+	Hashtags []*struct {
+		Text    string   `json:"text"`
+		Indices []string `json:"indices"`
+	} `json:"hashtags"`
+	Symbols []*struct {
+		Text    string   `json:"text"`
+		Indices []string `json:"indices"`
+	} `json:"symbols"`
+	UserMentions []*struct {
+		ScreenName string   `json:"screen_name"`
+		ID         string   `json:"id_str"`
+		Indices    []string `json:"indices"`
+	} `json:"user_mentions"`
+	URLs []*struct {
+		URL         string   `json:"url"`
+		ExpandedURL string   `json:"expanded_url"`
+		DisplayURL  string   `json:"display_url"`
+		Indices     []string `json:"indices"`
+	} `json:"urls"`
+	Media []*archivedMedia `json:"media"`
+}
+
+type archivedMedia struct {
+	ID            string   `json:"id_str"`
+	Type          string   `json:"type"`
+	URL           string   `json:"url"`
+	ExpandedURL   string   `json:"expanded_url"`
+	DisplayURL    string   `json:"display_url"`
+	MediaURLHTTPS string   `json:"media_url_https"`
+	AltText       string   `json:"ext_alt_text"`
+	Indices       []string `json:"indices"`
+	Sizes         struct {
+		Large struct {
+			W string `json:"w"`
+			H string `json:"h"`
+		} `json:"large"`
+	} `json:"sizes"`
+}
+
+// readTweets returns all tweets of the archive.
+func (a *archive) readTweets() ([]*archivedTweet, error) {
+	tweets := []*archivedTweet{}
+	for _, name := range a.tweetFiles() {
+		var elements []struct {
+			Tweet json.RawMessage `json:"tweet"`
+		}
+		if err := a.readData(name, &elements); err != nil {
+			return nil, err
+		}
+		for _, elem := range elements {
+			tweet := &archivedTweet{raw: elem.Tweet}
+			if err := json.Unmarshal(elem.Tweet, tweet); err != nil {
+				return nil, fmt.Errorf("error deserialising tweet in %s: %w", name, err)
+			}
+			tweets = append(tweets, tweet)
+		}
+	}
+	return tweets, nil
+}
+
+// OriginalID returns the ID of the first version of an edited tweet.
+func (t *archivedTweet) OriginalID() string {
+	if t.EditInfo != nil && t.EditInfo.Edit != nil && t.EditInfo.Edit.InitialTweetID != "" {
+		return t.EditInfo.Edit.InitialTweetID
+	}
+	return t.ID
+}
+
+// IsRetweet returns true for retweets, which the archive
+// stores as tweets with an "RT @username:" prefix.
+func (t *archivedTweet) IsRetweet() bool {
+	return t.Retweeted || strings.HasPrefix(t.FullText, "RT @")
+}
+
+// MediaList returns the tweet's media. Only the extended entities
+// list all media if a tweet has more than one photo.
+func (t *archivedTweet) MediaList() []*archivedMedia {
+	if t.ExtendedEntities != nil && len(t.ExtendedEntities.Media) > 0 {
+		return t.ExtendedEntities.Media
+	}
+	return t.Entities.Media
+}
+
+// indices parses the start and end of an entity, which
+// the archive stores as strings.
+func indices(values []string) (int, int) {
+	if len(values) != 2 {
+		return 0, 0
+	}
+	start, _ := strconv.Atoi(values[0])
+	end, _ := strconv.Atoi(values[1])
+	return start, end
+}
+
+// TwitterEntities converts the entities into the format of the
+// Twitter API v2, so that they can be rendered like harvested tweets.
+func (t *archivedTweet) TwitterEntities() *twitter.Entities {
+	entities := &twitter.Entities{}
+	for _, e := range t.Entities.Hashtags {
+		start, end := indices(e.Indices)
+		entities.Hashtags = append(entities.Hashtags,
+			&twitter.TagEntity{Start: start, End: end, Tag: e.Text})
+	}
+	for _, e := range t.Entities.Symbols {
+		start, end := indices(e.Indices)
+		entities.Cashtags = append(entities.Cashtags,
+			&twitter.TagEntity{Start: start, End: end, Tag: e.Text})
+	}
+	for _, e := range t.Entities.UserMentions {
+		start, end := indices(e.Indices)
+		entities.Mentions = append(entities.Mentions,
+			&twitter.MentionEntity{Start: start, End: end, Username: e.ScreenName, ID: e.ID})
+	}
+	for _, e := range t.Entities.URLs {
+		start, end := indices(e.Indices)
+		entities.URLs = append(entities.URLs, &twitter.URLEntity{
+			Start:       start,
+			End:         end,
+			URL:         e.URL,
+			ExpandedURL: e.ExpandedURL,
+			DisplayURL:  e.DisplayURL,
+		})
+	}
+	// All media of a tweet share the same link, which gets removed.
+	for _, e := range t.Entities.Media {
+		start, end := indices(e.Indices)
+		entities.URLs = append(entities.URLs, &twitter.URLEntity{
+			Start:       start,
+			End:         end,
+			URL:         e.URL,
+			ExpandedURL: e.ExpandedURL,
+			DisplayURL:  e.DisplayURL,
+			MediaKey:    e.ID,
+		})
+	}
+	return entities
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sabertoot/server/internal/twitter"
+)
+
+// newTestArchive returns an archive of the given files, which is built in memory.
+func newTestArchive(t *testing.T, files map[string]string) *archive {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newArchive(reader)
+}
+
+func Test_ReadData(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		Expected string
+		Error    bool
+	}{
+		{
+			Name:     "Assignment to a global variable",
+			Content:  `window.YTD.account.part0 = [{"account":{"username":"dustinmoris"}}]`,
+			Expected: "dustinmoris",
+		},
+		{
+			Name:     "Line breaks after the assignment",
+			Content:  "window.YTD.account.part0 = [\n  {\n    \"account\" : {\n      \"username\" : \"dustin\"\n    }\n  }\n]",
+			Expected: "dustin",
+		},
+		{
+			Name:    "No assignment",
+			Content: `[{"account":{"username":"dustinmoris"}}]`,
+			Error:   true,
+		},
+		{
+			Name:    "Invalid JSON",
+			Content: `window.YTD.account.part0 = [{"account":`,
+			Error:   true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			arch := newTestArchive(t, map[string]string{"data/account.js": testCase.Content})
+
+			var accounts []*archivedAccount
+			err := arch.readData("data/account.js", &accounts)
+			if testCase.Error {
+				if err == nil {
+					t.Errorf("Expected an error, Actual %+v", accounts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(accounts) != 1 || accounts[0].Account.Username != testCase.Expected {
+				t.Errorf("Expected %s, Actual %+v", testCase.Expected, accounts)
+			}
+		})
+	}
+}
+
+func Test_TweetFiles(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Files    []string
+		Expected []string
+	}{
+		{
+			Name:     "Single file",
+			Files:    []string{"data/tweets.js", "data/account.js", "data/tweets_media/1-a.jpg"},
+			Expected: []string{"data/tweets.js"},
+		},
+		{
+			Name:     "Older archive",
+			Files:    []string{"data/tweet.js", "data/profile.js"},
+			Expected: []string{"data/tweet.js"},
+		},
+		{
+			Name:     "Split into parts",
+			Files:    []string{"data/tweets-part2.js", "data/tweets.js", "data/tweets-part1.js"},
+			Expected: []string{"data/tweets-part1.js", "data/tweets-part2.js", "data/tweets.js"},
+		},
+		{
+			Name:     "Files outside of the data folder",
+			Files:    []string{"tweets.js", "assets/data/tweets.js", "data/tweets.json"},
+			Expected: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			files := make(map[string]string)
+			for _, name := range testCase.Files {
+				files[name] = ""
+			}
+			arch := newTestArchive(t, files)
+
+			if actual := arch.tweetFiles(); !reflect.DeepEqual(actual, testCase.Expected) {
+				t.Errorf("Expected %v, Actual %v", testCase.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_ReadTweets(t *testing.T) {
+	arch := newTestArchive(t, map[string]string{
+		"data/tweets.js":       `window.YTD.tweets.part0 = [{"tweet":{"id_str":"1","full_text":"One"}}]`,
+		"data/tweets-part1.js": `window.YTD.tweets.part1 = [{"tweet":{"id_str":"2","full_text":"Two"}},{"tweet":{"id_str":"3","full_text":"Three"}}]`,
+	})
+
+	tweets, err := arch.readTweets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, tweet := range tweets {
+		ids = append(ids, tweet.ID)
+		if !strings.Contains(string(tweet.raw), tweet.FullText) {
+			t.Errorf("Expected the raw tweet %s, Actual %s", tweet.ID, tweet.raw)
+		}
+	}
+	if strings.Join(ids, ",") != "2,3,1" {
+		t.Errorf("Expected the tweets of all parts, Actual %v", ids)
+	}
+}
+
+func Test_ArchivedTweet(t *testing.T) {
+	testCases := []struct {
+		Name               string
+		Tweet              string
+		ExpectedOriginalID string
+		ExpectedRetweet    bool
+	}{
+		{
+			Name:               "Tweet",
+			Tweet:              `{"id_str":"10","full_text":"Hello"}`,
+			ExpectedOriginalID: "10",
+		},
+		{
+			Name:               "Edited tweet",
+			Tweet:              `{"id_str":"12","full_text":"Hello!","edit_info":{"edit":{"initialTweetId":"10"}}}`,
+			ExpectedOriginalID: "10",
+		},
+		{
+			Name:               "First version of an edited tweet",
+			Tweet:              `{"id_str":"10","full_text":"Hello","edit_info":{"initial":{"editTweetIds":["10","12"]}}}`,
+			ExpectedOriginalID: "10",
+		},
+		{
+			Name:               "Retweet",
+			Tweet:              `{"id_str":"20","full_text":"RT @alice: Hello"}`,
+			ExpectedOriginalID: "20",
+			ExpectedRetweet:    true,
+		},
+		{
+			Name:               "Retweeted flag",
+			Tweet:              `{"id_str":"21","full_text":"Hello","retweeted":true}`,
+			ExpectedOriginalID: "21",
+			ExpectedRetweet:    true,
+		},
+		{
+			Name:               "Mention of RT",
+			Tweet:              `{"id_str":"22","full_text":"Please RT @alice"}`,
+			ExpectedOriginalID: "22",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			arch := newTestArchive(t, map[string]string{
+				"data/tweets.js": `window.YTD.tweets.part0 = [{"tweet":` + testCase.Tweet + `}]`,
+			})
+			tweets, err := arch.readTweets()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tweet := tweets[0]
+			if actual := tweet.OriginalID(); actual != testCase.ExpectedOriginalID {
+				t.Errorf("Expected original ID %s, Actual %s", testCase.ExpectedOriginalID, actual)
+			}
+			if actual := tweet.IsRetweet(); actual != testCase.ExpectedRetweet {
+				t.Errorf("Expected retweet %t, Actual %t", testCase.ExpectedRetweet, actual)
+			}
+		})
+	}
+}
+
+func Test_TwitterEntities(t *testing.T) {
+	arch := newTestArchive(t, map[string]string{
+		"data/tweets.js": `window.YTD.tweets.part0 = [{"tweet":{
+			"id_str": "30",
+			"full_text": "Hi @alice #Go $ABC https://t.co/a https://t.co/m",
+			"entities": {
+				"hashtags": [{"text": "Go", "indices": ["10", "13"]}],
+				"symbols": [{"text": "ABC", "indices": ["14", "18"]}],
+				"user_mentions": [{"screen_name": "alice", "id_str": "99", "indices": ["3", "9"]}],
+				"urls": [{"url": "https://t.co/a", "expanded_url": "https://example.com/", "display_url": "example.com", "indices": ["19", "33"]}],
+				"media": [{"id_str": "40", "url": "https://t.co/m", "expanded_url": "https://twitter.com/dustin/status/30/photo/1", "display_url": "pic.twitter.com/m", "indices": ["34", "48"]}]
+			}
+		}}]`,
+	})
+	tweets, err := arch.readTweets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &twitter.Entities{
+		Hashtags: []*twitter.TagEntity{{Start: 10, End: 13, Tag: "Go"}},
+		Cashtags: []*twitter.TagEntity{{Start: 14, End: 18, Tag: "ABC"}},
+		Mentions: []*twitter.MentionEntity{{Start: 3, End: 9, Username: "alice", ID: "99"}},
+		URLs: []*twitter.URLEntity{
+			{Start: 19, End: 33, URL: "https://t.co/a", ExpandedURL: "https://example.com/", DisplayURL: "example.com"},
+			{Start: 34, End: 48, URL: "https://t.co/m", ExpandedURL: "https://twitter.com/dustin/status/30/photo/1", DisplayURL: "pic.twitter.com/m", MediaKey: "40"},
+		},
+	}
+	if actual := tweets[0].TwitterEntities(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v, Actual %+v", expected, actual)
+	}
+}
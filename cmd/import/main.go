@@ -0,0 +1,354 @@
+// The import command reads a Twitter data archive and stores all tweets
+// which aren't known yet as toots. Imported toots are not delivered to
+// followers, because they are history. Remote servers can still backfill
+// them from the outbox.
+//
+// Usage:
+//
+//	import -archive twitter-2023-01-01-abc.zip [-user username]
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/twitter"
+	"github.com/sabertoot/server/internal/uid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	archivePath := flag.String("archive", "", "path to the Twitter archive zip file")
+	username := flag.String("user", "", "Sabertoot username to import the archive for (default: the user whose Twitter account matches the archive)")
+	flag.Parse()
+
+	if *archivePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	plog.Info("Sabertoot import starting...")
+
+	plog.Debug("Loading settings...")
+	settings, err := config.Load()
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	plog.Infof("Opening archive: %s", *archivePath)
+	arch, err := openArchive(*archivePath)
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+	defer arch.Close()
+
+	var accounts []*archivedAccount
+	if err = arch.readData("data/account.js", &accounts); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+	if len(accounts) == 0 {
+		plog.Fatal("archive does not contain an account")
+		return
+	}
+	account := accounts[0]
+
+	user, err := findUser(settings, *username, account.Account.Username)
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+	plog.Infof("Importing archive of @%s for %s", account.Account.Username, user.Username)
+
+	plog.Infof("Initialising SQLite database: %s", settings.SQLite.DSN)
+	db, err := sql.Open("sqlite3", settings.SQLite.DSN)
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+	defer db.Close()
+
+	dataService := data.NewService(db)
+	if err = dataService.InitTables(ctx); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	if err = os.MkdirAll(settings.Storage.MediaDirectory(), 0755); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	importProfileImage(ctx, settings, arch, account, user)
+
+	if err = importTweets(ctx, dataService, settings, arch, account.Account.AccountID, user); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+}
+
+// findUser returns the configured user with the given username or,
+// if none is given, the user whose Twitter account the archive belongs to.
+func findUser(settings *config.Settings, username string, twitterUsername string) (*config.User, error) {
+	for _, user := range settings.Users {
+		if username != "" && user.Username == username {
+			return user, nil
+		}
+		if username != "" {
+			continue
+		}
+		if account := user.TwitterAccount(); account != nil && strings.EqualFold(account.Username, twitterUsername) {
+			return user, nil
+		}
+	}
+	if username != "" {
+		return nil, fmt.Errorf("user %s is not configured", username)
+	}
+	return nil, fmt.Errorf("no user is configured for Twitter account @%s", twitterUsername)
+}
+
+func importProfileImage(
+	ctx context.Context,
+	settings *config.Settings,
+	arch *archive,
+	account *archivedAccount,
+	user *config.User,
+) {
+	var profiles []*archivedProfile
+	if err := arch.readData("data/profile.js", &profiles); err != nil {
+		plog.Warningf("Skipping profile image: %s", err.Error())
+		return
+	}
+	if len(profiles) == 0 || profiles[0].Profile.AvatarMediaURL == "" {
+		plog.Debug("Archive has no profile image.")
+		return
+	}
+
+	avatarURL := profiles[0].Profile.AvatarMediaURL
+	ext := path.Ext(avatarURL)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	name := fmt.Sprintf("data/profile_media/%s-%s", account.Account.AccountID, path.Base(avatarURL))
+	profileImagePath := settings.Storage.ProfileImageFullFilePath(user.ID, ext)
+
+	if err := arch.extractFile(name, profileImagePath); err != nil {
+		plog.Warningf("Skipping profile image: %s", err.Error())
+		return
+	}
+	plog.Infof("Profile image imported for user %s: %s", user.Username, profileImagePath)
+}
+
+func importTweets(
+	ctx context.Context,
+	dataService *data.Service,
+	settings *config.Settings,
+	arch *archive,
+	accountID string,
+	user *config.User,
+) error {
+	tweets, err := arch.readTweets()
+	if err != nil {
+		return err
+	}
+	plog.Infof("Archive contains %d tweets", len(tweets))
+
+	// Every version of an edited tweet is in the archive.
+	// Only the latest one is imported.
+	latest := make(map[string]*archivedTweet)
+	for _, tweet := range tweets {
+		originalID := tweet.OriginalID()
+		if current, ok := latest[originalID]; !ok || isNewer(tweet.ID, current.ID) {
+			latest[originalID] = tweet
+		}
+	}
+
+	// Tweets are imported from oldest to newest,
+	// so that threads are imported in order.
+	originalIDs := []string{}
+	for originalID := range latest {
+		originalIDs = append(originalIDs, originalID)
+	}
+	sort.Slice(originalIDs, func(i, j int) bool { return isNewer(originalIDs[j], originalIDs[i]) })
+
+	// Imported toots belong to the user's Twitter source,
+	// so that the harvester checks them for changes, too.
+	sourceName := config.SourceTypeTwitter
+	if source := user.Source(config.SourceTypeTwitter); source != nil {
+		sourceName = source.Key()
+	}
+
+	accounts := settings.FediverseAccounts()
+	imported, skipped := 0, 0
+	for _, originalID := range originalIDs {
+		tweet := latest[originalID]
+
+		// Same as the harvester, which only collects replies to the user's own
+		// tweets. Retweets are skipped, because the archive doesn't hold the
+		// ID of the original tweet, which is needed to announce it.
+		if tweet.IsRetweet() || (tweet.InReplyToStatusID != "" && tweet.InReplyToUserID != accountID) {
+			skipped++
+			continue
+		}
+
+		toot, err := parseArchivedTweet(user.ID, originalID, tweet, accounts)
+		if err != nil {
+			plog.Error(err.Error())
+			continue
+		}
+
+		if toot.InReplyToID, err = threadParent(ctx, dataService, user.ID, tweet.InReplyToStatusID); err != nil {
+			return err
+		}
+
+		existing, err := dataService.Toot(ctx, toot.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			skipped++
+			continue
+		}
+
+		toot.SourceName = sourceName
+		toot.Media = importTweetMedia(ctx, settings, arch, toot.ID, tweet)
+
+		if err = dataService.SaveToot(ctx, toot); err != nil {
+			return fmt.Errorf("error saving toot: %w", err)
+		}
+		imported++
+		plog.Debugf("Toot imported: %s", toot.ID)
+	}
+
+	plog.Infof("Imported %d tweets, skipped %d", imported, skipped)
+	return nil
+}
+
+// threadParent returns the ID of the toot which a self reply continues
+// or an empty ID if the previous tweet hasn't been imported.
+func threadParent(
+	ctx context.Context,
+	dataService *data.Service,
+	userID uid.UserID,
+	parentID string,
+) (uid.TootID, error) {
+	if parentID == "" {
+		return "", nil
+	}
+
+	sourceID, err := strconv.ParseUint(parentID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("error parsing tweet ID: %w", err)
+	}
+
+	return dataService.SourceTootID(ctx, uid.New(userID, uid.Twitter, sourceID), userID, uid.Twitter, parentID)
+}
+
+// isNewer compares two tweet IDs, which increase over time.
+func isNewer(id string, than string) bool {
+	a, _ := strconv.ParseUint(id, 10, 64)
+	b, _ := strconv.ParseUint(than, 10, 64)
+	return a > b
+}
+
+func parseArchivedTweet(
+	userID uid.UserID,
+	originalID string,
+	tweet *archivedTweet,
+	accounts map[string]*config.FediverseAccount,
+) (*data.Toot, error) {
+	// Wed Oct 10 20:19:24 +0000 2018
+	createdAt, err := time.Parse(time.RubyDate, tweet.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing `created_at` value of tweet %s: %w", tweet.ID, err)
+	}
+
+	// The toot ID is derived from the original tweet,
+	// exactly like the harvester does it.
+	sourceID, err := strconv.ParseUint(originalID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tweet ID: %w", err)
+	}
+
+	rendered := twitter.RenderHTML(tweet.FullText, tweet.TwitterEntities(), accounts)
+
+	return &data.Toot{
+		ID:           uid.New(userID, uid.Twitter, sourceID),
+		UserID:       userID,
+		CreatedAt:    createdAt.UTC(),
+		TextOriginal: tweet.FullText,
+		TextHTML:     rendered.HTML,
+		SourceType:   uid.Twitter,
+		SourceID:     tweet.ID,
+		SourceData:   string(tweet.raw),
+		Tags:         rendered.Tags(),
+	}, nil
+}
+
+// importTweetMedia copies the photos of a tweet from the archive. GIFs
+// and videos are only archived as MP4 files, so their preview images get
+// downloaded from Twitter, just like the harvester does it.
+func importTweetMedia(
+	ctx context.Context,
+	settings *config.Settings,
+	arch *archive,
+	tootID uid.TootID,
+	tweet *archivedTweet,
+) []*data.Media {
+	result := []*data.Media{}
+	for _, media := range tweet.MediaList() {
+		ext := path.Ext(media.MediaURLHTTPS)
+		if ext == "" {
+			ext = ".jpg"
+		}
+		mimeType := mime.TypeByExtension(ext)
+		if mimeType == "" {
+			mimeType = "image/jpeg"
+		}
+
+		fileName := fmt.Sprintf("%s-%d%s", tootID, len(result), ext)
+		filePath := settings.Storage.MediaFullFilePath(fileName)
+
+		var err error
+		if name := arch.mediaFile(tweet.ID, media.MediaURLHTTPS); name != "" {
+			err = arch.extractFile(name, filePath)
+		} else {
+			err = download.File(ctx, media.MediaURLHTTPS, filePath)
+		}
+		if err != nil {
+			plog.Errorf("Error importing media %s of toot %s: %s", media.ID, tootID, err.Error())
+			continue
+		}
+
+		width, _ := strconv.Atoi(media.Sizes.Large.W)
+		height, _ := strconv.Atoi(media.Sizes.Large.H)
+
+		result = append(result, &data.Media{
+			Type:      media.Type,
+			MIMEType:  mimeType,
+			FileName:  fileName,
+			Width:     width,
+			Height:    height,
+			AltText:   media.AltText,
+			SourceURL: media.MediaURLHTTPS,
+		})
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const testTweets = `window.YTD.tweets.part0 = [
+	{"tweet": {"id_str": "1", "created_at": "Tue Jan 03 10:00:00 +0000 2023", "full_text": "Hello",
+		"edit_info": {"initial": {"editTweetIds": ["1", "3"]}}}},
+	{"tweet": {"id_str": "3", "created_at": "Tue Jan 03 10:05:00 +0000 2023", "full_text": "Hello, edited",
+		"edit_info": {"edit": {"initialTweetId": "1"}}}},
+	{"tweet": {"id_str": "4", "created_at": "Tue Jan 03 11:00:00 +0000 2023", "full_text": "RT @alice: Hi"}},
+	{"tweet": {"id_str": "5", "created_at": "Tue Jan 03 12:00:00 +0000 2023", "full_text": "@alice Hi",
+		"in_reply_to_status_id_str": "2", "in_reply_to_user_id_str": "200"}},
+	{"tweet": {"id_str": "6", "created_at": "Tue Jan 03 13:00:00 +0000 2023", "full_text": "More",
+		"in_reply_to_status_id_str": "1", "in_reply_to_user_id_str": "100"}}
+]`
+
+func Test_ImportTweets(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	ctx := context.Background()
+	dataService := data.NewService(db)
+	if err = dataService.InitTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &config.User{ID: 1, Username: "dustin"}
+	settings := &config.Settings{
+		Server:  &config.Server{Domain: "sabertoot.example", PublicBaseURL: "https://sabertoot.example"},
+		Storage: &config.Storage{Path: t.TempDir()},
+		Users:   []*config.User{user},
+	}
+	arch := newTestArchive(t, map[string]string{"data/tweets.js": testTweets})
+
+	// Importing the archive again doesn't duplicate anything.
+	for run := 1; run <= 2; run++ {
+		if err = importTweets(ctx, dataService, settings, arch, "100", user); err != nil {
+			t.Fatalf("Run %d: %v", run, err)
+		}
+
+		testCases := []struct {
+			TweetID          uint64
+			ExpectedSourceID string
+			ExpectedText     string
+		}{
+			// Only the latest version of an edited tweet is
+			// imported, as the toot of the original tweet.
+			{TweetID: 1, ExpectedSourceID: "3", ExpectedText: "Hello, edited"},
+			{TweetID: 3},
+			// Retweets and replies to other accounts are skipped.
+			{TweetID: 4},
+			{TweetID: 5},
+			{TweetID: 6, ExpectedSourceID: "6", ExpectedText: "More"},
+		}
+		for _, testCase := range testCases {
+			toot, err := dataService.Toot(ctx, uid.New(user.ID, uid.Twitter, testCase.TweetID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.ExpectedSourceID == "" {
+				if toot != nil {
+					t.Errorf("Run %d: Expected tweet %d to be skipped, Actual %+v", run, testCase.TweetID, toot)
+				}
+				continue
+			}
+			if toot == nil || toot.SourceID != testCase.ExpectedSourceID || toot.TextOriginal != testCase.ExpectedText {
+				t.Errorf("Run %d: Unexpected toot of tweet %d: %+v", run, testCase.TweetID, toot)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// The token command manages the access tokens which clients, e.g.
+// Micropub apps, use to post on behalf of a user. The secret of a new
+// token is only shown once, because only its hash gets stored.
+//
+// Usage:
+//
+//	token -user username create [-client name] [-scope "create update delete media"]
+//	token -user username list
+//	token -user username revoke token-id
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/token"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	username := flag.String("user", "", "Sabertoot username whose tokens are managed")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: token -user username create|list|revoke [arguments]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *username == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	settings, err := config.Load()
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	var user *config.User
+	for _, u := range settings.Users {
+		if u.Username == *username {
+			user = u
+		}
+	}
+	if user == nil {
+		plog.Fatalf("user %s is not configured", *username)
+		return
+	}
+
+	db, err := sql.Open("sqlite3", settings.SQLite.DSN)
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+	defer db.Close()
+
+	dataService := data.NewService(db)
+	if err = dataService.InitTables(ctx); err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	args := flag.Args()
+	switch args[0] {
+	case "create":
+		err = createToken(ctx, dataService, user, args[1:])
+	case "list":
+		err = listTokens(ctx, dataService, user)
+	case "revoke":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = revokeToken(ctx, dataService, user, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		plog.Fatal(err.Error())
+	}
+}
+
+func createToken(ctx context.Context, dataService *data.Service, user *config.User, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	clientID := flags.String("client", "manual", "name of the app which uses the token")
+	scope := flags.String("scope", token.DefaultScope, "space separated permissions of the token")
+	flags.Parse(args)
+
+	t, secret, err := token.New(user.ID, *clientID, *scope)
+	if err != nil {
+		return err
+	}
+	if err = dataService.SaveAccessToken(ctx, t); err != nil {
+		return err
+	}
+
+	fmt.Printf("Token %s of %s for %s (%s):\n%s\n", t.ID, user.Username, t.ClientID, t.Scope, secret)
+	return nil
+}
+
+func listTokens(ctx context.Context, dataService *data.Service, user *config.User) error {
+	tokens, err := dataService.AccessTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tCLIENT\tSCOPE\tCREATED\tLAST USED")
+	for _, t := range tokens {
+		lastUsed := "never"
+		if !t.LastUsedAt.IsZero() {
+			lastUsed = t.LastUsedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.ClientID, t.Scope, t.CreatedAt.Format(time.RFC3339), lastUsed)
+	}
+	return out.Flush()
+}
+
+func revokeToken(ctx context.Context, dataService *data.Service, user *config.User, id string) error {
+	deleted, err := dataService.DeleteAccessToken(ctx, user.ID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%s has no token %s", user.Username, id)
+	}
+
+	fmt.Printf("Token %s of %s has been revoked\n", id, user.Username)
+	return nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/plog"
+)
+
+func (h *Handler) serveFollowers(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	totalItems, err := h.dataService.FollowerCount(ctx, user.ID)
+	if err != nil {
+		plog.Errorf("error getting follower count: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	id := h.settings.Server.PublicBaseURL + user.FollowersPath()
+
+	if user.HideFollowers {
+		h.serveObject(w, activitypub.NewOrderedCollection(id, totalItems, "", ""))
+		return
+	}
+
+	pageValue := r.URL.Query().Get("page")
+	if len(pageValue) == 0 {
+		h.serveObject(w, activitypub.NewOrderedCollection(
+			id,
+			totalItems,
+			fmt.Sprintf("%s?page=1", id),
+			fmt.Sprintf("%s?page=%d", id, lastPage(totalItems))))
+		return
+	}
+
+	pageNumber, err := strconv.Atoi(pageValue)
+	if err != nil || pageNumber < 1 {
+		h.error400(w, "The query parameter 'page' must be a positive integer")
+		return
+	}
+
+	followerIDs, err := h.dataService.FollowerIDs(ctx, user.ID, (pageNumber-1)*pageSize, pageSize)
+	if err != nil {
+		plog.Errorf("error getting followers: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	next, prev := "", ""
+	if pageNumber < lastPage(totalItems) {
+		next = fmt.Sprintf("%s?page=%d", id, pageNumber+1)
+	}
+	if pageNumber > 1 {
+		prev = fmt.Sprintf("%s?page=%d", id, pageNumber-1)
+	}
+
+	page := activitypub.NewOrderedCollectionPage(
+		fmt.Sprintf("%s?page=%d", id, pageNumber), id, next, prev)
+	for _, followerID := range followerIDs {
+		page.OrderedItems = append(page.OrderedItems, followerID)
+	}
+
+	h.serveObject(w, page)
+}
+
+// serveFollowing serves the collection of accounts a user follows.
+// Sabertoot users don't follow anyone, so the collection is always empty.
+func (h *Handler) serveFollowing(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	id := h.settings.Server.PublicBaseURL + user.FollowingPath()
+
+	if len(r.URL.Query().Get("page")) == 0 {
+		h.serveObject(w, activitypub.NewOrderedCollection(
+			id, 0, fmt.Sprintf("%s?page=1", id), ""))
+		return
+	}
+
+	h.serveObject(w, activitypub.NewOrderedCollectionPage(
+		fmt.Sprintf("%s?page=1", id), id, "", ""))
+}
+
+func lastPage(totalItems int) int {
+	if totalItems == 0 {
+		return 1
+	}
+	return (totalItems + pageSize - 1) / pageSize
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+)
+
+type testCollection struct {
+	Type         string
+	ID           string
+	TotalItems   int
+	First        string
+	Last         string
+	Next         string
+	Prev         string
+	PartOf       string
+	OrderedItems []string
+}
+
+func Test_ServeFollowers(t *testing.T) {
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+
+	// Followers are listed from the newest to the oldest.
+	createdAt := time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)
+	expected := []string{}
+	for i := 1; i <= pageSize+5; i++ {
+		actorID := fmt.Sprintf("https://mastodon.example/users/follower%02d", i)
+		err := h.dataService.SaveFollower(ctx, &data.Follower{
+			UserID:    user.ID,
+			ActorID:   actorID,
+			Inbox:     actorID + "/inbox",
+			FollowID:  actorID + "#follows/1",
+			CreatedAt: createdAt.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append([]string{actorID}, expected...)
+	}
+
+	get := func(query string) (int, *testCollection) {
+		req := httptest.NewRequest(http.MethodGet, user.FollowersPath()+query, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		collection := &testCollection{}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), collection); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, collection
+	}
+	id := h.settings.Server.PublicBaseURL + user.FollowersPath()
+
+	testCases := []struct {
+		Name          string
+		HideFollowers bool
+		Query         string
+		ExpectedCode  int
+		Expected      *testCollection
+	}{
+		{
+			Name:         "Collection",
+			ExpectedCode: http.StatusOK,
+			Expected: &testCollection{
+				Type: "OrderedCollection", ID: id, TotalItems: pageSize + 5,
+				First: id + "?page=1", Last: id + "?page=2",
+			},
+		},
+		{
+			Name:         "First page",
+			Query:        "?page=1",
+			ExpectedCode: http.StatusOK,
+			Expected: &testCollection{
+				Type: "OrderedCollectionPage", ID: id + "?page=1", PartOf: id,
+				Next: id + "?page=2", OrderedItems: expected[:pageSize],
+			},
+		},
+		{
+			Name:         "Last page",
+			Query:        "?page=2",
+			ExpectedCode: http.StatusOK,
+			Expected: &testCollection{
+				Type: "OrderedCollectionPage", ID: id + "?page=2", PartOf: id,
+				Prev: id + "?page=1", OrderedItems: expected[pageSize:],
+			},
+		},
+		{
+			Name:         "Page after the last one",
+			Query:        "?page=3",
+			ExpectedCode: http.StatusOK,
+			Expected: &testCollection{
+				Type: "OrderedCollectionPage", ID: id + "?page=3", PartOf: id,
+				Prev: id + "?page=2", OrderedItems: []string{},
+			},
+		},
+		{
+			Name:         "Invalid page",
+			Query:        "?page=0",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:          "Hidden followers",
+			HideFollowers: true,
+			ExpectedCode:  http.StatusOK,
+			Expected:      &testCollection{Type: "OrderedCollection", ID: id, TotalItems: pageSize + 5},
+		},
+		{
+			Name:          "Page of hidden followers",
+			HideFollowers: true,
+			Query:         "?page=1",
+			ExpectedCode:  http.StatusOK,
+			Expected:      &testCollection{Type: "OrderedCollection", ID: id, TotalItems: pageSize + 5},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			user.HideFollowers = testCase.HideFollowers
+
+			code, collection := get(testCase.Query)
+			if code != testCase.ExpectedCode {
+				t.Fatalf("Expected status %d, Actual %d", testCase.ExpectedCode, code)
+			}
+			if testCase.Expected != nil && !reflect.DeepEqual(collection, testCase.Expected) {
+				t.Errorf("Expected %+v, Actual %+v", testCase.Expected, collection)
+			}
+		})
+	}
+}
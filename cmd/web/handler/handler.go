@@ -7,14 +7,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sabertoot/server/internal/activitypub"
 	"github.com/sabertoot/server/internal/config"
 	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/indieauth"
 	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/uid"
 )
 
 const (
@@ -28,21 +30,34 @@ const (
 	pageSize = 20
 )
 
+// Let's create a Y99k problem in memory of Jay-Z
+var maxEpoch = time.Date(99000, 12, 31, 23, 59, 59, 0, time.UTC).Unix()
+
 type Handler struct {
 	settings    *config.Settings
 	dataService *data.Service
 	pubFactory  *activitypub.Factory
+	pubClient   *activitypub.Client
+	keys        map[uid.UserID]*httpsig.Key
+	authCodes   *indieauth.CodeStore
+	authGuard   *indieauth.Guard
 }
 
 func New(
 	settings *config.Settings,
 	dataService *data.Service,
 	pubFactory *activitypub.Factory,
+	pubClient *activitypub.Client,
+	keys map[uid.UserID]*httpsig.Key,
 ) *Handler {
 	return &Handler{
 		settings:    settings,
 		dataService: dataService,
 		pubFactory:  pubFactory,
+		pubClient:   pubClient,
+		keys:        keys,
+		authCodes:   indieauth.NewCodeStore(),
+		authGuard:   indieauth.NewGuard(),
 	}
 }
 
@@ -80,6 +95,13 @@ func (h *Handler) error400(w http.ResponseWriter, msg string) {
 	w.Write([]byte(`{ "error": "` + msg + `" }`))
 }
 
+func (h *Handler) error401(w http.ResponseWriter, msg string) {
+	clearHeaders(w)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Write([]byte(`{ "error": "` + msg + `" }`))
+}
+
 func (h *Handler) error500(w http.ResponseWriter, err error) {
 	clearHeaders(w)
 	w.WriteHeader(http.StatusInternalServerError)
@@ -133,19 +155,27 @@ func (h *Handler) serveWebFinger(w http.ResponseWriter, r *http.Request) {
 	h.error404(w, "User does not exist or has been moved")
 }
 
-func (h *Handler) serveObject(w http.ResponseWriter, obj any) {
+func (h *Handler) serveJSONStatus(w http.ResponseWriter, statusCode int, mediaType string, obj any) {
 	bytes, err := json.Marshal(obj)
 	if err != nil {
-		plog.Errorf("error marshalling actor: %v", err)
+		plog.Errorf("error marshalling object: %v", err)
 		h.error500(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", mediaTypeActivity)
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(statusCode)
 	w.Write(bytes)
 }
 
+func (h *Handler) serveJSON(w http.ResponseWriter, mediaType string, obj any) {
+	h.serveJSONStatus(w, http.StatusOK, mediaType, obj)
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, obj any) {
+	h.serveJSON(w, mediaTypeActivity, obj)
+}
+
 func (h *Handler) serveActor(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -156,7 +186,14 @@ func (h *Handler) serveActor(
 		return
 	}
 
-	h.serveObject(w, h.pubFactory.NewActor(user))
+	publicKeyPEM, err := h.keys[user.ID].PublicKeyPEM()
+	if err != nil {
+		plog.Errorf("error encoding public key: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	h.serveObject(w, h.pubFactory.NewActor(user, publicKeyPEM))
 }
 
 func (h *Handler) serveProfileImage(
@@ -227,57 +264,107 @@ func (h *Handler) serveOutbox(
 		return
 	}
 
-	if len(before) > 0 {
-		// Query toots before the given timestamp
+	if len(before) > 0 || len(after) > 0 {
+		h.serveOutboxPage(w, r, user, before, after)
+		return
+	}
+
+	ctx := r.Context()
+
+	totalItems, err := h.dataService.TootCount(ctx, user.ID)
+	if err != nil {
+		plog.Errorf("error getting toot count: %v", err)
+		h.error500(w, err)
 		return
 	}
 
+	id := h.settings.Server.PublicBaseURL + user.OutboxPath()
+	first := fmt.Sprintf("%s?before=%d", id, maxEpoch)
+	last := fmt.Sprintf("%s?after=0", id)
+
+	orderedCollection := activitypub.NewOrderedCollection(
+		id,
+		totalItems,
+		first,
+		last,
+	)
+
+	h.serveObject(w, orderedCollection)
+}
+
+// serveOutboxPage serves a page of the outbox, sorted from newest
+// to oldest. The 'before' and 'after' cursors are Unix timestamps,
+// followed by the ID of a toot to tell apart toots of the same second.
+func (h *Handler) serveOutboxPage(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+	before string,
+	after string,
+) {
 	ctx := r.Context()
 
+	var toots []*data.Toot
 	if len(after) > 0 {
-		after, err := strconv.ParseInt(after, 10, 64)
+		cursor, err := data.ParseTootCursor(after)
 		if err != nil {
-			h.error400(w, "The query parameter 'after' must be a valid int64 value")
+			h.error400(w, "The query parameter 'after' must be a valid cursor")
 			return
 		}
 
-		_, err = h.dataService.Toots(ctx, user.ID, after, pageSize)
+		toots, err = h.dataService.Toots(ctx, user.ID, cursor, pageSize)
 		if err != nil {
 			plog.Errorf("error getting toots: %v", err)
 			h.error500(w, err)
 			return
 		}
+	} else {
+		cursor, err := data.ParseTootCursor(before)
+		if err != nil {
+			h.error400(w, "The query parameter 'before' must be a valid cursor")
+			return
+		}
+
+		toots, err = h.dataService.TootsBefore(ctx, user.ID, cursor, pageSize)
+		if err != nil {
+			plog.Errorf("error getting toots: %v", err)
+			h.error500(w, err)
+			return
+		}
+	}
 
-		// for _, toot := range toots {
-		// 	obj := activitypub.Object
-		// }
+	outboxID := h.settings.Server.PublicBaseURL + user.OutboxPath()
+	id := outboxID + "?" + r.URL.RawQuery
 
-		return
+	next, prev := "", ""
+	if len(toots) > 0 {
+		newest := data.TootCursorOf(toots[0])
+		oldest := data.TootCursorOf(toots[len(toots)-1])
+		next = fmt.Sprintf("%s?before=%s", outboxID, oldest)
+		prev = fmt.Sprintf("%s?after=%s", outboxID, newest)
 	}
 
-	totalItems, err := h.dataService.TootCount(ctx, user.ID)
+	interactions, err := h.interactions(ctx, user, toots)
 	if err != nil {
-		plog.Errorf("error getting toot count: %v", err)
+		plog.Errorf("error getting interactions: %v", err)
 		h.error500(w, err)
 		return
 	}
 
-	// Let's create a Y99k problem in memory of Jay-Z
-	y9999 := time.Date(99000, 12, 31, 23, 59, 59, 0, time.UTC)
-	maxEpoch := y9999.Unix()
-
-	id := h.settings.Server.PublicBaseURL + user.OutboxPath()
-	first := fmt.Sprintf("%s?after=0", id)
-	last := fmt.Sprintf("%s?before=%d", id, maxEpoch)
-
-	orderedCollection := activitypub.NewOrderedCollection(
-		id,
-		totalItems,
-		first,
-		last,
-	)
+	page := activitypub.NewOrderedCollectionPage(id, outboxID, next, prev)
+	for _, toot := range toots {
+		if toot.IsRepost() {
+			announce := h.pubFactory.NewAnnounce(user, toot)
+			announce.Context = ""
+			page.OrderedItems = append(page.OrderedItems, announce)
+			continue
+		}
+		create := h.pubFactory.NewCreate(user, toot)
+		h.pubFactory.AddInteractions(create.Object, user, toot, interactions[toot.ID])
+		page.OrderedItems = append(page.OrderedItems, create)
+	}
 
-	h.serveObject(w, orderedCollection)
+	h.serveObject(w, page)
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -287,6 +374,56 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Path == "/.well-known/host-meta" {
+		h.serveHostMeta(w, r)
+		return
+	}
+
+	if r.URL.Path == "/.well-known/nodeinfo" {
+		h.serveNodeInfoLinks(w, r)
+		return
+	}
+
+	if r.URL.Path == "/nodeinfo/2.0" {
+		h.serveNodeInfo(w, r, "2.0")
+		return
+	}
+
+	if r.URL.Path == "/nodeinfo/2.1" {
+		h.serveNodeInfo(w, r, "2.1")
+		return
+	}
+
+	if r.URL.Path == micropubPath {
+		h.serveMicropub(w, r)
+		return
+	}
+
+	if r.URL.Path == micropubMediaPath {
+		h.serveMicropubMedia(w, r)
+		return
+	}
+
+	if r.URL.Path == indieAuthMetadataPath {
+		h.serveIndieAuthMetadata(w, r)
+		return
+	}
+
+	if r.URL.Path == authorizationPath {
+		h.serveAuthorization(w, r)
+		return
+	}
+
+	if r.URL.Path == tokenPath {
+		h.serveToken(w, r)
+		return
+	}
+
+	if r.URL.Path == revocationPath {
+		h.serveRevocation(w, r)
+		return
+	}
+
 	for _, user := range h.settings.Users {
 
 		if r.URL.Path == user.IDPath() {
@@ -294,11 +431,43 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if r.URL.Path == user.ProfilePath() {
+			h.serveProfile(w, r, user)
+			return
+		}
+
+		if r.URL.Path == user.InboxPath() {
+			h.serveInbox(w, r, user)
+			return
+		}
+
 		if r.URL.Path == user.OutboxPath() {
 			h.serveOutbox(w, r, user)
 			return
 		}
 
+		if r.URL.Path == user.FollowersPath() {
+			h.serveFollowers(w, r, user)
+			return
+		}
+
+		if r.URL.Path == user.FollowingPath() {
+			h.serveFollowing(w, r, user)
+			return
+		}
+
+		statusPrefix := user.StatusPath("")
+		if strings.HasPrefix(r.URL.Path, statusPrefix) {
+			h.serveStatus(w, r, user, r.URL.Path[len(statusPrefix):])
+			return
+		}
+
+		mediaPrefix := user.MediaPath("")
+		if strings.HasPrefix(r.URL.Path, mediaPrefix) {
+			h.serveMedia(w, r, user, r.URL.Path[len(mediaPrefix):])
+			return
+		}
+
 		if r.URL.Path == user.ProfileImagePath() {
 			h.serveProfileImage(w, r, user)
 			return
@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/delivery"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+)
+
+const (
+	maxInboxBodyBytes = 1 << 20
+)
+
+func (h *Handler) serveInbox(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+) {
+	if r.Method != http.MethodPost {
+		h.error405(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInboxBodyBytes))
+	if err != nil {
+		h.error400(w, "Unable to read request body")
+		return
+	}
+
+	activity, err := activitypub.ParseActivity(body)
+	if err != nil {
+		h.error400(w, "Invalid activity")
+		return
+	}
+
+	ctx := r.Context()
+
+	signer, err := h.verifySignature(ctx, r, body, user)
+	if err != nil && isSelfDelete(activity) {
+		// The keys of deleted actors can't be fetched anymore. If it
+		// wasn't cached then there is nothing to clean up either.
+		plog.Debugf("Ignoring unverifiable Delete of %s: %v", activity.Actor, err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		plog.Warningf("Rejecting %s activity from %s: %v", activity.Type, activity.Actor, err)
+		h.error401(w, "Invalid HTTP signature")
+		return
+	}
+	if signer != activity.Actor {
+		plog.Warningf("Rejecting %s activity from %s signed by %s", activity.Type, activity.Actor, signer)
+		h.error401(w, "Activity was not signed by its actor")
+		return
+	}
+	plog.Debugf("Received %s activity from %s for %s", activity.Type, activity.Actor, user.Username)
+
+	if err = h.dispatchActivity(ctx, user, activity, body); err != nil {
+		plog.Errorf("error handling %s activity: %v", activity.Type, err)
+		h.error500(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// dispatchActivity handles a verified incoming activity.
+func (h *Handler) dispatchActivity(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+	body []byte,
+) error {
+	switch activity.Type {
+	case "Follow":
+		return h.handleFollow(ctx, user, activity, body)
+	case "Undo":
+		return h.handleUndo(ctx, user, activity)
+	case "Create":
+		return h.handleCreate(ctx, user, activity)
+	case "Like", "Announce":
+		return h.handleReaction(ctx, user, activity)
+	case "Delete":
+		return h.handleDelete(ctx, activity)
+	case "Update":
+		return h.handleUpdate(ctx, activity)
+	case "Move":
+		return h.handleMove(ctx, user, activity)
+	default:
+		plog.Debugf("Ignoring unsupported activity type: %s", activity.Type)
+	}
+
+	return nil
+}
+
+// isSelfDelete returns true if the activity announces
+// the deletion of the actor who sent it.
+func isSelfDelete(activity *activitypub.IncomingActivity) bool {
+	return activity.Type == "Delete" && activity.ObjectID() == activity.Actor
+}
+
+func (h *Handler) handleFollow(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+	body []byte,
+) error {
+	actorID := h.settings.Server.PublicBaseURL + user.IDPath()
+	if activity.ObjectID() != actorID {
+		plog.Warningf("Ignoring Follow for unknown object: %s", activity.ObjectID())
+		return nil
+	}
+
+	remoteActor, err := h.pubClient.FetchActor(ctx, h.keys[user.ID], activity.Actor)
+	if err != nil {
+		return err
+	}
+
+	err = h.dataService.SaveFollower(ctx, &data.Follower{
+		UserID:      user.ID,
+		ActorID:     remoteActor.ID,
+		Inbox:       remoteActor.Inbox,
+		SharedInbox: remoteActor.Endpoints.SharedInbox,
+		FollowID:    activity.ID,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	plog.Infof("%s is now following %s", remoteActor.ID, user.Username)
+
+	// Mastodon expects the Accept to arrive after the Follow
+	// request has been answered, so it goes through the delivery queue.
+	accept := h.pubFactory.NewAccept(user, body)
+	return delivery.Enqueue(ctx, h.dataService, user.ID, []string{remoteActor.Inbox}, accept)
+}
+
+func (h *Handler) handleUndo(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+) error {
+	undone, err := activity.EmbeddedActivity()
+	if err != nil {
+		plog.Debugf("Ignoring Undo without embedded activity: %v", err)
+		return nil
+	}
+
+	if undone.Actor != activity.Actor {
+		plog.Warningf("Ignoring Undo from %s for activity of %s", activity.Actor, undone.Actor)
+		return nil
+	}
+
+	switch undone.Type {
+	case "Follow":
+		if err := h.dataService.DeleteFollower(ctx, user.ID, activity.Actor); err != nil {
+			return err
+		}
+		plog.Infof("%s has stopped following %s", activity.Actor, user.Username)
+	case "Like", "Announce":
+		if err := h.dataService.DeleteReaction(ctx, undone.ID, activity.Actor); err != nil {
+			return err
+		}
+	default:
+		plog.Debugf("Ignoring Undo of unsupported activity type: %s", undone.Type)
+	}
+
+	return nil
+}
+
+func (h *Handler) handleDelete(
+	ctx context.Context,
+	activity *activitypub.IncomingActivity,
+) error {
+	if !isSelfDelete(activity) {
+		// Only the author's own replies can be deleted by them.
+		return h.dataService.DeleteReply(ctx, activity.ObjectID(), activity.Actor)
+	}
+
+	if err := h.dataService.DeleteActorFollows(ctx, activity.Actor); err != nil {
+		return err
+	}
+	if err := h.dataService.DeleteRemoteKeys(ctx, activity.Actor); err != nil {
+		return err
+	}
+	plog.Infof("%s has been deleted", activity.Actor)
+
+	return nil
+}
+
+func (h *Handler) handleUpdate(
+	ctx context.Context,
+	activity *activitypub.IncomingActivity,
+) error {
+	if activity.ObjectType() == "Note" {
+		note, err := activity.EmbeddedNote()
+		if err != nil || note.AttributedTo != activity.Actor {
+			plog.Debugf("Ignoring Update of invalid note from %s", activity.Actor)
+			return nil
+		}
+		return h.dataService.UpdateReplyContent(ctx, note.ID, activity.Actor, sanitize.Text(note.Content))
+	}
+
+	if !activitypub.IsActorType(activity.ObjectType()) {
+		plog.Debugf("Ignoring Update of unsupported object type: %s", activity.ObjectType())
+		return nil
+	}
+
+	actor, err := activity.EmbeddedActor()
+	if err != nil {
+		plog.Debugf("Ignoring Update with invalid actor: %v", err)
+		return nil
+	}
+
+	if actor.ID != activity.Actor {
+		plog.Warningf("Ignoring Update from %s for actor %s", activity.Actor, actor.ID)
+		return nil
+	}
+
+	if actor.Inbox != "" {
+		err = h.dataService.UpdateFollowerInboxes(ctx, actor.ID, actor.Inbox, actor.Endpoints.SharedInbox)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keys are only taken from their own origin, so that an actor
+	// can't replace the cached keys of another server.
+	if actor.PublicKey != nil && !activitypub.SameOrigin(actor.PublicKey.ID, actor.ID) {
+		plog.Warningf("Ignoring key %s in Update of %s", actor.PublicKey.ID, actor.ID)
+	} else if actor.PublicKey != nil && actor.PublicKey.Owner == actor.ID && actor.PublicKey.PublicKeyPEM != "" {
+		err = h.dataService.SaveRemoteKey(ctx, &data.RemoteKey{
+			KeyID:     actor.PublicKey.ID,
+			ActorID:   actor.ID,
+			PublicKey: actor.PublicKey.PublicKeyPEM,
+			FetchedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	plog.Debugf("%s has been updated", actor.ID)
+
+	return nil
+}
+
+func (h *Handler) handleMove(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+) error {
+	if activity.ObjectID() != activity.Actor {
+		plog.Warningf("Ignoring Move from %s for actor %s", activity.Actor, activity.ObjectID())
+		return nil
+	}
+
+	targetID := activity.TargetID()
+	if targetID == "" {
+		plog.Debug("Ignoring Move without target")
+		return nil
+	}
+
+	// The new account must confirm that it is an alias of the old one,
+	// otherwise anyone could steal followers by moving them elsewhere.
+	target, err := h.pubClient.FetchActor(ctx, h.keys[user.ID], targetID)
+	if err != nil {
+		return err
+	}
+
+	confirmed := false
+	for _, alias := range target.AlsoKnownAs {
+		if alias == activity.Actor {
+			confirmed = true
+			break
+		}
+	}
+	if !confirmed {
+		plog.Warningf("Ignoring Move of %s to %s which is not an alias", activity.Actor, target.ID)
+		return nil
+	}
+
+	err = h.dataService.MoveFollower(ctx, activity.Actor, target.ID, target.Inbox, target.Endpoints.SharedInbox)
+	if err != nil {
+		return err
+	}
+	plog.Infof("%s has moved to %s", activity.Actor, target.ID)
+
+	return nil
+}
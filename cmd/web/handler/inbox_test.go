@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/delivery"
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/uid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Recorded payloads use this host, which gets replaced
+// with the address of the test server.
+const recordedHost = "https://mastodon.example"
+
+// newRemoteServer serves the recorded actor documents
+// in testdata/mastodon as https://mastodon.example/users/{name}.
+func newRemoteServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/users/")
+		payload, err := os.ReadFile(filepath.Join("testdata", "mastodon", "actor_"+name+".json"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeActivity)
+		w.Write([]byte(strings.ReplaceAll(string(payload), recordedHost, server.URL)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestHandler(t *testing.T) (*Handler, *config.User) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dataService := data.NewService(db)
+	if err = dataService.InitTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, err := httpsig.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &config.User{ID: 1, Username: "bob", FullName: "Bob"}
+	settings := &config.Settings{
+		Server: &config.Server{Domain: "sabertoot.example", PublicBaseURL: "https://sabertoot.example"},
+		Users:  []*config.User{user},
+	}
+	pubFactory := activitypub.NewFactory(settings.Server.PublicBaseURL)
+	keys := map[uid.UserID]*httpsig.Key{
+		user.ID: {ID: pubFactory.KeyID(user), PrivateKey: privateKey},
+	}
+
+	return New(settings, dataService, pubFactory, activitypub.NewClient(), keys), user
+}
+
+func Test_DispatchActivity_Lifecycle(t *testing.T) {
+	remote := newRemoteServer(t)
+	alice := remote.URL + "/users/alice"
+
+	testCases := []struct {
+		Name              string
+		Payload           string
+		ExpectedFollowers []string
+		ExpectedInbox     string
+		ExpectedKey       string
+	}{
+		{
+			Name:              "Delete of follower's actor",
+			Payload:           "delete_actor.json",
+			ExpectedFollowers: []string{},
+		},
+		{
+			Name:              "Delete of a note",
+			Payload:           "delete_note.json",
+			ExpectedFollowers: []string{alice},
+			ExpectedInbox:     alice + "/inbox",
+			ExpectedKey:       "ORIGINAL",
+		},
+		{
+			Name:              "Update of follower's actor",
+			Payload:           "update_actor.json",
+			ExpectedFollowers: []string{alice},
+			ExpectedInbox:     remote.URL + "/new-shared-inbox",
+			ExpectedKey:       "UPDATED",
+		},
+		{
+			Name:              "Update of a note",
+			Payload:           "update_note.json",
+			ExpectedFollowers: []string{alice},
+			ExpectedInbox:     alice + "/inbox",
+			ExpectedKey:       "ORIGINAL",
+		},
+		{
+			Name:              "Move to an alias",
+			Payload:           "move.json",
+			ExpectedFollowers: []string{remote.URL + "/users/alice2"},
+			ExpectedInbox:     remote.URL + "/inbox",
+			ExpectedKey:       "ORIGINAL",
+		},
+		{
+			Name:              "Move to an account which is not an alias",
+			Payload:           "move_no_alias.json",
+			ExpectedFollowers: []string{alice},
+			ExpectedInbox:     alice + "/inbox",
+			ExpectedKey:       "ORIGINAL",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			h, user := newTestHandler(t)
+			ctx := context.Background()
+
+			err := h.dataService.SaveFollower(ctx, &data.Follower{
+				UserID:    user.ID,
+				ActorID:   alice,
+				Inbox:     alice + "/inbox",
+				FollowID:  alice + "#follows/1",
+				CreatedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = h.dataService.SaveRemoteKey(ctx, &data.RemoteKey{
+				KeyID:     alice + "#main-key",
+				ActorID:   alice,
+				PublicKey: "-----BEGIN PUBLIC KEY-----\nORIGINAL\n-----END PUBLIC KEY-----\n",
+				FetchedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload, err := os.ReadFile(filepath.Join("testdata", "mastodon", testCase.Payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := []byte(strings.ReplaceAll(string(payload), recordedHost, remote.URL))
+
+			activity, err := activitypub.ParseActivity(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = h.dispatchActivity(ctx, user, activity, body); err != nil {
+				t.Fatal(err)
+			}
+
+			followers, err := h.dataService.Followers(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(followers) != len(testCase.ExpectedFollowers) {
+				t.Fatalf("Expected %d followers, Actual %d", len(testCase.ExpectedFollowers), len(followers))
+			}
+			for i, follower := range followers {
+				if follower.ActorID != testCase.ExpectedFollowers[i] {
+					t.Errorf("Expected follower %s, Actual %s", testCase.ExpectedFollowers[i], follower.ActorID)
+				}
+				if inbox := delivery.Inboxes([]*data.Follower{follower})[0]; inbox != testCase.ExpectedInbox {
+					t.Errorf("Expected inbox %s, Actual %s", testCase.ExpectedInbox, inbox)
+				}
+			}
+
+			key, err := h.dataService.RemoteKey(ctx, alice+"#main-key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actualKey := ""
+			if key != nil {
+				actualKey = strings.Split(key.PublicKey, "\n")[1]
+			}
+			if actualKey != testCase.ExpectedKey {
+				t.Errorf("Expected key %q, Actual %q", testCase.ExpectedKey, actualKey)
+			}
+		})
+	}
+}
+
+func Test_DispatchActivity_UpdateWithForeignKey(t *testing.T) {
+	for _, testCase := range []struct {
+		Name    string
+		Payload string
+		KeyID   string
+		Owner   string
+	}{
+		{
+			Name:    "Key on another server",
+			Payload: "update_actor_foreign_key.json",
+			KeyID:   "https://victim.example/users/carol#main-key",
+			Owner:   "https://victim.example/users/carol",
+		},
+		{
+			Name:    "Uncached key on another server",
+			Payload: "update_actor_foreign_key.json",
+			KeyID:   "https://victim.example/users/carol#main-key",
+		},
+		{
+			Name:    "Key of another actor",
+			Payload: "update_actor_other_key.json",
+			KeyID:   recordedHost + "/users/carol#main-key",
+			Owner:   recordedHost + "/users/carol",
+		},
+	} {
+		t.Run(testCase.Name, func(t *testing.T) {
+			h, user := newTestHandler(t)
+			ctx := context.Background()
+
+			if testCase.Owner != "" {
+				err := h.dataService.SaveRemoteKey(ctx, &data.RemoteKey{
+					KeyID:     testCase.KeyID,
+					ActorID:   testCase.Owner,
+					PublicKey: "-----BEGIN PUBLIC KEY-----\nORIGINAL\n-----END PUBLIC KEY-----\n",
+					FetchedAt: time.Now().UTC(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			body, err := os.ReadFile(filepath.Join("testdata", "mastodon", testCase.Payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			activity, err := activitypub.ParseActivity(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = h.dispatchActivity(ctx, user, activity, body); err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := h.dataService.RemoteKey(ctx, testCase.KeyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.Owner == "" {
+				if key != nil {
+					t.Errorf("Expected no key to be cached, Actual %+v", key)
+				}
+			} else if key == nil || key.ActorID != testCase.Owner || !strings.Contains(key.PublicKey, "ORIGINAL") {
+				t.Errorf("Expected the cached key of %s to be kept, Actual %+v", testCase.Owner, key)
+			}
+		})
+	}
+}
+
+func Test_DispatchActivity_FollowAndUndo(t *testing.T) {
+	remote := newRemoteServer(t)
+	alice := remote.URL + "/users/alice2"
+
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+	bob := h.settings.Server.PublicBaseURL + user.IDPath()
+
+	dispatch := func(body string) {
+		activity, err := activitypub.ParseActivity([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = h.dispatchActivity(ctx, user, activity, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	follow := `{"id": "` + alice + `#follows/1", "type": "Follow", "actor": "` + alice + `", "object": "` + bob + `"}`
+
+	dispatch(follow)
+
+	followers, err := h.dataService.Followers(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followers) != 1 || followers[0].ActorID != alice || followers[0].FollowID != alice+"#follows/1" ||
+		followers[0].Inbox != alice+"/inbox" || followers[0].SharedInbox != remote.URL+"/inbox" {
+		t.Fatalf("Expected %s to follow, Actual %+v", alice, followers)
+	}
+
+	// The Follow is accepted in the personal inbox of the follower.
+	deliveries, err := h.dataService.DueDeliveries(ctx, time.Now().UTC().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Inbox != alice+"/inbox" {
+		t.Fatalf("Expected an Accept for %s, Actual %+v", alice, deliveries)
+	}
+	var accept struct {
+		Type   string
+		Actor  string
+		Object struct{ ID string }
+	}
+	if err = json.Unmarshal([]byte(deliveries[0].Activity), &accept); err != nil {
+		t.Fatal(err)
+	}
+	if accept.Type != "Accept" || accept.Actor != bob || accept.Object.ID != alice+"#follows/1" {
+		t.Errorf("Expected an Accept of the Follow, Actual %s", deliveries[0].Activity)
+	}
+
+	// Only the follower can undo its Follow.
+	mallory := remote.URL + "/users/mallory"
+	dispatch(`{"id": "` + mallory + `#undo", "type": "Undo", "actor": "` + mallory + `", "object": ` + follow + `}`)
+	if followers, err = h.dataService.Followers(ctx, user.ID); err != nil || len(followers) != 1 {
+		t.Fatalf("Expected the follower to be kept, Actual %+v %v", followers, err)
+	}
+
+	dispatch(`{"id": "` + alice + `#undo", "type": "Undo", "actor": "` + alice + `", "object": ` + follow + `}`)
+	if followers, err = h.dataService.Followers(ctx, user.ID); err != nil || len(followers) != 0 {
+		t.Errorf("Expected the follower to be removed, Actual %+v %v", followers, err)
+	}
+}
+
+func Test_DispatchActivity_FollowOfUnknownUser(t *testing.T) {
+	remote := newRemoteServer(t)
+	alice := remote.URL + "/users/alice2"
+
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+
+	body := []byte(`{"id": "` + alice + `#follows/1", "type": "Follow", "actor": "` + alice +
+		`", "object": "https://sabertoot.example/users/carol"}`)
+	activity, err := activitypub.ParseActivity(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.dispatchActivity(ctx, user, activity, body); err != nil {
+		t.Fatal(err)
+	}
+
+	followers, err := h.dataService.Followers(ctx, user.ID)
+	if err != nil || len(followers) != 0 {
+		t.Errorf("Expected no followers, Actual %+v %v", followers, err)
+	}
+	deliveries, err := h.dataService.DueDeliveries(ctx, time.Now().UTC().Add(time.Minute), 10)
+	if err != nil || len(deliveries) != 0 {
+		t.Errorf("Expected no Accept, Actual %+v %v", deliveries, err)
+	}
+
+	// The inboxes of unknown users don't exist at all.
+	req := httptest.NewRequest(http.MethodPost, "/users/carol/inbox", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, Actual %d", http.StatusNotFound, rec.Code)
+	}
+}
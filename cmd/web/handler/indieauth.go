@@ -0,0 +1,540 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/indieauth"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/token"
+)
+
+const (
+	indieAuthMetadataPath = "/.well-known/oauth-authorization-server"
+	authorizationPath     = "/indieauth/auth"
+	tokenPath             = "/indieauth/token"
+	revocationPath        = "/indieauth/revoke"
+
+	maxAuthFormBytes = 64 << 10
+)
+
+// Scopes which clients can ask for. Unknown scopes are dropped
+// from authorization requests.
+var supportedScopes = []string{
+	token.ScopeCreate,
+	token.ScopeUpdate,
+	token.ScopeDelete,
+	token.ScopeMedia,
+	token.ScopeProfile,
+}
+
+// authorizationRequest holds the parameters of an authorization
+// request, which are carried through the sign-in form.
+type authorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string
+	Me                  string
+}
+
+func parseAuthorizationRequest(values url.Values) *authorizationRequest {
+	return &authorizationRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Scope:               values.Get("scope"),
+		Me:                  values.Get("me"),
+	}
+}
+
+// validate checks the parameters which don't concern the client. Errors
+// are reported to the client by redirecting to it.
+func (req *authorizationRequest) validate() error {
+	if req.ResponseType != "code" {
+		return &indieauth.Error{Code: indieauth.ErrorUnsupportedResponseType, Description: "response_type has to be code"}
+	}
+	if req.State == "" {
+		return &indieauth.Error{Code: indieauth.ErrorInvalidRequest, Description: "state is missing"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != indieauth.MethodS256 {
+		return &indieauth.Error{Code: indieauth.ErrorInvalidRequest, Description: "a code_challenge with the S256 method is required"}
+	}
+	return nil
+}
+
+// scopes returns the requested scopes which are supported.
+func (req *authorizationRequest) scopes() []string {
+	scopes := []string{}
+	for _, s := range strings.Fields(req.Scope) {
+		for _, supported := range supportedScopes {
+			if s == supported {
+				scopes = append(scopes, s)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+type authorizePage struct {
+	page
+	Action      string
+	Request     *authorizationRequest
+	ClientHost  string
+	Scopes      []string
+	Username    string
+	KnownUser   bool
+	AskPassword bool
+	AskCode     bool
+	Error       string
+}
+
+func (h *Handler) serveIndieAuthMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	baseURL := h.settings.Server.PublicBaseURL
+	h.serveJSON(w, mediaTypeJSON, map[string]any{
+		"issuer":                 baseURL + "/",
+		"authorization_endpoint": baseURL + authorizationPath,
+		"token_endpoint":         baseURL + tokenPath,
+		"revocation_endpoint":    baseURL + revocationPath,
+		"revocation_endpoint_auth_methods_supported":     []string{"none"},
+		"scopes_supported":                               supportedScopes,
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{"authorization_code"},
+		"code_challenge_methods_supported":               []string{indieauth.MethodS256},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+// serveAuthorization is the authorization endpoint. GET requests show
+// the sign-in form, which is posted back to approve the request. Codes
+// of clients which only want to know who the user is are redeemed here
+// as well.
+func (h *Handler) serveAuthorization(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.serveAuthorizationForm(w, r)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxAuthFormBytes)
+		if err := r.ParseForm(); err != nil {
+			h.error400(w, "Invalid form")
+			return
+		}
+		if r.PostForm.Get("grant_type") != "" {
+			h.redeemProfileCode(w, r)
+			return
+		}
+		h.handleAuthorizationForm(w, r)
+	default:
+		h.error405(w, r)
+	}
+}
+
+func (h *Handler) serveAuthorizationForm(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizationRequest(r.URL.Query())
+	if err := indieauth.ValidateClient(req.ClientID, req.RedirectURI); err != nil {
+		h.error400(w, err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		h.redirectAuthorizationError(w, r, req, err)
+		return
+	}
+
+	user := h.userByProfileURL(req.Me)
+	username := ""
+	if user != nil {
+		username = user.Username
+	}
+	h.serveAuthorizePage(w, http.StatusOK, req, user, username, "")
+}
+
+func (h *Handler) handleAuthorizationForm(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizationRequest(r.PostForm)
+	if err := indieauth.ValidateClient(req.ClientID, req.RedirectURI); err != nil {
+		h.error400(w, err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		h.redirectAuthorizationError(w, r, req, err)
+		return
+	}
+	if r.PostForm.Get("deny") != "" {
+		h.redirectAuthorizationError(w, r, req, &indieauth.Error{Code: indieauth.ErrorAccessDenied, Description: "the user has denied the request"})
+		return
+	}
+
+	username := strings.TrimPrefix(strings.TrimSpace(r.PostForm.Get("username")), "@")
+	var user *config.User
+	for _, u := range h.settings.Users {
+		if u.Username == username {
+			user = u
+		}
+	}
+
+	now := time.Now()
+	if user == nil || !user.CanSignIn() {
+		h.serveAuthorizePage(w, http.StatusUnauthorized, req, nil, username, "The username or the credentials are wrong.")
+		return
+	}
+	if h.authGuard.Locked(user.ID, now) {
+		h.serveAuthorizePage(w, http.StatusTooManyRequests, req, user, username, "Too many failed attempts. Please try again later.")
+		return
+	}
+	if !h.checkCredentials(user, r.PostForm.Get("password"), r.PostForm.Get("code"), now) {
+		h.authGuard.Fail(user.ID, now)
+		h.serveAuthorizePage(w, http.StatusUnauthorized, req, nil, username, "The username or the credentials are wrong.")
+		return
+	}
+	h.authGuard.Succeed(user.ID)
+
+	// Users can grant fewer scopes than requested.
+	granted := []string{}
+	for _, s := range req.scopes() {
+		for _, g := range r.PostForm["grant"] {
+			if s == g {
+				granted = append(granted, s)
+				break
+			}
+		}
+	}
+
+	code, err := h.authCodes.Issue(&indieauth.Code{
+		UserID:        user.ID,
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(granted, " "),
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     now.Add(indieauth.CodeLifetime),
+	})
+	if err != nil {
+		plog.Errorf("error issuing authorization code: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	h.redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// checkCredentials verifies the password and the one-time code of a
+// user. Both are required if both have been set up.
+func (h *Handler) checkCredentials(user *config.User, password string, code string, now time.Time) bool {
+	if user.Credentials.PasswordHash != "" && !indieauth.CheckPassword(user.Credentials.PasswordHash, password) {
+		return false
+	}
+	if user.Credentials.TOTPSecret != "" {
+		step, ok := indieauth.CheckTOTP(user.Credentials.TOTPSecret, code, now)
+		if !ok || !h.authGuard.UseStep(user.ID, step) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) serveAuthorizePage(
+	w http.ResponseWriter,
+	statusCode int,
+	req *authorizationRequest,
+	user *config.User,
+	username string,
+	message string,
+) {
+	clientHost := req.ClientID
+	if u, err := url.Parse(req.ClientID); err == nil {
+		clientHost = u.Host
+	}
+
+	// Without a user, all credentials are asked for,
+	// so that the form doesn't reveal who has which.
+	askPassword, askCode := true, true
+	if user != nil && user.CanSignIn() {
+		askPassword = user.Credentials.PasswordHash != ""
+		askCode = user.Credentials.TOTPSecret != ""
+	}
+
+	// Clickjacking would let other sites approve requests.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	h.serveHTMLStatus(w, statusCode, "authorize", &authorizePage{
+		page:        page{Title: "Sign in to " + clientHost},
+		Action:      h.settings.Server.PublicBaseURL + authorizationPath,
+		Request:     req,
+		ClientHost:  clientHost,
+		Scopes:      req.scopes(),
+		Username:    username,
+		KnownUser:   user != nil,
+		AskPassword: askPassword,
+		AskCode:     askCode,
+		Error:       message,
+	})
+}
+
+// redirectToClient sends the user back to the client with the
+// given parameters, the state of the request and the issuer.
+func (h *Handler) redirectToClient(w http.ResponseWriter, r *http.Request, req *authorizationRequest, params url.Values) {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		h.error400(w, "Invalid redirect_uri")
+		return
+	}
+
+	query := redirect.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", h.settings.Server.PublicBaseURL+"/")
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (h *Handler) redirectAuthorizationError(w http.ResponseWriter, r *http.Request, req *authorizationRequest, err error) {
+	var authErr *indieauth.Error
+	if !errors.As(err, &authErr) {
+		authErr = &indieauth.Error{Code: indieauth.ErrorInvalidRequest, Description: err.Error()}
+	}
+	h.redirectToClient(w, r, req, url.Values{
+		"error":             {authErr.Code},
+		"error_description": {authErr.Description},
+	})
+}
+
+// redeemProfileCode returns the profile URL of the user who has approved
+// an authorization request. Codes redeemed this way grant no token.
+func (h *Handler) redeemProfileCode(w http.ResponseWriter, r *http.Request) {
+	user, code, err := h.redeemCode(r)
+	if err != nil {
+		h.indieAuthError(w, err)
+		return
+	}
+
+	h.serveTokenResponse(w, h.profileResponse(user, code.Scope))
+}
+
+// serveToken is the token endpoint, which exchanges authorization codes
+// for access tokens. Tokens can be verified and revoked here as well,
+// as older clients expect.
+func (h *Handler) serveToken(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.verifyToken(w, r)
+		return
+	case http.MethodPost:
+	default:
+		h.error405(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAuthFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.error400(w, "Invalid form")
+		return
+	}
+
+	if r.PostForm.Get("action") == "revoke" {
+		if err := h.revokeToken(r.Context(), r.PostForm.Get("token")); err != nil {
+			plog.Errorf("error revoking token: %v", err)
+			h.error500(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, code, err := h.redeemCode(r)
+	if err != nil {
+		h.indieAuthError(w, err)
+		return
+	}
+
+	// A profile scope alone doesn't need a token,
+	// but it's up to the client to know that.
+	if code.Scope == "" {
+		h.indieAuthError(w, &indieauth.Error{Code: indieauth.ErrorInvalidGrant, Description: "no scope has been granted, the code can only be redeemed at the authorization endpoint"})
+		return
+	}
+
+	t, secret, err := token.New(user.ID, code.ClientID, code.Scope)
+	if err != nil {
+		h.indieAuthError(w, err)
+		return
+	}
+	if err = h.dataService.SaveAccessToken(r.Context(), t); err != nil {
+		h.indieAuthError(w, err)
+		return
+	}
+
+	response := h.profileResponse(user, t.Scope)
+	response["access_token"] = secret
+	response["token_type"] = "Bearer"
+	response["scope"] = t.Scope
+	h.serveTokenResponse(w, response)
+}
+
+// redeemCode returns the user and the authorization code of a request
+// to one of the endpoints after checking the client and the PKCE verifier.
+func (h *Handler) redeemCode(r *http.Request) (*config.User, *indieauth.Code, error) {
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		return nil, nil, &indieauth.Error{Code: indieauth.ErrorUnsupportedGrantType, Description: "grant_type has to be authorization_code"}
+	}
+
+	code := h.authCodes.Redeem(r.PostForm.Get("code"))
+	if code == nil {
+		return nil, nil, &indieauth.Error{Code: indieauth.ErrorInvalidGrant, Description: "the code is invalid or has expired"}
+	}
+	if code.ClientID != r.PostForm.Get("client_id") || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		return nil, nil, &indieauth.Error{Code: indieauth.ErrorInvalidGrant, Description: "client_id or redirect_uri don't match the authorization request"}
+	}
+	if !indieauth.VerifyPKCE(code.CodeChallenge, indieauth.MethodS256, r.PostForm.Get("code_verifier")) {
+		return nil, nil, &indieauth.Error{Code: indieauth.ErrorInvalidGrant, Description: "the code_verifier doesn't match the code_challenge"}
+	}
+
+	for _, user := range h.settings.Users {
+		if user.ID == code.UserID {
+			return user, code, nil
+		}
+	}
+	return nil, nil, &indieauth.Error{Code: indieauth.ErrorInvalidGrant, Description: "the user of the code does not exist"}
+}
+
+// profileResponse returns who the user is and,
+// if the scope allows it, their public profile.
+func (h *Handler) profileResponse(user *config.User, scope string) map[string]any {
+	baseURL := h.settings.Server.PublicBaseURL
+	response := map[string]any{"me": baseURL + user.ProfilePath()}
+	for _, s := range strings.Fields(scope) {
+		if s == token.ScopeProfile {
+			response["profile"] = map[string]string{
+				"name":  user.FullName,
+				"url":   baseURL + user.ProfilePath(),
+				"photo": baseURL + user.ProfileImagePath(),
+			}
+		}
+	}
+	return response
+}
+
+func (h *Handler) serveTokenResponse(w http.ResponseWriter, response map[string]any) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	h.serveJSON(w, mediaTypeJSON, response)
+}
+
+// verifyToken returns the user, client and scope of the Bearer token.
+func (h *Handler) verifyToken(w http.ResponseWriter, r *http.Request) {
+	t, err := token.Verify(r.Context(), h.dataService, bearerToken(r))
+	if err != nil {
+		h.indieAuthError(w, err)
+		return
+	}
+
+	var user *config.User
+	for _, u := range h.settings.Users {
+		if t != nil && u.ID == t.UserID {
+			user = u
+		}
+	}
+	if user == nil {
+		h.indieAuthError(w, &indieauth.Error{Code: indieauth.ErrorInvalidToken, Description: "the access token is invalid or has been revoked"})
+		return
+	}
+
+	h.serveJSON(w, mediaTypeJSON, map[string]string{
+		"me":        h.settings.Server.PublicBaseURL + user.ProfilePath(),
+		"client_id": t.ClientID,
+		"scope":     t.Scope,
+	})
+}
+
+// serveRevocation is the revocation endpoint of RFC 7009. Unknown
+// tokens are no error, because the client wanted them gone anyway.
+func (h *Handler) serveRevocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.error405(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAuthFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.error400(w, "Invalid form")
+		return
+	}
+
+	if err := h.revokeToken(r.Context(), r.PostForm.Get("token")); err != nil {
+		plog.Errorf("error revoking token: %v", err)
+		h.error500(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) revokeToken(ctx context.Context, secret string) error {
+	if secret == "" {
+		return nil
+	}
+
+	t, err := h.dataService.AccessTokenByHash(ctx, token.Hash(secret))
+	if err != nil || t == nil {
+		return err
+	}
+	_, err = h.dataService.DeleteAccessToken(ctx, t.UserID, t.ID)
+	return err
+}
+
+// userByProfileURL returns the user whose profile or actor URL
+// has been entered into the client, if any.
+func (h *Handler) userByProfileURL(me string) *config.User {
+	me = strings.TrimSuffix(me, "/")
+	if me == "" {
+		return nil
+	}
+
+	baseURL := h.settings.Server.PublicBaseURL
+	for _, user := range h.settings.Users {
+		if me == baseURL+user.ProfilePath() || me == baseURL+user.IDPath() {
+			return user
+		}
+	}
+	return nil
+}
+
+func (h *Handler) indieAuthError(w http.ResponseWriter, err error) {
+	var authErr *indieauth.Error
+	if !errors.As(err, &authErr) {
+		plog.Errorf("error processing IndieAuth request: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if authErr.Code == indieauth.ErrorInvalidToken {
+		status = http.StatusUnauthorized
+	}
+
+	clearHeaders(w)
+	w.Header().Set("Cache-Control", "no-store")
+	h.serveJSONStatus(w, status, mediaTypeJSON, map[string]string{
+		"error":             authErr.Code,
+		"error_description": authErr.Description,
+	})
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/indieauth"
+)
+
+const (
+	testVerifier  = "sabertoot-pkce-verifier-0123456789-abcdefghijklmnop"
+	testChallenge = "Du0LUIO_GnKcNDgsWNQGcF4IcvcJALh-ZvfbClACxR4"
+)
+
+func newIndieAuthHandler(t *testing.T) (*Handler, *config.User) {
+	h, user := newTestHandler(t)
+
+	hash, err := indieauth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Credentials = &config.Credentials{PasswordHash: hash}
+	return h, user
+}
+
+func authorizationForm(password string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"https://app.example/"},
+		"redirect_uri":          {"https://app.example/callback"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge},
+		"code_challenge_method": {"S256"},
+		"scope":                 {"create profile email"},
+		"username":              {"bob"},
+		"password":              {password},
+		"grant":                 {"create", "profile", "email"},
+	}
+}
+
+func postForm(h *Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// authorize approves an authorization request and returns the code.
+func authorize(t *testing.T, h *Handler) string {
+	rec := postForm(h, authorizationPath, authorizationForm("correct horse"))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("unexpected status of authorization: %d %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || location.Host != "app.example" || location.Path != "/callback" {
+		t.Fatalf("unexpected redirect: %s", rec.Header().Get("Location"))
+	}
+	query := location.Query()
+	if query.Get("state") != "xyz" || query.Get("iss") != "https://sabertoot.example/" || query.Get("code") == "" {
+		t.Fatalf("unexpected redirect parameters: %s", location.RawQuery)
+	}
+	return query.Get("code")
+}
+
+func Test_IndieAuth_Discovery(t *testing.T) {
+	h, user := newIndieAuthHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, user.ProfilePath(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status of profile: %d", rec.Code)
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, `<https://sabertoot.example/.well-known/oauth-authorization-server>; rel="indieauth-metadata"`) ||
+		!strings.Contains(link, `<https://sabertoot.example/indieauth/auth>; rel="authorization_endpoint"`) {
+		t.Errorf("unexpected Link header: %s", link)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `<link rel="token_endpoint" href="https://sabertoot.example/indieauth/token">`) {
+		t.Errorf("expected a token endpoint link: %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, indieAuthMetadataPath, nil))
+	var metadata map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata["issuer"] != "https://sabertoot.example/" || metadata["token_endpoint"] != "https://sabertoot.example/indieauth/token" {
+		t.Errorf("unexpected metadata: %s", rec.Body.String())
+	}
+}
+
+func Test_IndieAuth_Lifecycle(t *testing.T) {
+	h, _ := newIndieAuthHandler(t)
+
+	query := authorizationForm("")
+	query.Set("me", "https://sabertoot.example/@bob")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, authorizationPath+"?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("unexpected response of authorization form: %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Signing in as @bob") || strings.Contains(body, `value="email"`) {
+		t.Errorf("unexpected authorization form: %s", body)
+	}
+
+	code := authorize(t, h)
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"https://app.example/"},
+		"redirect_uri":  {"https://app.example/callback"},
+		"code_verifier": {testVerifier},
+	}
+	rec = postForm(h, tokenPath, exchange)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("unexpected status of token request: %d %s", rec.Code, rec.Body.String())
+	}
+	var response struct {
+		AccessToken string            `json:"access_token"`
+		Scope       string            `json:"scope"`
+		Me          string            `json:"me"`
+		Profile     map[string]string `json:"profile"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.AccessToken == "" || response.Scope != "create profile" ||
+		response.Me != "https://sabertoot.example/@bob" || response.Profile["name"] != "Bob" {
+		t.Errorf("unexpected token response: %s", rec.Body.String())
+	}
+
+	// Codes can only be redeemed once.
+	if rec = postForm(h, tokenPath, exchange); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a redeemed code to be rejected, got %d", rec.Code)
+	}
+
+	// The token works with Micropub until it's revoked.
+	form := url.Values{"h": {"entry"}, "content": {"Hello"}}.Encode()
+	h.settings.Storage = &config.Storage{Path: t.TempDir()}
+	if rec = micropubRequest(h, response.AccessToken, "application/x-www-form-urlencoded", form); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status of Micropub request: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = postForm(h, revocationPath, url.Values{"token": {response.AccessToken}}); rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status of revocation: %d", rec.Code)
+	}
+	if rec = micropubRequest(h, response.AccessToken, "application/x-www-form-urlencoded", form); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked token to be rejected, got %d", rec.Code)
+	}
+}
+
+func Test_IndieAuth_ProfileCode(t *testing.T) {
+	h, _ := newIndieAuthHandler(t)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {authorize(t, h)},
+		"client_id":     {"https://app.example/"},
+		"redirect_uri":  {"https://app.example/callback"},
+		"code_verifier": {testVerifier + "x"},
+	}
+	if rec := postForm(h, authorizationPath, exchange); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a wrong verifier to be rejected, got %d", rec.Code)
+	}
+
+	exchange.Set("code", authorize(t, h))
+	exchange.Set("code_verifier", testVerifier)
+	rec := postForm(h, authorizationPath, exchange)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"me":"https://sabertoot.example/@bob"`) ||
+		strings.Contains(rec.Body.String(), "access_token") {
+		t.Errorf("unexpected profile response: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_IndieAuth_Errors(t *testing.T) {
+	h, user := newIndieAuthHandler(t)
+
+	// Redirects to other hosts are never made.
+	form := authorizationForm("correct horse")
+	form.Set("redirect_uri", "https://evil.example/callback")
+	if rec := postForm(h, authorizationPath, form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a foreign redirect_uri to be rejected, got %d", rec.Code)
+	}
+
+	// Requests without PKCE are sent back to the client.
+	form = authorizationForm("correct horse")
+	form.Del("code_challenge")
+	rec := postForm(h, authorizationPath, form)
+	if location := rec.Header().Get("Location"); rec.Code != http.StatusFound || !strings.Contains(location, "error=invalid_request") {
+		t.Errorf("unexpected response without PKCE: %d %s", rec.Code, location)
+	}
+
+	// Wrong passwords lock the user out for a while.
+	for i := 0; i < 5; i++ {
+		if rec = postForm(h, authorizationPath, authorizationForm("wrong")); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected a wrong password to be rejected, got %d", rec.Code)
+		}
+	}
+	if rec = postForm(h, authorizationPath, authorizationForm("correct horse")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the user to be locked out, got %d", rec.Code)
+	}
+
+	// Users without credentials can't sign in.
+	user.Credentials = nil
+	h.authGuard = indieauth.NewGuard()
+	if rec = postForm(h, authorizationPath, authorizationForm("")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a user without credentials to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// localToot returns the toot of a user which is identified by the given
+// ActivityPub ID, or nil if the ID doesn't belong to one of its toots.
+func (h *Handler) localToot(
+	ctx context.Context,
+	user *config.User,
+	objectID string,
+) (*data.Toot, error) {
+	prefix := h.settings.Server.PublicBaseURL + user.StatusPath("")
+	if !strings.HasPrefix(objectID, prefix) {
+		return nil, nil
+	}
+
+	tootID := strings.TrimSuffix(objectID[len(prefix):], "/activity")
+	if tootID == "" || strings.Contains(tootID, "/") {
+		return nil, nil
+	}
+
+	toot, err := h.dataService.Toot(ctx, uid.TootID(tootID))
+	if err != nil {
+		return nil, err
+	}
+	if toot == nil || toot.UserID != user.ID || toot.IsDeleted() {
+		return nil, nil
+	}
+
+	return toot, nil
+}
+
+func (h *Handler) handleCreate(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+) error {
+	if activity.ObjectType() != "Note" {
+		plog.Debugf("Ignoring Create of unsupported object type: %s", activity.ObjectType())
+		return nil
+	}
+
+	note, err := activity.EmbeddedNote()
+	if err != nil {
+		plog.Debugf("Ignoring Create with invalid note: %v", err)
+		return nil
+	}
+
+	if note.AttributedTo != activity.Actor {
+		plog.Warningf("Ignoring Create from %s for note of %s", activity.Actor, note.AttributedTo)
+		return nil
+	}
+
+	// Actors can only create notes on their own server, otherwise
+	// they could take over the IDs of other people's replies.
+	if !sameHost(note.ID, activity.Actor) {
+		plog.Warningf("Ignoring Create from %s for note %s on another host", activity.Actor, note.ID)
+		return nil
+	}
+
+	toot, err := h.localToot(ctx, user, note.InReplyTo)
+	if err != nil || toot == nil {
+		plog.Debugf("Ignoring Create of note which is not a reply to %s", user.Username)
+		return err
+	}
+
+	remoteActor, err := h.pubClient.FetchActor(ctx, h.keys[user.ID], activity.Actor)
+	if err != nil {
+		return err
+	}
+
+	handle := remoteActor.PreferredUsername
+	if actorURL, err := url.Parse(remoteActor.ID); err == nil {
+		handle = handle + "@" + actorURL.Host
+	}
+
+	name := remoteActor.Name
+	if name == "" {
+		name = remoteActor.PreferredUsername
+	}
+
+	published, err := time.Parse(time.RFC3339, note.Published)
+	if err != nil {
+		published = time.Now().UTC()
+	}
+
+	err = h.dataService.SaveReply(ctx, &data.Reply{
+		ID:          note.ID,
+		TootID:      toot.ID,
+		UserID:      user.ID,
+		ActorID:     remoteActor.ID,
+		ActorName:   name,
+		ActorHandle: handle,
+		ActorURL:    remoteActor.ProfileURL(),
+		Content:     sanitize.Text(note.Content),
+		URL:         note.HTMLURL(),
+		Published:   published,
+	})
+	if err != nil {
+		return err
+	}
+	plog.Infof("%s replied to %s", activity.Actor, toot.ID)
+
+	return nil
+}
+
+// handleReaction stores a Like or Announce of one of the user's toots.
+func (h *Handler) handleReaction(
+	ctx context.Context,
+	user *config.User,
+	activity *activitypub.IncomingActivity,
+) error {
+	toot, err := h.localToot(ctx, user, activity.ObjectID())
+	if err != nil || toot == nil {
+		plog.Debugf("Ignoring %s of unknown object: %s", activity.Type, activity.ObjectID())
+		return err
+	}
+
+	err = h.dataService.SaveReaction(ctx, &data.Reaction{
+		ID:        activity.ID,
+		TootID:    toot.ID,
+		UserID:    user.ID,
+		ActorID:   activity.Actor,
+		Type:      activity.Type,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	plog.Infof("%s sent %s for %s", activity.Actor, activity.Type, toot.ID)
+
+	return nil
+}
+
+// serveStatusCollection serves the replies, likes or shares of a toot.
+func (h *Handler) serveStatusCollection(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+	toot *data.Toot,
+	collection string,
+) {
+	ctx := r.Context()
+	baseURL := h.settings.Server.PublicBaseURL
+
+	var (
+		id    string
+		items []any
+	)
+
+	switch collection {
+	case "replies":
+		id = baseURL + user.StatusRepliesPath(toot.ID)
+		if user.ShowsReplies() {
+			replies, err := h.dataService.Replies(ctx, toot.ID, user.ShowsOnlyFollowerReplies())
+			if err != nil {
+				plog.Errorf("error getting replies: %v", err)
+				h.error500(w, err)
+				return
+			}
+			for _, reply := range replies {
+				items = append(items, reply.ID)
+			}
+		}
+	case "likes", "shares":
+		id = baseURL + user.StatusLikesPath(toot.ID)
+		reactionType := data.ReactionLike
+		if collection == "shares" {
+			id = baseURL + user.StatusSharesPath(toot.ID)
+			reactionType = data.ReactionAnnounce
+		}
+		actors, err := h.dataService.ReactionActors(ctx, toot.ID, reactionType)
+		if err != nil {
+			plog.Errorf("error getting reactions: %v", err)
+			h.error500(w, err)
+			return
+		}
+		for _, actor := range actors {
+			items = append(items, actor)
+		}
+	default:
+		h.error404Generic(w)
+		return
+	}
+
+	h.serveObject(w, activitypub.NewCollection(id, len(items), items))
+}
+
+// interactions returns the number of replies, likes and shares of the
+// given toots, taking the user's reply moderation into account.
+func (h *Handler) interactions(
+	ctx context.Context,
+	user *config.User,
+	toots []*data.Toot,
+) (map[uid.TootID]*data.Interactions, error) {
+	ids := []uid.TootID{}
+	for _, toot := range toots {
+		ids = append(ids, toot.ID)
+	}
+
+	interactions, err := h.dataService.Interactions(ctx, ids, user.ShowsOnlyFollowerReplies())
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.ShowsReplies() {
+		for _, i := range interactions {
+			i.Replies = 0
+		}
+	}
+
+	return interactions, nil
+}
+
+// sameHost returns true if both URLs are on the same host.
+func sameHost(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Host, ub.Host)
+}
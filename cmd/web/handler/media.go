@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/plog"
+)
+
+func (h *Handler) serveMedia(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+	fileName string,
+) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	if fileName == "" || strings.ContainsAny(fileName, `/\`) || strings.HasPrefix(fileName, ".") {
+		h.error404(w, "Media not found")
+		return
+	}
+
+	ctx := r.Context()
+
+	media, err := h.dataService.MediaByFileName(ctx, fileName)
+	if err != nil {
+		plog.Errorf("error retrieving media: %v", err)
+		h.error500(w, err)
+		return
+	}
+	if media == nil {
+		h.serveUpload(w, r, user, fileName)
+		return
+	}
+
+	// Media of deleted toots disappears together with the toot.
+	toot, err := h.dataService.Toot(ctx, media.TootID)
+	if err != nil {
+		plog.Errorf("error retrieving toot: %v", err)
+		h.error500(w, err)
+		return
+	}
+	if toot == nil || toot.UserID != user.ID || toot.IsDeleted() {
+		h.error404(w, "Media not found")
+		return
+	}
+
+	h.serveMediaFile(w, r, media.FileName, media.MIMEType)
+}
+
+// serveUpload serves an image which has been uploaded to the Micropub
+// media endpoint, so that clients can show it before it gets posted.
+func (h *Handler) serveUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+	fileName string,
+) {
+	upload, err := h.dataService.Upload(r.Context(), user.ID, fileName)
+	if err != nil {
+		plog.Errorf("error retrieving upload: %v", err)
+		h.error500(w, err)
+		return
+	}
+	if upload == nil {
+		h.error404(w, "Media not found")
+		return
+	}
+
+	h.serveMediaFile(w, r, upload.FileName, upload.MIMEType)
+}
+
+func (h *Handler) serveMediaFile(w http.ResponseWriter, r *http.Request, fileName string, mimeType string) {
+	file, err := os.Open(h.settings.Storage.MediaFullFilePath(fileName))
+	if err != nil {
+		plog.Errorf("Error opening media file: %v", err)
+		h.error404(w, "Media not found")
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		plog.Errorf("Error reading media file: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	// Media files never change, because edits of a toot keep its media.
+	// The stored type is served as it is, so browsers mustn't guess.
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, fileName, info.ModTime(), file)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func Test_ServeMedia(t *testing.T) {
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+
+	h.settings.Storage = &config.Storage{Path: t.TempDir()}
+	if err := os.MkdirAll(h.settings.Storage.MediaDirectory(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Toots of bob, one of which gets deleted, and of another user.
+	toots := map[string]*data.Toot{}
+	for i, name := range []string{"photo", "deleted", "other"} {
+		owner := user.ID
+		if name == "other" {
+			owner = 2
+		}
+		toot := &data.Toot{
+			ID:        uid.New(owner, uid.Twitter, uint64(i+1)),
+			UserID:    owner,
+			CreatedAt: time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC),
+			TextHTML:  "<p>Photo</p>",
+		}
+		fileName := toot.ID.String() + "-0.png"
+		toot.Media = []*data.Media{{Type: data.MediaPhoto, MIMEType: "image/png", FileName: fileName}}
+		if err := os.WriteFile(h.settings.Storage.MediaFullFilePath(fileName), []byte("\x89PNG image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.dataService.SaveToot(ctx, toot); err != nil {
+			t.Fatal(err)
+		}
+		toots[name] = toot
+	}
+	if err := h.dataService.DeleteToot(ctx, toots["deleted"].ID, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(fileName string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, user.MediaPath(fileName), nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	fileName := toots["photo"].Media[0].FileName
+
+	rec := get(fileName, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "\x89PNG image" {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("unexpected headers: %v", rec.Header())
+	}
+
+	if rec = get(fileName, http.Header{"Range": {"bytes=1-3"}}); rec.Code != http.StatusPartialContent || rec.Body.String() != "PNG" {
+		t.Errorf("unexpected response to range request: %d %q", rec.Code, rec.Body.String())
+	}
+
+	lastModified := rec.Header().Get("Last-Modified")
+	if rec = get(fileName, http.Header{"If-Modified-Since": {lastModified}}); rec.Code != http.StatusNotModified {
+		t.Errorf("unexpected response to conditional request: %d", rec.Code)
+	}
+
+	for _, name := range []string{
+		toots["deleted"].Media[0].FileName,
+		toots["other"].Media[0].FileName,
+		"missing.png",
+		"..",
+	} {
+		if rec = get(name, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("expected media %s not to be found, got %d", name, rec.Code)
+		}
+	}
+}
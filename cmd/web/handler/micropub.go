@@ -0,0 +1,594 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/delivery"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/micropub"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/token"
+	"github.com/sabertoot/server/internal/uid"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	micropubPath      = "/micropub"
+	micropubMediaPath = "/micropub/media"
+
+	// Requests with larger bodies are rejected.
+	maxMicropubBytes = 20 << 20
+	maxMemoryBytes   = 4 << 20
+)
+
+// photoClient downloads the photos which clients reference by URL.
+// It only connects to public addresses, so that posts can't be used
+// to probe the network of the server.
+var photoClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: publicAddressOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func publicAddressOnly(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("address %s is not public", host)
+	}
+	return nil
+}
+
+// Images which can be uploaded, by the extension of their files.
+var uploadTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// serveMicropub is the Micropub endpoint of all users. The access
+// token of a request decides which user a post belongs to.
+func (h *Handler) serveMicropub(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.serveMicropubQuery(w, r)
+	case http.MethodPost:
+		h.handleMicropubRequest(w, r)
+	default:
+		h.error405(w, r)
+	}
+}
+
+func (h *Handler) serveMicropubQuery(w http.ResponseWriter, r *http.Request) {
+	user, err := h.micropubUser(r, "")
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	switch query.Get("q") {
+	case "config":
+		h.serveJSON(w, mediaTypeJSON, map[string]any{
+			"media-endpoint": h.settings.Server.PublicBaseURL + micropubMediaPath,
+			"syndicate-to":   []any{},
+			"q":              []string{"config", "source", "syndicate-to"},
+		})
+	case "syndicate-to":
+		h.serveJSON(w, mediaTypeJSON, map[string]any{"syndicate-to": []any{}})
+	case "source":
+		toot, err := h.micropubToot(r.Context(), user, query.Get("url"))
+		if err != nil {
+			h.micropubError(w, err)
+			return
+		}
+		if toot.SourceType != uid.Local {
+			h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "only posts which have been written here have a source"})
+			return
+		}
+		properties, err := micropub.DecodeProperties(toot.SourceData)
+		if err != nil {
+			h.error500(w, err)
+			return
+		}
+		names := append(query["properties[]"], query["properties"]...)
+		h.serveJSON(w, mediaTypeJSON, properties.Select(names))
+	default:
+		h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "unknown query"})
+	}
+}
+
+func (h *Handler) handleMicropubRequest(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMicropubBytes)
+
+	var req *micropub.Request
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		req, err = micropub.ParseJSON(r.Body)
+	case "multipart/form-data":
+		if err = r.ParseMultipartForm(maxMemoryBytes); err == nil {
+			req, err = micropub.ParseForm(r.PostForm, r.MultipartForm.File)
+		}
+	default:
+		if err = r.ParseForm(); err == nil {
+			req, err = micropub.ParseForm(r.PostForm, nil)
+		}
+	}
+	if err != nil {
+		var mpErr *micropub.Error
+		if !errors.As(err, &mpErr) {
+			err = &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: err.Error()}
+		}
+		h.micropubError(w, err)
+		return
+	}
+
+	scope := token.ScopeCreate
+	switch req.Action {
+	case micropub.ActionUpdate:
+		scope = token.ScopeUpdate
+	case micropub.ActionDelete, micropub.ActionUndelete:
+		scope = token.ScopeDelete
+	}
+	user, err := h.micropubUser(r, scope)
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+
+	switch req.Action {
+	case micropub.ActionCreate:
+		h.createMicropubPost(w, r, user, req)
+	case micropub.ActionUpdate:
+		h.updateMicropubPost(w, r, user, req)
+	case micropub.ActionDelete:
+		h.deleteMicropubPost(w, r, user, req)
+	default:
+		h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "deleted posts can't be restored"})
+	}
+}
+
+// createMicropubPost publishes a new toot and sends it to the followers.
+func (h *Handler) createMicropubPost(w http.ResponseWriter, r *http.Request, user *config.User, req *micropub.Request) {
+	ctx := r.Context()
+
+	// Files which have been sent along are uploaded first and
+	// referenced like photos which have been uploaded before.
+	for _, file := range req.Files["photo"] {
+		photoURL, err := h.saveUpload(ctx, user, file)
+		if err != nil {
+			h.micropubError(w, err)
+			return
+		}
+		req.Properties["photo"] = append(req.Properties["photo"], photoURL)
+	}
+
+	sourceID, err := micropub.NewSourceID()
+	if err != nil {
+		h.error500(w, err)
+		return
+	}
+
+	toot, entry, err := micropub.Toot(user.ID, sourceID, req.Properties)
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+	toot.Language = user.Language
+
+	// Replies continue a thread of the user's own toots.
+	if entry.InReplyTo != "" {
+		if parent, err := h.micropubToot(ctx, user, entry.InReplyTo); err == nil && !parent.IsDeleted() {
+			toot.InReplyToID = parent.ID
+		}
+	}
+
+	toot.Media = h.micropubMedia(ctx, user, toot, entry.Photos)
+
+	if err = h.dataService.SaveToot(ctx, toot); err != nil {
+		plog.Errorf("error saving toot: %v", err)
+		h.error500(w, err)
+		return
+	}
+	plog.Infof("Toot created: %s", toot.ID)
+
+	activity := h.pubFactory.NewPublish(user, toot)
+	if err = delivery.EnqueueForFollowers(ctx, h.dataService, user.ID, activity); err != nil {
+		plog.Errorf("Error queueing toot for delivery: %s", err.Error())
+	}
+
+	w.Header().Set("Location", h.settings.Server.PublicBaseURL+user.StatusPath(toot.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// updateMicropubPost applies the changes to the properties of a toot
+// which has been written here and sends an Update to the followers.
+// Photos can't be changed, because edits keep the media of a toot.
+func (h *Handler) updateMicropubPost(w http.ResponseWriter, r *http.Request, user *config.User, req *micropub.Request) {
+	ctx := r.Context()
+
+	existing, err := h.micropubToot(ctx, user, req.URL)
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+	if existing.IsDeleted() || existing.SourceType != uid.Local {
+		h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "only posts which have been written here can be updated"})
+		return
+	}
+
+	properties, err := micropub.DecodeProperties(existing.SourceData)
+	if err != nil {
+		h.error500(w, err)
+		return
+	}
+
+	toot, _, err := micropub.Toot(user.ID, existing.SourceID, properties.Update(req))
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+	toot.CreatedAt = existing.CreatedAt
+	toot.Language = existing.Language
+	toot.Media = existing.Media
+	toot.InReplyToID = existing.InReplyToID
+	toot.UpdatedAt = time.Now().UTC()
+
+	if err = h.dataService.UpdateToot(ctx, toot); err != nil {
+		plog.Errorf("error updating toot: %v", err)
+		h.error500(w, err)
+		return
+	}
+	plog.Infof("Toot updated: %s", toot.ID)
+
+	update := h.pubFactory.NewUpdate(user, toot)
+	if err = delivery.EnqueueForFollowers(ctx, h.dataService, user.ID, update); err != nil {
+		plog.Errorf("Error queueing toot update for delivery: %s", err.Error())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteMicropubPost deletes any of the user's toots and sends a Delete
+// to the followers. Harvested toots aren't harvested again afterwards,
+// except for the files of a directory, which get published as a new
+// toot once they're edited.
+func (h *Handler) deleteMicropubPost(w http.ResponseWriter, r *http.Request, user *config.User, req *micropub.Request) {
+	ctx := r.Context()
+
+	toot, err := h.micropubToot(ctx, user, req.URL)
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+	if toot.IsDeleted() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	toot.DeletedAt = time.Now().UTC()
+	if err = h.dataService.DeleteToot(ctx, toot.ID, toot.DeletedAt); err != nil {
+		plog.Errorf("error deleting toot: %v", err)
+		h.error500(w, err)
+		return
+	}
+	plog.Infof("Toot deleted: %s", toot.ID)
+
+	del := h.pubFactory.NewWithdraw(user, toot)
+	if err = delivery.EnqueueForFollowers(ctx, h.dataService, user.ID, del); err != nil {
+		plog.Errorf("Error queueing toot deletion for delivery: %s", err.Error())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveMicropubMedia is the media endpoint, which stores an uploaded
+// image until it gets attached to a post. The access token has to be
+// sent in the Authorization header, so that uploads are only read
+// once the client has been authenticated.
+func (h *Handler) serveMicropubMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.error405(w, r)
+		return
+	}
+
+	user, err := h.micropubUser(r, token.ScopeMedia)
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMicropubBytes)
+	if err = r.ParseMultipartForm(maxMemoryBytes); err != nil {
+		h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "the file has to be sent as multipart/form-data"})
+		return
+	}
+
+	files := r.MultipartForm.File["file"]
+	if len(files) != 1 {
+		h.micropubError(w, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "exactly one file has to be sent"})
+		return
+	}
+
+	location, err := h.saveUpload(r.Context(), user, files[0])
+	if err != nil {
+		h.micropubError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// micropubUser returns the user whose access token has been sent with
+// the request. The token has to grant the given scope, if any. Tokens
+// which grant the "create" scope may also upload media.
+func (h *Handler) micropubUser(r *http.Request, scope string) (*config.User, error) {
+	t, err := token.Verify(r.Context(), h.dataService, bearerToken(r))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, &micropub.Error{Code: micropub.ErrorUnauthorized, Description: "a valid access token is required"}
+	}
+
+	var user *config.User
+	for _, u := range h.settings.Users {
+		if u.ID == t.UserID {
+			user = u
+		}
+	}
+	if user == nil {
+		return nil, &micropub.Error{Code: micropub.ErrorUnauthorized, Description: "the user of the access token does not exist"}
+	}
+
+	granted := scope == "" || t.HasScope(scope) ||
+		// "post" is the scope of older clients.
+		(scope == token.ScopeCreate && t.HasScope("post")) ||
+		(scope == token.ScopeMedia && (t.HasScope(token.ScopeCreate) || t.HasScope("post")))
+	if !granted {
+		return nil, &micropub.Error{Code: micropub.ErrorInsufficientScope, Description: "the access token does not grant the " + scope + " scope"}
+	}
+
+	return user, nil
+}
+
+// bearerToken returns the access token of a request, which is either
+// sent in the Authorization header or as a form parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, _ := strings.Cut(header, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+		return ""
+	}
+	if r.PostForm != nil {
+		return r.PostForm.Get("access_token")
+	}
+	return ""
+}
+
+// micropubToot returns the user's toot at the given URL.
+func (h *Handler) micropubToot(ctx context.Context, user *config.User, tootURL string) (*data.Toot, error) {
+	prefix := h.settings.Server.PublicBaseURL + user.StatusPath("")
+	if !strings.HasPrefix(tootURL, prefix) {
+		return nil, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "the url is not a post of the user"}
+	}
+	tootID, _, _ := strings.Cut(tootURL[len(prefix):], "/")
+
+	toot, err := h.dataService.Toot(ctx, uid.TootID(tootID))
+	if err != nil {
+		return nil, err
+	}
+	if toot == nil || toot.UserID != user.ID {
+		return nil, &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "the post does not exist"}
+	}
+	return toot, nil
+}
+
+// micropubMedia attaches the photos of a post. Uploads are copied and
+// other photos are downloaded. Photos which fail are skipped.
+func (h *Handler) micropubMedia(ctx context.Context, user *config.User, toot *data.Toot, photos []*micropub.Photo) []*data.Media {
+	result := []*data.Media{}
+	uploadPrefix := h.settings.Server.PublicBaseURL + user.MediaPath("")
+
+	for _, photo := range photos {
+		baseName := fmt.Sprintf("%s-%d", toot.ID, len(result))
+		var mimeType, fileName string
+
+		if strings.HasPrefix(photo.URL, uploadPrefix) {
+			upload, err := h.dataService.Upload(ctx, user.ID, photo.URL[len(uploadPrefix):])
+			if err != nil || upload == nil {
+				plog.Errorf("Error attaching media to toot %s: unknown upload %s", toot.ID, photo.URL)
+				continue
+			}
+			mimeType, fileName = upload.MIMEType, baseName+path.Ext(upload.FileName)
+			err = download.CopyFile(h.settings.Storage.MediaFullFilePath(upload.FileName), h.settings.Storage.MediaFullFilePath(fileName))
+			if err != nil {
+				plog.Errorf("Error attaching media to toot %s: %s", toot.ID, err.Error())
+				continue
+			}
+		} else {
+			var err error
+			mimeType, fileName, err = h.downloadPhoto(ctx, photo.URL, baseName)
+			if err != nil {
+				plog.Errorf("Error attaching media to toot %s: %s", toot.ID, err.Error())
+				continue
+			}
+		}
+
+		mediaType := data.MediaPhoto
+		if mimeType == "image/gif" {
+			mediaType = data.MediaGIF
+		}
+		result = append(result, &data.Media{
+			Type:      mediaType,
+			MIMEType:  mimeType,
+			FileName:  fileName,
+			AltText:   photo.Alt,
+			SourceURL: photo.URL,
+		})
+	}
+
+	return result
+}
+
+// downloadPhoto downloads a photo which a client has referenced by its
+// URL into the media directory and returns its type and file name. Like
+// uploads, only images of the upload types are accepted.
+func (h *Handler) downloadPhoto(ctx context.Context, photoURL string, baseName string) (string, string, error) {
+	u, err := url.Parse(photoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid photo URL: %s", photoURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, photoURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := photoClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("error downloading photo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("bad status code downloading photo %s: %d", photoURL, resp.StatusCode)
+	}
+
+	body := io.LimitReader(resp.Body, maxMicropubBytes+1)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", "", fmt.Errorf("photo %s is empty", photoURL)
+	}
+	mimeType := http.DetectContentType(head[:n])
+	ext, ok := uploadTypes[mimeType]
+	if !ok {
+		return "", "", fmt.Errorf("photo %s is not a JPEG, PNG, GIF or WebP image but %s", photoURL, mimeType)
+	}
+
+	fileName := baseName + ext
+	filePath := h.settings.Storage.MediaFullFilePath(fileName)
+	out, err := os.Create(filePath)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating file: %w", err)
+	}
+	written, err := io.Copy(out, io.MultiReader(bytes.NewReader(head[:n]), body))
+	out.Close()
+	if err == nil && written > maxMicropubBytes {
+		err = fmt.Errorf("photo %s is larger than %d bytes", photoURL, maxMicropubBytes)
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return "", "", err
+	}
+
+	return mimeType, fileName, nil
+}
+
+// saveUpload stores an uploaded image and returns its URL.
+func (h *Handler) saveUpload(ctx context.Context, user *config.User, header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("error opening upload: %w", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "the file is empty"}
+	}
+	mimeType := http.DetectContentType(head[:n])
+	ext, ok := uploadTypes[mimeType]
+	if !ok {
+		return "", &micropub.Error{Code: micropub.ErrorInvalidRequest, Description: "only JPEG, PNG, GIF and WebP images can be uploaded"}
+	}
+
+	random := make([]byte, 8)
+	if _, err = rand.Read(random); err != nil {
+		return "", fmt.Errorf("error generating file name: %w", err)
+	}
+	fileName := "upload-" + hex.EncodeToString(random) + ext
+
+	out, err := os.Create(h.settings.Storage.MediaFullFilePath(fileName))
+	if err != nil {
+		return "", fmt.Errorf("error creating file: %w", err)
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, io.MultiReader(bytes.NewReader(head[:n]), file)); err != nil {
+		return "", fmt.Errorf("error writing upload: %w", err)
+	}
+
+	upload := &data.Upload{
+		FileName:  fileName,
+		UserID:    user.ID,
+		MIMEType:  mimeType,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = h.dataService.SaveUpload(ctx, upload); err != nil {
+		return "", err
+	}
+	plog.Infof("Media uploaded by %s: %s", user.Username, fileName)
+
+	return h.settings.Server.PublicBaseURL + user.MediaPath(fileName), nil
+}
+
+// micropubError responds with an error of the Micropub specification.
+func (h *Handler) micropubError(w http.ResponseWriter, err error) {
+	var mpErr *micropub.Error
+	if !errors.As(err, &mpErr) {
+		plog.Errorf("error processing Micropub request: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch mpErr.Code {
+	case micropub.ErrorUnauthorized:
+		status = http.StatusUnauthorized
+	case micropub.ErrorForbidden, micropub.ErrorInsufficientScope:
+		status = http.StatusForbidden
+	}
+
+	clearHeaders(w)
+	h.serveJSONStatus(w, status, mediaTypeJSON, map[string]string{
+		"error":             mpErr.Code,
+		"error_description": mpErr.Description,
+	})
+}
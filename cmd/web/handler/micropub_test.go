@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/token"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// A minimal PNG, which is recognised by its signature.
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+func newMicropubHandler(t *testing.T, scope string) (*Handler, *config.User, string) {
+	h, user := newTestHandler(t)
+
+	h.settings.Storage = &config.Storage{Path: t.TempDir()}
+	if err := os.MkdirAll(h.settings.Storage.MediaDirectory(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, secret, err := token.New(user.ID, "https://app.example/", scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.dataService.SaveAccessToken(context.Background(), accessToken); err != nil {
+		t.Fatal(err)
+	}
+	return h, user, secret
+}
+
+func micropubRequest(h *Handler, secret string, contentType string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, micropubPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func micropubTootAt(t *testing.T, h *Handler, user *config.User, location string) *data.Toot {
+	prefix := h.settings.Server.PublicBaseURL + user.StatusPath("")
+	if !strings.HasPrefix(location, prefix) {
+		t.Fatalf("unexpected location: %s", location)
+	}
+	toot, err := h.dataService.Toot(context.Background(), uid.TootID(location[len(prefix):]))
+	if err != nil || toot == nil {
+		t.Fatalf("toot at %s not found: %v", location, err)
+	}
+	return toot
+}
+
+func Test_Micropub_Lifecycle(t *testing.T) {
+	h, user, secret := newMicropubHandler(t, token.DefaultScope)
+
+	// An image is uploaded to the media endpoint first.
+	var upload bytes.Buffer
+	writer := multipart.NewWriter(&upload)
+	part, _ := writer.CreateFormFile("file", "cat.png")
+	part.Write(pngImage)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, micropubMediaPath, &upload)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+secret)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status of upload: %d %s", rec.Code, rec.Body.String())
+	}
+	photoURL := rec.Header().Get("Location")
+
+	// Uploads can be fetched before they're posted.
+	path := strings.TrimPrefix(photoURL, h.settings.Server.PublicBaseURL)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("unexpected response for upload: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"type": []string{"h-entry"},
+		"properties": map[string]any{
+			"content":  []string{"Hello from **Sabertoot**"},
+			"category": []string{"IndieWeb"},
+			"photo":    []any{map[string]string{"value": photoURL, "alt": "A cat"}},
+		},
+	})
+	rec = micropubRequest(h, secret, "application/json", string(body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status of create: %d %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	toot := micropubTootAt(t, h, user, location)
+	if toot.SourceType != uid.Local || toot.SourceName != "local" ||
+		toot.TextHTML != "<p>Hello from <strong>Sabertoot</strong></p>" || toot.Tags[0].Name != "#indieweb" {
+		t.Errorf("unexpected toot: %+v", toot)
+	}
+	if len(toot.Media) != 1 || toot.Media[0].AltText != "A cat" || toot.Media[0].MIMEType != "image/png" || toot.Media[0].SourceURL != photoURL {
+		t.Errorf("unexpected media: %+v", toot.Media)
+	}
+
+	// A form-encoded reply continues the thread.
+	form := url.Values{"h": {"entry"}, "content": {"More"}, "in-reply-to": {location}}
+	rec = micropubRequest(h, secret, "application/x-www-form-urlencoded", form.Encode())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status of reply: %d %s", rec.Code, rec.Body.String())
+	}
+	if reply := micropubTootAt(t, h, user, rec.Header().Get("Location")); reply.InReplyToID != toot.ID {
+		t.Errorf("expected a reply to %s, got %q", toot.ID, reply.InReplyToID)
+	}
+
+	body, _ = json.Marshal(map[string]any{
+		"action":  "update",
+		"url":     location,
+		"replace": map[string]any{"content": []string{"Hello again"}},
+		"add":     map[string]any{"summary": []string{"Greetings"}},
+	})
+	rec = micropubRequest(h, secret, "application/json", string(body))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status of update: %d %s", rec.Code, rec.Body.String())
+	}
+	toot = micropubTootAt(t, h, user, location)
+	if toot.TextHTML != "<p>Hello again</p>" || toot.Summary != "Greetings" || !toot.IsUpdated() || len(toot.Media) != 1 {
+		t.Errorf("unexpected updated toot: %+v", toot)
+	}
+
+	// The source query returns the updated properties.
+	req = httptest.NewRequest(http.MethodGet, micropubPath+"?q=source&properties[]=content&url="+url.QueryEscape(location), nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != `{"properties":{"content":["Hello again"]}}` {
+		t.Errorf("unexpected source: %s", rec.Body.String())
+	}
+
+	form = url.Values{"action": {"delete"}, "url": {location}, "access_token": {secret}}
+	rec = micropubRequest(h, "", "application/x-www-form-urlencoded", form.Encode())
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status of delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if toot = micropubTootAt(t, h, user, location); !toot.IsDeleted() {
+		t.Error("expected the toot to be deleted")
+	}
+}
+
+func Test_Micropub_Errors(t *testing.T) {
+	h, _, secret := newMicropubHandler(t, "create")
+	form := url.Values{"h": {"entry"}, "content": {"Hello"}}.Encode()
+
+	testCases := []struct {
+		Name           string
+		Secret         string
+		Body           string
+		ExpectedStatus int
+		ExpectedError  string
+	}{
+		{"no token", "", form, http.StatusUnauthorized, "unauthorized"},
+		{"unknown token", "unknown", form, http.StatusUnauthorized, "unauthorized"},
+		{"missing scope", secret, "action=delete&url=https://sabertoot.example/users/bob/statuses/x", http.StatusForbidden, "insufficient_scope"},
+		{"no content", secret, "h=entry", http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := micropubRequest(h, tc.Secret, "application/x-www-form-urlencoded", tc.Body)
+			if rec.Code != tc.ExpectedStatus {
+				t.Errorf("expected status %d, got %d", tc.ExpectedStatus, rec.Code)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != tc.ExpectedError {
+				t.Errorf("unexpected body: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+// unreadBody fails a test if a handler reads the request body.
+type unreadBody struct {
+	t *testing.T
+}
+
+func (b *unreadBody) Read(p []byte) (int, error) {
+	b.t.Error("the body of an unauthenticated upload has been read")
+	return 0, io.EOF
+}
+
+func Test_Micropub_MediaLimits(t *testing.T) {
+	h, _, secret := newMicropubHandler(t, token.DefaultScope)
+
+	// Uploads without a valid token are rejected before they're read.
+	for _, authorization := range []string{"", "Bearer unknown"} {
+		req := httptest.NewRequest(http.MethodPost, micropubMediaPath, &unreadBody{t: t})
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d for %q, got %d", http.StatusUnauthorized, authorization, rec.Code)
+		}
+	}
+
+	// Uploads are only read up to the limit.
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
+	writer.CreateFormFile("file", "large.png")
+	body := io.MultiReader(&head, bytes.NewReader(pngImage), io.LimitReader(zeroReader{}, maxMicropubBytes))
+	req := httptest.NewRequest(http.MethodPost, micropubMediaPath, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+secret)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a large upload, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func Test_Micropub_RemotePhotos(t *testing.T) {
+	h, user, secret := newMicropubHandler(t, token.DefaultScope)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.jpg":
+			w.Write(pngImage)
+		case "/page.jpg":
+			w.Write([]byte("<html><body>Not an image</body></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer remote.Close()
+
+	// The test server is on a loopback address,
+	// which the default client refuses.
+	defaultClient := photoClient
+	photoClient = remote.Client()
+	defer func() { photoClient = defaultClient }()
+
+	form := url.Values{
+		"h":       {"entry"},
+		"content": {"Photos"},
+		"photo[]": {remote.URL + "/cat.jpg", remote.URL + "/page.jpg", "file:///etc/passwd"},
+	}
+	rec := micropubRequest(h, secret, "application/x-www-form-urlencoded", form.Encode())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status of create: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Only the actual image is attached, with the type of its content.
+	toot := micropubTootAt(t, h, user, rec.Header().Get("Location"))
+	if len(toot.Media) != 1 || toot.Media[0].MIMEType != "image/png" || !strings.HasSuffix(toot.Media[0].FileName, ".png") {
+		t.Errorf("unexpected media: %+v", toot.Media)
+	}
+
+	for _, address := range []string{"127.0.0.1:80", "10.0.0.1:443", "[::1]:80", "169.254.169.254:80"} {
+		if publicAddressOnly("tcp", address, nil) == nil {
+			t.Errorf("expected %s to be refused", address)
+		}
+	}
+	if err := publicAddressOnly("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("expected a public address to be allowed: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	mediaTypeXRD = "application/xrd+xml; charset=utf-8"
+
+	nodeInfoSchema20 = "http://nodeinfo.diaspora.software/ns/schema/2.0"
+	nodeInfoSchema21 = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+)
+
+type nodeInfoLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+type nodeInfoLinks struct {
+	Links []nodeInfoLink `json:"links"`
+}
+
+type nodeInfoSoftware struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+type nodeInfoUsers struct {
+	Total          int `json:"total"`
+	ActiveMonth    int `json:"activeMonth"`
+	ActiveHalfyear int `json:"activeHalfyear"`
+}
+
+type nodeInfoUsage struct {
+	Users      nodeInfoUsers `json:"users"`
+	LocalPosts int           `json:"localPosts"`
+}
+
+type nodeInfoServices struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+type nodeInfo struct {
+	Version           string           `json:"version"`
+	Software          nodeInfoSoftware `json:"software"`
+	Protocols         []string         `json:"protocols"`
+	Services          nodeInfoServices `json:"services"`
+	OpenRegistrations bool             `json:"openRegistrations"`
+	Usage             nodeInfoUsage    `json:"usage"`
+	Metadata          map[string]any   `json:"metadata"`
+}
+
+func (h *Handler) serveNodeInfoLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	baseURL := h.settings.Server.PublicBaseURL
+	h.serveJSON(w, mediaTypeJSON, &nodeInfoLinks{
+		Links: []nodeInfoLink{
+			{Rel: nodeInfoSchema20, Href: baseURL + "/nodeinfo/2.0"},
+			{Rel: nodeInfoSchema21, Href: baseURL + "/nodeinfo/2.1"},
+		},
+	})
+}
+
+func (h *Handler) serveNodeInfo(w http.ResponseWriter, r *http.Request, schemaVersion string) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	localPosts := 0
+	for _, user := range h.settings.Users {
+		count, err := h.dataService.TootCount(ctx, user.ID)
+		if err != nil {
+			plog.Errorf("error getting toot count: %v", err)
+			h.error500(w, err)
+			return
+		}
+		localPosts += count
+	}
+
+	now := time.Now().UTC()
+	activeMonth, err := h.dataService.ActiveUserCount(ctx, now.AddDate(0, -1, 0))
+	if err != nil {
+		plog.Errorf("error getting active user count: %v", err)
+		h.error500(w, err)
+		return
+	}
+	activeHalfyear, err := h.dataService.ActiveUserCount(ctx, now.AddDate(0, -6, 0))
+	if err != nil {
+		plog.Errorf("error getting active user count: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	software := nodeInfoSoftware{
+		Name:    version.Name,
+		Version: version.Version,
+	}
+	// Repository and homepage have only been added in 2.1,
+	// and the homepage is left out unless one has been set.
+	if schemaVersion == "2.1" {
+		software.Repository = version.Repository
+		software.Homepage = version.Homepage
+	}
+
+	h.serveJSON(w,
+		fmt.Sprintf(`application/json; profile="http://nodeinfo.diaspora.software/ns/schema/%s#"`, schemaVersion),
+		&nodeInfo{
+			Version:   schemaVersion,
+			Software:  software,
+			Protocols: []string{"activitypub"},
+			Services: nodeInfoServices{
+				Inbound:  []string{},
+				Outbound: []string{},
+			},
+			OpenRegistrations: false,
+			Usage: nodeInfoUsage{
+				Users: nodeInfoUsers{
+					Total:          len(h.settings.Users),
+					ActiveMonth:    activeMonth,
+					ActiveHalfyear: activeHalfyear,
+				},
+				LocalPosts: localPosts,
+			},
+			Metadata: map[string]any{},
+		})
+}
+
+func (h *Handler) serveHostMeta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeXRD)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(
+		fmt.Sprintf(
+			`<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" template="%s/.well-known/webfinger?resource={uri}"/>
+</XRD>
+`,
+			h.settings.Server.PublicBaseURL)))
+}
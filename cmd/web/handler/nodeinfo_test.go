@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+	"github.com/sabertoot/server/internal/version"
+)
+
+func Test_ServeNodeInfoLinks(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/nodeinfo", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != mediaTypeJSON {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	links := &nodeInfoLinks{}
+	if err := json.Unmarshal(rec.Body.Bytes(), links); err != nil {
+		t.Fatal(err)
+	}
+	expected := &nodeInfoLinks{Links: []nodeInfoLink{
+		{Rel: "http://nodeinfo.diaspora.software/ns/schema/2.0", Href: "https://sabertoot.example/nodeinfo/2.0"},
+		{Rel: "http://nodeinfo.diaspora.software/ns/schema/2.1", Href: "https://sabertoot.example/nodeinfo/2.1"},
+	}}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected %+v, Actual %+v", expected, links)
+	}
+}
+
+func Test_ServeNodeInfo(t *testing.T) {
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+
+	// A toot of this month and a deleted one, which isn't counted.
+	for i := uint64(1); i <= 2; i++ {
+		toot := &data.Toot{
+			ID:        uid.New(user.ID, uid.Twitter, i),
+			UserID:    user.ID,
+			CreatedAt: time.Now().UTC().Add(-time.Duration(i) * time.Hour),
+			TextHTML:  "<p>Hello</p>",
+		}
+		if err := h.dataService.SaveToot(ctx, toot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.dataService.DeleteToot(ctx, uid.New(user.ID, uid.Twitter, 2), time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name             string
+		Path             string
+		Homepage         string
+		ExpectedVersion  string
+		ExpectedSoftware nodeInfoSoftware
+	}{
+		{
+			Name:             "NodeInfo 2.0",
+			Path:             "/nodeinfo/2.0",
+			Homepage:         "https://sabertoot.example/about",
+			ExpectedVersion:  "2.0",
+			ExpectedSoftware: nodeInfoSoftware{Name: "sabertoot", Version: version.Version},
+		},
+		{
+			Name:            "NodeInfo 2.1",
+			Path:            "/nodeinfo/2.1",
+			ExpectedVersion: "2.1",
+			ExpectedSoftware: nodeInfoSoftware{
+				Name:       "sabertoot",
+				Version:    version.Version,
+				Repository: "https://github.com/sabertoot/server",
+			},
+		},
+		{
+			Name:            "NodeInfo 2.1 with a homepage",
+			Path:            "/nodeinfo/2.1",
+			Homepage:        "https://sabertoot.example/about",
+			ExpectedVersion: "2.1",
+			ExpectedSoftware: nodeInfoSoftware{
+				Name:       "sabertoot",
+				Version:    version.Version,
+				Repository: "https://github.com/sabertoot/server",
+				Homepage:   "https://sabertoot.example/about",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			homepage := version.Homepage
+			version.Homepage = testCase.Homepage
+			defer func() { version.Homepage = homepage }()
+
+			req := httptest.NewRequest(http.MethodGet, testCase.Path, nil)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, Actual %d", http.StatusOK, rec.Code)
+			}
+			contentType := `application/json; profile="http://nodeinfo.diaspora.software/ns/schema/` + testCase.ExpectedVersion + `#"`
+			if rec.Header().Get("Content-Type") != contentType {
+				t.Errorf("Expected content type %s, Actual %s", contentType, rec.Header().Get("Content-Type"))
+			}
+
+			info := &nodeInfo{}
+			if err := json.Unmarshal(rec.Body.Bytes(), info); err != nil {
+				t.Fatal(err)
+			}
+			if info.Version != testCase.ExpectedVersion || info.Software != testCase.ExpectedSoftware {
+				t.Errorf("Expected %s %+v, Actual %s %+v", testCase.ExpectedVersion, testCase.ExpectedSoftware, info.Version, info.Software)
+			}
+			if !reflect.DeepEqual(info.Protocols, []string{"activitypub"}) || info.OpenRegistrations {
+				t.Errorf("Unexpected protocols or registrations: %+v", info)
+			}
+			expectedUsage := nodeInfoUsage{Users: nodeInfoUsers{Total: 1, ActiveMonth: 1, ActiveHalfyear: 1}, LocalPosts: 1}
+			if info.Usage != expectedUsage {
+				t.Errorf("Expected usage %+v, Actual %+v", expectedUsage, info.Usage)
+			}
+		})
+	}
+}
+
+func Test_ServeHostMeta(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/host-meta", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != mediaTypeXRD {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	link := `<Link rel="lrdd" template="https://sabertoot.example/.well-known/webfinger?resource={uri}"/>`
+	if !strings.Contains(rec.Body.String(), link) {
+		t.Errorf("Expected the link to WebFinger, Actual %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/.well-known/host-meta", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, Actual %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+)
+
+type profilePage struct {
+	page
+	User      *config.User
+	Domain    string
+	URL       string
+	AvatarURL string
+	Toots     []*tootView
+}
+
+type tootView struct {
+	URL              string
+	Text             string
+	Published        string
+	PublishedDisplay string
+}
+
+// serveProfile serves the h-card of a user and their latest toots.
+// It links to the IndieAuth and Micropub endpoints, so that the
+// profile URL can be used to sign in to apps.
+func (h *Handler) serveProfile(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	if wantsActivity(r) {
+		h.serveActor(w, r, user)
+		return
+	}
+
+	toots, err := h.dataService.TootsBefore(r.Context(), user.ID, data.TootCursor{CreatedAt: maxEpoch}, pageSize)
+	if err != nil {
+		plog.Errorf("error getting toots: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	baseURL := h.settings.Server.PublicBaseURL
+	views := []*tootView{}
+	for _, toot := range toots {
+		if toot.IsRepost() {
+			continue
+		}
+		text := toot.Title
+		if text == "" {
+			text = truncate(toot.TextOriginal, 280)
+		}
+		views = append(views, &tootView{
+			URL:              baseURL + user.StatusPath(toot.ID),
+			Text:             text,
+			Published:        toot.CreatedAt.Format(time.RFC3339),
+			PublishedDisplay: toot.CreatedAt.Format(displayTimeFormat),
+		})
+	}
+
+	links := h.endpointLinks()
+	header := []string{}
+	for _, l := range links {
+		header = append(header, fmt.Sprintf(`<%s>; rel="%s"`, l.Href, l.Rel))
+	}
+	w.Header().Set("Link", strings.Join(header, ", "))
+
+	links = append(links, link{Rel: "alternate", Type: mediaTypeActivity, Href: baseURL + user.IDPath()})
+	h.serveHTML(w, "profile", &profilePage{
+		page: page{
+			Lang:  user.Language,
+			Title: user.FullName + " (@" + user.Username + "@" + h.settings.Server.Domain + ")",
+			Links: links,
+		},
+		User:      user,
+		Domain:    h.settings.Server.Domain,
+		URL:       baseURL + user.ProfilePath(),
+		AvatarURL: baseURL + user.ProfileImagePath(),
+		Toots:     views,
+	})
+}
+
+// endpointLinks returns the endpoints which IndieAuth
+// and Micropub clients discover on a profile page.
+func (h *Handler) endpointLinks() []link {
+	baseURL := h.settings.Server.PublicBaseURL
+	return []link{
+		{Rel: "indieauth-metadata", Href: baseURL + indieAuthMetadataPath},
+		{Rel: "authorization_endpoint", Href: baseURL + authorizationPath},
+		{Rel: "token_endpoint", Href: baseURL + tokenPath},
+		{Rel: "micropub", Href: baseURL + micropubPath},
+	}
+}
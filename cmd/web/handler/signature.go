@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/plog"
+)
+
+// verifySignature validates the HTTP signature of an incoming request
+// and returns the ID of the actor who owns the signing key.
+// Remote keys are cached and only refetched when the cached key
+// fails to verify the request, which happens when a key got rotated.
+func (h *Handler) verifySignature(
+	ctx context.Context,
+	r *http.Request,
+	body []byte,
+	user *config.User,
+) (string, error) {
+	sig, err := httpsig.ParseSignature(r)
+	if err != nil {
+		return "", err
+	}
+
+	remoteKey, err := h.dataService.RemoteKey(ctx, sig.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	if remoteKey != nil {
+		publicKey, err := httpsig.ParsePublicKey(remoteKey.PublicKey)
+		if err == nil && sig.Verify(r, body, publicKey) == nil {
+			return remoteKey.ActorID, nil
+		}
+		plog.Debugf("Cached key %s failed to verify request, refetching", sig.KeyID)
+	}
+
+	remoteKey, err = h.fetchRemoteKey(ctx, user, sig.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, err := httpsig.ParsePublicKey(remoteKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err = sig.Verify(r, body, publicKey); err != nil {
+		return "", err
+	}
+
+	return remoteKey.ActorID, nil
+}
+
+// fetchRemoteKey downloads a remote public key and stores it in the cache.
+// Only keys whose owner has confirmed them get this far.
+func (h *Handler) fetchRemoteKey(
+	ctx context.Context,
+	user *config.User,
+	keyID string,
+) (*data.RemoteKey, error) {
+	publicKey, err := h.pubClient.FetchPublicKey(ctx, h.keys[user.ID], keyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching remote key: %w", err)
+	}
+
+	remoteKey := &data.RemoteKey{
+		KeyID:     publicKey.ID,
+		ActorID:   publicKey.Owner,
+		PublicKey: publicKey.PublicKeyPEM,
+		FetchedAt: time.Now().UTC(),
+	}
+	if err = h.dataService.SaveRemoteKey(ctx, remoteKey); err != nil {
+		return nil, err
+	}
+
+	return remoteKey, nil
+}
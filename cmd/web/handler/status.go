@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const displayTimeFormat = "2 Jan 2006, 15:04 MST"
+
+type statusPage struct {
+	page
+	User             *config.User
+	Toot             *data.Toot
+	Domain           string
+	URL              string
+	ProfileURL       string
+	AvatarURL        string
+	Content          template.HTML
+	InReplyToURL     string
+	Published        string
+	PublishedDisplay string
+	Media            []*mediaView
+	Interactions     *data.Interactions
+	Replies          []*replyView
+}
+
+type mediaView struct {
+	*data.Media
+	URL string
+}
+
+type replyView struct {
+	*data.Reply
+	Paragraphs       []string
+	Published        string
+	PublishedDisplay string
+}
+
+// serveStatus serves a single toot. The path is the remainder of the
+// URL after the user's statuses path, which is either "{tootID}" or
+// "{tootID}/{activity|replies|likes|shares}".
+func (h *Handler) serveStatus(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *config.User,
+	path string,
+) {
+	if r.Method != http.MethodGet {
+		h.error405(w, r)
+		return
+	}
+
+	tootID, subPath, _ := strings.Cut(path, "/")
+	if tootID == "" {
+		h.error404Generic(w)
+		return
+	}
+
+	toot, err := h.dataService.Toot(r.Context(), uid.TootID(tootID))
+	if err != nil {
+		plog.Errorf("error getting toot: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	if toot == nil || toot.UserID != user.ID {
+		h.error404(w, "Toot does not exist or has been deleted")
+		return
+	}
+
+	if toot.IsDeleted() {
+		h.serveJSONStatus(w, http.StatusGone, mediaTypeActivity,
+			h.pubFactory.NewTombstone(user, toot).WithContext())
+		return
+	}
+
+	// Reposts only consist of the Announce activity.
+	if toot.IsRepost() && (subPath == "activity" || subPath == "" && wantsActivity(r)) {
+		h.serveObject(w, h.pubFactory.NewAnnounce(user, toot))
+		return
+	}
+
+	switch subPath {
+	case "":
+	case "activity":
+		h.serveObject(w, h.pubFactory.NewCreate(user, toot).WithContext())
+		return
+	case "replies", "likes", "shares":
+		h.serveStatusCollection(w, r, user, toot, subPath)
+		return
+	default:
+		h.error404Generic(w)
+		return
+	}
+
+	interactions, err := h.interactions(r.Context(), user, []*data.Toot{toot})
+	if err != nil {
+		plog.Errorf("error getting interactions: %v", err)
+		h.error500(w, err)
+		return
+	}
+
+	if wantsActivity(r) {
+		note := h.pubFactory.NewNote(user, toot).WithContext()
+		h.pubFactory.AddInteractions(note, user, toot, interactions[toot.ID])
+		h.serveObject(w, note)
+		return
+	}
+
+	replies := []*replyView{}
+	if user.ShowsReplies() {
+		stored, err := h.dataService.Replies(r.Context(), toot.ID, user.ShowsOnlyFollowerReplies())
+		if err != nil {
+			plog.Errorf("error getting replies: %v", err)
+			h.error500(w, err)
+			return
+		}
+		for _, reply := range stored {
+			replies = append(replies, &replyView{
+				Reply:            reply,
+				Paragraphs:       sanitize.Paragraphs(reply.Content),
+				Published:        reply.Published.Format(time.RFC3339),
+				PublishedDisplay: reply.Published.Format(displayTimeFormat),
+			})
+		}
+	}
+
+	language := toot.Language
+	if language == "" {
+		language = user.Language
+	}
+
+	baseURL := h.settings.Server.PublicBaseURL
+	media := []*mediaView{}
+	for _, m := range toot.Media {
+		media = append(media, &mediaView{Media: m, URL: baseURL + user.MediaPath(m.FileName)})
+	}
+
+	inReplyToURL := ""
+	if toot.InReplyToID != "" {
+		inReplyToURL = baseURL + user.StatusPath(toot.InReplyToID)
+	}
+
+	title := toot.Title
+	if title == "" {
+		title = truncate(toot.TextOriginal, 80)
+	}
+
+	url := baseURL + user.StatusPath(toot.ID)
+	h.serveHTML(w, "status", &statusPage{
+		page: page{
+			Lang:  language,
+			Title: user.FullName + ": " + title,
+			Links: []link{{Rel: "alternate", Type: mediaTypeActivity, Href: url}},
+		},
+		User:             user,
+		Toot:             toot,
+		Domain:           h.settings.Server.Domain,
+		URL:              url,
+		ProfileURL:       baseURL + user.ProfilePath(),
+		AvatarURL:        baseURL + user.ProfileImagePath(),
+		Content:          template.HTML(toot.TextHTML),
+		InReplyToURL:     inReplyToURL,
+		Published:        toot.CreatedAt.Format(time.RFC3339),
+		PublishedDisplay: toot.CreatedAt.Format(displayTimeFormat),
+		Media:            media,
+		Interactions:     interactions[toot.ID],
+		Replies:          replies,
+	})
+}
+
+func truncate(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func Test_ServeStatus(t *testing.T) {
+	h, user := newTestHandler(t)
+	ctx := context.Background()
+
+	// Toots of bob, one of which gets deleted, and of another user.
+	toots := map[string]*data.Toot{}
+	for i, name := range []string{"hello", "deleted", "other"} {
+		owner := user.ID
+		if name == "other" {
+			owner = 2
+		}
+		toot := &data.Toot{
+			ID:           uid.New(owner, uid.Twitter, uint64(i+1)),
+			UserID:       owner,
+			CreatedAt:    time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC),
+			TextOriginal: "Hello world",
+			TextHTML:     "<p>Hello <strong>world</strong></p>",
+		}
+		if err := h.dataService.SaveToot(ctx, toot); err != nil {
+			t.Fatal(err)
+		}
+		toots[name] = toot
+	}
+	if err := h.dataService.DeleteToot(ctx, toots["deleted"].ID, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(tootID uid.TootID, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, user.StatusPath(tootID), nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testCases := []struct {
+		Name           string
+		TootID         uid.TootID
+		Accept         string
+		ExpectedCode   int
+		ExpectedType   string
+		ExpectedJSON   string
+		ExpectedInHTML string
+	}{
+		{
+			Name:           "Browser",
+			TootID:         toots["hello"].ID,
+			Accept:         "text/html,application/xhtml+xml,*/*;q=0.8",
+			ExpectedCode:   http.StatusOK,
+			ExpectedType:   mediaTypeHTML + "; charset=utf-8",
+			ExpectedInHTML: "<p>Hello <strong>world</strong></p>",
+		},
+		{
+			Name:           "No Accept header",
+			TootID:         toots["hello"].ID,
+			ExpectedCode:   http.StatusOK,
+			ExpectedType:   mediaTypeHTML + "; charset=utf-8",
+			ExpectedInHTML: "<title>Bob: Hello world</title>",
+		},
+		{
+			Name:         "ActivityPub client",
+			TootID:       toots["hello"].ID,
+			Accept:       mediaTypeActivity,
+			ExpectedCode: http.StatusOK,
+			ExpectedType: mediaTypeActivity,
+			ExpectedJSON: "Note",
+		},
+		{
+			Name:         "JSON-LD client",
+			TootID:       toots["hello"].ID,
+			Accept:       `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`,
+			ExpectedCode: http.StatusOK,
+			ExpectedType: mediaTypeActivity,
+			ExpectedJSON: "Note",
+		},
+		{
+			Name:         "Deleted toot",
+			TootID:       toots["deleted"].ID,
+			Accept:       mediaTypeActivity,
+			ExpectedCode: http.StatusGone,
+			ExpectedType: mediaTypeActivity,
+			ExpectedJSON: "Tombstone",
+		},
+		{
+			Name:         "Deleted toot in a browser",
+			TootID:       toots["deleted"].ID,
+			ExpectedCode: http.StatusGone,
+		},
+		{
+			Name:         "Unknown toot",
+			TootID:       uid.New(user.ID, uid.Twitter, 99),
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:         "Toot of another user",
+			TootID:       toots["other"].ID,
+			Accept:       mediaTypeActivity,
+			ExpectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			rec := get(testCase.TootID, testCase.Accept)
+			if rec.Code != testCase.ExpectedCode {
+				t.Fatalf("Expected status %d, Actual %d", testCase.ExpectedCode, rec.Code)
+			}
+			if testCase.ExpectedType != "" && rec.Header().Get("Content-Type") != testCase.ExpectedType {
+				t.Errorf("Expected content type %s, Actual %s", testCase.ExpectedType, rec.Header().Get("Content-Type"))
+			}
+			if testCase.ExpectedInHTML != "" && !strings.Contains(rec.Body.String(), testCase.ExpectedInHTML) {
+				t.Errorf("Expected the page to contain %s, Actual %s", testCase.ExpectedInHTML, rec.Body.String())
+			}
+			if testCase.ExpectedJSON != "" {
+				var obj struct {
+					ID   string
+					Type string
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &obj); err != nil {
+					t.Fatal(err)
+				}
+				id := h.settings.Server.PublicBaseURL + user.StatusPath(testCase.TootID)
+				if obj.Type != testCase.ExpectedJSON || obj.ID != id {
+					t.Errorf("Expected %s %s, Actual %s %s", testCase.ExpectedJSON, id, obj.Type, obj.ID)
+				}
+			}
+		})
+	}
+}
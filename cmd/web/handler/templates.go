@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/sabertoot/server/internal/plog"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Every page gets parsed together with the shared layout.
+var templates = map[string]*template.Template{
+	"status":    parseTemplate("status"),
+	"profile":   parseTemplate("profile"),
+	"authorize": parseTemplate("authorize"),
+}
+
+func parseTemplate(name string) *template.Template {
+	return template.Must(template.ParseFS(
+		templateFiles,
+		"templates/layout.html",
+		"templates/"+name+".html"))
+}
+
+type link struct {
+	Rel  string
+	Type string
+	Href string
+}
+
+type page struct {
+	Lang  string
+	Title string
+	Links []link
+}
+
+func (h *Handler) serveHTML(w http.ResponseWriter, name string, data any) {
+	h.serveHTMLStatus(w, http.StatusOK, name, data)
+}
+
+func (h *Handler) serveHTMLStatus(w http.ResponseWriter, statusCode int, name string, data any) {
+	var buffer bytes.Buffer
+	if err := templates[name].ExecuteTemplate(&buffer, "layout", data); err != nil {
+		plog.Errorf("error rendering %s template: %v", name, err)
+		h.error500(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeHTML+"; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(buffer.Bytes())
+}
+
+// wantsActivity returns true if the client asked for an
+// ActivityPub representation instead of an HTML page.
+func wantsActivity(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, mediaTypeActivity) ||
+		strings.Contains(accept, "application/ld+json")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,7 +12,10 @@ import (
 	"github.com/sabertoot/server/internal/activitypub"
 	"github.com/sabertoot/server/internal/config"
 	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/delivery"
+	"github.com/sabertoot/server/internal/httpsig"
 	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/uid"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -49,9 +53,26 @@ func main() {
 		return
 	}
 
+	plog.Debug("Loading signing keys...")
+	keys, err := loadKeys(ctx, settings, dataService)
+	if err != nil {
+		plog.Fatal(err.Error())
+		return
+	}
+
+	plog.Debug("Starting delivery worker...")
+	pubClient := activitypub.NewClient()
+	deliveryWorker := delivery.NewWorker(
+		dataService,
+		pubClient,
+		keys,
+		settings.Delivery.Interval(),
+		settings.Delivery.MaxAge())
+	go deliveryWorker.Run(ctx)
+
 	plog.Debug("Initialising handler...")
 	pubFactory := activitypub.NewFactory(settings.Server.PublicBaseURL)
-	webHandler := handler.New(settings, dataService, pubFactory)
+	webHandler := handler.New(settings, dataService, pubFactory, pubClient, keys)
 
 	plog.Debug("Creating server...")
 	httpServer := &http.Server{
@@ -69,3 +90,58 @@ func main() {
 		panic(err)
 	}
 }
+
+// loadKeys returns the signing key of every configured user.
+// Keys get generated and stored on first start.
+func loadKeys(
+	ctx context.Context,
+	settings *config.Settings,
+	dataService *data.Service,
+) (map[uid.UserID]*httpsig.Key, error) {
+	pubFactory := activitypub.NewFactory(settings.Server.PublicBaseURL)
+	keys := make(map[uid.UserID]*httpsig.Key)
+
+	for _, user := range settings.Users {
+		userKey, err := dataService.UserKey(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if userKey == nil {
+			plog.Infof("Generating signing key for user %s", user.Username)
+			privateKey, err := httpsig.GenerateKey()
+			if err != nil {
+				return nil, err
+			}
+			privateKeyPEM, err := httpsig.EncodePrivateKey(privateKey)
+			if err != nil {
+				return nil, err
+			}
+			publicKeyPEM, err := httpsig.EncodePublicKey(&privateKey.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			userKey = &data.UserKey{
+				UserID:     user.ID,
+				PrivateKey: privateKeyPEM,
+				PublicKey:  publicKeyPEM,
+				CreatedAt:  time.Now().UTC(),
+			}
+			if err = dataService.SaveUserKey(ctx, userKey); err != nil {
+				return nil, err
+			}
+		}
+
+		privateKey, err := httpsig.ParsePrivateKey(userKey.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading key of user %s: %w", user.Username, err)
+		}
+
+		keys[user.ID] = &httpsig.Key{
+			ID:         pubFactory.KeyID(user),
+			PrivateKey: privateKey,
+		}
+	}
+
+	return keys, nil
+}
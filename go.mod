@@ -2,4 +2,4 @@ module github.com/sabertoot/server
 
 go 1.19
 
-require github.com/mattn/go-sqlite3 v1.14.16 // indirect
+require github.com/mattn/go-sqlite3 v1.14.16
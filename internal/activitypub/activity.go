@@ -0,0 +1,244 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+)
+
+// Activity is an outgoing ActivityPub activity.
+type Activity struct {
+	Context   string   `json:"@context,omitempty"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Published string   `json:"published,omitempty"`
+	To        []string `json:"to,omitempty"`
+	CC        []string `json:"cc,omitempty"`
+	Object    any      `json:"object"`
+}
+
+// IncomingActivity is an ActivityPub activity received from a remote server.
+// The object is kept as raw JSON, because it can either be a plain ID or an
+// embedded object.
+type IncomingActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+	Target json.RawMessage `json:"target,omitempty"`
+}
+
+// ParseActivity deserialises an incoming activity.
+func ParseActivity(data []byte) (*IncomingActivity, error) {
+	var activity IncomingActivity
+	if err := json.Unmarshal(data, &activity); err != nil {
+		return nil, fmt.Errorf("error deserialising activity: %w", err)
+	}
+	if activity.Type == "" || activity.Actor == "" {
+		return nil, fmt.Errorf("activity is missing type or actor")
+	}
+	return &activity, nil
+}
+
+// rawID returns the ID of a property which can either
+// be a plain ID or an embedded object.
+func rawID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		return obj.ID
+	}
+	return ""
+}
+
+// ObjectID returns the ID of the activity's object, regardless of
+// whether the object was sent as a plain ID or as an embedded object.
+func (a *IncomingActivity) ObjectID() string {
+	return rawID(a.Object)
+}
+
+// TargetID returns the ID of the activity's target.
+func (a *IncomingActivity) TargetID() string {
+	return rawID(a.Target)
+}
+
+// ObjectType returns the type of an embedded object
+// or an empty string if the object is a plain ID.
+func (a *IncomingActivity) ObjectType() string {
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(a.Object, &obj); err == nil {
+		return obj.Type
+	}
+	return ""
+}
+
+// EmbeddedActor returns the activity's object as an actor.
+// This is used to read the new state of an actor from an Update.
+func (a *IncomingActivity) EmbeddedActor() (*RemoteActor, error) {
+	var actor RemoteActor
+	if err := json.Unmarshal(a.Object, &actor); err != nil {
+		return nil, fmt.Errorf("error deserialising actor: %w", err)
+	}
+	if actor.ID == "" {
+		return nil, fmt.Errorf("embedded actor has no id")
+	}
+	return &actor, nil
+}
+
+// IncomingNote is the subset of a remote Note which is
+// required to display it as a reply.
+type IncomingNote struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	AttributedTo string `json:"attributedTo"`
+	InReplyTo    string `json:"inReplyTo"`
+	Content      string `json:"content"`
+	URL          any    `json:"url"`
+	Published    string `json:"published"`
+}
+
+// EmbeddedNote returns the activity's object as a Note.
+func (a *IncomingActivity) EmbeddedNote() (*IncomingNote, error) {
+	var note IncomingNote
+	if err := json.Unmarshal(a.Object, &note); err != nil {
+		return nil, fmt.Errorf("error deserialising note: %w", err)
+	}
+	if note.ID == "" {
+		return nil, fmt.Errorf("embedded note has no id")
+	}
+	return &note, nil
+}
+
+// HTMLURL returns the URL of the Note's HTML representation.
+// The url property can be a string, a Link or a list of either.
+func (n *IncomingNote) HTMLURL() string {
+	switch url := n.URL.(type) {
+	case string:
+		return url
+	case map[string]any:
+		href, _ := url["href"].(string)
+		return href
+	case []any:
+		for _, elem := range url {
+			if href := (&IncomingNote{URL: elem}).HTMLURL(); href != "" {
+				return href
+			}
+		}
+	}
+	return n.ID
+}
+
+// IsActorType returns true if the given type is one
+// of the ActivityStreams actor types.
+func IsActorType(objectType string) bool {
+	switch objectType {
+	case "Person", "Service", "Application", "Group", "Organization":
+		return true
+	}
+	return false
+}
+
+// EmbeddedActivity returns the activity's object as an activity.
+// This is used to unwrap activities such as Undo{Follow}.
+func (a *IncomingActivity) EmbeddedActivity() (*IncomingActivity, error) {
+	return ParseActivity(a.Object)
+}
+
+// NewAccept creates an Accept activity in response to the given
+// (raw) activity, e.g. a Follow request.
+func (f *Factory) NewAccept(user *config.User, activity json.RawMessage) *Activity {
+	actorID := f.publicBaseURL + user.IDPath()
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#accepts/%d", actorID, time.Now().UnixNano()),
+		Type:    "Accept",
+		Actor:   actorID,
+		Object:  activity,
+	}
+}
+
+// NewUpdate announces the new version of an edited toot.
+func (f *Factory) NewUpdate(user *config.User, toot *data.Toot) *Activity {
+	return &Activity{
+		Context: activityStreamsContext,
+		ID: fmt.Sprintf("%s#updates/%d",
+			f.publicBaseURL+user.StatusPath(toot.ID),
+			toot.UpdatedAt.Unix()),
+		Type:   "Update",
+		Actor:  f.publicBaseURL + user.IDPath(),
+		To:     []string{PublicCollection},
+		CC:     []string{f.publicBaseURL + user.FollowersPath()},
+		Object: f.NewNote(user, toot),
+	}
+}
+
+// NewDelete announces the deletion of a toot.
+func (f *Factory) NewDelete(user *config.User, toot *data.Toot) *Activity {
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      f.publicBaseURL + user.StatusPath(toot.ID) + "#delete",
+		Type:    "Delete",
+		Actor:   f.publicBaseURL + user.IDPath(),
+		To:      []string{PublicCollection},
+		CC:      []string{f.publicBaseURL + user.FollowersPath()},
+		Object:  f.NewTombstone(user, toot),
+	}
+}
+
+// NewAnnounce shares a post from elsewhere, e.g. a retweet, by its URL.
+func (f *Factory) NewAnnounce(user *config.User, toot *data.Toot) *Activity {
+	return &Activity{
+		Context:   activityStreamsContext,
+		ID:        f.publicBaseURL + user.StatusActivityPath(toot.ID),
+		Type:      "Announce",
+		Actor:     f.publicBaseURL + user.IDPath(),
+		Published: toot.CreatedAt.UTC().Format(time.RFC3339),
+		To:        []string{PublicCollection},
+		CC:        []string{f.publicBaseURL + user.FollowersPath()},
+		Object:    toot.SharedURL,
+	}
+}
+
+// NewUndoAnnounce withdraws the Announce of a deleted repost.
+func (f *Factory) NewUndoAnnounce(user *config.User, toot *data.Toot) *Activity {
+	announce := f.NewAnnounce(user, toot)
+	announce.Context = ""
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      announce.ID + "#undo",
+		Type:    "Undo",
+		Actor:   announce.Actor,
+		To:      announce.To,
+		CC:      announce.CC,
+		Object:  announce,
+	}
+}
+
+// NewPublish returns the activity which publishes a toot:
+// an Announce for reposts and a Create for everything else.
+func (f *Factory) NewPublish(user *config.User, toot *data.Toot) any {
+	if toot.IsRepost() {
+		return f.NewAnnounce(user, toot)
+	}
+	return f.NewCreate(user, toot).WithContext()
+}
+
+// NewWithdraw returns the activity which retracts a deleted toot:
+// an Undo for reposts and a Delete for everything else.
+func (f *Factory) NewWithdraw(user *config.User, toot *data.Toot) *Activity {
+	if toot.IsRepost() {
+		return f.NewUndoAnnounce(user, toot)
+	}
+	return f.NewDelete(user, toot)
+}
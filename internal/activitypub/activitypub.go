@@ -4,11 +4,15 @@ import (
 	"time"
 
 	"github.com/sabertoot/server/internal/config"
-	"github.com/sabertoot/server/internal/uid"
+	"github.com/sabertoot/server/internal/data"
 )
 
 const (
 	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+
+	// Special collection which addresses everyone.
+	PublicCollection = "https://www.w3.org/ns/activitystreams#Public"
 )
 
 type Factory struct {
@@ -21,31 +25,43 @@ func NewFactory(publicBaseURL string) *Factory {
 	}
 }
 
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPEM string `json:"publicKeyPem"`
+}
+
 type Actor struct {
-	Context           string `json:"@context"`
-	Type              string `json:"type"`
-	ID                string `json:"id"`
-	PreferredUsername string `json:"preferredUsername"`
-	Name              string `json:"name"`
-	Summary           string `json:"summary"`
-	Icon              string `json:"icon"`
-	Inbox             string `json:"inbox"`
-	Outbox            string `json:"outbox"`
-	Followers         string `json:"followers"`
-	Following         string `json:"following"`
-	Liked             string `json:"liked"`
-	URL               string `json:"url"`
+	Context           []string   `json:"@context"`
+	Type              string     `json:"type"`
+	ID                string     `json:"id"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name"`
+	Summary           string     `json:"summary"`
+	Icon              string     `json:"icon"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox"`
+	Followers         string     `json:"followers"`
+	Following         string     `json:"following"`
+	Liked             string     `json:"liked"`
+	URL               string     `json:"url"`
+	PublicKey         *PublicKey `json:"publicKey"`
+}
+
+// KeyID returns the ID of the public key of a user.
+func (f *Factory) KeyID(user *config.User) string {
+	return f.publicBaseURL + user.IDPath() + "#main-key"
 }
 
 func (f *Factory) NewActor(
-	user *config.User) *Actor {
-	profileImageURL :=
-		f.publicBaseURL +
-			h.settings.Storage.ProfileImageRelativeURLPath(user.UserID())
+	user *config.User,
+	publicKeyPEM string) *Actor {
+	actorID := f.publicBaseURL + user.IDPath()
+	profileImageURL := f.publicBaseURL + user.ProfileImagePath()
 	return &Actor{
-		Context:           activityStreamsContext,
+		Context:           []string{activityStreamsContext, securityContext},
 		Type:              "Person",
-		ID:                f.publicBaseURL + user.IDPath(),
+		ID:                actorID,
 		PreferredUsername: user.Username,
 		Name:              user.FullName,
 		Summary:           user.Summary,
@@ -56,6 +72,11 @@ func (f *Factory) NewActor(
 		Following:         f.publicBaseURL + user.FollowingPath(),
 		Liked:             f.publicBaseURL + user.LikedPath(),
 		URL:               f.publicBaseURL + user.ProfilePath(),
+		PublicKey: &PublicKey{
+			ID:           f.KeyID(user),
+			Owner:        actorID,
+			PublicKeyPEM: publicKeyPEM,
+		},
 	}
 }
 
@@ -64,8 +85,8 @@ type OrderedCollection struct {
 	Type       string `json:"type"`
 	ID         string `json:"id"`
 	TotalItems int    `json:"totalItems"`
-	First      string `json:"first"`
-	Last       string `json:"last"`
+	First      string `json:"first,omitempty"`
+	Last       string `json:"last,omitempty"`
 }
 
 func NewOrderedCollection(
@@ -84,31 +105,225 @@ func NewOrderedCollection(
 }
 
 type Object struct {
-	ID           string   `json:"id"`
-	Type         string   `json:"type"`
-	Summary      string   `json:"summary,omitempty"`
-	InReplyTo    string   `json:"inReplyTo,omitempty"`
-	Published    string   `json:"published"`
-	URL          string   `json:"url"`
-	AttributedTo string   `json:"attributedTo"`
-	To           []string `json:"to"`
-	CC           []string `json:"cc"`
-}
-
-func NewNote(
-	tootID uid.TootID,
+	Context      string            `json:"@context,omitempty"`
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	Name         string            `json:"name,omitempty"`
+	Summary      string            `json:"summary,omitempty"`
+	InReplyTo    string            `json:"inReplyTo,omitempty"`
+	Published    string            `json:"published,omitempty"`
+	Updated      string            `json:"updated,omitempty"`
+	Deleted      string            `json:"deleted,omitempty"`
+	FormerType   string            `json:"formerType,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	AttributedTo string            `json:"attributedTo,omitempty"`
+	To           []string          `json:"to,omitempty"`
+	CC           []string          `json:"cc,omitempty"`
+	Sensitive    bool              `json:"sensitive"`
+	Content      string            `json:"content"`
+	ContentMap   map[string]string `json:"contentMap,omitempty"`
+	Tag          []*Tag            `json:"tag,omitempty"`
+	Attachment   []*Attachment     `json:"attachment,omitempty"`
+	QuoteURL     string            `json:"quoteUrl,omitempty"`
+	MisskeyQuote string            `json:"_misskey_quote,omitempty"`
+	Replies      *Collection       `json:"replies,omitempty"`
+	Likes        *Collection       `json:"likes,omitempty"`
+	Shares       *Collection       `json:"shares,omitempty"`
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+// Attachment is an image which is attached to a Note.
+type Attachment struct {
+	Type      string `json:"type"`
+	MediaType string `json:"mediaType"`
+	URL       string `json:"url"`
+	Name      string `json:"name,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+type Collection struct {
+	Context    string `json:"@context,omitempty"`
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	TotalItems int    `json:"totalItems"`
+	Items      []any  `json:"items,omitempty"`
+}
+
+func NewCollection(id string, totalItems int, items []any) *Collection {
+	return &Collection{
+		Context:    activityStreamsContext,
+		ID:         id,
+		Type:       "Collection",
+		TotalItems: totalItems,
+		Items:      items,
+	}
+}
+
+// AddInteractions adds the replies, likes and shares collections to a Note.
+func (f *Factory) AddInteractions(
+	note *Object,
+	user *config.User,
+	toot *data.Toot,
+	interactions *data.Interactions,
+) {
+	note.Replies = &Collection{
+		ID:         f.publicBaseURL + user.StatusRepliesPath(toot.ID),
+		Type:       "Collection",
+		TotalItems: interactions.Replies,
+	}
+	note.Likes = &Collection{
+		ID:         f.publicBaseURL + user.StatusLikesPath(toot.ID),
+		Type:       "Collection",
+		TotalItems: interactions.Likes,
+	}
+	note.Shares = &Collection{
+		ID:         f.publicBaseURL + user.StatusSharesPath(toot.ID),
+		Type:       "Collection",
+		TotalItems: interactions.Shares,
+	}
+}
+
+// NewNote turns a toot into a public Note which is addressed
+// to everyone and copied to the user's followers. Articles
+// become an Article with their title as name instead.
+func (f *Factory) NewNote(
+	user *config.User,
+	toot *data.Toot,
+) *Object {
+	id := f.publicBaseURL + user.StatusPath(toot.ID)
+
+	language := toot.Language
+	if language == "" {
+		language = user.Language
+	}
+
+	var contentMap map[string]string
+	if language != "" {
+		contentMap = map[string]string{language: toot.TextHTML}
+	}
+
+	tags := []*Tag{}
+	cc := []string{f.publicBaseURL + user.FollowersPath()}
+	for _, tag := range toot.Tags {
+		tags = append(tags, &Tag{Type: tag.Type, Href: tag.Href, Name: tag.Name})
+		// Mentioned accounts get notified by copying them in.
+		if tag.Type == data.TagMention {
+			cc = append(cc, tag.Href)
+		}
+	}
+
+	attachments := []*Attachment{}
+	for _, media := range toot.Media {
+		// Previews of GIFs and videos are plain documents, because
+		// they are not the actual media which has been posted.
+		attachmentType := "Image"
+		if media.IsPreview() {
+			attachmentType = "Document"
+		}
+		attachments = append(attachments, &Attachment{
+			Type:      attachmentType,
+			MediaType: media.MIMEType,
+			URL:       f.publicBaseURL + user.MediaPath(media.FileName),
+			Name:      media.AltText,
+			Width:     media.Width,
+			Height:    media.Height,
+		})
+	}
+
+	// Threads link to the previous toot, so that
+	// they are displayed just like they were written.
+	inReplyTo := ""
+	if toot.InReplyToID != "" {
+		inReplyTo = f.publicBaseURL + user.StatusPath(toot.InReplyToID)
+	}
+
+	// Quotes are understood by Misskey and
+	// its forks as well as by Pleroma and Akkoma.
+	quoteURL := ""
+	if toot.Kind == data.KindQuote {
+		quoteURL = toot.SharedURL
+	}
+
+	updated := ""
+	if toot.IsUpdated() {
+		updated = toot.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return &Object{
+		ID:           id,
+		Type:         objectType(toot),
+		Name:         toot.Title,
+		Summary:      toot.Summary,
+		InReplyTo:    inReplyTo,
+		Published:    toot.CreatedAt.UTC().Format(time.RFC3339),
+		Updated:      updated,
+		URL:          id,
+		AttributedTo: f.publicBaseURL + user.IDPath(),
+		To:           []string{PublicCollection},
+		CC:           cc,
+		Sensitive:    toot.Sensitive || toot.Summary != "",
+		Content:      toot.TextHTML,
+		ContentMap:   contentMap,
+		Tag:          tags,
+		Attachment:   attachments,
+		QuoteURL:     quoteURL,
+		MisskeyQuote: quoteURL,
+	}
+}
+
+// NewTombstone replaces the Note of a deleted toot.
+func (f *Factory) NewTombstone(
 	user *config.User,
-	published time.Time,
+	toot *data.Toot,
 ) *Object {
 	return &Object{
-		Type:      "Note",
-		Summary:   "",
-		InReplyTo: "",
-		Published: published.Format(time.RFC3339),
+		ID:         f.publicBaseURL + user.StatusPath(toot.ID),
+		Type:       "Tombstone",
+		FormerType: objectType(toot),
+		Deleted:    toot.DeletedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// objectType returns the type of object which a toot is published as.
+func objectType(toot *data.Toot) string {
+	if toot.IsArticle() {
+		return "Article"
+	}
+	return "Note"
+}
+
+// WithContext adds the JSON-LD context, which is required
+// when the object is served as a standalone document.
+func (o *Object) WithContext() *Object {
+	o.Context = activityStreamsContext
+	return o
+}
+
+// NewCreate wraps a toot's Note in a Create activity.
+func (f *Factory) NewCreate(
+	user *config.User,
+	toot *data.Toot,
+) *OrderedItem {
+	note := f.NewNote(user, toot)
+	return &OrderedItem{
+		ID:        f.publicBaseURL + user.StatusActivityPath(toot.ID),
+		Type:      "Create",
+		Actor:     f.publicBaseURL + user.IDPath(),
+		Published: note.Published,
+		To:        []string{PublicCollection},
+		CC:        []string{f.publicBaseURL + user.FollowersPath()},
+		Object:    note,
 	}
 }
 
 type OrderedItem struct {
+	Context   string   `json:"@context,omitempty"`
 	ID        string   `json:"id"`
 	Type      string   `json:"type"`
 	Actor     string   `json:"actor"`
@@ -118,14 +333,21 @@ type OrderedItem struct {
 	Object    *Object  `json:"object"`
 }
 
+// WithContext adds the JSON-LD context, which is required
+// when the activity is served as a standalone document.
+func (i *OrderedItem) WithContext() *OrderedItem {
+	i.Context = activityStreamsContext
+	return i
+}
+
 type OrderedCollectionPage struct {
-	Context      string         `json:"@context"`
-	Type         string         `json:"type"`
-	ID           string         `json:"id"`
-	Next         string         `json:"next"`
-	Prev         string         `json:"prev"`
-	PartOf       string         `json:"partOf"`
-	OrderedItems []*OrderedItem `json:"orderedItems"`
+	Context      string `json:"@context"`
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	Next         string `json:"next,omitempty"`
+	Prev         string `json:"prev,omitempty"`
+	PartOf       string `json:"partOf"`
+	OrderedItems []any  `json:"orderedItems"`
 }
 
 func NewOrderedCollectionPage(
@@ -140,6 +362,6 @@ func NewOrderedCollectionPage(
 		Next:         next,
 		Prev:         prev,
 		PartOf:       partOf,
-		OrderedItems: []*OrderedItem{},
+		OrderedItems: []any{},
 	}
 }
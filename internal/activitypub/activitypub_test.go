@@ -0,0 +1,118 @@
+package activitypub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func Test_NewNote_Addressing(t *testing.T) {
+	f := NewFactory("https://sabertoot.example")
+	user := &config.User{ID: 1, Username: "bob"}
+	followers := "https://sabertoot.example/users/bob/followers"
+	alice := "https://mastodon.example/users/alice"
+
+	testCases := []struct {
+		Name              string
+		Toot              *data.Toot
+		ExpectedCC        []string
+		ExpectedSensitive bool
+		ExpectedInReplyTo string
+	}{
+		{
+			Name:       "Public toot",
+			Toot:       &data.Toot{ID: uid.New(1, uid.Twitter, 1)},
+			ExpectedCC: []string{followers},
+		},
+		{
+			Name:              "Toot with a content warning",
+			Toot:              &data.Toot{ID: uid.New(1, uid.Twitter, 2), Summary: "Spoiler"},
+			ExpectedCC:        []string{followers},
+			ExpectedSensitive: true,
+		},
+		{
+			Name:              "Reply in a thread",
+			Toot:              &data.Toot{ID: uid.New(1, uid.Twitter, 3), InReplyToID: uid.New(1, uid.Twitter, 1)},
+			ExpectedCC:        []string{followers},
+			ExpectedInReplyTo: "https://sabertoot.example/users/bob/statuses/" + uid.New(1, uid.Twitter, 1).String(),
+		},
+		{
+			Name: "Toot mentioning an account",
+			Toot: &data.Toot{
+				ID:   uid.New(1, uid.Twitter, 4),
+				Tags: []*data.Tag{{Type: data.TagMention, Name: "@alice@mastodon.example", Href: alice}},
+			},
+			ExpectedCC: []string{followers, alice},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			testCase.Toot.CreatedAt = time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)
+			note := f.NewNote(user, testCase.Toot)
+
+			id := "https://sabertoot.example" + user.StatusPath(testCase.Toot.ID)
+			if note.ID != id || note.URL != id || note.AttributedTo != "https://sabertoot.example/users/bob" {
+				t.Errorf("Unexpected note %s by %s at %s", note.ID, note.AttributedTo, note.URL)
+			}
+			if !reflect.DeepEqual(note.To, []string{PublicCollection}) {
+				t.Errorf("Expected to %v, Actual %v", []string{PublicCollection}, note.To)
+			}
+			if !reflect.DeepEqual(note.CC, testCase.ExpectedCC) {
+				t.Errorf("Expected cc %v, Actual %v", testCase.ExpectedCC, note.CC)
+			}
+			if note.Summary != testCase.Toot.Summary || note.Sensitive != testCase.ExpectedSensitive {
+				t.Errorf("Expected summary %q and sensitive %t, Actual %q %t",
+					testCase.Toot.Summary, testCase.ExpectedSensitive, note.Summary, note.Sensitive)
+			}
+			if note.InReplyTo != testCase.ExpectedInReplyTo {
+				t.Errorf("Expected inReplyTo %q, Actual %q", testCase.ExpectedInReplyTo, note.InReplyTo)
+			}
+		})
+	}
+}
+
+func Test_NewNote_ContentMap(t *testing.T) {
+	f := NewFactory("https://sabertoot.example")
+
+	testCases := []struct {
+		Name         string
+		UserLanguage string
+		TootLanguage string
+		Expected     map[string]string
+	}{
+		{
+			Name:         "Language of the toot",
+			UserLanguage: "en",
+			TootLanguage: "de",
+			Expected:     map[string]string{"de": "<p>Hallo</p>"},
+		},
+		{
+			Name:         "Language of the user",
+			UserLanguage: "en",
+			Expected:     map[string]string{"en": "<p>Hallo</p>"},
+		},
+		{
+			Name: "No language",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			user := &config.User{ID: 1, Username: "bob", Language: testCase.UserLanguage}
+			toot := &data.Toot{ID: uid.New(1, uid.Twitter, 1), TextHTML: "<p>Hallo</p>", Language: testCase.TootLanguage}
+
+			note := f.NewNote(user, toot)
+			if note.Content != toot.TextHTML {
+				t.Errorf("Expected content %q, Actual %q", toot.TextHTML, note.Content)
+			}
+			if !reflect.DeepEqual(note.ContentMap, testCase.Expected) {
+				t.Errorf("Expected contentMap %v, Actual %v", testCase.Expected, note.ContentMap)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	mediaTypeActivity = "application/activity+json"
+	mediaTypeLDJSON   = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+	maxResponseBytes = 1 << 20
+)
+
+// RemoteActor is the subset of a remote actor document
+// which is required to talk to a remote server.
+type RemoteActor struct {
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferredUsername"`
+	URL               any    `json:"url"`
+	Inbox             string `json:"inbox"`
+	Endpoints         struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey   *PublicKey `json:"publicKey,omitempty"`
+	AlsoKnownAs []string   `json:"alsoKnownAs,omitempty"`
+}
+
+type Client struct {
+	httpClient *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// get fetches an ActivityPub document with a GET request signed by the given key.
+func (c *Client) get(ctx context.Context, key *httpsig.Key, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", mediaTypeActivity+", "+mediaTypeLDJSON)
+	if err = httpsig.Sign(req, key, nil); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code fetching %s: %d", url, resp.StatusCode)
+	}
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v); err != nil {
+		return fmt.Errorf("error deserialising %s: %w", url, err)
+	}
+
+	return nil
+}
+
+// ProfileURL returns the URL of the actor's HTML profile.
+func (a *RemoteActor) ProfileURL() string {
+	if url := (&IncomingNote{URL: a.URL}).HTMLURL(); url != "" {
+		return url
+	}
+	return a.ID
+}
+
+// FetchActor retrieves the actor document of a remote actor.
+func (c *Client) FetchActor(ctx context.Context, key *httpsig.Key, actorURL string) (*RemoteActor, error) {
+	var actor RemoteActor
+	if err := c.get(ctx, key, actorURL, &actor); err != nil {
+		return nil, err
+	}
+	if actor.ID == "" || actor.Inbox == "" {
+		return nil, fmt.Errorf("actor %s is missing id or inbox", actorURL)
+	}
+
+	return &actor, nil
+}
+
+// FetchPublicKey retrieves a remote public key by its key ID.
+// Most servers use a fragment of the actor URL as the key ID, in which
+// case the key is embedded in the actor document, but some servers
+// serve the key as a standalone document.
+//
+// The owner of a key is only trusted if it lives on the same origin as
+// the key and its actor document names the same key, because anyone
+// can publish a key document which claims to belong to someone else.
+func (c *Client) FetchPublicKey(ctx context.Context, key *httpsig.Key, keyID string) (*PublicKey, error) {
+	var doc struct {
+		PublicKey
+		PublicKeyObj *PublicKey `json:"publicKey"`
+	}
+	if err := c.get(ctx, key, keyID, &doc); err != nil {
+		return nil, err
+	}
+
+	publicKey := doc.PublicKeyObj
+	if publicKey == nil {
+		publicKey = &doc.PublicKey
+	}
+	if publicKey.ID != keyID || publicKey.PublicKeyPEM == "" {
+		return nil, fmt.Errorf("document %s does not contain key %s", keyID, keyID)
+	}
+	if !SameOrigin(keyID, publicKey.Owner) {
+		return nil, fmt.Errorf("owner %s of key %s is on another origin", publicKey.Owner, keyID)
+	}
+
+	// Keys which are embedded in the actor document
+	// have already been fetched from their owner.
+	if doc.PublicKeyObj != nil && doc.ID == publicKey.Owner {
+		return publicKey, nil
+	}
+
+	owner, err := c.FetchActor(ctx, key, publicKey.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching owner of key %s: %w", keyID, err)
+	}
+	if owner.ID != publicKey.Owner || owner.PublicKey == nil ||
+		owner.PublicKey.ID != keyID || owner.PublicKey.PublicKeyPEM != publicKey.PublicKeyPEM {
+		return nil, fmt.Errorf("actor %s does not own key %s", publicKey.Owner, keyID)
+	}
+
+	return publicKey, nil
+}
+
+// SameOrigin returns true if both URLs have the same scheme and host.
+func SameOrigin(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// Deliver posts a signed activity to a remote inbox.
+func (c *Client) Deliver(ctx context.Context, key *httpsig.Key, inboxURL string, activity any) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error serialising activity: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inboxURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Content-Type", mediaTypeActivity)
+	if err = httpsig.Sign(req, key, body); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error delivering activity to %s: %w", inboxURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad status code delivering activity to %s: %d", inboxURL, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sabertoot/server/internal/httpsig"
+)
+
+func Test_FetchPublicKey(t *testing.T) {
+	privateKey, err := httpsig.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &httpsig.Key{ID: "https://sabertoot.example/users/bob#main-key", PrivateKey: privateKey}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alice := server.URL + "/users/alice"
+		carol := server.URL + "/users/carol"
+		docs := map[string]any{
+			// The key is embedded in the actor document.
+			"/users/alice": map[string]any{
+				"id":        alice,
+				"inbox":     alice + "/inbox",
+				"publicKey": map[string]string{"id": alice + "#main-key", "owner": alice, "publicKeyPem": "ALICE"},
+			},
+			// A standalone key which its owner names.
+			"/users/carol": map[string]any{
+				"id":        carol,
+				"inbox":     carol + "/inbox",
+				"publicKey": map[string]string{"id": server.URL + "/keys/carol", "owner": carol, "publicKeyPem": "CAROL"},
+			},
+			"/keys/carol": map[string]string{"id": server.URL + "/keys/carol", "owner": carol, "publicKeyPem": "CAROL"},
+			// A key which claims to belong to alice, who doesn't know it.
+			"/keys/mallory": map[string]string{"id": server.URL + "/keys/mallory", "owner": alice, "publicKeyPem": "MALLORY"},
+			// A key which claims an owner on another server.
+			"/keys/victim": map[string]string{"id": server.URL + "/keys/victim", "owner": "https://victim.example/users/alice", "publicKeyPem": "MALLORY"},
+		}
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeActivity)
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+
+	publicKey, err := client.FetchPublicKey(ctx, key, server.URL+"/users/alice#main-key")
+	if err != nil || publicKey.Owner != server.URL+"/users/alice" {
+		t.Errorf("unexpected embedded key: %+v %v", publicKey, err)
+	}
+
+	// Standalone keys have to be named by their owner.
+	publicKey, err = client.FetchPublicKey(ctx, key, server.URL+"/keys/carol")
+	if err != nil || publicKey.Owner != server.URL+"/users/carol" {
+		t.Errorf("unexpected standalone key: %+v %v", publicKey, err)
+	}
+
+	for _, path := range []string{"/keys/mallory", "/keys/victim"} {
+		if publicKey, err = client.FetchPublicKey(ctx, key, server.URL+path); err == nil {
+			t.Errorf("expected key %s to be rejected, got %+v", path, publicKey)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	// DefaultService is the public AppView, which serves
+	// public data without authentication.
+	DefaultService = "https://public.api.bsky.app"
+
+	maxResponseBytes = 10 << 20
+
+	// The AppView counts requests in windows of five minutes.
+	defaultRetryAfter = 5 * time.Minute
+)
+
+// XRPCError is an error which has been returned by an XRPC method.
+type XRPCError struct {
+	StatusCode int
+	Name       string `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e *XRPCError) Error() string {
+	return fmt.Sprintf("XRPC error %d %s: %s", e.StatusCode, e.Name, e.Message)
+}
+
+// Client calls the XRPC methods of a Bluesky AppView.
+type Client struct {
+	httpClient *http.Client
+	service    string
+}
+
+func NewClient(service string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		service:    service,
+	}
+}
+
+// Filters of an author feed.
+const (
+	// FilterAuthorThreads returns posts and the replies of
+	// self-threads, but no replies to other accounts.
+	FilterAuthorThreads = "posts_and_author_threads"
+)
+
+// GetAuthorFeed returns a page of the posts and reposts of an actor,
+// newest first. The actor is a handle or a DID.
+func (c *Client) GetAuthorFeed(ctx context.Context, actor string, cursor string, limit int) (*AuthorFeed, error) {
+	params := url.Values{
+		"actor":  {actor},
+		"filter": {FilterAuthorThreads},
+		"limit":  {strconv.Itoa(limit)},
+	}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	var feed AuthorFeed
+	if err := c.query(ctx, "app.bsky.feed.getAuthorFeed", params, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// query calls an XRPC query method.
+func (c *Client) query(ctx context.Context, method string, params url.Values, v any) error {
+	endpoint := fmt.Sprintf("%s/xrpc/%s?%s", c.service, method, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("error reading response of %s: %w", method, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &source.RateLimitError{Service: "Bluesky API", Reset: source.ParseUnixReset(resp.Header.Get("RateLimit-Reset"), defaultRetryAfter)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		xrpcErr := &XRPCError{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(body, xrpcErr)
+		return xrpcErr
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error deserializing response of %s: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// DownloadMedia downloads the images which have been embedded in a post.
+func (s *blueskySource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	result := []*data.Media{}
+
+	i, ok := item.(*postItem)
+	if !ok {
+		return result
+	}
+
+	for _, image := range i.post.Embed.AllImages() {
+		sourceURL := image.Fullsize
+		if sourceURL == "" {
+			sourceURL = image.Thumb
+		}
+		if sourceURL == "" {
+			continue
+		}
+
+		ext, mimeType := imageFormat(sourceURL)
+		fileName := fmt.Sprintf("%s-%d%s", toot.ID, len(result), ext)
+		err := download.File(ctx, sourceURL, s.env.Settings.Storage.MediaFullFilePath(fileName))
+		if err != nil {
+			plog.Errorf("Error downloading media of toot %s: %s", toot.ID, err.Error())
+			continue
+		}
+
+		media := &data.Media{
+			Type:      data.MediaPhoto,
+			MIMEType:  mimeType,
+			FileName:  fileName,
+			AltText:   image.Alt,
+			SourceURL: sourceURL,
+		}
+		if image.AspectRatio != nil {
+			media.Width = image.AspectRatio.Width
+			media.Height = image.AspectRatio.Height
+		}
+		result = append(result, media)
+		plog.Debugf("Media downloaded for toot %s: %s", toot.ID, fileName)
+	}
+
+	return result
+}
+
+// imageFormat returns the file extension and MIME type of an image.
+// The CDN tells the format by a suffix, e.g. .../bafkrei...@jpeg.
+func imageFormat(imageURL string) (string, string) {
+	format := ""
+	if i := strings.LastIndex(imageURL, "@"); i > strings.LastIndex(imageURL, "/") {
+		format = strings.ToLower(imageURL[i+1:])
+	}
+	switch format {
+	case "png":
+		return ".png", "image/png"
+	case "webp":
+		return ".webp", "image/webp"
+	case "gif":
+		return ".gif", "image/gif"
+	default:
+		return ".jpg", "image/jpeg"
+	}
+}
+
+// downloadProfileImage downloads the avatar of the harvested account.
+func (s *blueskySource) downloadProfileImage(ctx context.Context, avatarURL string) {
+	if avatarURL == "" {
+		return
+	}
+	user := s.env.User
+
+	ext, _ := imageFormat(avatarURL)
+	profileImagePath := s.env.Settings.Storage.ProfileImageFullFilePath(user.ID, ext)
+	if err := download.File(ctx, avatarURL, profileImagePath); err != nil {
+		plog.Error(err.Error())
+		return
+	}
+
+	plog.Infof("Profile image downloaded for user %s: %s", user.Username, profileImagePath)
+}
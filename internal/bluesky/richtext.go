@@ -0,0 +1,122 @@
+package bluesky
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/richtext"
+)
+
+const bskyBaseURL = "https://bsky.app"
+
+// Rendered is a post's text converted to HTML.
+type Rendered struct {
+	HTML string
+
+	// Hashtags without the leading '#'.
+	Hashtags []string
+}
+
+// Tags returns the hashtags of a rendered post as toot tags.
+func (r *Rendered) Tags() []*data.Tag {
+	return richtext.HashtagTags(r.Hashtags, HashtagURL)
+}
+
+// RenderHTML converts the text of a post into HTML. Facets turn their
+// range of the text into links, mentions and hashtags. Their indices
+// count UTF-8 bytes, and facets which don't fit the text are ignored.
+func RenderHTML(text string, facets []*Facet) *Rendered {
+	rendered := &Rendered{Hashtags: []string{}}
+
+	valid := []*Facet{}
+	for _, f := range facets {
+		start, end := f.Index.ByteStart, f.Index.ByteEnd
+		if start < 0 || end > len(text) || start >= end {
+			continue
+		}
+		if !utf8.RuneStart(text[start]) || (end < len(text) && !utf8.RuneStart(text[end])) {
+			continue
+		}
+		valid = append(valid, f)
+	}
+	sort.SliceStable(valid, func(i, j int) bool { return valid[i].Index.ByteStart < valid[j].Index.ByteStart })
+
+	var b strings.Builder
+	pos := 0
+	for _, f := range valid {
+		// Facets never overlap, unless they are broken.
+		if f.Index.ByteStart < pos {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:f.Index.ByteStart]))
+		b.WriteString(renderFacet(rendered, text[f.Index.ByteStart:f.Index.ByteEnd], f.Features))
+		pos = f.Index.ByteEnd
+	}
+	b.WriteString(html.EscapeString(text[pos:]))
+
+	rendered.HTML = richtext.Paragraphs(b.String())
+	return rendered
+}
+
+// renderFacet renders the first feature of a facet which is understood.
+func renderFacet(r *Rendered, literal string, features []*FacetFeature) string {
+	for _, feature := range features {
+		switch feature.Type {
+		case FeatureLink:
+			if !richtext.IsWebURL(feature.URI) {
+				continue
+			}
+			return fmt.Sprintf(
+				`<a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a>`,
+				html.EscapeString(feature.URI),
+				html.EscapeString(literal))
+
+		case FeatureMention:
+			if feature.DID == "" {
+				continue
+			}
+			return fmt.Sprintf(
+				`<a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a>`,
+				html.EscapeString(ProfileURL(feature.DID)),
+				html.EscapeString(literal))
+
+		case FeatureTag:
+			if feature.Tag == "" {
+				continue
+			}
+			r.Hashtags = append(r.Hashtags, feature.Tag)
+			return fmt.Sprintf(
+				`<a href="%s" class="mention hashtag" rel="tag nofollow noopener noreferrer" target="_blank">#<span>%s</span></a>`,
+				html.EscapeString(HashtagURL(feature.Tag)),
+				html.EscapeString(strings.TrimPrefix(literal, "#")))
+		}
+	}
+	return html.EscapeString(literal)
+}
+
+// hasLink returns true if one of the facets links to the URI.
+func hasLink(facets []*Facet, uri string) bool {
+	for _, f := range facets {
+		for _, feature := range f.Features {
+			if feature.Type == FeatureLink && feature.URI == uri {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProfileURL returns the URL of an actor's profile on bsky.app.
+func ProfileURL(actor string) string {
+	return fmt.Sprintf("%s/profile/%s", bskyBaseURL, url.PathEscape(actor))
+}
+
+// HashtagURL returns the URL of a hashtag's page on bsky.app.
+func HashtagURL(tag string) string {
+	return fmt.Sprintf("%s/hashtag/%s", bskyBaseURL, url.PathEscape(tag))
+}
@@ -0,0 +1,81 @@
+package bluesky
+
+import (
+	"strings"
+	"testing"
+)
+
+func facetAt(text string, literal string, feature *FacetFeature) *Facet {
+	f := &Facet{Features: []*FacetFeature{feature}}
+	f.Index.ByteStart = strings.Index(text, literal)
+	f.Index.ByteEnd = f.Index.ByteStart + len(literal)
+	return f
+}
+
+func Test_RenderHTML(t *testing.T) {
+	text := "Grüße 👋 @alice.bsky.social\nsee bsky.app/docs… #AtProto <3"
+	testCases := []struct {
+		Name     string
+		Text     string
+		Facets   []*Facet
+		Expected string
+	}{
+		{
+			Name:     "plain text",
+			Text:     "One & two\n\nThree",
+			Expected: "<p>One &amp; two</p><p>Three</p>",
+		},
+		{
+			Name: "facets after multibyte characters",
+			Text: text,
+			Facets: []*Facet{
+				facetAt(text, "#AtProto", &FacetFeature{Type: FeatureTag, Tag: "AtProto"}),
+				facetAt(text, "@alice.bsky.social", &FacetFeature{Type: FeatureMention, DID: "did:plc:alice"}),
+				facetAt(text, "bsky.app/docs…", &FacetFeature{Type: FeatureLink, URI: "https://bsky.app/docs/long"}),
+			},
+			Expected: `<p>Grüße 👋 <a href="https://bsky.app/profile/did:plc:alice" rel="nofollow noopener noreferrer" target="_blank">@alice.bsky.social</a><br>` +
+				`see <a href="https://bsky.app/docs/long" rel="nofollow noopener noreferrer" target="_blank">bsky.app/docs…</a> ` +
+				`<a href="https://bsky.app/hashtag/AtProto" class="mention hashtag" rel="tag nofollow noopener noreferrer" target="_blank">#<span>AtProto</span></a> &lt;3</p>`,
+		},
+		{
+			Name: "unsafe links stay text",
+			Text: "click me",
+			Facets: []*Facet{
+				facetAt("click me", "click", &FacetFeature{Type: FeatureLink, URI: "javascript:alert(1)"}),
+			},
+			Expected: "<p>click me</p>",
+		},
+		{
+			Name: "broken indices are ignored",
+			Text: "👋 hi",
+			Facets: []*Facet{
+				{Index: FacetIndex{ByteStart: 1, ByteEnd: 3}, Features: []*FacetFeature{{Type: FeatureTag, Tag: "x"}}},
+				{Index: FacetIndex{ByteStart: 5, ByteEnd: 50}, Features: []*FacetFeature{{Type: FeatureTag, Tag: "y"}}},
+			},
+			Expected: "<p>👋 hi</p>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := RenderHTML(tc.Text, tc.Facets).HTML
+			if actual != tc.Expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_RenderHTML_Tags(t *testing.T) {
+	text := "#Go and #go and #Bluesky"
+	rendered := RenderHTML(text, []*Facet{
+		facetAt(text, "#Go", &FacetFeature{Type: FeatureTag, Tag: "Go"}),
+		facetAt(text, "#go", &FacetFeature{Type: FeatureTag, Tag: "go"}),
+		facetAt(text, "#Bluesky", &FacetFeature{Type: FeatureTag, Tag: "Bluesky"}),
+	})
+
+	tags := rendered.Tags()
+	if len(tags) != 2 || tags[0].Name != "#go" || tags[1].Name != "#bluesky" || tags[1].Href != "https://bsky.app/hashtag/Bluesky" {
+		t.Errorf("unexpected tags: %+v", tags)
+	}
+}
@@ -0,0 +1,252 @@
+// Package bluesky harvests the posts of a Bluesky account
+// through the public XRPC API of the AT Protocol.
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/richtext"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	SourceType = "bluesky"
+
+	pageSize = 50
+)
+
+// Options of a Bluesky source.
+type Options struct {
+	// Handle is the handle or DID of the account, e.g. dustin.bsky.social.
+	Handle string `json:"handle"`
+
+	// Service is the base URL of the AppView, which
+	// defaults to the public API of Bluesky.
+	Service string `json:"service,omitempty"`
+}
+
+func init() {
+	source.Register(SourceType, newSource)
+}
+
+// blueskySource harvests the posts and self-threads of a Bluesky account.
+// Replies to other accounts, reposts and pinned posts are skipped.
+type blueskySource struct {
+	env     *source.Env
+	options *Options
+	client  *Client
+}
+
+func newSource(env *source.Env, cfg *config.Source) (source.Source, error) {
+	var options Options
+	if err := cfg.DecodeOptions(&options); err != nil {
+		return nil, err
+	}
+	options.Handle = strings.TrimPrefix(options.Handle, "@")
+	if options.Handle == "" {
+		return nil, fmt.Errorf("%s source of user %s needs a handle", cfg.Key(), env.User.Username)
+	}
+	service := strings.TrimSuffix(options.Service, "/")
+	if service == "" {
+		service = DefaultService
+	}
+	return &blueskySource{
+		env:     env,
+		options: &options,
+		client:  NewClient(service),
+	}, nil
+}
+
+// postItem is a fetched post together with its decoded record.
+type postItem struct {
+	post   *PostView
+	record *PostRecord
+}
+
+// cursor is where the harvest of an account continues. The author feed
+// can't be filtered, so a harvest pages backwards from the newest post
+// until it reaches the newest post of the previous harvest.
+type cursor struct {
+	Latest int64  `json:"latest,omitempty"`
+	Since  int64  `json:"since,omitempty"`
+	Next   string `json:"next,omitempty"`
+}
+
+func (s *blueskySource) Fetch(ctx context.Context, value string) (*source.Page, error) {
+	c := &cursor{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), c); err != nil {
+			return nil, fmt.Errorf("error deserializing Bluesky cursor: %w", err)
+		}
+	}
+
+	newHarvest := c.Next == ""
+	if newHarvest {
+		c.Since = c.Latest
+	} else {
+		plog.Infof("Resuming to collect posts of %s", s.options.Handle)
+	}
+
+	feed, err := s.client.GetAuthorFeed(ctx, s.options.Handle, c.Next, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	plog.Debugf("Result count: %d", len(feed.Feed))
+
+	since := time.Unix(c.Since, 0).UTC()
+	items := []*postItem{}
+	done := len(feed.Feed) == 0 || feed.Cursor == ""
+	for _, entry := range feed.Feed {
+		if entry.Post == nil || entry.Reason != nil {
+			continue
+		}
+		post := entry.Post
+
+		var record PostRecord
+		if err := json.Unmarshal(post.Record, &record); err != nil {
+			plog.Warningf("Skipping post %s of %s: %s", post.URI, s.options.Handle, err.Error())
+			continue
+		}
+
+		if newHarvest && post.Author != nil {
+			s.downloadProfileImage(ctx, post.Author.Avatar)
+			newHarvest = false
+		}
+
+		// The feed is sorted by the earlier of both dates,
+		// because the creation date is set by the client.
+		sortAt := record.CreatedAt
+		if !post.IndexedAt.IsZero() && post.IndexedAt.Before(sortAt) {
+			sortAt = post.IndexedAt
+		}
+		if sortAt.Before(s.env.User.StartDate) || (c.Since > 0 && sortAt.Before(since)) {
+			done = true
+			continue
+		}
+
+		// The AppView only pages backwards, so the next harvest
+		// stops at the newest post seen here, while this one
+		// keeps comparing against its own Since.
+		if unix := sortAt.Unix(); unix > c.Latest {
+			c.Latest = unix
+		}
+
+		if parent := record.ParentURI(); parent != "" && (post.Author == nil || !IsBy(parent, post.Author.DID)) {
+			continue
+		}
+
+		items = append(items, &postItem{post: post, record: &record})
+	}
+
+	c.Next = ""
+	if !done {
+		c.Next = feed.Cursor
+	} else {
+		plog.Debugf("No more posts of %s to collect.", s.options.Handle)
+	}
+
+	// The author feed lists the newest posts first. They get saved by the
+	// creation date of their records, so that a post is saved before
+	// the replies which continue its thread.
+	sort.SliceStable(items, func(i, j int) bool { return items[i].record.CreatedAt.Before(items[j].record.CreatedAt) })
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing Bluesky cursor: %w", err)
+	}
+
+	page := &source.Page{Cursor: string(encoded), More: c.Next != ""}
+	for _, item := range items {
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+// TootID derives the ID of the toot from the at:// URI of a post.
+func TootID(userID uid.UserID, uri string) uid.TootID {
+	h := fnv.New64a()
+	h.Write([]byte(uri))
+	return uid.New(userID, uid.Bluesky, h.Sum64())
+}
+
+func (s *blueskySource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	i, ok := item.(*postItem)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item of Bluesky source: %T", item)
+	}
+
+	sourceData, err := json.Marshal(i.post)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing Bluesky post: %w", err)
+	}
+
+	rendered := RenderHTML(i.record.Text, i.record.Facets)
+	toot := &data.Toot{
+		ID:           TootID(s.env.User.ID, i.post.URI),
+		UserID:       s.env.User.ID,
+		CreatedAt:    i.record.CreatedAt.UTC(),
+		TextOriginal: i.record.Text,
+		TextHTML:     rendered.HTML,
+		SourceType:   uid.Bluesky,
+		SourceID:     i.post.URI,
+		SourceData:   string(sourceData),
+		Tags:         rendered.Tags(),
+		Kind:         data.KindPost,
+	}
+
+	if len(i.record.Langs) > 0 {
+		toot.Language = i.record.Langs[0]
+	}
+
+	// Self-labels become content warnings.
+	if label := i.post.SensitiveLabel(i.record); label != "" {
+		toot.Sensitive = true
+		toot.Summary = label
+	}
+
+	// The link of a card is often removed from the text,
+	// in which case it gets added to the end of it.
+	if embed := i.post.Embed; embed != nil && embed.External != nil &&
+		richtext.IsWebURL(embed.External.URI) && !hasLink(i.record.Facets, embed.External.URI) {
+		toot.TextHTML += fmt.Sprintf(`<p><a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a></p>`,
+			html.EscapeString(embed.External.URI), html.EscapeString(embed.External.URI))
+	}
+
+	if toot.InReplyToID, err = s.threadParent(ctx, i.record.ParentURI()); err != nil {
+		return nil, err
+	}
+
+	return toot, nil
+}
+
+// threadParent returns the ID of the toot which a reply to one of the
+// user's own posts continues. A parent which hasn't been harvested,
+// e.g. because it's older than the start date, leaves the reply
+// without a thread.
+func (s *blueskySource) threadParent(ctx context.Context, parentURI string) (uid.TootID, error) {
+	if parentURI == "" {
+		return "", nil
+	}
+
+	userID := s.env.User.ID
+	tootID, err := s.env.DataService.SourceTootID(ctx, TootID(userID, parentURI), userID, uid.Bluesky, parentURI)
+	if err != nil {
+		return "", err
+	}
+	if tootID == "" {
+		plog.Debugf("Previous post %s of thread has not been harvested", parentURI)
+	}
+
+	return tootID, nil
+}
@@ -0,0 +1,204 @@
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+)
+
+// newTestSource returns a source whose client talks to a stand-in for the
+// XRPC API, which serves recorded pages of an author feed by their cursor
+// and the images of the CDN.
+func newTestSource(t *testing.T, requests *[]*http.Request) *blueskySource {
+	pages := map[string]string{
+		"":                         "getAuthorFeed.json",
+		"2023-01-09T12:00:00.000Z": "getAuthorFeed_2.json",
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/img/") {
+			w.Write([]byte("image"))
+			return
+		}
+		*requests = append(*requests, r)
+
+		w.Header().Set("Content-Type", "application/json")
+		fixture, ok := pages[r.URL.Query().Get("cursor")]
+		if r.URL.Path != "/xrpc/app.bsky.feed.getAuthorFeed" || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"InvalidRequest","message":"unexpected request"}`))
+			return
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(strings.ReplaceAll(string(body), "https://cdn.bsky.app", server.URL)))
+	}))
+	t.Cleanup(server.Close)
+
+	options, _ := json.Marshal(&Options{Handle: "@dustin.bsky.social", Service: server.URL})
+	src, err := newSource(sourcetest.NewEnv(t), &config.Source{Type: SourceType, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src.(*blueskySource)
+}
+
+func itemKeys(page *source.Page) string {
+	keys := []string{}
+	for _, item := range page.Items {
+		uri := item.(*postItem).post.URI
+		keys = append(keys, uri[strings.LastIndex(uri, "/")+1:])
+	}
+	return strings.Join(keys, ",")
+}
+
+func Test_Source_Fetch(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinned posts, reposts and replies to other accounts are
+	// skipped and the rest is sorted from oldest to newest.
+	if keys := itemKeys(page); keys != "3jzthread1,3jzthread2" {
+		t.Errorf("unexpected items: %s", keys)
+	}
+	if !page.More {
+		t.Error("expected more pages")
+	}
+
+	query := requests[0].URL.Query()
+	if query.Get("actor") != "dustin.bsky.social" || query.Get("filter") != FilterAuthorThreads {
+		t.Errorf("unexpected query: %s", requests[0].URL.RawQuery)
+	}
+	if _, err = os.Stat(src.env.Settings.Storage.ProfileImageFullFilePath(1, ".jpg")); err != nil {
+		t.Errorf("profile image has not been downloaded: %v", err)
+	}
+
+	page, err = src.Fetch(ctx, page.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := itemKeys(page); keys != "3jzolder" {
+		t.Errorf("unexpected items: %s", keys)
+	}
+	if page.More {
+		t.Error("expected no more pages after the start date")
+	}
+
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Latest != time.Date(2023, 1, 10, 18, 31, 0, 0, time.UTC).Unix() || c.Next != "" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	// The next harvest stops at the newest post of this one.
+	page, err = src.Fetch(ctx, page.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := itemKeys(page); keys != "3jzthread2" || page.More {
+		t.Errorf("unexpected items of next harvest: %s", keys)
+	}
+}
+
+func Test_Source_Toot(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items are saved in order, so the reply finds its parent.
+	toots := sourcetest.SaveItems(t, src.env, src, SourceType, page)
+
+	post := toots[0]
+	if post.SourceID != "at://did:plc:dustin123/app.bsky.feed.post/3jzthread1" || post.ID != TootID(1, post.SourceID) {
+		t.Errorf("unexpected IDs: %s, %s", post.SourceID, post.ID)
+	}
+	if post.Language != "en" || !post.CreatedAt.Equal(time.Date(2023, 1, 10, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected toot: %+v", post)
+	}
+	for _, expected := range []string{
+		`<a href="https://bsky.app/profile/did:plc:alice456" rel="nofollow noopener noreferrer" target="_blank">@alice.bsky.social</a>!</p>`,
+		`<a href="https://example.com/sabertoot-is-here" rel="nofollow noopener noreferrer" target="_blank">example.com/sabertoot…</a>`,
+		`#<span>Sabertoot</span></a> &amp; more</p>`,
+	} {
+		if !strings.Contains(post.TextHTML, expected) {
+			t.Errorf("expected HTML to contain %s, got %s", expected, post.TextHTML)
+		}
+	}
+	if len(post.Tags) != 1 || post.Tags[0].Name != "#sabertoot" {
+		t.Errorf("unexpected tags: %+v", post.Tags)
+	}
+
+	if len(post.Media) != 2 {
+		t.Fatalf("expected 2 media, got %d", len(post.Media))
+	}
+	if post.Media[0].AltText != "A photo" || post.Media[0].Width != 1000 || post.Media[0].MIMEType != "image/jpeg" {
+		t.Errorf("unexpected media: %+v", post.Media[0])
+	}
+	if post.Media[1].MIMEType != "image/png" || !strings.HasSuffix(post.Media[1].FileName, ".png") {
+		t.Errorf("unexpected media: %+v", post.Media[1])
+	}
+
+	reply := toots[1]
+	if reply.InReplyToID != post.ID {
+		t.Errorf("expected reply to %s, got %q", post.ID, reply.InReplyToID)
+	}
+	if !reply.Sensitive || reply.Summary != "graphic-media" {
+		t.Errorf("expected a content warning: %+v", reply)
+	}
+	if !strings.HasSuffix(reply.TextHTML, `<a href="https://sabertoot.example/docs" rel="nofollow noopener noreferrer" target="_blank">https://sabertoot.example/docs</a></p>`) {
+		t.Errorf("expected the link of the card: %s", reply.TextHTML)
+	}
+}
+
+func Test_Client_XRPCError(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &requests)
+
+	_, err := src.client.GetAuthorFeed(context.Background(), "dustin.bsky.social", "unknown", pageSize)
+	xrpcErr, ok := err.(*XRPCError)
+	if !ok || xrpcErr.StatusCode != http.StatusBadRequest || xrpcErr.Name != "InvalidRequest" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_Client_RateLimited(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	// The harvester defers the source until the reset.
+	_, err := NewClient(server.URL).GetAuthorFeed(context.Background(), "dustin.bsky.social", "", pageSize)
+	if actual, ok := source.RetryAfter(err); !ok || !actual.Equal(reset) {
+		t.Errorf("expected the source to be deferred until %s, got %s %v", reset, actual, err)
+	}
+}
@@ -0,0 +1,174 @@
+package bluesky
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuthorFeed is the response of app.bsky.feed.getAuthorFeed.
+type AuthorFeed struct {
+	Cursor string          `json:"cursor"`
+	Feed   []*FeedViewPost `json:"feed"`
+}
+
+// FeedViewPost is an entry of a feed. The reason is set
+// if the post shows up because it has been reposted or pinned.
+type FeedViewPost struct {
+	Post   *PostView `json:"post"`
+	Reason *struct {
+		Type string `json:"$type"`
+	} `json:"reason"`
+}
+
+// Reasons of feed entries.
+const (
+	ReasonRepost = "app.bsky.feed.defs#reasonRepost"
+	ReasonPin    = "app.bsky.feed.defs#reasonPin"
+)
+
+// PostView is a post together with its author and the
+// hydrated views of its embeds.
+type PostView struct {
+	URI       string          `json:"uri"`
+	CID       string          `json:"cid"`
+	Author    *ProfileView    `json:"author"`
+	Record    json.RawMessage `json:"record"`
+	Embed     *EmbedView      `json:"embed"`
+	IndexedAt time.Time       `json:"indexedAt"`
+	Labels    []*Label        `json:"labels"`
+}
+
+// ProfileView is the author of a post.
+type ProfileView struct {
+	DID         string `json:"did"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+// Label is a moderation label of a post.
+type Label struct {
+	Val string `json:"val"`
+}
+
+// PostRecord is the app.bsky.feed.post record of a post,
+// which is what the author has written.
+type PostRecord struct {
+	Text      string    `json:"text"`
+	Facets    []*Facet  `json:"facets"`
+	CreatedAt time.Time `json:"createdAt"`
+	Langs     []string  `json:"langs"`
+	Reply     *struct {
+		Root   StrongRef `json:"root"`
+		Parent StrongRef `json:"parent"`
+	} `json:"reply"`
+	Labels *struct {
+		Values []*Label `json:"values"`
+	} `json:"labels"`
+}
+
+// StrongRef points to a specific version of a record.
+type StrongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// Facet annotates a range of a post's text, given in UTF-8 bytes.
+type Facet struct {
+	Index    FacetIndex      `json:"index"`
+	Features []*FacetFeature `json:"features"`
+}
+
+// FacetIndex is the range of a facet. The end is exclusive.
+type FacetIndex struct {
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+// FacetFeature is a link, mention or tag. Which of the
+// properties is set depends on the type.
+type FacetFeature struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri"`
+	DID  string `json:"did"`
+	Tag  string `json:"tag"`
+}
+
+// Types of facet features.
+const (
+	FeatureLink    = "app.bsky.richtext.facet#link"
+	FeatureMention = "app.bsky.richtext.facet#mention"
+	FeatureTag     = "app.bsky.richtext.facet#tag"
+)
+
+// EmbedView is the hydrated view of an embed. Images are either embedded
+// directly or as the media of a post which quotes another one.
+type EmbedView struct {
+	Type     string       `json:"$type"`
+	Images   []*ImageView `json:"images"`
+	External *struct {
+		URI   string `json:"uri"`
+		Title string `json:"title"`
+	} `json:"external"`
+	Media *EmbedView `json:"media"`
+}
+
+// ImageView is an image of a post.
+type ImageView struct {
+	Thumb       string `json:"thumb"`
+	Fullsize    string `json:"fullsize"`
+	Alt         string `json:"alt"`
+	AspectRatio *struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"aspectRatio"`
+}
+
+// AllImages returns the images of the embed, including
+// those of a post which quotes another one.
+func (e *EmbedView) AllImages() []*ImageView {
+	if e == nil {
+		return nil
+	}
+	if e.Media != nil {
+		return e.Media.AllImages()
+	}
+	return e.Images
+}
+
+// ParentURI returns the URI of the post which the record replies to.
+func (r *PostRecord) ParentURI() string {
+	if r.Reply == nil {
+		return ""
+	}
+	return r.Reply.Parent.URI
+}
+
+// Labels which mark a post as sensitive.
+var sensitiveLabels = map[string]bool{
+	"porn":          true,
+	"sexual":        true,
+	"nudity":        true,
+	"graphic-media": true,
+}
+
+// SensitiveLabel returns the first label of a post which
+// marks it as sensitive, or an empty string.
+func (p *PostView) SensitiveLabel(record *PostRecord) string {
+	labels := append([]*Label{}, p.Labels...)
+	if record.Labels != nil {
+		labels = append(labels, record.Labels.Values...)
+	}
+	for _, label := range labels {
+		if sensitiveLabels[label.Val] {
+			return label.Val
+		}
+	}
+	return ""
+}
+
+// IsBy returns true if the AT URI points to a record of the given DID.
+func IsBy(uri string, did string) bool {
+	return strings.HasPrefix(uri, "at://"+did+"/")
+}
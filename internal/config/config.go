@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/sabertoot/server/internal/uid"
@@ -16,14 +17,53 @@ type Server struct {
 	MaxHeaderBytes int    `json:"maxHeaderBytes"`
 }
 
+const defaultReconcileDays = 7
+
 type Cron struct {
 	IntervalSeconds int `json:"intervalSeconds"`
+
+	// ReconcileDays is how far back harvested toots
+	// get checked for edits and deletions at their source.
+	ReconcileDays int `json:"reconcileDays"`
 }
 
 func (c *Cron) Interval() time.Duration {
 	return time.Duration(c.IntervalSeconds) * time.Second
 }
 
+func (c *Cron) ReconcilePeriod() time.Duration {
+	if c.ReconcileDays <= 0 {
+		return defaultReconcileDays * 24 * time.Hour
+	}
+	return time.Duration(c.ReconcileDays) * 24 * time.Hour
+}
+
+const (
+	defaultDeliveryIntervalSeconds = 10
+	defaultDeliveryMaxAgeHours     = 72
+)
+
+type Delivery struct {
+	IntervalSeconds int `json:"intervalSeconds"`
+	MaxAgeHours     int `json:"maxAgeHours"`
+}
+
+// Interval is the time between two runs of the delivery queue.
+func (d *Delivery) Interval() time.Duration {
+	if d.IntervalSeconds <= 0 {
+		return defaultDeliveryIntervalSeconds * time.Second
+	}
+	return time.Duration(d.IntervalSeconds) * time.Second
+}
+
+// MaxAge is the time after which a failing delivery is given up.
+func (d *Delivery) MaxAge() time.Duration {
+	if d.MaxAgeHours <= 0 {
+		return defaultDeliveryMaxAgeHours * time.Hour
+	}
+	return time.Duration(d.MaxAgeHours) * time.Hour
+}
+
 type SQLite struct {
 	DSN string `json:"dsn"`
 }
@@ -44,9 +84,67 @@ func (s *Storage) ProfileImageFullFilePath(userID uid.UserID, ext string) string
 		ext)
 }
 
+func (s *Storage) MediaDirectory() string {
+	return fmt.Sprintf("%s/media", s.Path)
+}
+
+func (s *Storage) MediaFullFilePath(fileName string) string {
+	return fmt.Sprintf("%s/%s", s.MediaDirectory(), fileName)
+}
+
+// Source is a place where a user's posts get harvested from.
+type Source struct {
+	// Type is the name under which the source is registered, e.g. "twitter".
+	Type string `json:"type"`
+
+	// Name tells several sources of the same type apart.
+	// It defaults to the type.
+	Name string `json:"name,omitempty"`
+
+	// Options depend on the type of the source.
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// Key identifies the source among the user's sources.
+func (s *Source) Key() string {
+	if s.Name == "" {
+		return s.Type
+	}
+	return s.Name
+}
+
+// DecodeOptions deserializes the options of the source into v.
+func (s *Source) DecodeOptions(v any) error {
+	if len(s.Options) == 0 {
+		return fmt.Errorf("%s source has no options", s.Key())
+	}
+	if err := json.Unmarshal(s.Options, v); err != nil {
+		return fmt.Errorf("error deserializing options of %s source: %w", s.Key(), err)
+	}
+	return nil
+}
+
+const SourceTypeTwitter = "twitter"
+
+// Twitter holds the options of a Twitter source.
 type Twitter struct {
 	Username string `json:"username"`
 	Token    string `json:"token"`
+
+	// Retweets are harvested and published as Announce activities.
+	Retweets bool `json:"retweets,omitempty"`
+
+	// Quotes are harvested and published as quote posts.
+	Quotes bool `json:"quotes,omitempty"`
+}
+
+// FediverseAccount is a Fediverse account which gets mentioned
+// in place of a Twitter account.
+type FediverseAccount struct {
+	// Handle in the form of @user@domain.
+	Handle     string `json:"handle"`
+	ActorURL   string `json:"actorURL"`
+	ProfileURL string `json:"profileURL"`
 }
 
 type User struct {
@@ -54,8 +152,81 @@ type User struct {
 	Username  string     `json:"username"`
 	FullName  string     `json:"fullName"`
 	Summary   string     `json:"summary"`
-	Twitter   *Twitter   `json:"twitter,omitempty"`
+	Language  string     `json:"language,omitempty"`
+	Sources   []*Source  `json:"sources,omitempty"`
 	StartDate time.Time  `json:"startDate"`
+
+	// Deprecated: Twitter is converted into an entry
+	// of Sources when the settings are loaded.
+	Twitter *Twitter `json:"twitter,omitempty"`
+
+	// HideFollowers only publishes the number of followers
+	// but not who they are.
+	HideFollowers bool `json:"hideFollowers,omitempty"`
+
+	// ReplyModeration decides which replies from the Fediverse are
+	// shown on a toot: "followers" (default), "all" or "none".
+	ReplyModeration string `json:"replyModeration,omitempty"`
+
+	// Credentials let the user sign in to authorize apps
+	// through IndieAuth. Users without them can't sign in.
+	Credentials *Credentials `json:"credentials,omitempty"`
+}
+
+// Credentials of a user. If both are set, both are required.
+type Credentials struct {
+	// PasswordHash is a PBKDF2 hash, as created by the credentials command.
+	PasswordHash string `json:"passwordHash,omitempty"`
+
+	// TOTPSecret is the base32 encoded secret of an authenticator app.
+	TOTPSecret string `json:"totpSecret,omitempty"`
+}
+
+// CanSignIn returns true if the user has any credentials.
+func (u *User) CanSignIn() bool {
+	return u.Credentials != nil && (u.Credentials.PasswordHash != "" || u.Credentials.TOTPSecret != "")
+}
+
+const (
+	ReplyModerationFollowers = "followers"
+	ReplyModerationAll       = "all"
+	ReplyModerationNone      = "none"
+)
+
+// ShowsReplies returns false if replies are hidden altogether.
+func (u *User) ShowsReplies() bool {
+	return u.ReplyModeration != ReplyModerationNone
+}
+
+// ShowsOnlyFollowerReplies returns true if only replies
+// of the user's followers are shown.
+func (u *User) ShowsOnlyFollowerReplies() bool {
+	return u.ReplyModeration != ReplyModerationAll
+}
+
+// Source returns the user's first source of the given type
+// or nil if the user has none.
+func (u *User) Source(typeName string) *Source {
+	for _, source := range u.Sources {
+		if source.Type == typeName {
+			return source
+		}
+	}
+	return nil
+}
+
+// TwitterAccount returns the options of the user's
+// Twitter source or nil if the user has none.
+func (u *User) TwitterAccount() *Twitter {
+	source := u.Source(SourceTypeTwitter)
+	if source == nil {
+		return nil
+	}
+	var account Twitter
+	if err := source.DecodeOptions(&account); err != nil {
+		return nil
+	}
+	return &account
 }
 
 func (u *User) IDPath() string {
@@ -86,16 +257,67 @@ func (u *User) LikedPath() string {
 	return fmt.Sprintf("%s/liked", u.IDPath())
 }
 
+func (u *User) StatusPath(tootID uid.TootID) string {
+	return fmt.Sprintf("%s/statuses/%s", u.IDPath(), tootID)
+}
+
+func (u *User) StatusActivityPath(tootID uid.TootID) string {
+	return fmt.Sprintf("%s/activity", u.StatusPath(tootID))
+}
+
+func (u *User) StatusRepliesPath(tootID uid.TootID) string {
+	return fmt.Sprintf("%s/replies", u.StatusPath(tootID))
+}
+
+func (u *User) StatusLikesPath(tootID uid.TootID) string {
+	return fmt.Sprintf("%s/likes", u.StatusPath(tootID))
+}
+
+func (u *User) StatusSharesPath(tootID uid.TootID) string {
+	return fmt.Sprintf("%s/shares", u.StatusPath(tootID))
+}
+
+func (u *User) MediaPath(fileName string) string {
+	return fmt.Sprintf("%s/media/%s", u.IDPath(), fileName)
+}
+
 func (u *User) ProfileImagePath() string {
 	return fmt.Sprintf("/profile_images/%d", u.ID)
 }
 
 type Settings struct {
-	Server  *Server  `json:"server,omitempty"`
-	Cron    *Cron    `json:"cron,omitempty"`
-	SQLite  *SQLite  `json:"sqlite,omitempty"`
-	Storage *Storage `json:"storage,omitempty"`
-	Users   []*User  `json:"users,omitempty"`
+	Server   *Server   `json:"server,omitempty"`
+	Cron     *Cron     `json:"cron,omitempty"`
+	Delivery *Delivery `json:"delivery,omitempty"`
+	SQLite   *SQLite   `json:"sqlite,omitempty"`
+	Storage  *Storage  `json:"storage,omitempty"`
+	Users    []*User   `json:"users,omitempty"`
+
+	// Mentions maps Twitter usernames to Fediverse accounts, so that
+	// @mentions of people who moved turn into proper Mention tags.
+	// Configured users are mapped to their own accounts automatically.
+	Mentions map[string]*FediverseAccount `json:"mentions,omitempty"`
+}
+
+// FediverseAccounts returns the Fediverse account of every known Twitter
+// username, keyed by the lowercase username.
+func (s *Settings) FediverseAccounts() map[string]*FediverseAccount {
+	accounts := make(map[string]*FediverseAccount)
+	for username, account := range s.Mentions {
+		accounts[strings.ToLower(username)] = account
+	}
+	for _, user := range s.Users {
+		account := user.TwitterAccount()
+		if account == nil {
+			continue
+		}
+		accounts[strings.ToLower(account.Username)] = &FediverseAccount{
+			Handle:     "@" + user.Username + "@" + s.Server.Domain,
+			ActorURL:   s.Server.PublicBaseURL + user.IDPath(),
+			ProfileURL: s.Server.PublicBaseURL + user.ProfilePath(),
+		}
+	}
+	return accounts
 }
 
 func (s *Settings) Validate() (bool, error) {
@@ -112,8 +334,23 @@ func (s *Settings) Validate() (bool, error) {
 		return false, fmt.Errorf("no users are configured")
 	}
 	for _, user := range s.Users {
-		if user.Twitter == nil {
-			return false, fmt.Errorf("user %s is missing twitter settings", user.Username)
+		if len(user.Sources) == 0 {
+			return false, fmt.Errorf("user %s has no sources", user.Username)
+		}
+		keys := make(map[string]bool)
+		for _, source := range user.Sources {
+			if source.Type == "" {
+				return false, fmt.Errorf("user %s has a source without type", user.Username)
+			}
+			if keys[source.Key()] {
+				return false, fmt.Errorf("user %s has more than one source named %s", user.Username, source.Key())
+			}
+			keys[source.Key()] = true
+		}
+		switch user.ReplyModeration {
+		case "", ReplyModerationFollowers, ReplyModerationAll, ReplyModerationNone:
+		default:
+			return false, fmt.Errorf("user %s has an invalid replyModeration setting: %s", user.Username, user.ReplyModeration)
 		}
 	}
 
@@ -139,5 +376,27 @@ func LoadFrom(filepath string) (*Settings, error) {
 	if err = json.Unmarshal(data, &settings); err != nil {
 		return nil, fmt.Errorf("error deserializing settings.json file: %w", err)
 	}
+	if settings.Delivery == nil {
+		settings.Delivery = &Delivery{}
+	}
+	for _, user := range settings.Users {
+		if err = user.convertTwitter(); err != nil {
+			return nil, err
+		}
+	}
 	return &settings, nil
 }
+
+// convertTwitter turns the deprecated Twitter settings into a source.
+func (u *User) convertTwitter() error {
+	if u.Twitter == nil {
+		return nil
+	}
+	options, err := json.Marshal(u.Twitter)
+	if err != nil {
+		return fmt.Errorf("error serializing twitter settings of user %s: %w", u.Username, err)
+	}
+	u.Sources = append(u.Sources, &Source{Type: SourceTypeTwitter, Options: options})
+	u.Twitter = nil
+	return nil
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// SourceCursor remembers where the harvest of one of
+// a user's sources has stopped, so that the next run
+// continues from there.
+type SourceCursor struct {
+	UserID     uid.UserID
+	SourceName string
+
+	// Cursor is opaque to everything but the source.
+	Cursor string
+
+	// The harvest is deferred, e.g. while a rate limit is exhausted.
+	DeferredUntil time.Time
+	UpdatedAt     time.Time
+}
+
+// IsDeferred returns true if the source must not be harvested yet.
+func (c *SourceCursor) IsDeferred() bool {
+	return time.Now().Before(c.DeferredUntil)
+}
+
+// SourceCursor returns the cursor of a user's source. An empty
+// cursor is returned if the source hasn't been harvested yet.
+func (svc *Service) SourceCursor(
+	ctx context.Context,
+	userID uid.UserID,
+	sourceName string,
+) (
+	*SourceCursor, error,
+) {
+	c := &SourceCursor{UserID: userID, SourceName: sourceName}
+	var deferredUntil, updatedAt int64
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT cursor, deferred_until, updated_at FROM %s WHERE user_id=? AND source_name=?",
+		cursorsTable), userID.Int(), sourceName).Scan(
+		&c.Cursor,
+		&deferredUntil,
+		&updatedAt)
+
+	if err == sql.ErrNoRows {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying source cursor: %w", err)
+	}
+	c.DeferredUntil = timeOrZero(deferredUntil)
+	c.UpdatedAt = timeOrZero(updatedAt)
+
+	return c, nil
+}
+
+// SaveSourceCursor inserts or replaces the cursor of a user's source.
+func (svc *Service) SaveSourceCursor(ctx context.Context, c *SourceCursor) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, source_name, cursor, deferred_until, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, source_name) DO UPDATE SET
+			cursor=excluded.cursor,
+			deferred_until=excluded.deferred_until,
+			updated_at=excluded.updated_at`,
+		cursorsTable),
+		c.UserID.Int(),
+		c.SourceName,
+		c.Cursor,
+		unixOrZero(c.DeferredUntil),
+		unixOrZero(c.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", cursorsTable, err)
+	}
+
+	return nil
+}
@@ -3,7 +3,10 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sabertoot/server/internal/uid"
@@ -28,19 +31,168 @@ type Toot struct {
 	SourceType   uid.SourceType
 	SourceID     string
 	SourceData   string
+	Summary      string
+	Sensitive    bool
+	Language     string
+	UpdatedAt    time.Time
+	DeletedAt    time.Time
+	Tags         []*Tag
+	Media        []*Media
+
+	// InReplyToID is the toot which this toot continues,
+	// if it is part of a thread.
+	InReplyToID uid.TootID
+
+	// Kind tells if the toot is an original post, a repost
+	// or a quote of the post at SharedURL.
+	Kind      string
+	SharedURL string
+
+	// Title is the name of an article.
+	Title string
+
+	// SourceName is the key of the user's source
+	// which the toot has been harvested from.
+	SourceName string
+}
+
+// Tag is a mention or hashtag in a toot.
+type Tag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+// Types of tags.
+const (
+	TagMention = "Mention"
+	TagHashtag = "Hashtag"
+)
+
+// Hashtags turns the names of tags, e.g. of front matter or Micropub
+// categories, into hashtags. Names which are URLs, e.g. of people who
+// are tagged in a post, are skipped. There is no page which lists the
+// toots of a hashtag, so they don't link anywhere.
+func Hashtags(names []string) []*Tag {
+	tags := []*Tag{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if strings.Contains(name, "://") {
+			continue
+		}
+		name = strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(name, "#")), ""))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, &Tag{Type: TagHashtag, Name: "#" + name})
+	}
+	return tags
+}
+
+// Kinds of toots.
+const (
+	KindPost    = "post"
+	KindRepost  = "repost"
+	KindQuote   = "quote"
+	KindArticle = "article"
+)
+
+// IsRepost returns true if the toot only shares the post at SharedURL.
+func (t *Toot) IsRepost() bool {
+	return t.Kind == KindRepost
+}
+
+// IsArticle returns true if the toot is a long-form post with a title.
+func (t *Toot) IsArticle() bool {
+	return t.Kind == KindArticle
+}
+
+// IsDeleted returns true if the toot has been deleted at its source.
+func (t *Toot) IsDeleted() bool {
+	return !t.DeletedAt.IsZero()
+}
+
+// IsUpdated returns true if the toot has been edited at its source.
+func (t *Toot) IsUpdated() bool {
+	return !t.UpdatedAt.IsZero()
+}
+
+// Tags are stored as a JSON array.
+func encodeTags(tags []*Tag) (string, error) {
+	if tags == nil {
+		tags = []*Tag{}
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("error serialising tags: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeTags(data string) ([]*Tag, error) {
+	tags := []*Tag{}
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, fmt.Errorf("error deserialising tags: %w", err)
+	}
+	return tags, nil
+}
+
+// Optional timestamps are stored as 0 when they are not set.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0).UTC()
 }
 
 const (
-	tootsTable = "toots"
+	tootsTable      = "toots"
+	followersTable  = "followers"
+	userKeysTable   = "user_keys"
+	remoteKeysTable = "remote_keys"
+	deliveriesTable = "deliveries"
+	tootEditsTable  = "toot_edits"
+	repliesTable    = "replies"
+	reactionsTable  = "reactions"
+	mediaTable      = "media"
+	cursorsTable    = "source_cursors"
+	tokensTable     = "access_tokens"
+	uploadsTable    = "uploads"
 )
 
+func (svc *Service) createTable(ctx context.Context, table string, columns string) error {
+	statement, err := svc.db.PrepareContext(ctx,
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s\n(%s)", table, columns))
+	if err != nil {
+		return fmt.Errorf("error preparing create statement for '%s' table: %w", table, err)
+	}
+	defer statement.Close()
+
+	_, err = statement.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating '%s' table: %w", table, err)
+	}
+
+	return nil
+}
+
 func (svc *Service) InitTables(ctx context.Context) error {
 	// SQLite supported data types:
 	// TEXT, NUMERIC, INTEGER, REAL, BLOB
 
-	statement, err := svc.db.PrepareContext(ctx,
-		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
-		(
+	tables := []struct {
+		name    string
+		columns string
+	}{
+		{tootsTable, `
 			id TEXT PRIMARY KEY,
 			user_id INTEGER NOT NULL,
 			created_at INTEGER NOT NULL,
@@ -49,22 +201,196 @@ func (svc *Service) InitTables(ctx context.Context) error {
 			source_type INTEGER NOT NULL,
 			source_id TEXT NOT NULL,
 			source_data TEXT NOT NULL
-		)`, tootsTable))
+		`},
+		{followersTable, `
+			user_id INTEGER NOT NULL,
+			actor_id TEXT NOT NULL,
+			inbox TEXT NOT NULL,
+			shared_inbox TEXT NOT NULL,
+			follow_id TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, actor_id)
+		`},
+		{userKeysTable, `
+			user_id INTEGER PRIMARY KEY,
+			private_key TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		`},
+		{remoteKeysTable, `
+			key_id TEXT PRIMARY KEY,
+			actor_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			fetched_at INTEGER NOT NULL
+		`},
+		{deliveriesTable, `
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			inbox TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			next_attempt_at INTEGER NOT NULL
+		`},
+		{tootEditsTable, `
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			toot_id TEXT NOT NULL,
+			edited_at INTEGER NOT NULL,
+			text_original TEXT NOT NULL,
+			text_html TEXT NOT NULL,
+			source_data TEXT NOT NULL
+		`},
+		{repliesTable, `
+			id TEXT PRIMARY KEY,
+			toot_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			actor_id TEXT NOT NULL,
+			actor_name TEXT NOT NULL,
+			actor_handle TEXT NOT NULL,
+			actor_url TEXT NOT NULL,
+			content TEXT NOT NULL,
+			url TEXT NOT NULL,
+			published INTEGER NOT NULL
+		`},
+		{reactionsTable, `
+			id TEXT PRIMARY KEY,
+			toot_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			actor_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		`},
+		{mediaTable, `
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			toot_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			mime_type TEXT NOT NULL,
+			file_name TEXT NOT NULL UNIQUE,
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+			alt_text TEXT NOT NULL,
+			source_url TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		`},
+		{cursorsTable, `
+			user_id INTEGER NOT NULL,
+			source_name TEXT NOT NULL,
+			cursor TEXT NOT NULL,
+			deferred_until INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, source_name)
+		`},
+		{tokensTable, `
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			hash TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER NOT NULL
+		`},
+		{uploadsTable, `
+			file_name TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			mime_type TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		`},
+	}
+
+	for _, table := range tables {
+		if err := svc.createTable(ctx, table.name, table.columns); err != nil {
+			return err
+		}
+	}
+
+	// Columns which have been added after a table was first released.
+	// They get added to existing databases on start-up.
+	columns := []struct {
+		table      string
+		name       string
+		definition string
+	}{
+		{tootsTable, "summary", "TEXT NOT NULL DEFAULT ''"},
+		{tootsTable, "sensitive", "INTEGER NOT NULL DEFAULT 0"},
+		{tootsTable, "language", "TEXT NOT NULL DEFAULT ''"},
+		{tootsTable, "updated_at", "INTEGER NOT NULL DEFAULT 0"},
+		{tootsTable, "deleted_at", "INTEGER NOT NULL DEFAULT 0"},
+		{tootsTable, "tags", "TEXT NOT NULL DEFAULT '[]'"},
+		{tootsTable, "in_reply_to", "TEXT NOT NULL DEFAULT ''"},
+		{tootsTable, "kind", "TEXT NOT NULL DEFAULT 'post'"},
+		{tootsTable, "shared_url", "TEXT NOT NULL DEFAULT ''"},
+		// Toots from before sources were configurable all came from Twitter.
+		{tootsTable, "source_name", "TEXT NOT NULL DEFAULT 'twitter'"},
+		{tootsTable, "title", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, column := range columns {
+		if err := svc.addColumn(ctx, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (svc *Service) addColumn(ctx context.Context, table string, column string, definition string) error {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return fmt.Errorf("error preparing create statement for '%s' table: %w", tootsTable, err)
+		return fmt.Errorf("error querying columns of '%s' table: %w", table, err)
 	}
+	defer rows.Close()
 
-	_, err = statement.ExecContext(ctx)
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			dataType     string
+			notNull      int
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("error scanning columns of '%s' table: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating columns of '%s' table: %w", table, err)
+	}
+
+	_, err = svc.db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return fmt.Errorf("error creating '%s' table: %w", tootsTable, err)
+		return fmt.Errorf("error adding column '%s' to '%s' table: %w", column, table, err)
 	}
 
 	return nil
 }
 
+// SaveToot stores a new toot together with its media attachments.
 func (svc *Service) SaveToot(ctx context.Context, t *Toot) error {
-	statement, err := svc.db.PrepareContext(ctx,
-		fmt.Sprintf(`INSERT INTO %s
+	tags, err := encodeTags(t.Tags)
+	if err != nil {
+		return err
+	}
+
+	kind := t.Kind
+	if kind == "" {
+		kind = KindPost
+	}
+
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s
 		(
 			id,
 			user_id,
@@ -73,15 +399,18 @@ func (svc *Service) SaveToot(ctx context.Context, t *Toot) error {
 			text_html,
 			source_type,
 			source_id,
-			source_data
+			source_data,
+			summary,
+			sensitive,
+			language,
+			tags,
+			in_reply_to,
+			kind,
+			shared_url,
+			source_name,
+			title
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, tootsTable))
-	if err != nil {
-		return fmt.Errorf("error preparing insert statement for '%s' table: %w", tootsTable, err)
-	}
-
-	_, err = statement.ExecContext(
-		ctx,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, tootsTable),
 		t.ID.String(),
 		t.UserID.Int(),
 		t.CreatedAt.Unix(),
@@ -89,26 +418,45 @@ func (svc *Service) SaveToot(ctx context.Context, t *Toot) error {
 		t.TextHTML,
 		t.SourceType.Int(),
 		t.SourceID,
-		t.SourceData)
+		t.SourceData,
+		t.Summary,
+		t.Sensitive,
+		t.Language,
+		tags,
+		t.InReplyToID.String(),
+		kind,
+		t.SharedURL,
+		t.SourceName,
+		t.Title)
 	if err != nil {
 		return fmt.Errorf("error inserting into '%s' table: %w", tootsTable, err)
 	}
 
+	if err = saveMedia(ctx, tx, t.ID, t.Media); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
-func (svc *Service) LatestTweetID(ctx context.Context, userID uid.UserID) (string, error) {
+// LatestSourceID returns the source ID of the newest toot which
+// has been harvested from one of the user's sources.
+func (svc *Service) LatestSourceID(ctx context.Context, userID uid.UserID, sourceName string) (string, error) {
 	var id string
 	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
-		"SELECT source_id FROM %s WHERE source_type=? AND user_id=? ORDER BY id DESC LIMIT 1",
-		tootsTable), uid.Twitter, userID.Int()).Scan(&id)
+		"SELECT source_id FROM %s WHERE user_id=? AND source_name=? ORDER BY created_at DESC LIMIT 1",
+		tootsTable), userID.Int(), sourceName).Scan(&id)
 
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("error querying latest tweet id: %w", err)
+		return "", fmt.Errorf("error querying latest source id: %w", err)
 	}
 
 	return id, nil
@@ -117,7 +465,7 @@ func (svc *Service) LatestTweetID(ctx context.Context, userID uid.UserID) (strin
 func (svc *Service) TootCount(ctx context.Context, userID uid.UserID) (int, error) {
 	var count int
 	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
-		"SELECT COUNT(*) FROM %s WHERE user_id=?",
+		"SELECT COUNT(*) FROM %s WHERE user_id=? AND deleted_at=0",
 		tootsTable), userID.Int()).Scan(&count)
 
 	if err != nil {
@@ -127,40 +475,217 @@ func (svc *Service) TootCount(ctx context.Context, userID uid.UserID) (int, erro
 	return count, nil
 }
 
-func (svc *Service) Toots(
-	ctx context.Context,
-	userID uid.UserID,
-	after int64,
-	limit int,
-) (
-	[]*Toot, error,
-) {
-	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
-		"SELECT * FROM %s WHERE user_id=? AND created_at>? ORDER BY created_at DESC LIMIT ?",
-		tootsTable), userID.Int(), after, limit)
-	if err != nil {
-		return nil, fmt.Errorf("error querying toots: %w", err)
-	}
-	defer rows.Close()
+const tootColumns = "id, user_id, created_at, text_original, text_html, source_type, source_id, source_data, summary, sensitive, language, updated_at, deleted_at, tags, in_reply_to, kind, shared_url, source_name, title"
 
+func scanToots(rows *sql.Rows) ([]*Toot, error) {
 	toots := []*Toot{}
 	for rows.Next() {
 		t := &Toot{}
+		var createdAt, updatedAt, deletedAt int64
+		var tags string
 		err := rows.Scan(
 			&t.ID,
 			&t.UserID,
-			&t.CreatedAt,
+			&createdAt,
 			&t.TextOriginal,
 			&t.TextHTML,
 			&t.SourceType,
 			&t.SourceID,
-			&t.SourceData)
+			&t.SourceData,
+			&t.Summary,
+			&t.Sensitive,
+			&t.Language,
+			&updatedAt,
+			&deletedAt,
+			&tags,
+			&t.InReplyToID,
+			&t.Kind,
+			&t.SharedURL,
+			&t.SourceName,
+			&t.Title)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning toot: %w", err)
 		}
+		if t.Tags, err = decodeTags(tags); err != nil {
+			return nil, err
+		}
+		t.CreatedAt = time.Unix(createdAt, 0).UTC()
+		t.UpdatedAt = timeOrZero(updatedAt)
+		t.DeletedAt = timeOrZero(deletedAt)
 
 		toots = append(toots, t)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating toots: %w", err)
+	}
+
+	return toots, nil
+}
+
+// TootCursor is a position in the toots of a user. Toots which have
+// been created in the same second are ordered by their ID, so that
+// pages don't skip any of them.
+type TootCursor struct {
+	CreatedAt int64
+	ID        uid.TootID
+}
+
+// ParseTootCursor parses a cursor in the form "{unix}_{id}". Cursors
+// without an ID are positioned before the first toot of their second.
+func ParseTootCursor(value string) (TootCursor, error) {
+	unix, id, _ := strings.Cut(value, "_")
+	createdAt, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return TootCursor{}, fmt.Errorf("invalid cursor %s: %w", value, err)
+	}
+	return TootCursor{CreatedAt: createdAt, ID: uid.TootID(id)}, nil
+}
+
+// TootCursorOf returns the position of a toot.
+func TootCursorOf(t *Toot) TootCursor {
+	return TootCursor{CreatedAt: t.CreatedAt.Unix(), ID: t.ID}
+}
+
+func (c TootCursor) String() string {
+	if c.ID == "" {
+		return strconv.FormatInt(c.CreatedAt, 10)
+	}
+	return fmt.Sprintf("%d_%s", c.CreatedAt, c.ID)
+}
+
+// Toots returns the oldest toots which come after the given cursor.
+// The result is sorted from newest to oldest.
+func (svc *Service) Toots(
+	ctx context.Context,
+	userID uid.UserID,
+	after TootCursor,
+	limit int,
+) (
+	[]*Toot, error,
+) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT %s FROM %s WHERE user_id=? AND deleted_at=0 AND (created_at>? OR (created_at=? AND id>?))
+		ORDER BY created_at ASC, id ASC LIMIT ?`,
+		tootColumns, tootsTable), userID.Int(), after.CreatedAt, after.CreatedAt, after.ID.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying toots: %w", err)
+	}
+	defer rows.Close()
+
+	toots, err := scanToots(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = svc.attachMedia(ctx, toots); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(toots)-1; i < j; i, j = i+1, j-1 {
+		toots[i], toots[j] = toots[j], toots[i]
+	}
+
 	return toots, nil
 }
+
+// TootsBefore returns the newest toots which come before the given
+// cursor. The result is sorted from newest to oldest.
+func (svc *Service) TootsBefore(
+	ctx context.Context,
+	userID uid.UserID,
+	before TootCursor,
+	limit int,
+) (
+	[]*Toot, error,
+) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT %s FROM %s WHERE user_id=? AND deleted_at=0 AND (created_at<? OR (created_at=? AND id<?))
+		ORDER BY created_at DESC, id DESC LIMIT ?`,
+		tootColumns, tootsTable), userID.Int(), before.CreatedAt, before.CreatedAt, before.ID.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying toots: %w", err)
+	}
+	defer rows.Close()
+
+	toots, err := scanToots(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = svc.attachMedia(ctx, toots); err != nil {
+		return nil, err
+	}
+
+	return toots, nil
+}
+
+// Toot returns a single toot or nil if it does not exist.
+// Deleted toots are returned as well, so they can be served as tombstones.
+func (svc *Service) Toot(ctx context.Context, id uid.TootID) (*Toot, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE id=?",
+		tootColumns, tootsTable), id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error querying toot: %w", err)
+	}
+	defer rows.Close()
+
+	toots, err := scanToots(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toots) == 0 {
+		return nil, nil
+	}
+
+	if err = svc.attachMedia(ctx, toots); err != nil {
+		return nil, err
+	}
+
+	return toots[0], nil
+}
+
+// SourceTootID returns the ID of the toot which has been created from a
+// post at its source. The toot is looked up by its expected ID first and
+// otherwise by the ID of the post, which finds the latest version of an
+// edited post. An empty ID is returned if the toot doesn't exist.
+func (svc *Service) SourceTootID(
+	ctx context.Context,
+	expectedID uid.TootID,
+	userID uid.UserID,
+	sourceType uid.SourceType,
+	sourceID string,
+) (
+	uid.TootID, error,
+) {
+	var id uid.TootID
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT id FROM %s WHERE id=? OR (user_id=? AND source_type=? AND source_id=?) ORDER BY id=? DESC LIMIT 1",
+		tootsTable), expectedID.String(), userID.Int(), sourceType.Int(), sourceID, expectedID.String()).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error querying source toot: %w", err)
+	}
+
+	return id, nil
+}
+
+// ActiveUserCount returns the number of users who tooted since the given time.
+func (svc *Service) ActiveUserCount(ctx context.Context, since time.Time) (int, error) {
+	var count int
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COUNT(DISTINCT user_id) FROM %s WHERE deleted_at=0 AND created_at>=?",
+		tootsTable), since.Unix()).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("error querying active user count: %w", err)
+	}
+
+	return count, nil
+}
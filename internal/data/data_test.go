@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestService(t *testing.T) *Service {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	svc := NewService(db)
+	if err = svc.InitTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func Test_TootsBefore_SameSecond(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	// Five toots of the same second are split across pages of two.
+	createdAt := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := uint64(1); i <= 5; i++ {
+		err := svc.SaveToot(ctx, &Toot{
+			ID:        uid.New(1, uid.Twitter, i),
+			UserID:    1,
+			CreatedAt: createdAt,
+			TextHTML:  "<p>Hello</p>",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[uid.TootID]bool{}
+	cursor := TootCursor{CreatedAt: createdAt.Unix() + 1}
+	for {
+		toots, err := svc.TootsBefore(ctx, 1, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(toots) == 0 {
+			break
+		}
+		for _, toot := range toots {
+			seen[toot.ID] = true
+		}
+		cursor, err = ParseTootCursor(TootCursorOf(toots[len(toots)-1]).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected all 5 toots across pages, got %d", len(seen))
+	}
+
+	// Paging forwards from the oldest toot finds the other four.
+	oldest, err := svc.TootsBefore(ctx, 1, TootCursor{CreatedAt: createdAt.Unix() + 1}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := svc.Toots(ctx, 1, TootCursorOf(oldest[4]), 10)
+	if err != nil || len(newer) != 4 {
+		t.Errorf("expected 4 newer toots, got %d: %v", len(newer), err)
+	}
+}
+
+func Test_Hashtags(t *testing.T) {
+	tags := Hashtags([]string{"Go", "#go", "Open Source", "https://alice.example/", " ", "#"})
+	names := []string{}
+	for _, tag := range tags {
+		if tag.Type != TagHashtag || tag.Href != "" {
+			t.Errorf("unexpected tag: %+v", tag)
+		}
+		names = append(names, tag.Name)
+	}
+	if strings.Join(names, ",") != "#go,#opensource" {
+		t.Errorf("unexpected hashtags: %v", names)
+	}
+}
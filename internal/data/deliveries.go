@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Delivery is an activity which is waiting to be posted to a remote inbox.
+type Delivery struct {
+	ID            int64
+	UserID        uid.UserID
+	Inbox         string
+	Activity      string
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// EnqueueDelivery adds a new delivery to the queue.
+func (svc *Service) EnqueueDelivery(ctx context.Context, d *Delivery) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s
+		(
+			user_id,
+			inbox,
+			activity,
+			attempts,
+			last_error,
+			created_at,
+			next_attempt_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, deliveriesTable),
+		d.UserID.Int(),
+		d.Inbox,
+		d.Activity,
+		d.Attempts,
+		d.LastError,
+		d.CreatedAt.Unix(),
+		d.NextAttemptAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", deliveriesTable, err)
+	}
+
+	return nil
+}
+
+// DueDeliveries returns deliveries whose next attempt is due.
+func (svc *Service) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, user_id, inbox, activity, attempts, last_error, created_at, next_attempt_at
+		FROM %s WHERE next_attempt_at<=? ORDER BY next_attempt_at ASC, id ASC LIMIT ?`,
+		deliveriesTable), now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d := &Delivery{}
+		var createdAt, nextAttemptAt int64
+		err := rows.Scan(
+			&d.ID,
+			&d.UserID,
+			&d.Inbox,
+			&d.Activity,
+			&d.Attempts,
+			&d.LastError,
+			&createdAt,
+			&nextAttemptAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning delivery: %w", err)
+		}
+		d.CreatedAt = time.Unix(createdAt, 0).UTC()
+		d.NextAttemptAt = time.Unix(nextAttemptAt, 0).UTC()
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RescheduleDelivery records a failed attempt and sets the time of the next one.
+func (svc *Service) RescheduleDelivery(ctx context.Context, d *Delivery) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET attempts=?, last_error=?, next_attempt_at=? WHERE id=?",
+		deliveriesTable),
+		d.Attempts,
+		d.LastError,
+		d.NextAttemptAt.Unix(),
+		d.ID)
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", deliveriesTable, err)
+	}
+
+	return nil
+}
+
+// DeleteDelivery removes a delivery from the queue, either because it
+// succeeded or because it has been given up.
+func (svc *Service) DeleteDelivery(ctx context.Context, id int64) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE id=?",
+		deliveriesTable), id)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", deliveriesTable, err)
+	}
+
+	return nil
+}
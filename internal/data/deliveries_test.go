@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_DueDeliveries(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, d := range []struct {
+		inbox string
+		next  time.Duration
+	}{
+		{"https://a.example/inbox", -time.Minute},
+		{"https://b.example/inbox", time.Minute},
+		{"https://c.example/inbox", -2 * time.Minute},
+		{"https://d.example/inbox", 0},
+	} {
+		err := svc.EnqueueDelivery(ctx, &Delivery{
+			UserID:        1,
+			Inbox:         d.inbox,
+			Activity:      `{"type":"Create"}`,
+			CreatedAt:     now.Add(-time.Hour),
+			NextAttemptAt: now.Add(d.next),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// inboxes lists the first letters of the hosts of deliveries.
+	inboxes := func(deliveries []*Delivery) string {
+		s := ""
+		for _, d := range deliveries {
+			s += strings.TrimPrefix(d.Inbox, "https://")[:1]
+		}
+		return s
+	}
+
+	// Deliveries which have been due the longest come first.
+	deliveries, err := svc.DueDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := inboxes(deliveries); s != "cad" {
+		t.Fatalf("unexpected due deliveries: %s", s)
+	}
+	if d := deliveries[0]; d.Activity != `{"type":"Create"}` || !d.CreatedAt.Equal(now.Add(-time.Hour)) || d.Attempts != 0 {
+		t.Errorf("unexpected delivery: %+v", d)
+	}
+	if deliveries, err = svc.DueDeliveries(ctx, now, 2); err != nil || inboxes(deliveries) != "ca" {
+		t.Errorf("unexpected limited deliveries: %s %v", inboxes(deliveries), err)
+	}
+
+	// A rescheduled delivery is due again at its next attempt.
+	failed := deliveries[0]
+	failed.Attempts = 1
+	failed.LastError = "bad status code"
+	failed.NextAttemptAt = now.Add(2 * time.Minute)
+	if err = svc.RescheduleDelivery(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+	if err = svc.DeleteDelivery(ctx, deliveries[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err = svc.DueDeliveries(ctx, now, 10); err != nil || inboxes(deliveries) != "d" {
+		t.Errorf("unexpected due deliveries: %s %v", inboxes(deliveries), err)
+	}
+	if deliveries, err = svc.DueDeliveries(ctx, now.Add(2*time.Minute), 10); err != nil || inboxes(deliveries) != "dbc" {
+		t.Fatalf("unexpected later deliveries: %s %v", inboxes(deliveries), err)
+	}
+	if d := deliveries[2]; d.Attempts != 1 || d.LastError != "bad status code" {
+		t.Errorf("unexpected rescheduled delivery: %+v", d)
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// TootEdit is a previous version of a toot which has been edited.
+type TootEdit struct {
+	ID           int64
+	TootID       uid.TootID
+	EditedAt     time.Time
+	TextOriginal string
+	TextHTML     string
+	SourceData   string
+}
+
+// UpdateToot replaces the content and the media of a toot and
+// keeps the previous version of its text in the edit history.
+func (svc *Service) UpdateToot(ctx context.Context, t *Toot) error {
+	tags, err := encodeTags(t.Tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (toot_id, edited_at, text_original, text_html, source_data)
+		SELECT id, ?, text_original, text_html, source_data FROM %s WHERE id=?`,
+		tootEditsTable, tootsTable),
+		t.UpdatedAt.Unix(),
+		t.ID.String())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", tootEditsTable, err)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET
+			text_original=?,
+			text_html=?,
+			source_id=?,
+			source_data=?,
+			title=?,
+			summary=?,
+			sensitive=?,
+			language=?,
+			tags=?,
+			updated_at=?
+		WHERE id=?`, tootsTable),
+		t.TextOriginal,
+		t.TextHTML,
+		t.SourceID,
+		t.SourceData,
+		t.Title,
+		t.Summary,
+		t.Sensitive,
+		t.Language,
+		tags,
+		t.UpdatedAt.Unix(),
+		t.ID.String())
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", tootsTable, err)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE toot_id=?", mediaTable), t.ID.String())
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", mediaTable, err)
+	}
+	if err = saveMedia(ctx, tx, t.ID, t.Media); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteToot marks a toot as deleted. The row is kept,
+// so that the toot can still be served as a tombstone.
+func (svc *Service) DeleteToot(ctx context.Context, id uid.TootID, deletedAt time.Time) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET deleted_at=? WHERE id=?",
+		tootsTable), deletedAt.Unix(), id.String())
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", tootsTable, err)
+	}
+
+	return nil
+}
+
+// TootEdits returns the previous versions of a toot, sorted from oldest to newest.
+func (svc *Service) TootEdits(ctx context.Context, id uid.TootID) ([]*TootEdit, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, toot_id, edited_at, text_original, text_html, source_data
+		FROM %s WHERE toot_id=? ORDER BY id ASC`,
+		tootEditsTable), id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error querying toot edits: %w", err)
+	}
+	defer rows.Close()
+
+	edits := []*TootEdit{}
+	for rows.Next() {
+		e := &TootEdit{}
+		var editedAt int64
+		err := rows.Scan(
+			&e.ID,
+			&e.TootID,
+			&editedAt,
+			&e.TextOriginal,
+			&e.TextHTML,
+			&e.SourceData)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning toot edit: %w", err)
+		}
+		e.EditedAt = time.Unix(editedAt, 0).UTC()
+
+		edits = append(edits, e)
+	}
+
+	return edits, rows.Err()
+}
+
+// SourceToots returns all toots of a user from the given source which have
+// been created since the given time and haven't been deleted yet.
+// It is used to check harvested toots for changes at their source.
+func (svc *Service) SourceToots(
+	ctx context.Context,
+	userID uid.UserID,
+	sourceName string,
+	since time.Time,
+) (
+	[]*Toot, error,
+) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE user_id=? AND source_name=? AND deleted_at=0 AND created_at>=? ORDER BY created_at DESC",
+		tootColumns, tootsTable), userID.Int(), sourceName, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("error querying toots: %w", err)
+	}
+	defer rows.Close()
+
+	toots, err := scanToots(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = svc.attachMedia(ctx, toots); err != nil {
+		return nil, err
+	}
+
+	return toots, nil
+}
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Follower is a remote actor following one of the local users.
+type Follower struct {
+	UserID      uid.UserID
+	ActorID     string
+	Inbox       string
+	SharedInbox string
+	FollowID    string
+	CreatedAt   time.Time
+}
+
+// SaveFollower stores a follower. If the actor already follows the user
+// then the existing record gets updated.
+func (svc *Service) SaveFollower(ctx context.Context, f *Follower) error {
+	statement, err := svc.db.PrepareContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s
+		(
+			user_id,
+			actor_id,
+			inbox,
+			shared_inbox,
+			follow_id,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, actor_id) DO UPDATE SET
+			inbox=excluded.inbox,
+			shared_inbox=excluded.shared_inbox,
+			follow_id=excluded.follow_id`, followersTable))
+	if err != nil {
+		return fmt.Errorf("error preparing insert statement for '%s' table: %w", followersTable, err)
+	}
+	defer statement.Close()
+
+	_, err = statement.ExecContext(
+		ctx,
+		f.UserID.Int(),
+		f.ActorID,
+		f.Inbox,
+		f.SharedInbox,
+		f.FollowID,
+		f.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", followersTable, err)
+	}
+
+	return nil
+}
+
+// DeleteFollower removes a follower from a user.
+func (svc *Service) DeleteFollower(ctx context.Context, userID uid.UserID, actorID string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE user_id=? AND actor_id=?",
+		followersTable), userID.Int(), actorID)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", followersTable, err)
+	}
+
+	return nil
+}
+
+// Followers returns all followers of a user.
+func (svc *Service) Followers(ctx context.Context, userID uid.UserID) ([]*Follower, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT user_id, actor_id, inbox, shared_inbox, follow_id, created_at FROM %s WHERE user_id=? ORDER BY created_at ASC",
+		followersTable), userID.Int())
+	if err != nil {
+		return nil, fmt.Errorf("error querying followers: %w", err)
+	}
+	defer rows.Close()
+
+	followers := []*Follower{}
+	for rows.Next() {
+		f := &Follower{}
+		var createdAt int64
+		err := rows.Scan(
+			&f.UserID,
+			&f.ActorID,
+			&f.Inbox,
+			&f.SharedInbox,
+			&f.FollowID,
+			&createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning follower: %w", err)
+		}
+		f.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+		followers = append(followers, f)
+	}
+
+	return followers, rows.Err()
+}
+
+// FollowerCount returns the number of followers of a user.
+func (svc *Service) FollowerCount(ctx context.Context, userID uid.UserID) (int, error) {
+	var count int
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s WHERE user_id=?",
+		followersTable), userID.Int()).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("error querying follower count: %w", err)
+	}
+
+	return count, nil
+}
+
+// FollowerIDs returns a page of actor IDs of a user's followers,
+// sorted from the most recent follower to the oldest.
+func (svc *Service) FollowerIDs(
+	ctx context.Context,
+	userID uid.UserID,
+	offset int,
+	limit int,
+) (
+	[]string, error,
+) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT actor_id FROM %s WHERE user_id=? ORDER BY created_at DESC, actor_id ASC LIMIT ? OFFSET ?",
+		followersTable), userID.Int(), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying followers: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning follower: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// DeleteActorFollows removes a remote actor from the followers of all users.
+func (svc *Service) DeleteActorFollows(ctx context.Context, actorID string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE actor_id=?",
+		followersTable), actorID)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", followersTable, err)
+	}
+
+	return nil
+}
+
+// UpdateFollowerInboxes updates the inboxes of a remote actor for all users it follows.
+func (svc *Service) UpdateFollowerInboxes(
+	ctx context.Context,
+	actorID string,
+	inbox string,
+	sharedInbox string,
+) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET inbox=?, shared_inbox=? WHERE actor_id=?",
+		followersTable), inbox, sharedInbox, actorID)
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", followersTable, err)
+	}
+
+	return nil
+}
+
+// MoveFollower transfers all follows of a remote actor to the account it moved to.
+// Follows which the new account already has are kept as they are.
+func (svc *Service) MoveFollower(
+	ctx context.Context,
+	oldActorID string,
+	newActorID string,
+	inbox string,
+	sharedInbox string,
+) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE OR IGNORE %s SET actor_id=?, inbox=?, shared_inbox=? WHERE actor_id=?",
+		followersTable), newActorID, inbox, sharedInbox, oldActorID)
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", followersTable, err)
+	}
+
+	return svc.DeleteActorFollows(ctx, oldActorID)
+}
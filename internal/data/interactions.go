@@ -0,0 +1,277 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Types of reactions to a toot.
+const (
+	ReactionLike     = "Like"
+	ReactionAnnounce = "Announce"
+)
+
+// Reply is a remote Note which has been posted in reply to a toot.
+type Reply struct {
+	ID          string
+	TootID      uid.TootID
+	UserID      uid.UserID
+	ActorID     string
+	ActorName   string
+	ActorHandle string
+	ActorURL    string
+	Content     string
+	URL         string
+	Published   time.Time
+}
+
+// Reaction is a Like or an Announce (boost) of a toot by a remote actor.
+type Reaction struct {
+	ID        string
+	TootID    uid.TootID
+	UserID    uid.UserID
+	ActorID   string
+	Type      string
+	CreatedAt time.Time
+}
+
+// Interactions holds the number of replies, likes and shares of a toot.
+type Interactions struct {
+	Replies int
+	Likes   int
+	Shares  int
+}
+
+// SaveReply stores a reply or replaces a previous version of it.
+// Replies of other actors with the same ID are left untouched.
+func (svc *Service) SaveReply(ctx context.Context, r *Reply) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s
+		(
+			id,
+			toot_id,
+			user_id,
+			actor_id,
+			actor_name,
+			actor_handle,
+			actor_url,
+			content,
+			url,
+			published
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			toot_id=excluded.toot_id,
+			user_id=excluded.user_id,
+			actor_name=excluded.actor_name,
+			actor_handle=excluded.actor_handle,
+			actor_url=excluded.actor_url,
+			content=excluded.content,
+			url=excluded.url,
+			published=excluded.published
+		WHERE actor_id=excluded.actor_id`, repliesTable),
+		r.ID,
+		r.TootID.String(),
+		r.UserID.Int(),
+		r.ActorID,
+		r.ActorName,
+		r.ActorHandle,
+		r.ActorURL,
+		r.Content,
+		r.URL,
+		r.Published.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", repliesTable, err)
+	}
+
+	return nil
+}
+
+// UpdateReplyContent replaces the content of an existing reply.
+func (svc *Service) UpdateReplyContent(ctx context.Context, id string, actorID string, content string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET content=? WHERE id=? AND actor_id=?",
+		repliesTable), content, id, actorID)
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", repliesTable, err)
+	}
+
+	return nil
+}
+
+// DeleteReply removes a reply. Only the author of a reply can delete it.
+func (svc *Service) DeleteReply(ctx context.Context, id string, actorID string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE id=? AND actor_id=?",
+		repliesTable), id, actorID)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", repliesTable, err)
+	}
+
+	return nil
+}
+
+// repliesFilter limits replies to those of followers when onlyFollowers is set.
+func repliesFilter(onlyFollowers bool) string {
+	if !onlyFollowers {
+		return ""
+	}
+	return fmt.Sprintf(
+		" AND actor_id IN (SELECT actor_id FROM %s WHERE %s.user_id=%s.user_id)",
+		followersTable, followersTable, repliesTable)
+}
+
+// Replies returns the replies to a toot, sorted from oldest to newest.
+// If onlyFollowers is set then only replies of the user's followers
+// are returned, which is how replies are moderated.
+func (svc *Service) Replies(ctx context.Context, tootID uid.TootID, onlyFollowers bool) ([]*Reply, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, toot_id, user_id, actor_id, actor_name, actor_handle, actor_url, content, url, published
+		FROM %s WHERE toot_id=?%s ORDER BY published ASC`,
+		repliesTable, repliesFilter(onlyFollowers)), tootID.String())
+	if err != nil {
+		return nil, fmt.Errorf("error querying replies: %w", err)
+	}
+	defer rows.Close()
+
+	replies := []*Reply{}
+	for rows.Next() {
+		r := &Reply{}
+		var published int64
+		err := rows.Scan(
+			&r.ID,
+			&r.TootID,
+			&r.UserID,
+			&r.ActorID,
+			&r.ActorName,
+			&r.ActorHandle,
+			&r.ActorURL,
+			&r.Content,
+			&r.URL,
+			&published)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reply: %w", err)
+		}
+		r.Published = time.Unix(published, 0).UTC()
+
+		replies = append(replies, r)
+	}
+
+	return replies, rows.Err()
+}
+
+// SaveReaction stores a Like or Announce. Duplicates are ignored.
+func (svc *Service) SaveReaction(ctx context.Context, r *Reaction) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT OR IGNORE INTO %s (id, toot_id, user_id, actor_id, type, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, reactionsTable),
+		r.ID,
+		r.TootID.String(),
+		r.UserID.Int(),
+		r.ActorID,
+		r.Type,
+		r.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", reactionsTable, err)
+	}
+
+	return nil
+}
+
+// DeleteReaction removes a Like or Announce. Only the actor who
+// reacted can take it back.
+func (svc *Service) DeleteReaction(ctx context.Context, id string, actorID string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE id=? AND actor_id=?",
+		reactionsTable), id, actorID)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", reactionsTable, err)
+	}
+
+	return nil
+}
+
+// ReactionActors returns the IDs of all actors who reacted to
+// a toot with the given reaction type.
+func (svc *Service) ReactionActors(ctx context.Context, tootID uid.TootID, reactionType string) ([]string, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT actor_id FROM %s WHERE toot_id=? AND type=? ORDER BY created_at ASC",
+		reactionsTable), tootID.String(), reactionType)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reactions: %w", err)
+	}
+	defer rows.Close()
+
+	actors := []string{}
+	for rows.Next() {
+		var actor string
+		if err := rows.Scan(&actor); err != nil {
+			return nil, fmt.Errorf("error scanning reaction: %w", err)
+		}
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+// Interactions returns the number of replies, likes and shares of the given toots.
+func (svc *Service) Interactions(
+	ctx context.Context,
+	tootIDs []uid.TootID,
+	onlyFollowers bool,
+) (
+	map[uid.TootID]*Interactions, error,
+) {
+	result := make(map[uid.TootID]*Interactions)
+	if len(tootIDs) == 0 {
+		return result, nil
+	}
+
+	args := []any{}
+	for _, id := range tootIDs {
+		result[id] = &Interactions{}
+		args = append(args, id.String())
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tootIDs)), ",")
+
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT toot_id, 'Reply', COUNT(*) FROM %s WHERE toot_id IN (%s)%s GROUP BY toot_id
+		UNION ALL
+		SELECT toot_id, type, COUNT(*) FROM %s WHERE toot_id IN (%s) GROUP BY toot_id, type`,
+		repliesTable, placeholders, repliesFilter(onlyFollowers),
+		reactionsTable, placeholders),
+		append(args, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying interactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tootID          uid.TootID
+			interactionType string
+			count           int
+		)
+		if err := rows.Scan(&tootID, &interactionType, &count); err != nil {
+			return nil, fmt.Errorf("error scanning interactions: %w", err)
+		}
+		interactions, ok := result[tootID]
+		if !ok {
+			continue
+		}
+		switch interactionType {
+		case "Reply":
+			interactions.Replies = count
+		case ReactionLike:
+			interactions.Likes = count
+		case ReactionAnnounce:
+			interactions.Shares = count
+		}
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_SaveReply(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	reply := &Reply{
+		ID:          "https://remote.example/notes/1",
+		TootID:      "toot",
+		UserID:      1,
+		ActorID:     "https://remote.example/users/alice",
+		ActorName:   "Alice",
+		ActorHandle: "alice@remote.example",
+		ActorURL:    "https://remote.example/@alice",
+		Content:     "Hello",
+		URL:         "https://remote.example/@alice/1",
+		Published:   time.Unix(1700000000, 0),
+	}
+	if err := svc.SaveReply(ctx, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	// The author can replace the reply, but nobody else can.
+	edited := *reply
+	edited.Content = "Hello again"
+	if err := svc.SaveReply(ctx, &edited); err != nil {
+		t.Fatal(err)
+	}
+	forged := *reply
+	forged.ActorID = "https://evil.example/users/mallory"
+	forged.ActorName = "Mallory"
+	forged.Content = "Forged"
+	if err := svc.SaveReply(ctx, &forged); err != nil {
+		t.Fatal(err)
+	}
+
+	replies, err := svc.Replies(ctx, "toot", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].ActorID != reply.ActorID || replies[0].Content != "Hello again" {
+		t.Errorf("unexpected replies: %+v", replies)
+	}
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// UserKey is the key pair which is used to sign
+// requests on behalf of a local user.
+type UserKey struct {
+	UserID     uid.UserID
+	PrivateKey string
+	PublicKey  string
+	CreatedAt  time.Time
+}
+
+// RemoteKey is a cached public key of a remote actor.
+type RemoteKey struct {
+	KeyID     string
+	ActorID   string
+	PublicKey string
+	FetchedAt time.Time
+}
+
+// UserKey returns the key pair of a user or nil if none has been created yet.
+func (svc *Service) UserKey(ctx context.Context, userID uid.UserID) (*UserKey, error) {
+	k := &UserKey{}
+	var createdAt int64
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT user_id, private_key, public_key, created_at FROM %s WHERE user_id=?",
+		userKeysTable), userID.Int()).Scan(
+		&k.UserID,
+		&k.PrivateKey,
+		&k.PublicKey,
+		&createdAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying user key: %w", err)
+	}
+	k.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+	return k, nil
+}
+
+func (svc *Service) SaveUserKey(ctx context.Context, k *UserKey) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (user_id, private_key, public_key, created_at) VALUES (?, ?, ?, ?)",
+		userKeysTable),
+		k.UserID.Int(),
+		k.PrivateKey,
+		k.PublicKey,
+		k.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", userKeysTable, err)
+	}
+
+	return nil
+}
+
+// RemoteKey returns a cached remote key or nil if it is not cached.
+func (svc *Service) RemoteKey(ctx context.Context, keyID string) (*RemoteKey, error) {
+	k := &RemoteKey{}
+	var fetchedAt int64
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT key_id, actor_id, public_key, fetched_at FROM %s WHERE key_id=?",
+		remoteKeysTable), keyID).Scan(
+		&k.KeyID,
+		&k.ActorID,
+		&k.PublicKey,
+		&fetchedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying remote key: %w", err)
+	}
+	k.FetchedAt = time.Unix(fetchedAt, 0).UTC()
+
+	return k, nil
+}
+
+// SaveRemoteKey caches a remote key, replacing any previously cached
+// version of the same actor. Keys of other actors are kept.
+func (svc *Service) SaveRemoteKey(ctx context.Context, k *RemoteKey) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (key_id, actor_id, public_key, fetched_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key_id) DO UPDATE SET
+			public_key=excluded.public_key,
+			fetched_at=excluded.fetched_at
+		WHERE actor_id=excluded.actor_id`,
+		remoteKeysTable),
+		k.KeyID,
+		k.ActorID,
+		k.PublicKey,
+		k.FetchedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", remoteKeysTable, err)
+	}
+
+	return nil
+}
+
+// DeleteRemoteKeys removes all cached keys of a remote actor.
+func (svc *Service) DeleteRemoteKeys(ctx context.Context, actorID string) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE actor_id=?",
+		remoteKeysTable), actorID)
+	if err != nil {
+		return fmt.Errorf("error deleting from '%s' table: %w", remoteKeysTable, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Types of media attachments.
+const (
+	MediaPhoto = "photo"
+	MediaGIF   = "animated_gif"
+	MediaVideo = "video"
+)
+
+// Media is an image which has been downloaded from a toot's source and
+// is attached to the toot. GIFs and videos are represented by their
+// preview image.
+type Media struct {
+	ID        int64
+	TootID    uid.TootID
+	Position  int
+	Type      string
+	MIMEType  string
+	FileName  string
+	Width     int
+	Height    int
+	AltText   string
+	SourceURL string
+	CreatedAt time.Time
+}
+
+// IsPreview returns true if the media is only a still
+// preview of an animated GIF or a video.
+func (m *Media) IsPreview() bool {
+	return m.Type == MediaGIF || m.Type == MediaVideo
+}
+
+func saveMedia(ctx context.Context, tx *sql.Tx, tootID uid.TootID, media []*Media) error {
+	for i, m := range media {
+		m.TootID = tootID
+		m.Position = i
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = time.Now().UTC()
+		}
+
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s
+			(
+				toot_id,
+				position,
+				type,
+				mime_type,
+				file_name,
+				width,
+				height,
+				alt_text,
+				source_url,
+				created_at
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, mediaTable),
+			m.TootID.String(),
+			m.Position,
+			m.Type,
+			m.MIMEType,
+			m.FileName,
+			m.Width,
+			m.Height,
+			m.AltText,
+			m.SourceURL,
+			m.CreatedAt.Unix())
+		if err != nil {
+			return fmt.Errorf("error inserting into '%s' table: %w", mediaTable, err)
+		}
+		if m.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("error reading media id: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MediaByFileName returns a media attachment by the name of its
+// file or nil if it does not exist.
+func (svc *Service) MediaByFileName(ctx context.Context, fileName string) (*Media, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE file_name=?",
+		mediaColumns, mediaTable), fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error querying media: %w", err)
+	}
+	defer rows.Close()
+
+	media, err := scanMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(media) == 0 {
+		return nil, nil
+	}
+
+	return media[0], nil
+}
+
+const mediaColumns = "id, toot_id, position, type, mime_type, file_name, width, height, alt_text, source_url, created_at"
+
+func scanMedia(rows *sql.Rows) ([]*Media, error) {
+	media := []*Media{}
+	for rows.Next() {
+		m := &Media{}
+		var createdAt int64
+		err := rows.Scan(
+			&m.ID,
+			&m.TootID,
+			&m.Position,
+			&m.Type,
+			&m.MIMEType,
+			&m.FileName,
+			&m.Width,
+			&m.Height,
+			&m.AltText,
+			&m.SourceURL,
+			&createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning media: %w", err)
+		}
+		m.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+		media = append(media, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating media: %w", err)
+	}
+
+	return media, nil
+}
+
+// attachMedia loads the media attachments of the given toots.
+func (svc *Service) attachMedia(ctx context.Context, toots []*Toot) error {
+	if len(toots) == 0 {
+		return nil
+	}
+
+	byID := make(map[uid.TootID]*Toot)
+	args := []any{}
+	for _, t := range toots {
+		t.Media = []*Media{}
+		byID[t.ID] = t
+		args = append(args, t.ID.String())
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(toots)), ",")
+
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE toot_id IN (%s) ORDER BY toot_id, position",
+		mediaColumns, mediaTable, placeholders), args...)
+	if err != nil {
+		return fmt.Errorf("error querying media: %w", err)
+	}
+	defer rows.Close()
+
+	media, err := scanMedia(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range media {
+		if t, ok := byID[m.TootID]; ok {
+			t.Media = append(t.Media, m)
+		}
+	}
+
+	return nil
+}
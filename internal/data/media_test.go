@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func Test_SaveToot_Media(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	createdAt := time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)
+	for i := uint64(1); i <= 2; i++ {
+		toot := &Toot{
+			ID:        uid.New(1, uid.Twitter, i),
+			UserID:    1,
+			CreatedAt: createdAt.Add(time.Duration(i) * time.Minute),
+			TextHTML:  "<p>Photos</p>",
+		}
+		for j := 0; j < int(i); j++ {
+			toot.Media = append(toot.Media, &Media{
+				Type:     MediaPhoto,
+				MIMEType: "image/jpeg",
+				FileName: fmt.Sprintf("%s-%d.jpg", toot.ID, j),
+				Width:    1200,
+				Height:   800,
+				AltText:  "A photo",
+			})
+		}
+		if err := svc.SaveToot(ctx, toot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Media gets attached in order to every toot which is read.
+	toots, err := svc.TootsBefore(ctx, 1, TootCursor{CreatedAt: createdAt.Add(time.Hour).Unix()}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toots) != 2 || len(toots[0].Media) != 2 || len(toots[1].Media) != 1 {
+		t.Fatalf("unexpected toots: %+v", toots)
+	}
+	for i, m := range toots[0].Media {
+		if m.TootID != toots[0].ID || m.Position != i || m.FileName != fmt.Sprintf("%s-%d.jpg", toots[0].ID, i) ||
+			m.Width != 1200 || m.AltText != "A photo" || m.CreatedAt.IsZero() {
+			t.Errorf("unexpected media: %+v", m)
+		}
+	}
+
+	toot, err := svc.Toot(ctx, toots[1].ID)
+	if err != nil || len(toot.Media) != 1 {
+		t.Fatalf("unexpected toot: %+v %v", toot, err)
+	}
+
+	media, err := svc.MediaByFileName(ctx, toot.Media[0].FileName)
+	if err != nil || media == nil || media.TootID != toot.ID || media.MIMEType != "image/jpeg" {
+		t.Errorf("unexpected media: %+v %v", media, err)
+	}
+	if media, err = svc.MediaByFileName(ctx, "missing.jpg"); err != nil || media != nil {
+		t.Errorf("expected no media, got %+v %v", media, err)
+	}
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// AccessToken authorises a client, e.g. a Micropub app, to act on
+// behalf of a user. Only the hash of the secret token is stored.
+type AccessToken struct {
+	ID     string
+	UserID uid.UserID
+	Hash   string
+
+	// ClientID names the app which the token has been issued to.
+	ClientID string
+
+	// Scope is a space separated list of permissions.
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// HasScope returns true if the token grants the given permission.
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range strings.Fields(t.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const tokenColumns = "id, user_id, hash, client_id, scope, created_at, last_used_at"
+
+// SaveAccessToken stores a new access token.
+func (svc *Service) SaveAccessToken(ctx context.Context, t *AccessToken) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		tokensTable, tokenColumns),
+		t.ID,
+		t.UserID.Int(),
+		t.Hash,
+		t.ClientID,
+		t.Scope,
+		t.CreatedAt.Unix(),
+		unixOrZero(t.LastUsedAt))
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", tokensTable, err)
+	}
+
+	return nil
+}
+
+// AccessTokenByHash returns the access token with the
+// given hash or nil if it does not exist.
+func (svc *Service) AccessTokenByHash(ctx context.Context, hash string) (*AccessToken, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE hash=?",
+		tokenColumns, tokensTable), hash)
+	if err != nil {
+		return nil, fmt.Errorf("error querying access token: %w", err)
+	}
+	defer rows.Close()
+
+	tokens, err := scanAccessTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	return tokens[0], nil
+}
+
+// AccessTokens returns all access tokens of a user, newest first.
+func (svc *Service) AccessTokens(ctx context.Context, userID uid.UserID) ([]*AccessToken, error) {
+	rows, err := svc.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE user_id=? ORDER BY created_at DESC, id",
+		tokenColumns, tokensTable), userID.Int())
+	if err != nil {
+		return nil, fmt.Errorf("error querying access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAccessTokens(rows)
+}
+
+// TouchAccessToken records when a token has been used last.
+func (svc *Service) TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET last_used_at=? WHERE id=?",
+		tokensTable), usedAt.Unix(), id)
+	if err != nil {
+		return fmt.Errorf("error updating '%s' table: %w", tokensTable, err)
+	}
+
+	return nil
+}
+
+// DeleteAccessToken revokes an access token of a user. It returns
+// false if the user has no token with the given ID.
+func (svc *Service) DeleteAccessToken(ctx context.Context, userID uid.UserID, id string) (bool, error) {
+	result, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE user_id=? AND id=?",
+		tokensTable), userID.Int(), id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting from '%s' table: %w", tokensTable, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reading deleted rows: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func scanAccessTokens(rows *sql.Rows) ([]*AccessToken, error) {
+	tokens := []*AccessToken{}
+	for rows.Next() {
+		t := &AccessToken{}
+		var createdAt, lastUsedAt int64
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Hash,
+			&t.ClientID,
+			&t.Scope,
+			&createdAt,
+			&lastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning access token: %w", err)
+		}
+		t.CreatedAt = time.Unix(createdAt, 0).UTC()
+		t.LastUsedAt = timeOrZero(lastUsedAt)
+
+		tokens = append(tokens, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
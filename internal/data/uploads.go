@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Upload is a file which has been uploaded to the media endpoint
+// of Micropub. It can be attached to any number of the user's
+// toots, each of which gets its own copy.
+type Upload struct {
+	FileName  string
+	UserID    uid.UserID
+	MIMEType  string
+	CreatedAt time.Time
+}
+
+// SaveUpload stores a new upload.
+func (svc *Service) SaveUpload(ctx context.Context, u *Upload) error {
+	_, err := svc.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (file_name, user_id, mime_type, created_at) VALUES (?, ?, ?, ?)",
+		uploadsTable),
+		u.FileName,
+		u.UserID.Int(),
+		u.MIMEType,
+		u.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("error inserting into '%s' table: %w", uploadsTable, err)
+	}
+
+	return nil
+}
+
+// Upload returns an upload of a user or nil if it does not exist.
+func (svc *Service) Upload(ctx context.Context, userID uid.UserID, fileName string) (*Upload, error) {
+	u := &Upload{}
+	var createdAt int64
+	err := svc.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT file_name, user_id, mime_type, created_at FROM %s WHERE user_id=? AND file_name=?",
+		uploadsTable), userID.Int(), fileName).Scan(
+		&u.FileName,
+		&u.UserID,
+		&u.MIMEType,
+		&createdAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying upload: %w", err)
+	}
+	u.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+	return u, nil
+}
@@ -0,0 +1,244 @@
+// delivery implements a persistent queue for activities
+// which need to be posted to remote inboxes.
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	batchSize = 50
+
+	// Deliveries to different hosts are posted concurrently by
+	// up to this many workers, while each host receives them one
+	// after another.
+	maxConcurrentHosts = 8
+
+	minBackoff = time.Minute
+	maxBackoff = 12 * time.Hour
+
+	attemptTimeout = 30 * time.Second
+)
+
+// Inboxes returns the distinct inboxes of the given followers.
+// A shared inbox is preferred where it exists, so that servers
+// with many followers receive an activity only once.
+func Inboxes(followers []*data.Follower) []string {
+	seen := make(map[string]bool)
+	inboxes := []string{}
+	for _, f := range followers {
+		inbox := f.SharedInbox
+		if inbox == "" {
+			inbox = f.Inbox
+		}
+		if !seen[inbox] {
+			seen[inbox] = true
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	return inboxes
+}
+
+// Enqueue queues an activity for delivery to each of the given inboxes.
+func Enqueue(
+	ctx context.Context,
+	dataService *data.Service,
+	userID uid.UserID,
+	inboxes []string,
+	activity any,
+) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error serialising activity: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, inbox := range inboxes {
+		err = dataService.EnqueueDelivery(ctx, &data.Delivery{
+			UserID:        userID,
+			Inbox:         inbox,
+			Activity:      string(body),
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnqueueForFollowers queues an activity for delivery to all followers of a user.
+func EnqueueForFollowers(
+	ctx context.Context,
+	dataService *data.Service,
+	userID uid.UserID,
+	activity any,
+) error {
+	followers, err := dataService.Followers(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return Enqueue(ctx, dataService, userID, Inboxes(followers), activity)
+}
+
+// Worker posts queued activities and retries failed deliveries
+// with an exponential backoff until they are older than maxAge.
+type Worker struct {
+	dataService *data.Service
+	pubClient   *activitypub.Client
+	keys        map[uid.UserID]*httpsig.Key
+	interval    time.Duration
+	maxAge      time.Duration
+}
+
+func NewWorker(
+	dataService *data.Service,
+	pubClient *activitypub.Client,
+	keys map[uid.UserID]*httpsig.Key,
+	interval time.Duration,
+	maxAge time.Duration,
+) *Worker {
+	return &Worker{
+		dataService: dataService,
+		pubClient:   pubClient,
+		keys:        keys,
+		interval:    interval,
+		maxAge:      maxAge,
+	}
+}
+
+// Run processes the queue until the context gets cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		w.processQueue(ctx)
+
+		select {
+		case <-ctx.Done():
+			plog.Info("Delivery worker stopped.")
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+func (w *Worker) processQueue(ctx context.Context) {
+	for {
+		deliveries, err := w.dataService.DueDeliveries(ctx, time.Now().UTC(), batchSize)
+		if err != nil {
+			plog.Error(err.Error())
+			return
+		}
+
+		w.deliverBatch(ctx, deliveries)
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliverBatch groups deliveries by the host of their inbox, so that
+// a slow or unreachable server only holds up the deliveries to itself.
+func (w *Worker) deliverBatch(ctx context.Context, deliveries []*data.Delivery) {
+	hosts := make(map[string][]*data.Delivery)
+	for _, d := range deliveries {
+		host := inboxHost(d.Inbox)
+		hosts[host] = append(hosts[host], d)
+	}
+
+	slots := make(chan struct{}, maxConcurrentHosts)
+	var wg sync.WaitGroup
+	for _, batch := range hosts {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(batch []*data.Delivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			for _, d := range batch {
+				w.deliver(ctx, d)
+			}
+		}(batch)
+	}
+	wg.Wait()
+}
+
+func inboxHost(inbox string) string {
+	u, err := url.Parse(inbox)
+	if err != nil {
+		return inbox
+	}
+	return u.Host
+}
+
+func (w *Worker) deliver(ctx context.Context, d *data.Delivery) {
+	key, ok := w.keys[d.UserID]
+	if !ok {
+		plog.Errorf("Dropping delivery %d of unknown user %s", d.ID, d.UserID)
+		w.delete(ctx, d)
+		return
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	err := w.pubClient.Deliver(attemptCtx, key, d.Inbox, json.RawMessage(d.Activity))
+	cancel()
+
+	if err == nil {
+		plog.Debugf("Delivered activity to %s", d.Inbox)
+		w.delete(ctx, d)
+		return
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(d.CreatedAt) > w.maxAge {
+		plog.Warningf("Giving up delivery to %s after %d attempts: %v", d.Inbox, d.Attempts+1, err)
+		w.delete(ctx, d)
+		return
+	}
+
+	d.Attempts++
+	d.LastError = err.Error()
+	d.NextAttemptAt = now.Add(backoff(d.Attempts))
+	plog.Warningf("Delivery to %s failed, retrying at %s: %v", d.Inbox, d.NextAttemptAt.Format(time.RFC3339), err)
+
+	if err = w.dataService.RescheduleDelivery(ctx, d); err != nil {
+		plog.Error(err.Error())
+	}
+}
+
+func (w *Worker) delete(ctx context.Context, d *data.Delivery) {
+	if err := w.dataService.DeleteDelivery(ctx, d.ID); err != nil {
+		plog.Error(err.Error())
+	}
+}
+
+// backoff returns the delay before the next attempt, which doubles with
+// every failed attempt and is jittered to spread out retries to the
+// same server.
+func backoff(attempts int) time.Duration {
+	delay := maxBackoff
+	if attempts < 16 {
+		delay = minBackoff << (attempts - 1)
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay / 4)))
+	return delay + jitter
+}
@@ -0,0 +1,123 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/activitypub"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/httpsig"
+	"github.com/sabertoot/server/internal/uid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestService(t *testing.T) *data.Service {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	svc := data.NewService(db)
+	if err = svc.InitTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func Test_Backoff(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		10: 512 * time.Minute,
+		11: maxBackoff,
+		40: maxBackoff,
+	} {
+		for i := 0; i < 100; i++ {
+			if delay := backoff(attempts); delay < expected || delay >= expected+expected/4 {
+				t.Errorf("expected a delay of %s plus jitter after %d attempts, got %s", expected, attempts, delay)
+				break
+			}
+		}
+	}
+}
+
+func Test_Worker_ProcessQueue(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	// The slow server only answers once the other one has
+	// received its delivery, which it doesn't if they're
+	// posted one after another.
+	release := make(chan struct{})
+	var once sync.Once
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			w.WriteHeader(http.StatusAccepted)
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(release) })
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer fast.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	activity := map[string]string{"type": "Create"}
+	if err := Enqueue(ctx, svc, 1, []string{slow.URL + "/inbox", fast.URL + "/inbox", failing.URL + "/inbox"}, activity); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliveries are given up after the maximum age
+	// and dropped for users without a key.
+	now := time.Now().UTC()
+	for _, d := range []*data.Delivery{
+		{UserID: 1, Inbox: failing.URL + "/expired", CreatedAt: now.Add(-48 * time.Hour)},
+		{UserID: 2, Inbox: fast.URL + "/inbox", CreatedAt: now},
+	} {
+		d.Activity = `{"type":"Create"}`
+		d.NextAttemptAt = d.CreatedAt
+		if err := svc.EnqueueDelivery(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	privateKey, err := httpsig.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[uid.UserID]*httpsig.Key{1: {ID: "https://sabertoot.example/users/dustin#main-key", PrivateKey: privateKey}}
+	worker := NewWorker(svc, activitypub.NewClient(), keys, time.Minute, 24*time.Hour)
+	worker.processQueue(ctx)
+
+	// Only the failed delivery is left, and it's retried after a minute.
+	deliveries, err := svc.DueDeliveries(ctx, now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery to be left, got %d", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Inbox != failing.URL+"/inbox" || d.Attempts != 1 || d.LastError == "" {
+		t.Errorf("unexpected delivery: %+v", d)
+	}
+	if delay := d.NextAttemptAt.Sub(now); delay < time.Minute-time.Second || delay > minBackoff*5/4+time.Second {
+		t.Errorf("unexpected delay of the next attempt: %s", delay)
+	}
+}
@@ -0,0 +1,569 @@
+package directory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrontMatter is the metadata at the top of a Markdown file.
+type FrontMatter struct {
+	Title          string
+	Date           time.Time
+	Tags           []string
+	ContentWarning string
+	Sensitive      bool
+	Language       string
+	Media          []*MediaRef
+	Draft          bool
+}
+
+// MediaRef is an image which is attached to a post.
+// Its path is relative to the Markdown file.
+type MediaRef struct {
+	Path string
+	Alt  string
+}
+
+// dateLayouts are the accepted formats of dates.
+// Dates without a time zone are in UTC.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// SplitFrontMatter separates a Markdown file into its front matter and
+// body. YAML front matter is delimited by "---" lines, TOML front matter
+// by "+++" lines. Files without front matter are all body.
+//
+// Only the subset of both formats which is common in front matter is
+// supported, as described by parseYAML and parseTOML. Other syntax is
+// an error rather than being misread.
+func SplitFrontMatter(content string) (*FrontMatter, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var delimiter string
+	switch {
+	case strings.HasPrefix(content, "---\n"):
+		delimiter = "---"
+	case strings.HasPrefix(content, "+++\n"):
+		delimiter = "+++"
+	default:
+		return &FrontMatter{}, content, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		if line == delimiter || (delimiter == "---" && line == "...") {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, "", fmt.Errorf("front matter is not closed by %s", delimiter)
+	}
+
+	var values map[string]any
+	var err error
+	if delimiter == "---" {
+		values, err = parseYAML(lines[1:end])
+	} else {
+		values, err = parseTOML(lines[1:end])
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	fm, err := newFrontMatter(values)
+	if err != nil {
+		return nil, "", err
+	}
+	return fm, strings.Join(lines[end+1:], "\n"), nil
+}
+
+// newFrontMatter picks the known fields from the parsed values.
+// Unknown fields are ignored, so that files can be shared with
+// static site generators.
+func newFrontMatter(values map[string]any) (*FrontMatter, error) {
+	fm := &FrontMatter{}
+	for key, value := range values {
+		var err error
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title = stringValue(value)
+		case "date", "published":
+			fm.Date, err = parseDate(stringValue(value))
+		case "tags", "hashtags":
+			fm.Tags = stringList(value)
+		case "cw", "content_warning", "contentwarning", "summary", "spoiler":
+			fm.ContentWarning = stringValue(value)
+		case "sensitive":
+			fm.Sensitive, err = boolValue(key, value)
+		case "language", "lang":
+			fm.Language = stringValue(value)
+		case "draft":
+			fm.Draft, err = boolValue(key, value)
+		case "media", "images":
+			fm.Media, err = mediaRefs(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fm, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", value)
+}
+
+func stringValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// stringList accepts a list as well as a single
+// value with comma separated entries.
+func stringList(value any) []string {
+	result := []string{}
+	switch v := value.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	case []any:
+		for _, entry := range v {
+			if s := stringValue(entry); s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+func boolValue(key string, value any) (bool, error) {
+	b, err := strconv.ParseBool(stringValue(value))
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return b, nil
+}
+
+// mediaRefs accepts a list of paths as well as a list
+// of tables with a path and an alternative text each.
+func mediaRefs(value any) ([]*MediaRef, error) {
+	entries, ok := value.([]any)
+	if !ok {
+		if s := stringValue(value); s != "" {
+			entries = []any{s}
+		}
+	}
+
+	result := []*MediaRef{}
+	for _, entry := range entries {
+		ref := &MediaRef{}
+		switch v := entry.(type) {
+		case string:
+			ref.Path = v
+		case map[string]any:
+			for key, value := range v {
+				switch strings.ToLower(key) {
+				case "path", "src", "file", "url":
+					ref.Path = stringValue(value)
+				case "alt", "description":
+					ref.Alt = stringValue(value)
+				}
+			}
+		}
+		if ref.Path == "" {
+			return nil, fmt.Errorf("media entry without a path")
+		}
+		result = append(result, ref)
+	}
+	return result, nil
+}
+
+// parseYAML parses the subset of YAML which is common in front matter:
+// scalars, flow sequences, block sequences of scalars or flat mappings,
+// mappings nested one level deep and literal or folded block scalars.
+// All scalars are kept as strings. Anchors, aliases, tags, flow
+// mappings and deeper nesting are not supported.
+func parseYAML(lines []string) (map[string]any, error) {
+	values := make(map[string]any)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if isBlankOrComment(line) {
+			continue
+		}
+		if indentation(line) > 0 {
+			return nil, fmt.Errorf("front matter line %d: unexpected indentation", i+1)
+		}
+
+		key, value, ok := splitYAMLPair(line)
+		if !ok {
+			return nil, fmt.Errorf("front matter line %d: expected key: value", i+1)
+		}
+
+		// Nested values are indented below their key.
+		keyLine := i + 1
+		block := []string{}
+		for i+1 < len(lines) && (isBlankOrComment(lines[i+1]) || indentation(lines[i+1]) > 0 ||
+			strings.HasPrefix(lines[i+1], "- ") || lines[i+1] == "-") {
+			i++
+			block = append(block, lines[i])
+		}
+
+		var err error
+		switch {
+		case value == "|" || value == ">" || value == "|-" || value == ">-":
+			values[key] = yamlBlockScalar(block, value[0] == '>')
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			return nil, fmt.Errorf("front matter line %d: block scalar indicator %s is not supported", keyLine, value)
+		case value != "":
+			if hasContent(block) {
+				return nil, fmt.Errorf("front matter line %d: unexpected nested value of %s", keyLine, key)
+			}
+			values[key], err = yamlValue(value)
+		case isSequence(block):
+			values[key], err = yamlSequence(block)
+		case hasContent(block):
+			values[key], err = yamlMapping(block)
+		default:
+			values[key] = ""
+		}
+		if err != nil {
+			return nil, fmt.Errorf("front matter field %s: %w", key, err)
+		}
+	}
+	return values, nil
+}
+
+func splitYAMLPair(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 || (i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t') {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+// yamlSequence parses a block sequence, whose entries
+// are either scalars or mappings of scalars.
+func yamlSequence(lines []string) ([]any, error) {
+	result := []any{}
+	var current map[string]any
+	itemIndent := -1
+	for _, line := range lines {
+		if isBlankOrComment(line) {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		indent := indentation(line)
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if itemIndent < 0 {
+				itemIndent = indent
+			}
+			if indent != itemIndent {
+				return nil, fmt.Errorf("nested sequences are not supported")
+			}
+			entry := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			current = nil
+			if key, value, ok := splitYAMLPair(entry); ok && !isQuoted(entry) {
+				parsed, err := yamlScalar(value)
+				if err != nil {
+					return nil, err
+				}
+				current = map[string]any{key: parsed}
+				result = append(result, current)
+				continue
+			}
+			parsed, err := yamlScalar(entry)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, parsed)
+			continue
+		}
+
+		// Further keys of a mapping are indented beyond the dash.
+		key, value, ok := splitYAMLPair(trimmed)
+		if current == nil || indent <= itemIndent || !ok {
+			return nil, fmt.Errorf("unexpected line: %s", trimmed)
+		}
+		parsed, err := yamlScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		current[key] = parsed
+	}
+	return result, nil
+}
+
+// yamlMapping reads the pairs of a nested mapping, whose values
+// have to be scalars or flow sequences.
+func yamlMapping(lines []string) (map[string]any, error) {
+	result := make(map[string]any)
+	keyIndent := -1
+	for _, line := range lines {
+		if isBlankOrComment(line) {
+			continue
+		}
+		if keyIndent < 0 {
+			keyIndent = indentation(line)
+		}
+		key, value, ok := splitYAMLPair(strings.TrimSpace(line))
+		if !ok || indentation(line) != keyIndent || value == "" {
+			return nil, fmt.Errorf("only mappings of values nested one level deep are supported")
+		}
+		parsed, err := yamlValue(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = parsed
+	}
+	return result, nil
+}
+
+// yamlBlockScalar joins the lines of a literal block with line breaks
+// or the lines of a folded block with spaces.
+func yamlBlockScalar(lines []string, folded bool) string {
+	parts := []string{}
+	for _, line := range lines {
+		parts = append(parts, strings.TrimSpace(line))
+	}
+	separator := "\n"
+	if folded {
+		separator = " "
+	}
+	return strings.TrimSpace(strings.Join(parts, separator))
+}
+
+func yamlValue(value string) (any, error) {
+	if strings.HasPrefix(value, "[") {
+		return flowList(value, yamlScalar)
+	}
+	return yamlScalar(value)
+}
+
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value, '"')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string: %s", value)
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		// Single quotes are escaped by doubling them.
+		s := value[1:]
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				return b.String(), nil
+			}
+			b.WriteByte(s[i])
+		}
+		return "", fmt.Errorf("unterminated string: %s", value)
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+		if value == "~" || value == "null" {
+			return "", nil
+		}
+		if value != "" && strings.ContainsRune("{&*!|>%@`", rune(value[0])) {
+			return "", fmt.Errorf("unsupported YAML syntax: %s", value)
+		}
+		return value, nil
+	}
+}
+
+// parseTOML parses the subset of TOML which is common in front matter:
+// key/value pairs of strings, booleans, dates, numbers and single line
+// arrays of those, and arrays of tables. Keys of other tables are
+// prefixed with the name of the table. Multi-line strings, inline
+// tables and nested arrays are not supported.
+func parseTOML(lines []string) (map[string]any, error) {
+	values := make(map[string]any)
+	target := values
+	prefix := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]") {
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			table := make(map[string]any)
+			list, _ := values[name].([]any)
+			values[name] = append(list, table)
+			target, prefix = table, ""
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			target, prefix = values, strings.TrimSpace(line[1:len(line)-1])+"."
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("front matter line %d: expected key = value", i+1)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:eq]), `"'`)
+		value, err := tomlValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("front matter field %s: %w", key, err)
+		}
+		target[prefix+key] = value
+	}
+	return values, nil
+}
+
+func tomlValue(value string) (any, error) {
+	if strings.HasPrefix(value, "[") {
+		return flowList(value, tomlScalar)
+	}
+	return tomlScalar(value)
+}
+
+func tomlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''"):
+		return "", fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(value, "{"):
+		return "", fmt.Errorf("inline tables are not supported")
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value, '"')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string: %s", value)
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string: %s", value)
+		}
+		return value[1 : end+1], nil
+	default:
+		if i := strings.Index(value, "#"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// flowList parses a single line list like [a, "b", 'c'].
+func flowList(value string, scalar func(string) (string, error)) ([]any, error) {
+	result := []any{}
+	rest := strings.TrimSpace(value[1:])
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "]") {
+			return result, nil
+		}
+		if rest == "" {
+			return nil, fmt.Errorf("unterminated list: %s", value)
+		}
+
+		// Find the end of the entry, skipping over quoted strings.
+		end := -1
+		switch rest[0] {
+		case '[', '{':
+			return nil, fmt.Errorf("nested lists and tables are not supported: %s", value)
+		case '"', '\'':
+			if q := closingQuote(rest, rest[0]); q >= 0 {
+				end = q + 1 + strings.IndexAny(rest[q+1:], ",]")
+				if end == q {
+					end = -1
+				}
+			}
+		default:
+			end = strings.IndexAny(rest, ",]")
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated list: %s", value)
+		}
+
+		entry, err := scalar(strings.TrimSpace(rest[:end]))
+		if err != nil {
+			return nil, err
+		}
+		if entry != "" {
+			result = append(result, entry)
+		}
+		if rest[end] == ']' {
+			return result, nil
+		}
+		rest = rest[end+1:]
+	}
+}
+
+// closingQuote returns the index of the quote which ends
+// the string at the start of s, or -1.
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func isQuoted(s string) bool {
+	return strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'")
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// isSequence tells whether the first line with content is an entry of a sequence.
+func isSequence(lines []string) bool {
+	for _, line := range lines {
+		if !isBlankOrComment(line) {
+			trimmed := strings.TrimSpace(line)
+			return strings.HasPrefix(trimmed, "- ") || trimmed == "-"
+		}
+	}
+	return false
+}
+
+func hasContent(lines []string) bool {
+	for _, line := range lines {
+		if !isBlankOrComment(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
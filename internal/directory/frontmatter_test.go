@@ -0,0 +1,136 @@
+package directory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_SplitFrontMatter(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		Expected *FrontMatter
+		Body     string
+	}{
+		{
+			Name:     "no front matter",
+			Content:  "# Hello\n\nWorld",
+			Expected: &FrontMatter{},
+			Body:     "# Hello\n\nWorld",
+		},
+		{
+			Name: "YAML",
+			Content: "---\n" +
+				"title: \"Release: 1.0\"\n" +
+				"date: 2023-01-05T10:00:00+01:00\n" +
+				"tags: [release, 'Sabertoot']\n" +
+				"cw: Long read # for the timeline\n" +
+				"lang: en\n" +
+				"draft: false\n" +
+				"unknown:\n" +
+				"  nested: value\n" +
+				"media:\n" +
+				"  - path: images/cat.png\n" +
+				"    alt: 'A cat''s nap'\n" +
+				"  - dog.jpg\n" +
+				"---\n" +
+				"Body\n",
+			Expected: &FrontMatter{
+				Title:          "Release: 1.0",
+				Date:           time.Date(2023, 1, 5, 9, 0, 0, 0, time.UTC),
+				Tags:           []string{"release", "Sabertoot"},
+				ContentWarning: "Long read",
+				Language:       "en",
+				Media:          []*MediaRef{{Path: "images/cat.png", Alt: "A cat's nap"}, {Path: "dog.jpg"}},
+			},
+			Body: "Body\n",
+		},
+		{
+			Name: "YAML block values",
+			Content: "---\n" +
+				"tags:\n" +
+				"- one\n" +
+				"- two\n" +
+				"content_warning: >\n" +
+				"  Spoilers for\n" +
+				"  the movie\n" +
+				"date: 2023-01-05\n" +
+				"sensitive: true\n" +
+				"...\n" +
+				"Body",
+			Expected: &FrontMatter{
+				Date:           time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC),
+				Tags:           []string{"one", "two"},
+				ContentWarning: "Spoilers for the movie",
+				Sensitive:      true,
+			},
+			Body: "Body",
+		},
+		{
+			Name: "TOML",
+			Content: "+++\n" +
+				"title = \"Hello \\\"world\\\"\"\n" +
+				"date = 2023-01-05 12:30\n" +
+				"tags = [\"a, b\", 'c'] # comment\n" +
+				"language = \"de\"\n" +
+				"\n" +
+				"[[media]]\n" +
+				"path = \"cat.png\"\n" +
+				"alt = \"A cat\"\n" +
+				"\n" +
+				"[params]\n" +
+				"title = \"ignored\"\n" +
+				"+++\n" +
+				"Body",
+			Expected: &FrontMatter{
+				Title:    "Hello \"world\"",
+				Date:     time.Date(2023, 1, 5, 12, 30, 0, 0, time.UTC),
+				Tags:     []string{"a, b", "c"},
+				Language: "de",
+				Media:    []*MediaRef{{Path: "cat.png", Alt: "A cat"}},
+			},
+			Body: "Body",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			fm, body, err := SplitFrontMatter(tc.Content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fm, tc.Expected) {
+				t.Errorf("expected\n%+v\ngot\n%+v", tc.Expected, fm)
+			}
+			if body != tc.Body {
+				t.Errorf("expected body %q, got %q", tc.Body, body)
+			}
+		})
+	}
+}
+
+func Test_SplitFrontMatter_Errors(t *testing.T) {
+	for _, content := range []string{
+		"---\ntitle: Unclosed\n",
+		"---\ndate: yesterday\n---\n",
+		"---\ndraft: maybe\n---\n",
+		"---\ntags: [one, two\n---\n",
+		"+++\ntitle\n+++\n",
+		"---\nmedia:\n  - alt: no path\n---\n",
+		// Syntax outside of the supported subset.
+		"---\ntitle: &title Hello\n---\n",
+		"---\ncw: *title\n---\n",
+		"---\ndate: !!timestamp 2023-01-05\n---\n",
+		"---\nparams: {a: b}\n---\n",
+		"---\ncw: |+\n  Spoilers\n---\n",
+		"---\ntags: [[a, b]]\n---\n",
+		"---\nparams:\n  author:\n    name: Dustin\n---\n",
+		"+++\ntitle = \"\"\"\nHello\n\"\"\"\n+++\n",
+		"+++\nparams = { a = 1 }\n+++\n",
+	} {
+		if _, _, err := SplitFrontMatter(content); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// DownloadMedia copies the images which are listed in the front matter
+// of a file into the media directory. Images have to be inside of the
+// source's directory.
+func (s *directorySource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	result := []*data.Media{}
+
+	i, ok := item.(*fileItem)
+	if !ok {
+		return result
+	}
+
+	for _, media := range s.fileMedia(i) {
+		fileName := fmt.Sprintf("%s-%d%s", toot.ID, len(result), strings.ToLower(path.Ext(media.SourceURL)))
+		err := download.CopyFile(s.fullPath(media.SourceURL), s.env.Settings.Storage.MediaFullFilePath(fileName))
+		if err != nil {
+			plog.Errorf("Error copying media of toot %s: %s", toot.ID, err.Error())
+			continue
+		}
+
+		media.FileName = fileName
+		result = append(result, media)
+		plog.Debugf("Media copied for toot %s: %s", toot.ID, fileName)
+	}
+
+	return result
+}
+
+// fileMedia lists the images of the front matter of a file by their path
+// in the directory, so that edits of them can be compared to the toot.
+func (s *directorySource) fileMedia(i *fileItem) []*data.Media {
+	list := []*data.Media{}
+	for _, ref := range i.FrontMatter.Media {
+		rel, err := s.mediaPath(i.Path, ref.Path)
+		if err != nil {
+			plog.Errorf("Error reading media of %s: %s", i.Path, err.Error())
+			continue
+		}
+
+		mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(rel)))
+		if !strings.HasPrefix(mimeType, "image/") {
+			plog.Errorf("Error reading media of %s: %s is not an image", i.Path, rel)
+			continue
+		}
+		mimeType = strings.Split(mimeType, ";")[0]
+
+		mediaType := data.MediaPhoto
+		if mimeType == "image/gif" {
+			mediaType = data.MediaGIF
+		}
+		list = append(list, &data.Media{
+			Type:      mediaType,
+			MIMEType:  mimeType,
+			AltText:   ref.Alt,
+			SourceURL: rel,
+		})
+	}
+	return list
+}
+
+// mediaPath resolves the path of an image relative to the Markdown file
+// which refers to it. Paths which start with a slash are relative to
+// the directory of the source.
+func (s *directorySource) mediaPath(filePath string, ref string) (string, error) {
+	ref = filepath.ToSlash(ref)
+	var rel string
+	if strings.HasPrefix(ref, "/") {
+		rel = path.Clean(strings.TrimPrefix(ref, "/"))
+	} else {
+		rel = path.Join(path.Dir(filePath), ref)
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") || strings.Contains(ref, "://") {
+		return "", fmt.Errorf("media %s is outside of the directory", ref)
+	}
+	return rel, nil
+}
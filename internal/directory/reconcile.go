@@ -0,0 +1,40 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// Reconcile deletes the toots of files which have been removed. Files can
+// be removed at any time, so all toots of the source get checked rather
+// than only the recent ones. Edits are picked up by Fetch.
+func (s *directorySource) Reconcile(ctx context.Context, toots []*data.Toot) (*source.Changes, error) {
+	// Nothing gets deleted while the directory itself is missing,
+	// e.g. because a volume hasn't been mounted.
+	if info, err := os.Stat(s.options.Path); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("directory %s of %s source is not available", s.options.Path, s.name)
+	}
+
+	toots, err := s.env.DataService.SourceToots(ctx, s.env.User.ID, s.name, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	plog.Debugf("Checking %d files of %s for deletions", len(toots), s.options.Path)
+
+	changes := &source.Changes{}
+	for _, toot := range toots {
+		_, err := os.Stat(s.fullPath(sourcePath(toot.SourceID)))
+		if errors.Is(err, fs.ErrNotExist) {
+			changes.Deleted = append(changes.Deleted, toot)
+		}
+	}
+	return changes, nil
+}
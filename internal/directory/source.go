@@ -0,0 +1,304 @@
+// Package directory publishes the Markdown files of a local directory,
+// e.g. a checkout of a repository with announcements. Metadata is taken
+// from YAML or TOML front matter.
+package directory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/markdown"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	SourceType = "directory"
+
+	// The length of the content hash in source IDs.
+	hashLength = 16
+)
+
+// Options of a directory source.
+type Options struct {
+	// Path of the directory, which is searched for
+	// *.md and *.markdown files recursively.
+	Path string `json:"path"`
+}
+
+func init() {
+	source.Register(SourceType, newSource)
+}
+
+// directorySource publishes new Markdown files and the changes of
+// files which have been published before. Hidden files and
+// directories, drafts and files dated in the future are skipped.
+type directorySource struct {
+	env     *source.Env
+	name    string
+	options *Options
+}
+
+func newSource(env *source.Env, cfg *config.Source) (source.Source, error) {
+	var options Options
+	if err := cfg.DecodeOptions(&options); err != nil {
+		return nil, err
+	}
+	if options.Path == "" {
+		return nil, fmt.Errorf("%s source of user %s needs a path", cfg.Key(), env.User.Username)
+	}
+	path, err := filepath.Abs(options.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s source of user %s has an invalid path: %w", cfg.Key(), env.User.Username, err)
+	}
+	options.Path = path
+	return &directorySource{
+		env:     env,
+		name:    cfg.Key(),
+		options: &options,
+	}, nil
+}
+
+// fileItem is a Markdown file which is new or has changed.
+type fileItem struct {
+	// Path is relative to the directory and uses slashes.
+	Path        string       `json:"path"`
+	Hash        string       `json:"hash"`
+	Date        time.Time    `json:"date"`
+	FrontMatter *FrontMatter `json:"frontMatter"`
+	Body        string       `json:"body"`
+}
+
+// cursor maps the paths of all files which have been
+// published to the hash of their published content.
+type cursor struct {
+	Files map[string]string `json:"files"`
+}
+
+// Fetch returns the files which have been added or changed since the
+// last fetch. A changed file maps to the toot of its previous version,
+// which gets updated.
+func (s *directorySource) Fetch(ctx context.Context, value string) (*source.Page, error) {
+	c := &cursor{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), c); err != nil {
+			return nil, fmt.Errorf("error deserializing directory cursor: %w", err)
+		}
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	next := &cursor{Files: make(map[string]string)}
+	items := []*fileItem{}
+	for _, path := range files {
+		content, err := os.ReadFile(s.fullPath(path))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+
+		hash := contentHash(content)
+		if previous, ok := c.Files[path]; ok && previous == hash {
+			next.Files[path] = hash
+			continue
+		}
+
+		// Broken files are skipped until they have been fixed.
+		fm, body, err := SplitFrontMatter(string(content))
+		if err == nil {
+			err = markdown.Validate(body)
+		}
+		if err != nil {
+			plog.Warningf("Skipping %s of %s source: %s", path, s.name, err.Error())
+			if previous, ok := c.Files[path]; ok {
+				next.Files[path] = previous
+			}
+			continue
+		}
+
+		// Drafts and scheduled posts get picked up once they're due,
+		// while published files keep their toot until then.
+		date := fm.Date
+		if date.IsZero() {
+			date = modTime(s.fullPath(path))
+		}
+		if fm.Draft || date.After(now) {
+			if previous, ok := c.Files[path]; ok {
+				next.Files[path] = previous
+			}
+			continue
+		}
+
+		next.Files[path] = hash
+		if date.Before(s.env.User.StartDate) {
+			continue
+		}
+
+		items = append(items, &fileItem{Path: path, Hash: hash, Date: date, FrontMatter: fm, Body: body})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Date.Before(items[j].Date) })
+	plog.Debugf("Directory %s has %d new or changed files", s.options.Path, len(items))
+
+	encoded, err := json.Marshal(next)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing directory cursor: %w", err)
+	}
+
+	page := &source.Page{Cursor: string(encoded)}
+	for _, item := range items {
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+// files returns the relative paths of all Markdown files of the directory.
+func (s *directorySource) files() ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(s.options.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != s.options.Path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !isMarkdown(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.options.Path, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %w", s.options.Path, err)
+	}
+	return files, nil
+}
+
+func (s *directorySource) fullPath(path string) string {
+	return filepath.Join(s.options.Path, filepath.FromSlash(path))
+}
+
+func isMarkdown(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return info.ModTime().UTC()
+}
+
+// TootID derives the ID of the toot from the relative path of a file,
+// so that all versions of a file map to the same toot. A file which is
+// added again after its toot has been deleted gets the ID of the next
+// generation, because other servers remember the IDs of deleted toots.
+func TootID(userID uid.UserID, path string, generation int) uid.TootID {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	if generation > 0 {
+		fmt.Fprintf(h, "\x00%d", generation)
+	}
+	return uid.New(userID, uid.Directory, h.Sum64())
+}
+
+// tootID returns the ID of the toot of a file,
+// skipping the generations which have been deleted.
+func (s *directorySource) tootID(ctx context.Context, path string) (uid.TootID, error) {
+	for generation := 0; ; generation++ {
+		id := TootID(s.env.User.ID, path, generation)
+		toot, err := s.env.DataService.Toot(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if toot == nil || !toot.IsDeleted() {
+			return id, nil
+		}
+	}
+}
+
+// SourceID identifies a version of a file by its path and content hash.
+func SourceID(path string, hash string) string {
+	return path + "@" + hash
+}
+
+// sourcePath returns the path of a file from the source ID of its toot.
+func sourcePath(sourceID string) string {
+	if i := strings.LastIndex(sourceID, "@"); i >= 0 {
+		return sourceID[:i]
+	}
+	return sourceID
+}
+
+func (s *directorySource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	i, ok := item.(*fileItem)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item of directory source: %T", item)
+	}
+
+	sourceData, err := json.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing file %s: %w", i.Path, err)
+	}
+
+	id, err := s.tootID(ctx, i.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fm := i.FrontMatter
+	toot := &data.Toot{
+		ID:         id,
+		UserID:     s.env.User.ID,
+		CreatedAt:  i.Date,
+		SourceType: uid.Directory,
+		SourceID:   SourceID(i.Path, i.Hash),
+		SourceData: string(sourceData),
+		Summary:    fm.ContentWarning,
+		Sensitive:  fm.Sensitive || fm.ContentWarning != "",
+		Language:   fm.Language,
+		Tags:       data.Hashtags(fm.Tags),
+		Kind:       data.KindPost,
+		Media:      s.fileMedia(i),
+	}
+
+	// Files with a title are published as articles.
+	if fm.Title != "" {
+		toot.Kind = data.KindArticle
+		toot.Title = fm.Title
+	}
+
+	toot.TextHTML = sanitize.HTML(markdown.HTML(i.Body))
+	toot.TextOriginal = sanitize.Text(toot.TextHTML)
+	return toot, nil
+}
@@ -0,0 +1,261 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+)
+
+// newTestSource returns a source of an empty temporary directory.
+func newTestSource(t *testing.T) *directorySource {
+	options, _ := json.Marshal(&Options{Path: t.TempDir()})
+	src, err := newSource(sourcetest.NewEnv(t), &config.Source{Type: SourceType, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src.(*directorySource)
+}
+
+func writeFile(t *testing.T, src *directorySource, path string, content string) {
+	fullPath := src.fullPath(path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func itemPaths(page *source.Page) string {
+	paths := []string{}
+	for _, item := range page.Items {
+		paths = append(paths, item.(*fileItem).Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func Test_Source_Fetch(t *testing.T) {
+	src := newTestSource(t)
+	ctx := context.Background()
+
+	writeFile(t, src, "2023/second.md", "---\ndate: 2023-01-06\n---\nSecond")
+	writeFile(t, src, "first.markdown", "+++\ndate = 2023-01-05\n+++\nFirst")
+	writeFile(t, src, "old.md", "---\ndate: 2022-12-24\n---\nBefore the start date")
+	writeFile(t, src, "draft.md", "---\ndate: 2023-01-07\ndraft: true\n---\nNot yet")
+	writeFile(t, src, "scheduled.md", "---\ndate: 2999-01-01\n---\nLater")
+	writeFile(t, src, "broken.md", "---\ndate: soon\n---\nBroken")
+	writeFile(t, src, "table.md", "---\ndate: 2023-01-05\n---\n| a | b |\n|---|---|")
+	writeFile(t, src, ".hidden/secret.md", "Hidden")
+	writeFile(t, src, "notes.txt", "No Markdown")
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(page); paths != "first.markdown,2023/second.md" || page.More {
+		t.Errorf("unexpected items: %s", paths)
+	}
+
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Files) != 3 || c.Files["old.md"] == "" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	// Only changed files are fetched again and
+	// removed files are dropped from the cursor.
+	writeFile(t, src, "first.markdown", "+++\ndate = 2023-01-05\n+++\nFirst, edited")
+	writeFile(t, src, "draft.md", "---\ndate: 2023-01-07\n---\nDone")
+	if err = os.Remove(src.fullPath("old.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = src.Fetch(ctx, page.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(page); paths != "first.markdown,draft.md" {
+		t.Errorf("unexpected items of next fetch: %s", paths)
+	}
+	c = cursor{}
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Files["old.md"]; ok || len(c.Files) != 3 {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+}
+
+func Test_Source_Toot(t *testing.T) {
+	src := newTestSource(t)
+	ctx := context.Background()
+
+	writeFile(t, src, "images/cat.png", "image")
+	writeFile(t, src, "posts/hello.md", "---\n"+
+		"title: Hello\n"+
+		"date: 2023-01-05 10:00\n"+
+		"tags: [Sabertoot, '#News', news]\n"+
+		"cw: Announcement\n"+
+		"language: en\n"+
+		"media:\n"+
+		"  - path: ../images/cat.png\n"+
+		"    alt: A cat\n"+
+		"  - ../../outside.png\n"+
+		"  - notes.txt\n"+
+		"---\n"+
+		"**Sabertoot** is here: <script>alert(1)</script>\n\n- [Docs](https://example.com/docs)\n")
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(page.Items))
+	}
+	item := page.Items[0]
+
+	toot, err := src.Toot(ctx, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := item.(*fileItem).Hash
+	if toot.SourceID != "posts/hello.md@"+hash || toot.ID != TootID(1, "posts/hello.md", 0) {
+		t.Errorf("unexpected IDs: %s, %s", toot.SourceID, toot.ID)
+	}
+	if toot.Kind != data.KindArticle || toot.Title != "Hello" || toot.Language != "en" ||
+		!toot.Sensitive || toot.Summary != "Announcement" ||
+		!toot.CreatedAt.Equal(time.Date(2023, 1, 5, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected toot: %+v", toot)
+	}
+	expected := `<p><strong>Sabertoot</strong> is here: &lt;script&gt;alert(1)&lt;/script&gt;</p>` +
+		`<ul><li><a href="https://example.com/docs" rel="nofollow noopener noreferrer" target="_blank">Docs</a></li></ul>`
+	if toot.TextHTML != expected {
+		t.Errorf("expected HTML\n%s\ngot\n%s", expected, toot.TextHTML)
+	}
+	if len(toot.Tags) != 2 || toot.Tags[0].Name != "#sabertoot" || toot.Tags[1].Name != "#news" {
+		t.Errorf("unexpected tags: %+v", toot.Tags)
+	}
+
+	// Images are listed by their path, so that edits
+	// of the front matter can be compared to the toot.
+	if len(toot.Media) != 1 || toot.Media[0].SourceURL != "images/cat.png" || toot.Media[0].AltText != "A cat" || toot.Media[0].FileName != "" {
+		t.Errorf("unexpected listed media: %+v", toot.Media)
+	}
+
+	media := src.DownloadMedia(ctx, item, toot)
+	if len(media) != 1 {
+		t.Fatalf("expected 1 media, got %d", len(media))
+	}
+	if media[0].AltText != "A cat" || media[0].MIMEType != "image/png" || media[0].SourceURL != "images/cat.png" {
+		t.Errorf("unexpected media: %+v", media[0])
+	}
+	if _, err = os.Stat(src.env.Settings.Storage.MediaFullFilePath(media[0].FileName)); err != nil {
+		t.Errorf("media has not been copied: %v", err)
+	}
+}
+
+func Test_Source_Reconcile(t *testing.T) {
+	src := newTestSource(t)
+	ctx := context.Background()
+
+	writeFile(t, src, "kept.md", "---\ndate: 2023-01-05\n---\nKept")
+	writeFile(t, src, "removed.md", "---\ndate: 2023-01-06\n---\nRemoved")
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourcetest.SaveItems(t, src.env, src, SourceType, page)
+
+	if err = os.Remove(src.fullPath("removed.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Toots outside of the reconcile period are checked as well.
+	changes, err := src.Reconcile(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0].ID != TootID(1, "removed.md", 0) || len(changes.Updated) != 0 {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+
+	// A file which is added again gets a new toot.
+	if err = src.env.DataService.DeleteToot(ctx, changes.Deleted[0].ID, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if page, err = src.Fetch(ctx, page.Cursor); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, src, "removed.md", "---\ndate: 2023-01-06\n---\nRemoved")
+	if page, err = src.Fetch(ctx, page.Cursor); err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(page); paths != "removed.md" {
+		t.Fatalf("unexpected items: %s", paths)
+	}
+	toot := sourcetest.SaveItems(t, src.env, src, SourceType, page)[0]
+	if toot.ID != TootID(1, "removed.md", 1) {
+		t.Errorf("expected a new toot, got %s", toot.ID)
+	}
+
+	// Its edits update the new toot.
+	writeFile(t, src, "removed.md", "---\ndate: 2023-01-06\n---\nAdded again")
+	if page, err = src.Fetch(ctx, page.Cursor); err != nil {
+		t.Fatal(err)
+	}
+	if edited, err := src.Toot(ctx, page.Items[0]); err != nil || edited.ID != toot.ID {
+		t.Errorf("expected the edit of %s, got %+v %v", toot.ID, edited, err)
+	}
+
+	// A missing directory doesn't delete anything.
+	src.options.Path = filepath.Join(src.options.Path, "missing")
+	if changes, err = src.Reconcile(ctx, nil); err == nil || changes != nil {
+		t.Errorf("expected an error, got %+v", changes)
+	}
+}
+
+func Test_Source_EditAfterDelete(t *testing.T) {
+	src := newTestSource(t)
+	ctx := context.Background()
+
+	writeFile(t, src, "hello.md", "---\ndate: 2023-01-05\n---\nHello")
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toot := sourcetest.SaveItems(t, src.env, src, SourceType, page)[0]
+
+	// A toot which is deleted while its file still exists,
+	// e.g. through Micropub, stays deleted until the file
+	// gets edited, which publishes it as a new toot.
+	if err = src.env.DataService.DeleteToot(ctx, toot.ID, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if page, err = src.Fetch(ctx, page.Cursor); err != nil || len(page.Items) != 0 {
+		t.Fatalf("expected no items, got %+v %v", page, err)
+	}
+
+	writeFile(t, src, "hello.md", "---\ndate: 2023-01-05\n---\nHello again")
+	if page, err = src.Fetch(ctx, page.Cursor); err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(page); paths != "hello.md" {
+		t.Fatalf("unexpected items: %s", paths)
+	}
+	edited := sourcetest.SaveItems(t, src.env, src, SourceType, page)[0]
+	if edited.ID != TootID(1, "hello.md", 1) {
+		t.Errorf("expected a new toot, got %s", edited.ID)
+	}
+}
@@ -15,10 +15,20 @@ func File(
 ) error {
 	client := http.DefaultClient
 
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error downloading file: %w", err)
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code downloading file %s: %d", url, resp.StatusCode)
+	}
 
 	file, err := os.Create(path)
 	if err != nil {
@@ -26,7 +36,6 @@ func File(
 	}
 
 	defer file.Close()
-	defer resp.Body.Close()
 
 	_, err = io.Copy(file, resp.Body)
 	if err != nil {
@@ -35,3 +44,24 @@ func File(
 
 	return nil
 }
+
+// CopyFile copies a local file, e.g. an upload or
+// the image of a directory, to path.
+func CopyFile(src string, path string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return fmt.Errorf("error copying file: %w", err)
+	}
+	return nil
+}
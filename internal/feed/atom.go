@@ -0,0 +1,120 @@
+package feed
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/sabertoot/server/internal/sanitize"
+)
+
+type atomFeed struct {
+	Title   atomText     `xml:"title"`
+	Lang    string       `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string     `xml:"id"`
+	Title      atomText   `xml:"title"`
+	Links      []atomLink `xml:"link"`
+	Summary    atomText   `xml:"summary"`
+	Content    atomText   `xml:"content"`
+	Published  string     `xml:"published"`
+	Updated    string     `xml:"updated"`
+	Lang       string     `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+type atomLink struct {
+	Href  string `xml:"href,attr"`
+	Rel   string `xml:"rel,attr"`
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+}
+
+// atomText is a text construct, which holds
+// plain text, escaped HTML or inline XHTML.
+type atomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// HTML returns the text construct as HTML.
+func (t *atomText) HTML() string {
+	switch t.Type {
+	case "html":
+		return strings.TrimSpace(t.Text)
+	case "xhtml":
+		return strings.TrimSpace(t.InnerXML)
+	default:
+		return html.EscapeString(strings.TrimSpace(t.Text))
+	}
+}
+
+// Plain returns the text construct without any markup.
+func (t *atomText) Plain() string {
+	if t.Type == "html" || t.Type == "xhtml" {
+		return sanitize.Text(t.HTML())
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+func parseAtom(body []byte) (*Feed, error) {
+	var doc atomFeed
+	if err := newXMLDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing Atom feed: %w", err)
+	}
+
+	feed := &Feed{
+		Title:    doc.Title.Plain(),
+		Language: doc.Lang,
+		Items:    []*Item{},
+	}
+
+	for _, e := range doc.Entries {
+		item := &Item{
+			GUID:      strings.TrimSpace(e.ID),
+			Title:     e.Title.Plain(),
+			Summary:   e.Summary.HTML(),
+			Content:   e.Content.HTML(),
+			Published: parseDate(e.Published),
+			Language:  e.Lang,
+			Tags:      []string{},
+			Images:    []*Image{},
+		}
+		if item.Published.IsZero() {
+			item.Published = parseDate(e.Updated)
+		}
+		if item.Language == "" {
+			item.Language = feed.Language
+		}
+		for _, link := range e.Links {
+			switch {
+			case (link.Rel == "" || link.Rel == "alternate") && item.Link == "":
+				item.Link = link.Href
+			case link.Rel == "enclosure" && isImage(link.Type):
+				item.Images = append(item.Images, &Image{URL: link.Href, MIMEType: link.Type, Title: link.Title})
+			}
+		}
+		for _, category := range e.Categories {
+			if term := strings.TrimSpace(category.Term); term != "" {
+				item.Tags = append(item.Tags, term)
+			}
+		}
+
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			continue
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	maxFeedBytes = 10 << 20
+
+	// Servers which rate limit without saying for how long
+	// are left alone for a while.
+	defaultRetryAfter = time.Hour
+
+	acceptFeeds = "application/rss+xml, application/atom+xml, application/feed+json, application/json;q=0.9, application/xml;q=0.8, text/xml;q=0.8, */*;q=0.1"
+)
+
+// Response is the result of a conditional GET of a feed.
+type Response struct {
+	// Feed is nil if the feed hasn't been modified.
+	Feed         *Feed
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+type Client struct {
+	httpClient *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Get fetches and parses a feed. The validators of a previous response
+// make it a conditional request, which servers answer with 304 Not
+// Modified if the feed hasn't changed.
+func (c *Client) Get(ctx context.Context, url string, etag string, lastModified string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", acceptFeeds)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return &Response{NotModified: true, ETag: etag, LastModified: lastModified}, nil
+	case http.StatusTooManyRequests:
+		return nil, &source.RateLimitError{Service: "feed " + url, Reset: source.ParseRetryAfter(resp.Header.Get("Retry-After"), defaultRetryAfter)}
+	default:
+		return nil, fmt.Errorf("bad status code fetching %s: %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", url, err)
+	}
+
+	feed, err := Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", url, err)
+	}
+
+	return &Response{
+		Feed:         feed,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
@@ -0,0 +1,145 @@
+// Package feed reads RSS 2.0, Atom and JSON Feed documents,
+// so that their items can be harvested as toots.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Feed is a parsed feed in any of the supported formats.
+type Feed struct {
+	Title    string
+	Language string
+	Items    []*Item
+}
+
+// Item is an entry of a feed. Summary and Content are untrusted HTML.
+type Item struct {
+	// GUID identifies the item, even if its link changes.
+	GUID      string    `json:"guid"`
+	Link      string    `json:"link,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	Published time.Time `json:"published"`
+	Language  string    `json:"language,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Images    []*Image  `json:"images,omitempty"`
+}
+
+// Image is a picture which has been attached to an item.
+type Image struct {
+	URL      string `json:"url"`
+	MIMEType string `json:"mimeType,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// Parse detects the format of a feed and parses it.
+func Parse(body []byte) (*Feed, error) {
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	body = bytes.TrimSpace(body)
+
+	if bytes.HasPrefix(body, []byte("{")) {
+		return parseJSONFeed(body)
+	}
+
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "rss":
+		return parseRSS(body)
+	case "feed":
+		return parseAtom(body)
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+}
+
+// rootElement returns the local name of the document's root element.
+func rootElement(body []byte) (string, error) {
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", errors.New("feed is empty")
+		}
+		if err != nil {
+			return "", fmt.Errorf("error parsing feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func newXMLDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = charsetReader
+	return decoder
+}
+
+// charsetReader converts the few legacy charsets which
+// are still found in feeds into UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	default:
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+}
+
+// Formats of dates which are found in feeds. RSS is meant to use
+// RFC 822, but all sorts of variations are out there.
+var dateFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseDate returns the zero time if the date can't be parsed.
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, format := range dateFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(mimeType), "image/")
+}
@@ -0,0 +1,143 @@
+package feed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFixture(t *testing.T, name string) *Feed {
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := Parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func Test_Parse_RSS(t *testing.T) {
+	feed := parseFixture(t, "rss.xml")
+
+	if feed.Title != "Dusted Codes" || feed.Language != "en-gb" {
+		t.Errorf("unexpected feed: %+v", feed)
+	}
+	if len(feed.Items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(feed.Items))
+	}
+
+	item := feed.Items[1]
+	if item.GUID != "post-42" {
+		t.Errorf("unexpected GUID: %s", item.GUID)
+	}
+	// The <atom:link> must not replace the item's link.
+	if item.Link != "/why-sabertoot" {
+		t.Errorf("unexpected link: %s", item.Link)
+	}
+	if item.Title != "Why I moved to <Sabertoot>" {
+		t.Errorf("unexpected title: %s", item.Title)
+	}
+	if !item.Published.Equal(time.Date(2023, 1, 10, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date: %s", item.Published)
+	}
+	if item.Summary != "<p>Owning your words &amp; more.</p>" {
+		t.Errorf("unexpected summary: %s", item.Summary)
+	}
+	if !strings.HasPrefix(item.Content, "<p>Owning your <em>words</em>.</p>") {
+		t.Errorf("unexpected content: %s", item.Content)
+	}
+	if strings.Join(item.Tags, ",") != "fediverse,indieweb" {
+		t.Errorf("unexpected tags: %v", item.Tags)
+	}
+	if len(item.Images) != 1 || item.Images[0].URL != "/images/cover.png" {
+		t.Errorf("unexpected images: %+v", item.Images)
+	}
+
+	// Items without GUID are identified by their link.
+	item = feed.Items[2]
+	if item.GUID != "https://dusted.codes/no-guid" {
+		t.Errorf("unexpected GUID: %s", item.GUID)
+	}
+	if !item.Published.Equal(time.Date(2023, 1, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date: %s", item.Published)
+	}
+}
+
+func Test_Parse_Atom(t *testing.T) {
+	feed := parseFixture(t, "atom.xml")
+
+	if feed.Title != "Example Blog" || feed.Language != "de" {
+		t.Errorf("unexpected feed: %+v", feed)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(feed.Items))
+	}
+
+	item := feed.Items[0]
+	if item.GUID != "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a" || item.Link != "https://example.org/2023/01/atom" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if item.Title != "Atom <3" {
+		t.Errorf("unexpected title: %s", item.Title)
+	}
+	if item.Summary != "Plain &lt;summary&gt;" {
+		t.Errorf("unexpected summary: %s", item.Summary)
+	}
+	if !strings.Contains(item.Content, "<p>Hello <strong>Atom</strong></p>") {
+		t.Errorf("unexpected content: %s", item.Content)
+	}
+	if !item.Published.Equal(time.Date(2023, 1, 12, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date: %s", item.Published)
+	}
+	if item.Language != "de" || len(item.Images) != 1 || item.Images[0].Title != "A photo" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	item = feed.Items[1]
+	if item.Language != "en" || item.Content != "<p>English</p>" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if !item.Published.Equal(time.Date(2023, 1, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date: %s", item.Published)
+	}
+}
+
+func Test_Parse_JSONFeed(t *testing.T) {
+	feed := parseFixture(t, "feed.json")
+
+	if feed.Title != "Micro Blog" || len(feed.Items) != 2 {
+		t.Fatalf("unexpected feed: %+v", feed)
+	}
+
+	item := feed.Items[0]
+	if item.GUID != "2" || item.Title != "" || item.Language != "en" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if item.Content != "<p>Just a note.</p><p>With two paragraphs &amp; an ampersand.</p>" {
+		t.Errorf("unexpected content: %s", item.Content)
+	}
+
+	item = feed.Items[1]
+	if item.GUID != "https://micro.example/1" || item.Summary != "Summary &lt;b&gt;text&lt;/b&gt;" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if len(item.Images) != 2 || item.Images[1].Title != "Chart" {
+		t.Errorf("unexpected images: %+v", item.Images)
+	}
+}
+
+func Test_Parse_Unsupported(t *testing.T) {
+	for _, body := range []string{
+		`<html><body>Not a feed</body></html>`,
+		`{"version": "1.0", "items": []}`,
+		``,
+	} {
+		if _, err := Parse([]byte(body)); err == nil {
+			t.Errorf("expected error for %q", body)
+		}
+	}
+}
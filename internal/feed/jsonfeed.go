@@ -0,0 +1,119 @@
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/"
+
+type jsonFeed struct {
+	Version  string      `json:"version"`
+	Title    string      `json:"title"`
+	Language string      `json:"language"`
+	Items    []*jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	// IDs are meant to be strings, but some feeds use numbers.
+	ID            json.RawMessage `json:"id"`
+	URL           string          `json:"url"`
+	Title         string          `json:"title"`
+	ContentHTML   string          `json:"content_html"`
+	ContentText   string          `json:"content_text"`
+	Summary       string          `json:"summary"`
+	Image         string          `json:"image"`
+	DatePublished string          `json:"date_published"`
+	DateModified  string          `json:"date_modified"`
+	Language      string          `json:"language"`
+	Tags          []string        `json:"tags"`
+	Attachments   []struct {
+		URL      string `json:"url"`
+		MIMEType string `json:"mime_type"`
+		Title    string `json:"title"`
+	} `json:"attachments"`
+}
+
+func (i *jsonItem) id() string {
+	var id string
+	if err := json.Unmarshal(i.ID, &id); err == nil {
+		return strings.TrimSpace(id)
+	}
+	return strings.TrimSpace(string(i.ID))
+}
+
+func parseJSONFeed(body []byte) (*Feed, error) {
+	var doc jsonFeed
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing JSON feed: %w", err)
+	}
+	if !strings.HasPrefix(doc.Version, jsonFeedVersionPrefix) {
+		return nil, fmt.Errorf("unsupported JSON feed version: %s", doc.Version)
+	}
+
+	feed := &Feed{
+		Title:    strings.TrimSpace(doc.Title),
+		Language: doc.Language,
+		Items:    []*Item{},
+	}
+
+	for _, i := range doc.Items {
+		item := &Item{
+			GUID:      i.id(),
+			Link:      i.URL,
+			Title:     strings.TrimSpace(i.Title),
+			Summary:   html.EscapeString(strings.TrimSpace(i.Summary)),
+			Content:   strings.TrimSpace(i.ContentHTML),
+			Published: parseDate(i.DatePublished),
+			Language:  i.Language,
+			Tags:      []string{},
+			Images:    []*Image{},
+		}
+		if item.Content == "" && i.ContentText != "" {
+			item.Content = textToHTML(i.ContentText)
+		}
+		if item.Published.IsZero() {
+			item.Published = parseDate(i.DateModified)
+		}
+		if item.Language == "" {
+			item.Language = feed.Language
+		}
+		for _, tag := range i.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+		if i.Image != "" {
+			item.Images = append(item.Images, &Image{URL: i.Image})
+		}
+		for _, attachment := range i.Attachments {
+			if isImage(attachment.MIMEType) && attachment.URL != "" {
+				item.Images = append(item.Images, &Image{URL: attachment.URL, MIMEType: attachment.MIMEType, Title: attachment.Title})
+			}
+		}
+
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			continue
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+// textToHTML turns plain text into paragraphs.
+func textToHTML(text string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(p), "\n", "<br>") + "</p>")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type rssDocument struct {
+	Channel struct {
+		Title    string     `xml:"title"`
+		Language string     `xml:"language"`
+		Items    []*rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Elements without a namespace in the tag also match elements of other
+// namespaces, e.g. <atom:link>, so links are told apart by their name.
+type xmlText struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Links       []xmlText `xml:"link"`
+	Description string    `xml:"description"`
+	Content     string    `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	GUID        string    `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Date        string    `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories  []string  `xml:"category"`
+	Enclosures  []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	MediaContents []struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Medium string `xml:"medium,attr"`
+		Title  string `xml:"http://search.yahoo.com/mrss/ title"`
+	} `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+func parseRSS(body []byte) (*Feed, error) {
+	var doc rssDocument
+	if err := newXMLDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing RSS feed: %w", err)
+	}
+
+	feed := &Feed{
+		Title:    strings.TrimSpace(doc.Channel.Title),
+		Language: strings.TrimSpace(doc.Channel.Language),
+		Items:    []*Item{},
+	}
+
+	for _, i := range doc.Channel.Items {
+		item := &Item{
+			Title:     strings.TrimSpace(i.Title),
+			Summary:   strings.TrimSpace(i.Description),
+			Content:   strings.TrimSpace(i.Content),
+			Published: parseDate(i.PubDate),
+			Language:  feed.Language,
+			Tags:      []string{},
+			Images:    []*Image{},
+		}
+		if item.Published.IsZero() {
+			item.Published = parseDate(i.Date)
+		}
+		for _, link := range i.Links {
+			if link.XMLName.Space == "" && strings.TrimSpace(link.Value) != "" {
+				item.Link = strings.TrimSpace(link.Value)
+				break
+			}
+		}
+		for _, category := range i.Categories {
+			if category = strings.TrimSpace(category); category != "" {
+				item.Tags = append(item.Tags, category)
+			}
+		}
+		for _, enclosure := range i.Enclosures {
+			if isImage(enclosure.Type) && enclosure.URL != "" {
+				item.Images = append(item.Images, &Image{URL: enclosure.URL, MIMEType: enclosure.Type})
+			}
+		}
+		for _, media := range i.MediaContents {
+			if (media.Medium == "image" || isImage(media.Type)) && media.URL != "" {
+				item.Images = append(item.Images, &Image{URL: media.URL, MIMEType: media.Type, Title: media.Title})
+			}
+		}
+
+		// The GUID is optional, so the link has to do without it.
+		item.GUID = strings.TrimSpace(i.GUID)
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			continue
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
@@ -0,0 +1,285 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	SourceType = "feed"
+
+	// How items are turned into toots.
+	ContentSummary = "summary"
+	ContentFull    = "full"
+
+	// Summaries are cut off, so that they read like a toot.
+	maxSummaryRunes = 400
+	maxImages       = 4
+)
+
+// Options of a feed source.
+type Options struct {
+	URL string `json:"url"`
+
+	// Content is either "summary" (default), which posts the title, a
+	// short summary and a link, or "full", which posts the full content
+	// of an item as an article.
+	Content string `json:"content,omitempty"`
+}
+
+func init() {
+	source.Register(SourceType, newSource)
+}
+
+// feedSource harvests the items of an RSS, Atom or JSON feed.
+type feedSource struct {
+	env     *source.Env
+	options *Options
+	client  *Client
+}
+
+func newSource(env *source.Env, cfg *config.Source) (source.Source, error) {
+	var options Options
+	if err := cfg.DecodeOptions(&options); err != nil {
+		return nil, err
+	}
+	if options.URL == "" {
+		return nil, fmt.Errorf("%s source of user %s needs a url", cfg.Key(), env.User.Username)
+	}
+	switch options.Content {
+	case "":
+		options.Content = ContentSummary
+	case ContentSummary, ContentFull:
+	default:
+		return nil, fmt.Errorf("%s source of user %s has an invalid content setting: %s", cfg.Key(), env.User.Username, options.Content)
+	}
+	return &feedSource{
+		env:     env,
+		options: &options,
+		client:  NewClient(),
+	}, nil
+}
+
+// cursor holds the validators of the last response.
+type cursor struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// Fetch returns all items of the feed which have been published after
+// the user's start date. Items which show up again map to the same toot,
+// because its ID is derived from the item's GUID.
+func (s *feedSource) Fetch(ctx context.Context, value string) (*source.Page, error) {
+	c := &cursor{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), c); err != nil {
+			return nil, fmt.Errorf("error deserializing feed cursor: %w", err)
+		}
+	}
+
+	resp, err := s.client.Get(ctx, s.options.URL, c.ETag, c.LastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.NotModified {
+		plog.Debugf("Feed has not been modified: %s", s.options.URL)
+		return &source.Page{Cursor: value}, nil
+	}
+
+	items := []*Item{}
+	for _, item := range resp.Feed.Items {
+		if !item.Published.IsZero() && item.Published.Before(s.env.User.StartDate) {
+			continue
+		}
+		s.resolveURLs(item)
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Published.Before(items[j].Published) })
+	plog.Debugf("Feed %s has %d items since the start date", s.options.URL, len(items))
+
+	encoded, err := json.Marshal(&cursor{ETag: resp.ETag, LastModified: resp.LastModified})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing feed cursor: %w", err)
+	}
+
+	page := &source.Page{Cursor: string(encoded)}
+	for _, item := range items {
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+// resolveURLs turns relative links and images into absolute ones.
+func (s *feedSource) resolveURLs(item *Item) {
+	base, err := url.Parse(s.options.URL)
+	if err != nil {
+		return
+	}
+	resolve := func(ref string) string {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+	if item.Link != "" {
+		item.Link = resolve(item.Link)
+	}
+	for _, image := range item.Images {
+		image.URL = resolve(image.URL)
+	}
+}
+
+// TootID derives the ID of the toot from the GUID of an item.
+func TootID(userID uid.UserID, guid string) uid.TootID {
+	h := fnv.New64a()
+	h.Write([]byte(guid))
+	return uid.New(userID, uid.Feed, h.Sum64())
+}
+
+func (s *feedSource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	i, ok := item.(*Item)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item of feed source: %T", item)
+	}
+
+	sourceData, err := json.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing feed item: %w", err)
+	}
+
+	createdAt := i.Published
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	toot := &data.Toot{
+		ID:         TootID(s.env.User.ID, i.GUID),
+		UserID:     s.env.User.ID,
+		CreatedAt:  createdAt,
+		SourceType: uid.Feed,
+		SourceID:   i.GUID,
+		SourceData: string(sourceData),
+		Language:   i.Language,
+		Tags:       []*data.Tag{},
+		Kind:       data.KindPost,
+	}
+
+	content := i.Content
+	if content == "" {
+		content = i.Summary
+	}
+
+	if s.options.Content == ContentFull && content != "" {
+		// Articles need a title, everything else is a note,
+		// e.g. the posts of a microblog.
+		if i.Title != "" {
+			toot.Kind = data.KindArticle
+			toot.Title = i.Title
+		}
+		toot.TextHTML = sanitize.HTML(content)
+		toot.TextOriginal = sanitize.Text(toot.TextHTML)
+		return toot, nil
+	}
+
+	summary := i.Summary
+	if summary == "" {
+		summary = i.Content
+	}
+	text := truncate(sanitize.Text(summary), maxSummaryRunes)
+
+	var b strings.Builder
+	original := []string{}
+	if i.Title != "" {
+		b.WriteString("<p><strong>" + html.EscapeString(i.Title) + "</strong></p>")
+		original = append(original, i.Title)
+	}
+	for _, p := range sanitize.Paragraphs(text) {
+		b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(p), "\n", "<br>") + "</p>")
+	}
+	if text != "" {
+		original = append(original, text)
+	}
+	if i.Link != "" {
+		fmt.Fprintf(&b, `<p><a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a></p>`,
+			html.EscapeString(i.Link), html.EscapeString(i.Link))
+		original = append(original, i.Link)
+	}
+	toot.TextHTML = b.String()
+	toot.TextOriginal = strings.Join(original, "\n\n")
+
+	return toot, nil
+}
+
+func truncate(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:maxRunes-1])) + "…"
+}
+
+// DownloadMedia downloads the images which have been attached to an item.
+func (s *feedSource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	result := []*data.Media{}
+
+	i, ok := item.(*Item)
+	if !ok {
+		return result
+	}
+
+	for _, image := range i.Images {
+		if len(result) == maxImages {
+			break
+		}
+
+		ext := ".jpg"
+		if parsedURL, err := url.Parse(image.URL); err == nil && path.Ext(parsedURL.Path) != "" {
+			ext = path.Ext(parsedURL.Path)
+		}
+		mimeType := image.MIMEType
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(ext)
+		}
+		if !isImage(mimeType) {
+			plog.Warningf("Skipping media of toot %s which is not an image: %s", toot.ID, image.URL)
+			continue
+		}
+
+		fileName := fmt.Sprintf("%s-%d%s", toot.ID, len(result), ext)
+		err := download.File(ctx, image.URL, s.env.Settings.Storage.MediaFullFilePath(fileName))
+		if err != nil {
+			plog.Errorf("Error downloading media of toot %s: %s", toot.ID, err.Error())
+			continue
+		}
+
+		result = append(result, &data.Media{
+			Type:      data.MediaPhoto,
+			MIMEType:  mimeType,
+			FileName:  fileName,
+			AltText:   image.Title,
+			SourceURL: image.URL,
+		})
+		plog.Debugf("Media downloaded for toot %s: %s", toot.ID, fileName)
+	}
+
+	return result
+}
@@ -0,0 +1,189 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source"
+)
+
+const testETag = `"v1"`
+
+// newTestSource returns a source of a feed which is served with an ETag
+// and answered with 304 Not Modified when the ETag is sent back.
+func newTestSource(t *testing.T, fixture string, content string, requests *[]*http.Request) *feedSource {
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+		if r.Header.Get("If-None-Match") == testETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", "Tue, 10 Jan 2023 18:30:00 GMT")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	user := &config.User{ID: 1, Username: "dustin", StartDate: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)}
+	options, _ := json.Marshal(&Options{URL: server.URL + "/feed/rss", Content: content})
+	src, err := newSource(&source.Env{User: user}, &config.Source{Type: SourceType, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src.(*feedSource)
+}
+
+func Test_Source_Fetch(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, "rss.xml", "", &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items before the start date are skipped
+	// and the rest is sorted from oldest to newest.
+	guids := []string{}
+	for _, item := range page.Items {
+		guids = append(guids, item.(*Item).GUID)
+	}
+	if strings.Join(guids, ",") != "https://dusted.codes/no-guid,post-42" {
+		t.Errorf("unexpected items: %v", guids)
+	}
+	if page.More {
+		t.Error("feeds have a single page")
+	}
+
+	item := page.Items[1].(*Item)
+	if !strings.HasSuffix(item.Link, "/why-sabertoot") || !strings.HasPrefix(item.Link, "http://127.0.0.1") {
+		t.Errorf("relative link has not been resolved: %s", item.Link)
+	}
+	if !strings.HasSuffix(item.Images[0].URL, "/images/cover.png") || !strings.HasPrefix(item.Images[0].URL, "http://") {
+		t.Errorf("relative image has not been resolved: %s", item.Images[0].URL)
+	}
+
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ETag != testETag || c.LastModified == "" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	// The next fetch is a conditional request.
+	next, err := src.Fetch(ctx, page.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") != testETag || requests[1].Header.Get("If-Modified-Since") == "" {
+		t.Fatalf("expected a conditional request, got %v", requests[len(requests)-1].Header)
+	}
+	if len(next.Items) != 0 || next.Cursor != page.Cursor {
+		t.Errorf("unexpected page of unmodified feed: %+v", next)
+	}
+}
+
+func Test_Source_Toot_Summary(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, "rss.xml", ContentSummary, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toot, err := src.Toot(ctx, page.Items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if toot.ID != TootID(1, "post-42") || toot.SourceID != "post-42" || toot.Kind != data.KindPost {
+		t.Errorf("unexpected toot: %+v", toot)
+	}
+	if toot.Language != "en-gb" || !toot.CreatedAt.Equal(time.Date(2023, 1, 10, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected toot: %+v", toot)
+	}
+	if !strings.HasPrefix(toot.TextHTML, "<p><strong>Why I moved to &lt;Sabertoot&gt;</strong></p><p>Owning your words &amp; more.</p><p><a href=\"http://") {
+		t.Errorf("unexpected HTML: %s", toot.TextHTML)
+	}
+
+	// An item which shows up again maps to the same toot.
+	again, err := src.Toot(ctx, page.Items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != toot.ID {
+		t.Errorf("expected the same toot ID, got %s and %s", toot.ID, again.ID)
+	}
+}
+
+func Test_Source_Toot_Full(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, "feed.json", ContentFull, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(page.Items))
+	}
+
+	article, err := src.Toot(ctx, page.Items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Kind != data.KindArticle || article.Title != "A titled post" {
+		t.Errorf("unexpected article: %+v", article)
+	}
+	if article.TextHTML != "<p>Full <b>content</b></p>" || article.TextOriginal != "Full content" {
+		t.Errorf("unexpected content: %q, %q", article.TextHTML, article.TextOriginal)
+	}
+
+	// Items without a title are notes.
+	note, err := src.Toot(ctx, page.Items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Kind != data.KindPost || note.Title != "" {
+		t.Errorf("unexpected note: %+v", note)
+	}
+}
+
+func Test_Source_Fetch_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	options, _ := json.Marshal(&Options{URL: server.URL + "/feed/rss"})
+	src, err := newSource(&source.Env{User: &config.User{ID: 1, Username: "dustin"}}, &config.Source{Type: SourceType, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The harvester defers the source until the server's reset.
+	_, err = src.Fetch(context.Background(), "")
+	if reset, ok := source.RetryAfter(err); !ok || time.Until(reset) < time.Minute {
+		t.Errorf("expected the source to be deferred, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+// httpsig implements signing and verification of HTTP requests as
+// specified by draft-cavage-http-signatures, which is the flavour of
+// HTTP Signatures that Mastodon and most of the Fediverse speak.
+package httpsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "rsa-sha256"
+	keyBits   = 2048
+
+	// Signed requests may be a few hours old, e.g. when they've been
+	// queued by a proxy, but only slightly ahead of the local clock.
+	maxSignatureAge = 12 * time.Hour
+	maxClockSkew    = 1 * time.Hour
+)
+
+// Key is a private key which is used to sign outgoing requests
+// on behalf of a local actor.
+type Key struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+}
+
+// PublicKeyPEM returns the PEM encoded public key.
+func (k *Key) PublicKeyPEM() (string, error) {
+	return EncodePublicKey(&k.PrivateKey.PublicKey)
+}
+
+// GenerateKey creates a new RSA private key.
+func GenerateKey() (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, fmt.Errorf("error generating RSA key: %w", err)
+	}
+	return key, nil
+}
+
+// EncodePrivateKey returns a private key as a PEM encoded PKCS#8 block.
+func EncodePrivateKey(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("error encoding private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// EncodePublicKey returns a public key as a PEM encoded PKIX block.
+func EncodePublicKey(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("error encoding public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePrivateKey decodes a PEM encoded PKCS#1 or PKCS#8 RSA private key.
+func ParsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("error decoding private key: no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// ParsePublicKey decodes a PEM encoded PKIX or PKCS#1 RSA public key.
+func ParsePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("error decoding public key: no PEM block found")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// Digest returns the value of the Digest header for the given body.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Sign adds the Date, Digest (when a body is present)
+// and Signature headers to a request.
+func Sign(req *http.Request, key *Key, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", Digest(body))
+		headers = append(headers, "digest")
+	}
+
+	signingString, err := buildSigningString(req, headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("error signing request: %w", err)
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		key.ID,
+		algorithm,
+		strings.Join(headers, " "),
+		base64.StdEncoding.EncodeToString(signature)))
+
+	return nil
+}
+
+// Signature is a parsed Signature header.
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+}
+
+// ParseSignature parses the Signature header of a request.
+func ParseSignature(req *http.Request) (*Signature, error) {
+	value := req.Header.Get("Signature")
+	if value == "" {
+		return nil, fmt.Errorf("request is not signed")
+	}
+
+	sig := &Signature{Headers: []string{"date"}}
+	for _, param := range splitParams(value) {
+		name, val, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		val = strings.Trim(val, `"`)
+		switch strings.TrimSpace(name) {
+		case "keyId":
+			sig.KeyID = val
+		case "algorithm":
+			sig.Algorithm = val
+		case "headers":
+			sig.Headers = strings.Fields(strings.ToLower(val))
+		case "signature":
+			decoded, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding signature: %w", err)
+			}
+			sig.Signature = decoded
+		}
+	}
+
+	if sig.KeyID == "" || len(sig.Signature) == 0 {
+		return nil, fmt.Errorf("signature is missing keyId or signature")
+	}
+
+	return sig, nil
+}
+
+// Verify checks the signature against the given public key and also
+// validates the Date header and, when the body is signed, the Digest.
+func (sig *Signature) Verify(req *http.Request, body []byte, key *rsa.PublicKey) error {
+	if sig.Algorithm != "" && sig.Algorithm != algorithm && sig.Algorithm != "hs2019" {
+		return fmt.Errorf("unsupported signature algorithm: %s", sig.Algorithm)
+	}
+
+	if !contains(sig.Headers, "(request-target)") {
+		return fmt.Errorf("signature does not cover (request-target)")
+	}
+
+	// Without a signed date, a signature could be replayed forever.
+	if !contains(sig.Headers, "date") {
+		return fmt.Errorf("signature does not cover the date")
+	}
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("invalid Date header: %w", err)
+	}
+	age := time.Since(date)
+	if age > maxSignatureAge || age < -maxClockSkew {
+		return fmt.Errorf("Date header is out of range: %s", date)
+	}
+
+	if body != nil {
+		if !contains(sig.Headers, "digest") {
+			return fmt.Errorf("signature does not cover the digest")
+		}
+		if !verifyDigest(req.Header.Get("Digest"), body) {
+			return fmt.Errorf("digest does not match body")
+		}
+	}
+
+	signingString, err := buildSigningString(req, sig.Headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig.Signature); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	return nil
+}
+
+func verifyDigest(header string, body []byte) bool {
+	expected := Digest(body)
+	for _, value := range strings.Split(header, ",") {
+		algo, digest, ok := strings.Cut(strings.TrimSpace(value), "=")
+		if ok && strings.EqualFold(algo, "SHA-256") && "SHA-256="+digest == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func buildSigningString(req *http.Request, headers []string) (string, error) {
+	var buffer bytes.Buffer
+	for i, header := range headers {
+		if i > 0 {
+			buffer.WriteString("\n")
+		}
+		switch header {
+		case "(request-target)":
+			fmt.Fprintf(&buffer, "(request-target): %s %s",
+				strings.ToLower(req.Method),
+				req.URL.RequestURI())
+		case "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			fmt.Fprintf(&buffer, "host: %s", host)
+		default:
+			values := req.Header.Values(header)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header '%s' is missing", header)
+			}
+			fmt.Fprintf(&buffer, "%s: %s", header, strings.Join(values, ", "))
+		}
+	}
+	return buffer.String(), nil
+}
+
+// splitParams splits the comma separated parameters of a Signature
+// header, ignoring commas inside quoted values.
+func splitParams(value string) []string {
+	params := []string{}
+	quoted := false
+	start := 0
+	for i, c := range value {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, value[start:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
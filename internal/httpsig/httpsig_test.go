@@ -0,0 +1,119 @@
+package httpsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SignAndVerify(t *testing.T) {
+	privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{ID: "https://example.com/users/alice#main-key", PrivateKey: privateKey}
+
+	testCases := []struct {
+		Name     string
+		Body     []byte
+		Tamper   func(r *http.Request)
+		Expected bool
+	}{
+		{"signed GET", nil, nil, true},
+		{"signed POST", []byte(`{"type":"Follow"}`), nil, true},
+		{"tampered digest", []byte(`{"type":"Follow"}`), func(r *http.Request) {
+			r.Header.Set("Digest", Digest([]byte(`{"type":"Delete"}`)))
+		}, false},
+		{"tampered path", nil, func(r *http.Request) {
+			r.URL.Path = "/users/bob/inbox"
+		}, false},
+	}
+
+	for _, testCase := range testCases {
+		method := http.MethodGet
+		if testCase.Body != nil {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, "https://example.com/users/alice/inbox", bytes.NewReader(testCase.Body))
+		if err = Sign(req, key, testCase.Body); err != nil {
+			t.Fatalf("%s: %v", testCase.Name, err)
+		}
+		if testCase.Tamper != nil {
+			testCase.Tamper(req)
+		}
+
+		sig, err := ParseSignature(req)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.Name, err)
+		}
+		if sig.KeyID != key.ID {
+			t.Errorf("%s: Expected key ID %s, Actual %s", testCase.Name, key.ID, sig.KeyID)
+		}
+
+		err = sig.Verify(req, testCase.Body, &privateKey.PublicKey)
+		if actual := err == nil; actual != testCase.Expected {
+			t.Errorf("%s: Expected valid=%t, Actual %t (%v)", testCase.Name, testCase.Expected, actual, err)
+		}
+	}
+}
+
+// signWith signs a request over the given headers with the given date,
+// which Sign doesn't allow.
+func signWith(t *testing.T, req *http.Request, key *Key, headers []string, date time.Time) {
+	req.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	signingString, err := buildSigningString(req, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		key.ID, algorithm, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+}
+
+func Test_Verify_Date(t *testing.T) {
+	privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{ID: "https://example.com/users/alice#main-key", PrivateKey: privateKey}
+
+	testCases := []struct {
+		Name     string
+		Headers  []string
+		Date     time.Time
+		Expected bool
+	}{
+		{"recent date", []string{"(request-target)", "host", "date"}, time.Now().Add(-time.Hour), true},
+		{"unsigned date", []string{"(request-target)", "host"}, time.Now(), false},
+		{"old date", []string{"(request-target)", "host", "date"}, time.Now().Add(-13 * time.Hour), false},
+		{"future date", []string{"(request-target)", "host", "date"}, time.Now().Add(2 * time.Hour), false},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/users/alice/outbox", nil)
+		signWith(t, req, key, testCase.Headers, testCase.Date)
+
+		sig, err := ParseSignature(req)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.Name, err)
+		}
+		err = sig.Verify(req, nil, &privateKey.PublicKey)
+		if actual := err == nil; actual != testCase.Expected {
+			t.Errorf("%s: Expected valid=%t, Actual %t (%v)", testCase.Name, testCase.Expected, actual, err)
+		}
+	}
+}
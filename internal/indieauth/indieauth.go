@@ -0,0 +1,225 @@
+// Package indieauth implements the parts of an IndieAuth authorization
+// server which don't depend on HTTP: checking the credentials of users,
+// PKCE, the validation of clients and short-lived authorization codes.
+package indieauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	// CodeLifetime is how long an authorization code can be redeemed.
+	CodeLifetime = 10 * time.Minute
+
+	// Signing in is blocked for a while after too many failed attempts.
+	maxFailures     = 5
+	lockoutDuration = 15 * time.Minute
+)
+
+// Error codes of OAuth 2.0, which are sent by the authorization
+// and token endpoints.
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorInvalidToken            = "invalid_token"
+	ErrorAccessDenied            = "access_denied"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+)
+
+// Error is an error which is reported to the client.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// PKCE methods. Plain challenges aren't supported.
+const MethodS256 = "S256"
+
+// VerifyPKCE checks a code verifier against the S256 code challenge
+// of the authorization request as defined in RFC 7636.
+func VerifyPKCE(challenge string, method string, verifier string) bool {
+	if method != MethodS256 || challenge == "" || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ValidateClient checks the client ID and redirect URI of an authorization
+// request. Redirects have to go to the host of the client, because the
+// redirect URIs which a client publishes aren't fetched.
+func ValidateClient(clientID string, redirectURI string) error {
+	client, err := parseClientURL(clientID)
+	if err != nil {
+		return fmt.Errorf("invalid client_id: %w", err)
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil || redirect.Fragment != "" || (redirect.Scheme != "https" && redirect.Scheme != "http") {
+		return fmt.Errorf("invalid redirect_uri")
+	}
+	if redirect.Scheme != client.Scheme || !strings.EqualFold(redirect.Host, client.Host) {
+		return fmt.Errorf("redirect_uri has to be on the host of the client_id")
+	}
+	return nil
+}
+
+// parseClientURL validates a client ID as defined in
+// section 3.2 of the IndieAuth specification.
+func parseClientURL(clientID string) (*url.URL, error) {
+	u, err := url.Parse(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("scheme has to be https or http")
+	}
+	if u.Host == "" || u.User != nil || u.Fragment != "" {
+		return nil, fmt.Errorf("host is missing or url has credentials or a fragment")
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return nil, fmt.Errorf("path has dot segments")
+		}
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !ip.IsLoopback() {
+		return nil, fmt.Errorf("host must not be an IP address")
+	}
+	return u, nil
+}
+
+// Code is an authorization code, which a client exchanges for
+// a token or the URL of the user's profile.
+type Code struct {
+	UserID        uid.UserID
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// CodeStore keeps authorization codes in memory, because they're only
+// valid for a few minutes. Codes which are pending during a restart
+// have to be requested again.
+type CodeStore struct {
+	mu    sync.Mutex
+	codes map[string]*Code
+}
+
+func NewCodeStore() *CodeStore {
+	return &CodeStore{codes: make(map[string]*Code)}
+}
+
+// Issue stores an authorization code and returns its value.
+func (s *CodeStore) Issue(code *Code) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating authorization code: %w", err)
+	}
+	value := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, c := range s.codes {
+		if now.After(c.ExpiresAt) {
+			delete(s.codes, key)
+		}
+	}
+	s.codes[value] = code
+	return value, nil
+}
+
+// Redeem returns the code with the given value and removes it, so that
+// it can only be used once. Nil is returned for unknown or expired codes.
+func (s *CodeStore) Redeem(value string) *Code {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[value]
+	if !ok {
+		return nil
+	}
+	delete(s.codes, value)
+	if time.Now().After(code.ExpiresAt) {
+		return nil
+	}
+	return code
+}
+
+// Guard slows down the guessing of credentials
+// and stops one-time codes from being used twice.
+type Guard struct {
+	mu        sync.Mutex
+	failures  map[uid.UserID][]time.Time
+	usedSteps map[uid.UserID]int64
+}
+
+func NewGuard() *Guard {
+	return &Guard{
+		failures:  make(map[uid.UserID][]time.Time),
+		usedSteps: make(map[uid.UserID]int64),
+	}
+}
+
+// Locked returns true if a user has failed to sign in too often recently.
+func (g *Guard) Locked(userID uid.UserID, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	recent := []time.Time{}
+	for _, t := range g.failures[userID] {
+		if now.Sub(t) < lockoutDuration {
+			recent = append(recent, t)
+		}
+	}
+	g.failures[userID] = recent
+	return len(recent) >= maxFailures
+}
+
+// Fail records a failed attempt to sign in.
+func (g *Guard) Fail(userID uid.UserID, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.failures[userID] = append(g.failures[userID], now)
+}
+
+// Succeed forgets the failed attempts of a user.
+func (g *Guard) Succeed(userID uid.UserID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, userID)
+}
+
+// UseStep records the time step of a one-time code. It returns false
+// if a code of the same or a later step has been used before.
+func (g *Guard) UseStep(userID uid.UserID, step int64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if last, ok := g.usedSteps[userID]; ok && step <= last {
+		return false
+	}
+	g.usedSteps[userID] = step
+	return true
+}
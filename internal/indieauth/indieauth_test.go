@@ -0,0 +1,150 @@
+package indieauth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_pbkdf2(t *testing.T) {
+	// Test vector of RFC 7914, section 11.
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if actual := hex.EncodeToString(key); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func Test_Password(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$310000$") {
+		t.Errorf("unexpected hash: %s", hash)
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("expected the password to match")
+	}
+	for _, wrong := range []string{"", "correct horse ", "Correct horse"} {
+		if CheckPassword(hash, wrong) {
+			t.Errorf("expected %q not to match", wrong)
+		}
+	}
+	if CheckPassword("plain text", "plain text") {
+		t.Error("expected an invalid hash not to match")
+	}
+}
+
+func Test_CheckTOTP(t *testing.T) {
+	// The SHA-1 test vectors of RFC 6238, appendix B,
+	// cut to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testCases := []struct {
+		Unix int64
+		Code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		step, ok := CheckTOTP(secret, tc.Code, time.Unix(tc.Unix, 0))
+		if !ok || step != tc.Unix/totpPeriod {
+			t.Errorf("expected code %s to be valid at %d", tc.Code, tc.Unix)
+		}
+	}
+
+	// Codes of the neighbouring periods are accepted, older ones aren't.
+	if _, ok := CheckTOTP(secret, "287082", time.Unix(59+totpPeriod, 0)); !ok {
+		t.Error("expected the code of the previous period to be valid")
+	}
+	if _, ok := CheckTOTP(secret, "287082", time.Unix(59+3*totpPeriod, 0)); ok {
+		t.Error("expected an old code to be invalid")
+	}
+	if _, ok := CheckTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("expected an invalid secret to fail")
+	}
+}
+
+func Test_VerifyPKCE(t *testing.T) {
+	verifier := "sabertoot-pkce-verifier-0123456789-abcdefghijklmnop"
+	challenge := "Du0LUIO_GnKcNDgsWNQGcF4IcvcJALh-ZvfbClACxR4"
+
+	if !VerifyPKCE(challenge, MethodS256, verifier) {
+		t.Error("expected the verifier to match")
+	}
+	if VerifyPKCE(challenge, "plain", verifier) || VerifyPKCE(challenge, MethodS256, verifier+"x") {
+		t.Error("expected the verifier not to match")
+	}
+	if VerifyPKCE(challenge, MethodS256, "short") {
+		t.Error("expected a short verifier to be rejected")
+	}
+}
+
+func Test_ValidateClient(t *testing.T) {
+	testCases := []struct {
+		ClientID    string
+		RedirectURI string
+		Valid       bool
+	}{
+		{"https://app.example/", "https://app.example/callback", true},
+		{"http://localhost:8080/", "http://localhost:8080/callback", true},
+		{"https://app.example/", "https://evil.example/callback", false},
+		{"https://app.example/", "http://app.example/callback", false},
+		{"https://192.168.1.1/", "https://192.168.1.1/callback", false},
+		{"https://app.example/../x", "https://app.example/callback", false},
+		{"app.example", "https://app.example/callback", false},
+	}
+
+	for _, tc := range testCases {
+		if err := ValidateClient(tc.ClientID, tc.RedirectURI); (err == nil) != tc.Valid {
+			t.Errorf("unexpected result for %s and %s: %v", tc.ClientID, tc.RedirectURI, err)
+		}
+	}
+}
+
+func Test_CodeStore(t *testing.T) {
+	store := NewCodeStore()
+	value, err := store.Issue(&Code{UserID: 1, ExpiresAt: time.Now().Add(CodeLifetime)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := store.Redeem(value); code == nil || code.UserID != 1 {
+		t.Errorf("unexpected code: %+v", code)
+	}
+	if store.Redeem(value) != nil {
+		t.Error("expected the code to be redeemable only once")
+	}
+
+	value, _ = store.Issue(&Code{UserID: 1, ExpiresAt: time.Now().Add(-time.Second)})
+	if store.Redeem(value) != nil {
+		t.Error("expected an expired code to be invalid")
+	}
+}
+
+func Test_Guard(t *testing.T) {
+	guard := NewGuard()
+	now := time.Now()
+
+	for i := 0; i < maxFailures; i++ {
+		if guard.Locked(1, now) {
+			t.Fatalf("locked after %d failures", i)
+		}
+		guard.Fail(1, now)
+	}
+	if !guard.Locked(1, now) || guard.Locked(2, now) {
+		t.Error("expected only the first user to be locked")
+	}
+	if guard.Locked(1, now.Add(lockoutDuration)) {
+		t.Error("expected the lock to expire")
+	}
+
+	if !guard.UseStep(1, 10) || guard.UseStep(1, 10) || guard.UseStep(1, 9) || !guard.UseStep(1, 11) {
+		t.Error("expected each step to be usable once")
+	}
+}
@@ -0,0 +1,525 @@
+// Package markdown renders the commonly used subset of Markdown into
+// HTML: paragraphs, headings, lists, block quotes, code, rules, emphasis,
+// links and bare URLs. Raw HTML is escaped and images turn into links,
+// because toots carry their pictures as attachments. Reference links,
+// footnotes and tables are not supported, which Validate reports.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	atxHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextLine   = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	thematic     = regexp.MustCompile(`^ {0,3}((?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceOpen    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})")
+	blockquote   = regexp.MustCompile(`^ {0,3}> ?`)
+	listItem     = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])( +|$)`)
+	bareURL      = regexp.MustCompile(`^https?://[^\s<>"]+`)
+	autolink     = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]+|[^\s<>@]+@[^\s<>@]+\.[^\s<>@]+)>`)
+	trailingPunc = ".,:;!?'\""
+
+	codeSpan      = regexp.MustCompile("(`+)[^`]*?(`+)")
+	escapedChar   = regexp.MustCompile(`\\.`)
+	linkReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:`)
+	referenceLink = regexp.MustCompile(`\]\[[^\]]*\]`)
+	footnote      = regexp.MustCompile(`\[\^[^\]]+\]`)
+)
+
+// Validate returns an error for syntax which HTML doesn't support and
+// would leave as text, so that it can be fixed before it's published.
+// Code blocks are not checked.
+func Validate(src string) error {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+
+	fence := ""
+	for n, line := range strings.Split(src, "\n") {
+		if fence != "" {
+			if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceOpen.FindStringSubmatch(line); m != nil {
+			fence = m[2]
+			continue
+		}
+		if strings.HasPrefix(line, "    ") {
+			continue
+		}
+
+		text := escapedChar.ReplaceAllString(codeSpan.ReplaceAllString(line, ""), "")
+		switch {
+		case linkReference.MatchString(text):
+			return fmt.Errorf("line %d: link reference definitions are not supported", n+1)
+		case referenceLink.MatchString(text):
+			return fmt.Errorf("line %d: reference links are not supported", n+1)
+		case footnote.MatchString(text):
+			return fmt.Errorf("line %d: footnotes are not supported", n+1)
+		case isTableDelimiter(text):
+			return fmt.Errorf("line %d: tables are not supported", n+1)
+		}
+	}
+	return nil
+}
+
+// isTableDelimiter returns true for the line below the header of a
+// table, e.g. "| --- | :-: |".
+func isTableDelimiter(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.Contains(trimmed, "|") && strings.Contains(trimmed, "-") && strings.Trim(trimmed, "|-: ") == ""
+}
+
+// HTML renders Markdown into HTML.
+func HTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	return renderBlocks(strings.Split(src, "\n"))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock returns true if the line interrupts a paragraph.
+func startsBlock(line string) bool {
+	return atxHeading.MatchString(line) ||
+		thematic.MatchString(line) ||
+		fenceOpen.MatchString(line) ||
+		blockquote.MatchString(line) ||
+		(listItem.MatchString(line) && !isBlank(listItem.ReplaceAllString(line, "")))
+}
+
+func renderBlocks(lines []string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			i++
+
+		case fenceOpen.MatchString(line):
+			i = renderFence(&b, lines, i)
+
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + renderInline(strings.TrimSpace(m[2])) + "</h" + level + ">")
+			i++
+
+		case thematic.MatchString(line):
+			b.WriteString("<hr>")
+			i++
+
+		case blockquote.MatchString(line):
+			quoted := []string{}
+			for i < len(lines) && blockquote.MatchString(lines[i]) {
+				quoted = append(quoted, blockquote.ReplaceAllString(lines[i], ""))
+				i++
+			}
+			b.WriteString("<blockquote>" + renderBlocks(quoted) + "</blockquote>")
+
+		case listItem.MatchString(line):
+			i = renderList(&b, lines, i)
+
+		case strings.HasPrefix(line, "    "):
+			code := []string{}
+			for i < len(lines) && (strings.HasPrefix(lines[i], "    ") || isBlank(lines[i])) {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+				i++
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>")
+
+		default:
+			i = renderParagraph(&b, lines, i)
+		}
+	}
+
+	return b.String()
+}
+
+func renderFence(b *strings.Builder, lines []string, i int) int {
+	m := fenceOpen.FindStringSubmatch(lines[i])
+	indent, fence := len(m[1]), m[2]
+	i++
+
+	code := []string{}
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+
+	content := html.EscapeString(strings.Join(code, "\n"))
+	if len(code) > 0 {
+		content += "\n"
+	}
+	b.WriteString("<pre><code>" + content + "</code></pre>")
+	return i
+}
+
+func renderParagraph(b *strings.Builder, lines []string, i int) int {
+	text := []string{lines[i]}
+	i++
+	for ; i < len(lines); i++ {
+		if isBlank(lines[i]) {
+			break
+		}
+		if m := setextLine.FindStringSubmatch(lines[i]); m != nil {
+			level := "1"
+			if m[1][0] == '-' {
+				level = "2"
+			}
+			b.WriteString("<h" + level + ">" + renderInline(strings.TrimSpace(strings.Join(text, "\n"))) + "</h" + level + ">")
+			return i + 1
+		}
+		if startsBlock(lines[i]) {
+			break
+		}
+		text = append(text, lines[i])
+	}
+
+	b.WriteString("<p>" + renderLines(text) + "</p>")
+	return i
+}
+
+// renderLines renders the lines of a paragraph. A line which ends
+// with two spaces or a backslash is followed by a hard line break.
+func renderLines(lines []string) string {
+	var b strings.Builder
+	for n, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		last := n == len(lines)-1
+		switch {
+		case !last && strings.HasSuffix(line, "  "):
+			b.WriteString(renderInline(strings.TrimRight(line, " ")) + "<br>")
+		case !last && strings.HasSuffix(line, "\\"):
+			b.WriteString(renderInline(strings.TrimSuffix(line, "\\")) + "<br>")
+		case last:
+			b.WriteString(renderInline(strings.TrimRight(line, " ")))
+		default:
+			b.WriteString(renderInline(line) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// renderList renders consecutive items of the same kind of list.
+// Lines which are indented at least as far as the content of an item
+// belong to it, so that items can hold paragraphs and nested lists.
+func renderList(b *strings.Builder, lines []string, i int) int {
+	first := listItem.FindStringSubmatch(lines[i])
+	ordered := !strings.ContainsAny(first[2], "-*+")
+	marker := first[2][len(first[2])-1:]
+
+	// sameList returns the match of an item which continues the list.
+	sameList := func(line string) []string {
+		m := listItem.FindStringSubmatch(line)
+		if m == nil || strings.ContainsAny(m[2], "-*+") == ordered || !strings.HasSuffix(m[2], marker) || thematic.MatchString(line) {
+			return nil
+		}
+		return m
+	}
+
+	items := [][]string{}
+	loose := false
+	for i < len(lines) {
+		m := sameList(lines[i])
+		if m == nil {
+			break
+		}
+
+		// The content starts after the spaces which follow the marker,
+		// unless there are so many that they start a code block.
+		indent := len(m[0])
+		if m[3] == "" || len(m[3]) > 4 {
+			indent = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{""}
+		if indent < len(lines[i]) {
+			item[0] = lines[i][indent:]
+		}
+		i++
+
+		for i < len(lines) {
+			line := lines[i]
+			if isBlank(line) {
+				// A blank line only continues the item if
+				// the next line is indented into it.
+				if i+1 < len(lines) && !isBlank(lines[i+1]) && indentation(lines[i+1]) >= indent {
+					item = append(item, "")
+					loose = true
+					i++
+					continue
+				}
+				break
+			}
+			if indentation(line) >= indent {
+				item = append(item, line[indent:])
+			} else if listItem.MatchString(line) || startsBlock(line) {
+				break
+			} else {
+				// Lazy continuation of the item's paragraph.
+				item = append(item, line)
+			}
+			i++
+		}
+		items = append(items, item)
+
+		// Items separated by a blank line make a loose list.
+		if i+1 < len(lines) && isBlank(lines[i]) && sameList(lines[i+1]) != nil {
+			loose = true
+			i++
+		}
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag + ">")
+	for _, item := range items {
+		content := renderBlocks(item)
+		if !loose {
+			content = unwrapParagraphs(content)
+		}
+		b.WriteString("<li>" + content + "</li>")
+	}
+	b.WriteString("</" + tag + ">")
+	return i
+}
+
+// unwrapParagraphs removes the paragraphs of a tight list item.
+func unwrapParagraphs(s string) string {
+	s = strings.ReplaceAll(s, "</p><p>", "\n")
+	s = strings.ReplaceAll(s, "<p>", "")
+	return strings.ReplaceAll(s, "</p>", "")
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// renderInline renders code spans, links, emphasis and escapes.
+func renderInline(s string) string {
+	return renderText(s, true)
+}
+
+// renderText renders inline Markdown. The text of a link
+// must not contain links itself, so they are left out.
+func renderText(s string, links bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>~|\"'", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			run := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[run:], rest[:run]); end >= 0 {
+				code := rest[run : run+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			b.WriteString(rest[:run])
+			i += run
+			continue
+
+		case c == '!' && links && strings.HasPrefix(rest, "!["):
+			if text, href, n := parseLink(rest[1:]); n > 0 {
+				b.WriteString(renderLink(href, text))
+				i += 1 + n
+				continue
+			}
+
+		case c == '[' && links:
+			if text, href, n := parseLink(rest); n > 0 {
+				b.WriteString(renderLink(href, text))
+				i += n
+				continue
+			}
+
+		case c == '<' && links:
+			if m := autolink.FindStringSubmatch(rest); m != nil {
+				href := m[1]
+				if !strings.Contains(href, ":") {
+					href = "mailto:" + href
+				}
+				b.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+				continue
+			}
+
+		case c == 'h' && links && (i == 0 || !isWordByte(s[i-1])):
+			if m := bareURL.FindString(rest); m != "" {
+				m = trimURL(m)
+				b.WriteString(`<a href="` + html.EscapeString(m) + `">` + html.EscapeString(m) + "</a>")
+				i += len(m)
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if rendered, n := renderEmphasis(s, i, links); n > 0 {
+				b.WriteString(rendered)
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+
+	return b.String()
+}
+
+// parseLink parses [text](href "title") and returns
+// the text, the href and the length of the link.
+func parseLink(s string) (string, string, int) {
+	depth := 0
+	closing := -1
+	for i := 0; i < len(s) && closing < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closing = i
+			}
+		}
+	}
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return "", "", 0
+	}
+
+	depth = 0
+	end := -1
+	for i := closing + 1; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return "", "", 0
+	}
+
+	dest := strings.TrimSpace(s[closing+2 : end])
+	if space := strings.IndexAny(dest, " \n"); space >= 0 {
+		dest = dest[:space]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return s[1:closing], dest, end + 1
+}
+
+func renderLink(href string, text string) string {
+	return `<a href="` + html.EscapeString(href) + `">` + renderText(text, false) + "</a>"
+}
+
+// renderEmphasis renders **strong**, *emphasis* and ~~strikethrough~~
+// which start at position i. The closing delimiter must follow
+// a non-space character and end a run of delimiters.
+func renderEmphasis(s string, i int, links bool) (string, int) {
+	c := s[i]
+	run := 1
+	for i+run < len(s) && s[i+run] == c {
+		run++
+	}
+
+	size := 1
+	tag := "em"
+	switch {
+	case c == '~' && run >= 2:
+		size, tag = 2, "del"
+	case c == '~':
+		return "", 0
+	case run >= 2:
+		size, tag = 2, "strong"
+	}
+
+	// Underscores don't emphasise inside of words.
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0
+	}
+
+	start := i + size
+	if start >= len(s) || s[start] == ' ' || s[start] == '\n' {
+		return "", 0
+	}
+
+	delimiter := strings.Repeat(string(c), size)
+	for j := start + 1; j+size <= len(s); j++ {
+		if s[j:j+size] != delimiter || s[j-1] == ' ' || s[j-1] == '\n' || s[j-1] == '\\' {
+			continue
+		}
+		// The closing delimiter is at the end of its run,
+		// so that ***both*** nests emphasis in strong.
+		for j+size < len(s) && s[j+size] == c {
+			j++
+		}
+		if c == '_' && j+size < len(s) && isWordByte(s[j+size]) {
+			continue
+		}
+		inner := s[start:j]
+		return "<" + tag + ">" + renderText(inner, links) + "</" + tag + ">", j + size - i
+	}
+
+	return "", 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c >= 0x80
+}
+
+// trimURL removes punctuation which ends the sentence rather than the URL,
+// as well as a closing parenthesis which has not been opened in the URL.
+func trimURL(u string) string {
+	for len(u) > 0 {
+		last := u[len(u)-1]
+		if strings.IndexByte(trailingPunc, last) >= 0 {
+			u = u[:len(u)-1]
+			continue
+		}
+		if last == ')' && strings.Count(u, "(") < strings.Count(u, ")") {
+			u = u[:len(u)-1]
+			continue
+		}
+		break
+	}
+	return u
+}
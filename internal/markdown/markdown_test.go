@@ -0,0 +1,101 @@
+package markdown
+
+import "testing"
+
+func Test_HTML(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Markdown string
+		Expected string
+	}{
+		{
+			Name:     "paragraphs and line breaks",
+			Markdown: "First line\nsame paragraph  \nafter a break\n\nSecond & <last>",
+			Expected: "<p>First line\nsame paragraph<br>after a break</p><p>Second &amp; &lt;last&gt;</p>",
+		},
+		{
+			Name:     "headings",
+			Markdown: "# Title #\n\n### Sub *title*\n\nSetext\n------",
+			Expected: "<h1>Title</h1><h3>Sub <em>title</em></h3><h2>Setext</h2>",
+		},
+		{
+			Name:     "emphasis",
+			Markdown: "**bold**, *em*, _em_, ***both***, ~~gone~~, snake_case_name and 2 * 3 * 4",
+			Expected: "<p><strong>bold</strong>, <em>em</em>, <em>em</em>, <strong><em>both</em></strong>, <del>gone</del>, snake_case_name and 2 * 3 * 4</p>",
+		},
+		{
+			Name:     "code",
+			Markdown: "Use `a < b` or ``x ` y``\n\n```go\nif a < b {\n}\n```\n\n    indented\n    code",
+			Expected: "<p>Use <code>a &lt; b</code> or <code>x ` y</code></p><pre><code>if a &lt; b {\n}\n</code></pre><pre><code>indented\ncode\n</code></pre>",
+		},
+		{
+			Name:     "links",
+			Markdown: "[Sabertoot](https://example.com/a_(b) \"Title\"), <https://example.com/x>, see https://example.com/y. and ![a cat](cat.png)",
+			Expected: `<p><a href="https://example.com/a_(b)">Sabertoot</a>, <a href="https://example.com/x">https://example.com/x</a>, ` +
+				`see <a href="https://example.com/y">https://example.com/y</a>. and <a href="cat.png">a cat</a></p>`,
+		},
+		{
+			Name:     "no links in links",
+			Markdown: "[https://example.com *here*](https://example.org)",
+			Expected: `<p><a href="https://example.org">https://example.com <em>here</em></a></p>`,
+		},
+		{
+			Name:     "escapes",
+			Markdown: `\*not emphasis\* and \[not a link\]`,
+			Expected: "<p>*not emphasis* and [not a link]</p>",
+		},
+		{
+			Name:     "tight lists",
+			Markdown: "- one\n- two\n  - nested\n\n1. first\n2. second",
+			Expected: "<ul><li>one</li><li>two<ul><li>nested</li></ul></li></ul><ol><li>first</li><li>second</li></ol>",
+		},
+		{
+			Name:     "loose list",
+			Markdown: "* one\n\n  more of one\n* two",
+			Expected: "<ul><li><p>one</p><p>more of one</p></li><li><p>two</p></li></ul>",
+		},
+		{
+			Name:     "block quote and rule",
+			Markdown: "> Quoted\n> **text**\n\n---\n\nAfter",
+			Expected: "<blockquote><p>Quoted\n<strong>text</strong></p></blockquote><hr><p>After</p>",
+		},
+		{
+			Name:     "blocks interrupt paragraphs",
+			Markdown: "Text\n- item\n\nText\n# Heading",
+			Expected: "<p>Text</p><ul><li>item</li></ul><p>Text</p><h1>Heading</h1>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := HTML(tc.Markdown)
+			if actual != tc.Expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Markdown string
+		Error    bool
+	}{
+		{Name: "supported syntax", Markdown: "# Title\n\n- [link](https://example.com) and `[a][b]`\n\n---\n\n\\[not\\]\\[a link\\]"},
+		{Name: "code blocks", Markdown: "```\n| a | b |\n| - | - |\n[1]: https://example.com\n```\n\n    [a][b]"},
+		{Name: "link reference definition", Markdown: "See [the docs].\n\n[the docs]: https://example.com", Error: true},
+		{Name: "reference link", Markdown: "See [the docs][1].", Error: true},
+		{Name: "footnote", Markdown: "Sabertoot[^1] is here.", Error: true},
+		{Name: "table", Markdown: "| a | b |\n|---|:-:|\n| 1 | 2 |", Error: true},
+		{Name: "table without pipes at the ends", Markdown: "a | b\n--- | ---", Error: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if err := Validate(tc.Markdown); (err != nil) != tc.Error {
+				t.Errorf("expected an error %t, got %v", tc.Error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package mastodon
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sabertoot/server/internal/plog"
+)
+
+// fetchStatuses returns a page of statuses from the Mastodon API. A new
+// harvest starts with the newest statuses and pages backwards until
+// it reaches the latest status of the previous harvest or the
+// user's start date.
+func (s *mastodonSource) fetchStatuses(ctx context.Context, c *cursor) ([]*post, error) {
+	if c.MaxID == "" {
+		account, err := s.client.LookupAccount(ctx, s.server, s.username)
+		if err != nil {
+			return nil, err
+		}
+		c.AccountID = account.ID
+		c.SinceID = c.LatestID
+		plog.Infof("Latest status ID of %s: %s", s.options.Account, c.SinceID)
+
+		s.downloadProfileImage(ctx, account.Avatar)
+	} else {
+		plog.Infof("Resuming to collect statuses of %s since %s", s.options.Account, c.SinceID)
+	}
+
+	statuses, err := s.client.AccountStatuses(ctx, s.server, c.AccountID, StatusesParams{
+		SinceID:        c.SinceID,
+		MaxID:          c.MaxID,
+		Limit:          pageSize,
+		ExcludeReplies: !s.options.Replies,
+		ExcludeReblogs: !s.options.Boosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plog.Debugf("Result count: %d", len(statuses))
+
+	byID := make(map[string]*Status)
+	for _, status := range statuses {
+		byID[status.ID] = status
+	}
+
+	posts := []*post{}
+	done := len(statuses) == 0
+	for _, status := range statuses {
+		if status.CreatedAt.Before(s.env.User.StartDate) {
+			done = true
+			continue
+		}
+
+		// Paging goes on with max_id, and the newest status
+		// becomes the since_id of the next harvest.
+		if isNewerID(status.ID, c.LatestID) {
+			c.LatestID = status.ID
+		}
+
+		if !status.IsPublic() || (status.Reblog != nil && !s.options.Boosts) {
+			continue
+		}
+
+		parentURI := ""
+		if status.InReplyToID != "" {
+			if status.InReplyToAccountID != c.AccountID {
+				if !s.options.Replies {
+					continue
+				}
+			} else if parentURI, err = s.statusURI(ctx, status.InReplyToID, byID); err != nil {
+				return nil, err
+			}
+		}
+
+		posts = append(posts, postFromStatus(status, parentURI))
+	}
+
+	c.MaxID = ""
+	if !done {
+		c.MaxID = statuses[len(statuses)-1].ID
+	} else {
+		plog.Debugf("No more statuses of %s to collect.", s.options.Account)
+	}
+
+	return posts, nil
+}
+
+// statusURI returns the URI of a status which is either part of the
+// current page or gets fetched. Deleted statuses have no URI.
+func (s *mastodonSource) statusURI(ctx context.Context, id string, byID map[string]*Status) (string, error) {
+	if status, ok := byID[id]; ok {
+		return status.URI, nil
+	}
+
+	status, err := s.client.Status(ctx, s.server, id)
+	if err != nil {
+		var notFoundErr *NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return "", nil
+		}
+		return "", err
+	}
+	return status.URI, nil
+}
+
+// isNewerID returns true if the status ID a is newer than b. Status IDs
+// grow over time, but they have to be compared by their length first.
+func isNewerID(a string, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
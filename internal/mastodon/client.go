@@ -0,0 +1,230 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/version"
+)
+
+const (
+	maxResponseBytes = 10 << 20
+
+	// Mastodon counts requests in windows of five minutes.
+	defaultRetryAfter = 5 * time.Minute
+
+	acceptActivityJSON = `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+	acceptJRD          = "application/jrd+json, application/json"
+)
+
+// NotFoundError is returned when a status or account doesn't exist.
+type NotFoundError struct {
+	URL string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s does not exist", e.URL)
+}
+
+// Client reads public posts from the Mastodon API or from an ActivityPub
+// outbox. Requests are not signed, so servers which require authorised
+// fetches for their outboxes can only be read through the API.
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a client. The token is optional and only
+// needed for servers which don't serve their API publicly.
+func NewClient(token string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		token:      token,
+	}
+}
+
+// StatusesParams are the filters of an account's statuses.
+// Both IDs are exclusive and optional.
+type StatusesParams struct {
+	SinceID        string
+	MaxID          string
+	Limit          int
+	ExcludeReplies bool
+	ExcludeReblogs bool
+}
+
+// LookupAccount finds an account of the server by its username.
+func (c *Client) LookupAccount(ctx context.Context, server string, username string) (*Account, error) {
+	query := url.Values{"acct": {username}}
+	var account Account
+	if err := c.get(ctx, server+"/api/v1/accounts/lookup?"+query.Encode(), "application/json", &account); err != nil {
+		return nil, err
+	}
+	if account.ID == "" {
+		return nil, fmt.Errorf("account %s of %s has no id", username, server)
+	}
+	return &account, nil
+}
+
+// AccountStatuses returns the statuses of an account, newest first.
+func (c *Client) AccountStatuses(ctx context.Context, server string, accountID string, params StatusesParams) ([]*Status, error) {
+	query := url.Values{}
+	if params.SinceID != "" {
+		query.Set("since_id", params.SinceID)
+	}
+	if params.MaxID != "" {
+		query.Set("max_id", params.MaxID)
+	}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.ExcludeReplies {
+		query.Set("exclude_replies", "true")
+	}
+	if params.ExcludeReblogs {
+		query.Set("exclude_reblogs", "true")
+	}
+
+	var raw []json.RawMessage
+	err := c.get(ctx, fmt.Sprintf("%s/api/v1/accounts/%s/statuses?%s", server, url.PathEscape(accountID), query.Encode()), "application/json", &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*Status{}
+	for _, data := range raw {
+		status, err := parseStatus(data)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Status returns a single status by its ID.
+func (c *Client) Status(ctx context.Context, server string, id string) (*Status, error) {
+	var raw json.RawMessage
+	if err := c.get(ctx, fmt.Sprintf("%s/api/v1/statuses/%s", server, url.PathEscape(id)), "application/json", &raw); err != nil {
+		return nil, err
+	}
+	return parseStatus(raw)
+}
+
+// WebFinger resolves an account of the form user@host
+// into the URL of its ActivityPub actor.
+func (c *Client) WebFinger(ctx context.Context, server string, acct string) (string, error) {
+	query := url.Values{"resource": {"acct:" + acct}}
+	var doc struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := c.get(ctx, server+"/.well-known/webfinger?"+query.Encode(), acceptJRD, &doc); err != nil {
+		return "", err
+	}
+	for _, link := range doc.Links {
+		if link.Rel == "self" && isActivityJSON(link.Type) && link.Href != "" {
+			return link.Href, nil
+		}
+	}
+	return "", fmt.Errorf("WebFinger document of %s does not link an actor", acct)
+}
+
+// Actor fetches the actor document of an account.
+func (c *Client) Actor(ctx context.Context, actorURL string) (*Actor, error) {
+	var actor Actor
+	if err := c.get(ctx, actorURL, acceptActivityJSON, &actor); err != nil {
+		return nil, err
+	}
+	if actor.ID == "" || actor.Outbox == "" {
+		return nil, fmt.Errorf("actor %s is missing id or outbox", actorURL)
+	}
+	return &actor, nil
+}
+
+// OutboxPage fetches a page of an outbox. If the URL is the outbox itself,
+// its first page is returned, which holds the newest activities.
+func (c *Client) OutboxPage(ctx context.Context, pageURL string) (*CollectionPage, error) {
+	var page CollectionPage
+	if err := c.get(ctx, pageURL, acceptActivityJSON, &page); err != nil {
+		return nil, err
+	}
+
+	switch page.Type {
+	case "OrderedCollectionPage", "CollectionPage":
+		return &page, nil
+	case "OrderedCollection", "Collection":
+		if first := page.FirstPage(); first != nil {
+			return first, nil
+		}
+		if firstURL := rawID(page.First); firstURL != "" {
+			return c.OutboxPage(ctx, firstURL)
+		}
+		// Small collections list their items without pages.
+		page.Next = ""
+		return &page, nil
+	default:
+		return nil, fmt.Errorf("%s is not a collection: %s", pageURL, page.Type)
+	}
+}
+
+func (c *Client) get(ctx context.Context, url string, accept string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", accept)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return &NotFoundError{URL: url}
+	case http.StatusTooManyRequests:
+		return &source.RateLimitError{Service: url, Reset: parseReset(resp.Header)}
+	default:
+		return fmt.Errorf("bad status code fetching %s: %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", url, err)
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error deserialising %s: %w", url, err)
+	}
+	return nil
+}
+
+// parseReset reads when a rate limit ends. Mastodon sends the
+// X-RateLimit-Reset header, other servers send Retry-After.
+func parseReset(header http.Header) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, header.Get("X-RateLimit-Reset")); err == nil && t.After(time.Now()) {
+		return t
+	}
+	return source.ParseRetryAfter(header.Get("Retry-After"), defaultRetryAfter)
+}
+
+func isActivityJSON(contentType string) bool {
+	return contentType == "application/activity+json" ||
+		contentType == `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+}
@@ -0,0 +1,80 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// DownloadMedia downloads the images of a post, or the previews of its
+// GIFs and videos, into the media directory.
+func (s *mastodonSource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	result := []*data.Media{}
+
+	p, ok := item.(*post)
+	if !ok {
+		return result
+	}
+
+	for _, m := range p.Media {
+		ext := ".jpg"
+		if parsedURL, err := url.Parse(m.URL); err == nil && path.Ext(parsedURL.Path) != "" {
+			ext = path.Ext(parsedURL.Path)
+		}
+		mimeType := m.MIMEType
+		if mimeType == "" || m.Type != data.MediaPhoto {
+			mimeType = mime.TypeByExtension(ext)
+		}
+		if mimeType == "" {
+			mimeType = "image/jpeg"
+		}
+
+		fileName := fmt.Sprintf("%s-%d%s", toot.ID, len(result), ext)
+		err := download.File(ctx, m.URL, s.env.Settings.Storage.MediaFullFilePath(fileName))
+		if err != nil {
+			plog.Errorf("Error downloading media of toot %s: %s", toot.ID, err.Error())
+			continue
+		}
+
+		result = append(result, &data.Media{
+			Type:      m.Type,
+			MIMEType:  mimeType,
+			FileName:  fileName,
+			Width:     m.Width,
+			Height:    m.Height,
+			AltText:   m.Description,
+			SourceURL: m.URL,
+		})
+		plog.Debugf("Media downloaded for toot %s: %s", toot.ID, fileName)
+	}
+
+	return result
+}
+
+// downloadProfileImage downloads the avatar of the harvested account.
+func (s *mastodonSource) downloadProfileImage(ctx context.Context, imageURL string) {
+	if imageURL == "" {
+		return
+	}
+	user := s.env.User
+
+	ext := ".jpg"
+	if parsedURL, err := url.Parse(imageURL); err == nil && path.Ext(parsedURL.Path) != "" {
+		ext = path.Ext(parsedURL.Path)
+	}
+
+	profileImagePath := s.env.Settings.Storage.ProfileImageFullFilePath(user.ID, ext)
+	if err := download.File(ctx, imageURL, profileImagePath); err != nil {
+		plog.Error(err.Error())
+		return
+	}
+
+	plog.Infof("Profile image downloaded for user %s: %s", user.Username, profileImagePath)
+}
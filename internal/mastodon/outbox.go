@@ -0,0 +1,134 @@
+package mastodon
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// fetchOutbox returns a page of the account's outbox. A new harvest
+// starts with the first page, which holds the newest activities, and
+// follows the next pages until it reaches the newest activity of the
+// previous harvest or the user's start date.
+func (s *mastodonSource) fetchOutbox(ctx context.Context, c *cursor) ([]*post, error) {
+	pageURL := c.Next
+	if pageURL == "" {
+		actorURL := c.Actor
+		if actorURL == "" {
+			var err error
+			if actorURL, err = s.client.WebFinger(ctx, s.server, s.username+"@"+s.domain); err != nil {
+				return nil, err
+			}
+		}
+		actor, err := s.client.Actor(ctx, actorURL)
+		if err != nil {
+			return nil, err
+		}
+		c.Actor = actor.ID
+		c.Since = c.Latest
+		pageURL = actor.Outbox
+
+		s.downloadProfileImage(ctx, actor.IconURL())
+	} else {
+		plog.Infof("Resuming to collect the outbox of %s at %s", s.options.Account, pageURL)
+	}
+
+	page, err := s.client.OutboxPage(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	activities := []*Activity{}
+	created := make(map[string]bool)
+	for _, raw := range page.Activities() {
+		activity, err := parseActivity(raw)
+		if err != nil {
+			plog.Warningf("Skipping activity in outbox of %s: %s", s.options.Account, err.Error())
+			continue
+		}
+		activities = append(activities, activity)
+		if activity.Type == "Create" {
+			created[activity.ObjectID()] = true
+		}
+	}
+	plog.Debugf("Result count: %d", len(activities))
+
+	since := time.Unix(c.Since, 0).UTC()
+	posts := []*post{}
+	done := len(activities) == 0 || page.Next == ""
+	for _, activity := range activities {
+		if activity.Published.Before(s.env.User.StartDate) || (c.Since > 0 && activity.Published.Before(since)) {
+			done = true
+			continue
+		}
+
+		// Since stays put while the outbox gets paged through, and
+		// the next harvest stops at the newest activity seen here.
+		if published := activity.Published.Unix(); published > c.Latest {
+			c.Latest = published
+		}
+
+		if !activity.IsPublic() {
+			continue
+		}
+
+		switch activity.Type {
+		case "Create":
+			object, err := activity.EmbeddedObject()
+			if err != nil {
+				plog.Warningf("Skipping activity in outbox of %s: %s", s.options.Account, err.Error())
+				continue
+			}
+			if object.Type != "Note" && object.Type != "Article" {
+				continue
+			}
+
+			parentURI := ""
+			if object.InReplyTo != "" {
+				isSelfReply, err := s.isOwnPost(ctx, c.Actor, object.InReplyTo, created)
+				if err != nil {
+					return nil, err
+				}
+				if isSelfReply {
+					parentURI = object.InReplyTo
+				} else if !s.options.Replies {
+					continue
+				}
+			}
+			posts = append(posts, postFromObject(activity, object, parentURI))
+
+		case "Announce":
+			if s.options.Boosts && activity.ObjectID() != "" {
+				posts = append(posts, postFromAnnounce(activity))
+			}
+		}
+	}
+
+	c.Next = ""
+	if !done {
+		c.Next = page.Next
+	} else {
+		plog.Debugf("No more activities of %s to collect.", s.options.Account)
+	}
+
+	return posts, nil
+}
+
+// isOwnPost returns true if a post belongs to the harvested account.
+// Outboxes don't say who the author of a parent is, but Mastodon
+// nests the URIs of posts under the actor and other servers' posts
+// have been harvested before, unless they are on the same page.
+func (s *mastodonSource) isOwnPost(ctx context.Context, actorID string, uri string, created map[string]bool) (bool, error) {
+	if strings.HasPrefix(uri, actorID+"/") || created[uri] {
+		return true, nil
+	}
+	userID := s.env.User.ID
+	tootID, err := s.env.DataService.SourceTootID(ctx, TootID(userID, uri), userID, uid.Mastodon, uri)
+	if err != nil {
+		return false, err
+	}
+	return tootID != "", nil
+}
@@ -0,0 +1,181 @@
+package mastodon
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+)
+
+// post is a status of the API or an activity of an outbox,
+// in the shape which both of them have in common.
+type post struct {
+	URI       string
+	URL       string
+	Published time.Time
+	Title     string
+	Content   string
+	Summary   string
+	Sensitive bool
+	Language  string
+
+	// InReplyTo is the URI of the previous post of a self-thread.
+	// It is empty for posts which reply to other accounts.
+	InReplyTo string
+
+	// Shared is the original post of a boost.
+	Shared *sharedPost
+
+	Hashtags []*data.Tag
+	Media    []*media
+	Raw      json.RawMessage
+}
+
+// sharedPost is a post of another account which has been boosted.
+// Outboxes only link the original post, so only its URI is known.
+type sharedPost struct {
+	URI     string
+	URL     string
+	Author  string
+	Content string
+}
+
+// media is an attachment of a post. URL is the image which gets
+// downloaded, which is only a preview for GIFs and videos.
+type media struct {
+	Type        string
+	MIMEType    string
+	URL         string
+	Description string
+	Width       int
+	Height      int
+}
+
+func postFromStatus(status *Status, parentURI string) *post {
+	p := &post{
+		URI:       status.URI,
+		URL:       status.URL,
+		Published: status.CreatedAt.UTC(),
+		Content:   status.Content,
+		Summary:   status.SpoilerText,
+		Sensitive: status.Sensitive,
+		Language:  status.Language,
+		InReplyTo: parentURI,
+		Hashtags:  []*data.Tag{},
+		Media:     []*media{},
+		Raw:       status.Raw,
+	}
+
+	if reblog := status.Reblog; reblog != nil {
+		p.Shared = &sharedPost{URI: reblog.URI, URL: reblog.URL, Content: reblog.Content}
+		if reblog.Account != nil {
+			p.Shared.Author = reblog.Account.Acct
+		}
+		return p
+	}
+
+	for _, tag := range status.Tags {
+		p.Hashtags = append(p.Hashtags, &data.Tag{Type: data.TagHashtag, Name: "#" + strings.ToLower(tag.Name), Href: tag.URL})
+	}
+
+	for _, attachment := range status.MediaAttachments {
+		m := &media{
+			Description: attachment.Description,
+			Width:       attachment.Meta.Original.Width,
+			Height:      attachment.Meta.Original.Height,
+		}
+		switch attachment.Type {
+		case "image":
+			m.Type = data.MediaPhoto
+			m.URL = attachment.URL
+		case "gifv":
+			m.Type = data.MediaGIF
+			m.URL = attachment.PreviewURL
+		case "video":
+			m.Type = data.MediaVideo
+			m.URL = attachment.PreviewURL
+		default:
+			// Audio has nothing to show.
+			continue
+		}
+		if m.URL != "" {
+			p.Media = append(p.Media, m)
+		}
+	}
+
+	return p
+}
+
+// postFromObject turns the object of a Create activity into a post.
+func postFromObject(activity *Activity, object *Object, parentURI string) *post {
+	published := object.Published
+	if published.IsZero() {
+		published = activity.Published
+	}
+
+	p := &post{
+		URI:       object.ID,
+		URL:       rawHref(object.URL),
+		Published: published.UTC(),
+		Content:   object.Content,
+		Summary:   object.Summary,
+		Sensitive: object.Sensitive,
+		InReplyTo: parentURI,
+		Hashtags:  []*data.Tag{},
+		Media:     []*media{},
+		Raw:       activity.Raw,
+	}
+
+	if object.Type == "Article" {
+		p.Title = object.Name
+	}
+
+	// Objects with a single language tell it through their content map.
+	if len(object.ContentMap) == 1 {
+		for language, content := range object.ContentMap {
+			p.Language = language
+			if p.Content == "" {
+				p.Content = content
+			}
+		}
+	}
+
+	for _, tag := range object.Tag {
+		if tag.Type == "Hashtag" && tag.Name != "" {
+			name := "#" + strings.ToLower(strings.TrimPrefix(tag.Name, "#"))
+			p.Hashtags = append(p.Hashtags, &data.Tag{Type: data.TagHashtag, Name: name, Href: tag.Href})
+		}
+	}
+
+	for _, attachment := range object.Attachment {
+		// Outboxes don't link previews of videos, so only images are kept.
+		if !strings.HasPrefix(attachment.MediaType, "image/") {
+			continue
+		}
+		if href := attachment.Href(); href != "" {
+			p.Media = append(p.Media, &media{
+				Type:        data.MediaPhoto,
+				MIMEType:    attachment.MediaType,
+				URL:         href,
+				Description: attachment.Name,
+				Width:       attachment.Width,
+				Height:      attachment.Height,
+			})
+		}
+	}
+
+	return p
+}
+
+// postFromAnnounce turns a boost of an outbox into a post.
+func postFromAnnounce(activity *Activity) *post {
+	return &post{
+		URI:       activity.ID,
+		Published: activity.Published.UTC(),
+		Shared:    &sharedPost{URI: activity.ObjectID()},
+		Hashtags:  []*data.Tag{},
+		Media:     []*media{},
+		Raw:       activity.Raw,
+	}
+}
@@ -0,0 +1,247 @@
+// Package mastodon harvests the public posts of a fediverse account,
+// either through the Mastodon API or from the account's ActivityPub outbox.
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+const (
+	SourceType = "mastodon"
+
+	// How the posts of the account are read.
+	ProtocolAPI         = "api"
+	ProtocolActivityPub = "activitypub"
+
+	// The maximum number of statuses which Mastodon returns at once.
+	pageSize = 40
+)
+
+// Options of a Mastodon source.
+type Options struct {
+	// Account is the address of the account, e.g. @dustin@mastodon.social.
+	Account string `json:"account"`
+
+	// Server is the base URL of the server, if it differs
+	// from the domain of the account, e.g. https://social.example.com.
+	Server string `json:"server,omitempty"`
+
+	// Protocol is either "api" (default), which reads the Mastodon API,
+	// or "activitypub", which reads the account's outbox and works
+	// with other fediverse servers too.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Token is an optional access token of the Mastodon API.
+	Token string `json:"token,omitempty"`
+
+	// Boosts and replies to other accounts are skipped unless they are
+	// enabled. Replies to the account itself are always harvested,
+	// so that threads are kept together.
+	Boosts  bool `json:"boosts,omitempty"`
+	Replies bool `json:"replies,omitempty"`
+}
+
+func init() {
+	source.Register(SourceType, newSource)
+}
+
+// mastodonSource harvests the posts of a fediverse account.
+type mastodonSource struct {
+	env      *source.Env
+	options  *Options
+	username string
+	domain   string
+	server   string
+	client   *Client
+}
+
+func newSource(env *source.Env, cfg *config.Source) (source.Source, error) {
+	var options Options
+	if err := cfg.DecodeOptions(&options); err != nil {
+		return nil, err
+	}
+
+	username, domain, ok := strings.Cut(strings.TrimPrefix(options.Account, "@"), "@")
+	if !ok || username == "" || domain == "" {
+		return nil, fmt.Errorf("%s source of user %s needs an account of the form @user@host", cfg.Key(), env.User.Username)
+	}
+
+	switch options.Protocol {
+	case "":
+		options.Protocol = ProtocolAPI
+	case ProtocolAPI, ProtocolActivityPub:
+	default:
+		return nil, fmt.Errorf("%s source of user %s has an invalid protocol: %s", cfg.Key(), env.User.Username, options.Protocol)
+	}
+
+	server := strings.TrimSuffix(options.Server, "/")
+	if server == "" {
+		server = "https://" + domain
+	}
+
+	return &mastodonSource{
+		env:      env,
+		options:  &options,
+		username: username,
+		domain:   domain,
+		server:   server,
+		client:   NewClient(options.Token),
+	}, nil
+}
+
+// cursor is where the harvest of an account continues.
+type cursor struct {
+	// The account of the API and the newest status which has been
+	// fetched. The since ID and the max ID of an unfinished harvest
+	// page backwards from the newest status.
+	AccountID string `json:"accountID,omitempty"`
+	LatestID  string `json:"latestID,omitempty"`
+	SinceID   string `json:"sinceID,omitempty"`
+	MaxID     string `json:"maxID,omitempty"`
+
+	// The actor whose outbox is read, the newest activity which has
+	// been fetched and the next page of an unfinished harvest.
+	// Outboxes can't be filtered, so the harvest stops at the
+	// newest activity of the previous one.
+	Actor  string `json:"actor,omitempty"`
+	Latest int64  `json:"latest,omitempty"`
+	Since  int64  `json:"since,omitempty"`
+	Next   string `json:"next,omitempty"`
+}
+
+func (s *mastodonSource) Fetch(ctx context.Context, value string) (*source.Page, error) {
+	c := &cursor{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), c); err != nil {
+			return nil, fmt.Errorf("error deserializing Mastodon cursor: %w", err)
+		}
+	}
+
+	var posts []*post
+	var err error
+	if s.options.Protocol == ProtocolActivityPub {
+		posts, err = s.fetchOutbox(ctx, c)
+	} else {
+		posts, err = s.fetchStatuses(ctx, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Statuses and outbox activities are listed newest first. Toots get
+	// saved by publication date, so that a self reply is saved after
+	// the post which it continues.
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Published.Before(posts[j].Published) })
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing Mastodon cursor: %w", err)
+	}
+
+	page := &source.Page{
+		Cursor: string(encoded),
+		More:   c.MaxID != "" || c.Next != "",
+	}
+	for _, p := range posts {
+		page.Items = append(page.Items, p)
+	}
+	return page, nil
+}
+
+// TootID derives the ID of the toot from the URI of a post,
+// which stays the same when the post gets edited.
+func TootID(userID uid.UserID, uri string) uid.TootID {
+	h := fnv.New64a()
+	h.Write([]byte(uri))
+	return uid.New(userID, uid.Mastodon, h.Sum64())
+}
+
+func (s *mastodonSource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	p, ok := item.(*post)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item of Mastodon source: %T", item)
+	}
+
+	toot := &data.Toot{
+		ID:         TootID(s.env.User.ID, p.URI),
+		UserID:     s.env.User.ID,
+		CreatedAt:  p.Published,
+		SourceType: uid.Mastodon,
+		SourceID:   p.URI,
+		SourceData: string(p.Raw),
+		Summary:    p.Summary,
+		Sensitive:  p.Sensitive,
+		Language:   p.Language,
+		Tags:       p.Hashtags,
+		Kind:       data.KindPost,
+	}
+
+	if shared := p.Shared; shared != nil {
+		// A boost gets announced, but the original post is
+		// kept as a link card for the toot's HTML page.
+		link := shared.URL
+		if link == "" {
+			link = shared.URI
+		}
+		label := link
+		if shared.Author != "" {
+			label = "@" + shared.Author
+		}
+		toot.Kind = data.KindRepost
+		toot.SharedURL = shared.URI
+		toot.TextHTML = fmt.Sprintf(`<p>RT <a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a></p>`,
+			html.EscapeString(link), html.EscapeString(label))
+		if shared.Content != "" {
+			toot.TextHTML += "<blockquote>" + sanitize.HTML(shared.Content) + "</blockquote>"
+		}
+		toot.TextOriginal = "RT " + label
+		return toot, nil
+	}
+
+	if p.Title != "" {
+		toot.Kind = data.KindArticle
+		toot.Title = p.Title
+	}
+	toot.TextHTML = sanitize.HTML(p.Content)
+	toot.TextOriginal = sanitize.Text(toot.TextHTML)
+
+	var err error
+	if toot.InReplyToID, err = s.threadParent(ctx, p.InReplyTo); err != nil {
+		return nil, err
+	}
+
+	return toot, nil
+}
+
+// threadParent returns the ID of the toot which a self reply continues.
+// Replies to posts which haven't been harvested, e.g. private ones or
+// ones from before the start date, start a thread of their own.
+func (s *mastodonSource) threadParent(ctx context.Context, parentURI string) (uid.TootID, error) {
+	if parentURI == "" {
+		return "", nil
+	}
+
+	userID := s.env.User.ID
+	tootID, err := s.env.DataService.SourceTootID(ctx, TootID(userID, parentURI), userID, uid.Mastodon, parentURI)
+	if err != nil {
+		return "", err
+	}
+	if tootID == "" {
+		plog.Debugf("Previous post %s of thread has not been harvested", parentURI)
+	}
+
+	return tootID, nil
+}
@@ -0,0 +1,262 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+)
+
+// fixtures maps the paths of the stand-in for a Mastodon server
+// to the recorded responses which it serves.
+var fixtures = map[string]string{
+	"/api/v1/accounts/lookup":                                  "api/account.json",
+	"/api/v1/accounts/109348/statuses":                         "api/statuses.json",
+	"/.well-known/webfinger":                                   "activitypub/webfinger.json",
+	"/users/dustin":                                            "activitypub/actor.json",
+	"/users/dustin/outbox":                                     "activitypub/outbox.json",
+	"/users/dustin/outbox?page=true":                           "activitypub/outbox_page1.json",
+	"/users/dustin/outbox?max_id=109700000000000004&page=true": "activitypub/outbox_page2.json",
+}
+
+// newTestSource returns a source whose client talks to a stand-in for
+// a Mastodon server, which also serves the images of the fixtures.
+func newTestSource(t *testing.T, options *Options, requests *[]*http.Request) *mastodonSource {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/system/") {
+			w.Write([]byte("image"))
+			return
+		}
+		*requests = append(*requests, r)
+
+		fixture, ok := fixtures[r.URL.Path+"?"+r.URL.RawQuery]
+		if !ok {
+			fixture, ok = fixtures[r.URL.Path]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(string(body), "https://mastodon.example", server.URL)))
+	}))
+	t.Cleanup(server.Close)
+
+	options.Account = "@dustin@mastodon.example"
+	options.Server = server.URL
+	rawOptions, _ := json.Marshal(options)
+	src, err := newSource(sourcetest.NewEnv(t), &config.Source{Type: SourceType, Options: rawOptions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src.(*mastodonSource)
+}
+
+func itemURIs(page *source.Page) string {
+	uris := []string{}
+	for _, item := range page.Items {
+		uri := item.(*post).URI
+		uris = append(uris, uri[strings.LastIndex(uri, "/statuses/")+len("/statuses/"):])
+	}
+	return strings.Join(uris, ",")
+}
+
+// saveItems saves the toots of a page and maps them to the IDs of their statuses.
+func saveItems(t *testing.T, src *mastodonSource, page *source.Page) map[string]*data.Toot {
+	toots := make(map[string]*data.Toot)
+	for _, toot := range sourcetest.SaveItems(t, src.env, src, SourceType, page) {
+		toots[toot.SourceID[strings.LastIndex(toot.SourceID, "/")+1:]] = toot
+	}
+	return toots
+}
+
+func Test_Source_Fetch_API(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &Options{}, &requests)
+
+	page, err := src.Fetch(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Private statuses, boosts, replies to other accounts and statuses
+	// before the start date are skipped. The rest is sorted from
+	// oldest to newest.
+	if uris := itemURIs(page); uris != "109700000000000004,109700000000000005" {
+		t.Errorf("unexpected items: %s", uris)
+	}
+	if page.More {
+		t.Error("expected no more pages after the start date")
+	}
+
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.AccountID != "109348" || c.LatestID != "109700000000000006" || c.MaxID != "" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	query := requests[1].URL.Query()
+	if query.Get("exclude_replies") != "true" || query.Get("exclude_reblogs") != "true" || query.Get("limit") != "40" {
+		t.Errorf("unexpected query: %s", requests[1].URL.RawQuery)
+	}
+
+	if _, err = os.Stat(src.env.Settings.Storage.ProfileImageFullFilePath(1, ".png")); err != nil {
+		t.Errorf("profile image has not been downloaded: %v", err)
+	}
+
+	// The next harvest only asks for newer statuses.
+	if _, err = src.Fetch(context.Background(), page.Cursor); err != nil {
+		t.Fatal(err)
+	}
+	if sinceID := requests[3].URL.Query().Get("since_id"); sinceID != "109700000000000006" {
+		t.Errorf("unexpected since ID: %s", sinceID)
+	}
+}
+
+func Test_Source_Toot_API(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &Options{Boosts: true, Replies: true}, &requests)
+
+	page, err := src.Fetch(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uris := itemURIs(page); uris != "109700000000000003,109700000000000004,109700000000000005,109700000000000006/activity" {
+		t.Fatalf("unexpected items: %s", uris)
+	}
+	toots := saveItems(t, src, page)
+
+	post := toots["109700000000000004"]
+	if post.Kind != data.KindPost || post.Language != "en" || post.Summary != "" {
+		t.Errorf("unexpected toot: %+v", post)
+	}
+	if !strings.HasPrefix(post.TextHTML, "<p>Hello <a href=") || strings.Contains(post.TextHTML, "class=") {
+		t.Errorf("unexpected HTML: %s", post.TextHTML)
+	}
+	if post.TextOriginal != "Hello #Sabertoot https://example.com/" {
+		t.Errorf("unexpected text: %q", post.TextOriginal)
+	}
+	if len(post.Tags) != 1 || post.Tags[0].Name != "#sabertoot" {
+		t.Errorf("unexpected tags: %+v", post.Tags)
+	}
+
+	// Self replies continue the thread, replies to others don't.
+	reply := toots["109700000000000005"]
+	if reply.InReplyToID != post.ID || !reply.Sensitive || reply.Summary != "Pictures" {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+	if toots["109700000000000003"].InReplyToID != "" {
+		t.Error("reply to another account must not be part of a thread")
+	}
+
+	// GIFs are kept as previews and audio is skipped.
+	if len(reply.Media) != 2 {
+		t.Fatalf("expected 2 media, got %d", len(reply.Media))
+	}
+	if reply.Media[0].Type != data.MediaPhoto || reply.Media[0].AltText != "A photo" || reply.Media[0].Width != 640 {
+		t.Errorf("unexpected photo: %+v", reply.Media[0])
+	}
+	if reply.Media[1].Type != data.MediaGIF || !strings.HasSuffix(reply.Media[1].SourceURL, "/small/anim.png") {
+		t.Errorf("unexpected GIF: %+v", reply.Media[1])
+	}
+
+	boost := toots["activity"]
+	if boost.Kind != data.KindRepost || boost.SharedURL != "https://other.example/users/alice/statuses/1" {
+		t.Errorf("unexpected boost: %+v", boost)
+	}
+	if !strings.Contains(boost.TextHTML, "@alice@other.example") || strings.Contains(boost.TextHTML, "script") {
+		t.Errorf("unexpected HTML of boost: %s", boost.TextHTML)
+	}
+}
+
+func Test_Source_Fetch_Outbox(t *testing.T) {
+	requests := []*http.Request{}
+	src := newTestSource(t, &Options{Protocol: ProtocolActivityPub, Boosts: true}, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uris := itemURIs(page); uris != "109700000000000005,109700000000000006/activity" {
+		t.Errorf("unexpected items: %s", uris)
+	}
+	if !page.More {
+		t.Error("expected more pages")
+	}
+	first := saveItems(t, src, page)
+
+	page, err = src.Fetch(ctx, page.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uris := itemURIs(page); uris != "109700000000000004" {
+		t.Errorf("unexpected items: %s", uris)
+	}
+	if page.More {
+		t.Error("expected no more pages after the start date")
+	}
+	second := saveItems(t, src, page)
+
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Latest != time.Date(2023, 1, 12, 10, 0, 0, 0, time.UTC).Unix() || c.Next != "" || !strings.HasSuffix(c.Actor, "/users/dustin") {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	post := second["109700000000000004"]
+	if post.Language != "en" || len(post.Tags) != 1 || post.Tags[0].Name != "#sabertoot" {
+		t.Errorf("unexpected toot: %+v", post)
+	}
+
+	// Outboxes only link the previews of images.
+	reply := first["109700000000000005"]
+	if len(reply.Media) != 1 || reply.Media[0].MIMEType != "image/png" {
+		t.Errorf("unexpected media: %+v", reply.Media)
+	}
+
+	boost := first["activity"]
+	if boost.Kind != data.KindRepost || boost.SharedURL != "https://other.example/users/alice/statuses/1" {
+		t.Errorf("unexpected boost: %+v", boost)
+	}
+}
+
+func Test_Source_Fetch_RateLimited(t *testing.T) {
+	reset := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Reset", reset.Format(time.RFC3339Nano))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	rawOptions, _ := json.Marshal(&Options{Account: "@dustin@mastodon.example", Server: server.URL})
+	src, err := newSource(sourcetest.NewEnv(t), &config.Source{Type: SourceType, Options: rawOptions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The harvester defers the source until the server's reset.
+	_, err = src.Fetch(context.Background(), "")
+	if actual, ok := source.RetryAfter(err); !ok || !actual.Equal(reset) {
+		t.Errorf("expected the source to be deferred until %s, got %s %v", reset, actual, err)
+	}
+}
@@ -0,0 +1,291 @@
+package mastodon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Mastodon API
+// ---
+
+// Account is an account of the Mastodon API.
+type Account struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Acct     string `json:"acct"`
+	URL      string `json:"url"`
+	Avatar   string `json:"avatar"`
+}
+
+// Status is a post of the Mastodon API.
+type Status struct {
+	ID                 string             `json:"id"`
+	URI                string             `json:"uri"`
+	URL                string             `json:"url"`
+	CreatedAt          time.Time          `json:"created_at"`
+	EditedAt           *time.Time         `json:"edited_at"`
+	Account            *Account           `json:"account"`
+	Content            string             `json:"content"`
+	SpoilerText        string             `json:"spoiler_text"`
+	Sensitive          bool               `json:"sensitive"`
+	Language           string             `json:"language"`
+	Visibility         string             `json:"visibility"`
+	InReplyToID        string             `json:"in_reply_to_id"`
+	InReplyToAccountID string             `json:"in_reply_to_account_id"`
+	Reblog             *Status            `json:"reblog"`
+	MediaAttachments   []*MediaAttachment `json:"media_attachments"`
+	Tags               []*StatusTag       `json:"tags"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// MediaAttachment is a file which has been attached to a status.
+type MediaAttachment struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	PreviewURL  string `json:"preview_url"`
+	Description string `json:"description"`
+	Meta        struct {
+		Original struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"original"`
+	} `json:"meta"`
+}
+
+// StatusTag is a hashtag of a status.
+type StatusTag struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Visibilities of a status.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+)
+
+// IsPublic returns true if the status can be seen by anyone.
+func (s *Status) IsPublic() bool {
+	return s.Visibility == VisibilityPublic || s.Visibility == VisibilityUnlisted
+}
+
+func parseStatus(data []byte) (*Status, error) {
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("error deserialising status: %w", err)
+	}
+	if status.ID == "" || status.URI == "" {
+		return nil, fmt.Errorf("status is missing id or uri")
+	}
+	status.Raw = data
+	return &status, nil
+}
+
+// ActivityPub
+// ---
+
+// Actor is the subset of an ActivityPub actor which is needed to read
+// its outbox. Icon can be a single image or a list of images.
+type Actor struct {
+	ID                string          `json:"id"`
+	PreferredUsername string          `json:"preferredUsername"`
+	Outbox            string          `json:"outbox"`
+	Icon              json.RawMessage `json:"icon"`
+}
+
+// IconURL returns the URL of the actor's profile image.
+func (a *Actor) IconURL() string {
+	var icon Attachment
+	if err := json.Unmarshal(a.Icon, &icon); err == nil {
+		return icon.Href()
+	}
+	var icons []Attachment
+	if err := json.Unmarshal(a.Icon, &icons); err == nil && len(icons) > 0 {
+		return icons[0].Href()
+	}
+	return ""
+}
+
+// CollectionPage is a page of an (ordered) collection,
+// or the collection itself if it doesn't have pages.
+type CollectionPage struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	First        json.RawMessage   `json:"first"`
+	Next         string            `json:"next"`
+	OrderedItems []json.RawMessage `json:"orderedItems"`
+	Items        []json.RawMessage `json:"items"`
+}
+
+// FirstPage returns the first page if it is embedded in the collection.
+func (c *CollectionPage) FirstPage() *CollectionPage {
+	var first CollectionPage
+	if err := json.Unmarshal(c.First, &first); err != nil || first.Type == "" {
+		return nil
+	}
+	return &first
+}
+
+// Activities returns the items of the page, whichever property holds them.
+func (c *CollectionPage) Activities() []json.RawMessage {
+	if len(c.OrderedItems) > 0 {
+		return c.OrderedItems
+	}
+	return c.Items
+}
+
+// Activity is an activity of an outbox. The object is either
+// embedded, as for a Create, or a plain ID, as for an Announce.
+type Activity struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Published time.Time       `json:"published"`
+	To        audience        `json:"to"`
+	CC        audience        `json:"cc"`
+	Object    json.RawMessage `json:"object"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// Object is a Note or Article which has been created by an activity.
+type Object struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	URL        json.RawMessage   `json:"url"`
+	Name       string            `json:"name"`
+	Summary    string            `json:"summary"`
+	Content    string            `json:"content"`
+	ContentMap map[string]string `json:"contentMap"`
+	Sensitive  bool              `json:"sensitive"`
+	InReplyTo  string            `json:"inReplyTo"`
+	Published  time.Time         `json:"published"`
+	Attachment []*Attachment     `json:"attachment"`
+	Tag        []*ObjectTag      `json:"tag"`
+}
+
+// Attachment is a file which has been attached to an object.
+type Attachment struct {
+	Type      string          `json:"type"`
+	MediaType string          `json:"mediaType"`
+	URL       json.RawMessage `json:"url"`
+	Name      string          `json:"name"`
+	Width     int             `json:"width"`
+	Height    int             `json:"height"`
+}
+
+// Href returns the URL of the attachment, which
+// can be a plain URL or a Link object.
+func (a *Attachment) Href() string {
+	return rawHref(a.URL)
+}
+
+// ObjectTag is a hashtag, mention or emoji of an object.
+type ObjectTag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+// Public is the special collection which addresses everyone.
+const Public = "https://www.w3.org/ns/activitystreams#Public"
+
+// IsPublic returns true if the activity has been addressed to everyone,
+// which is the case for both public and unlisted posts.
+func (a *Activity) IsPublic() bool {
+	return a.To.isPublic() || a.CC.isPublic()
+}
+
+// audience is a list of recipients, which
+// is sent as a plain ID if it has only one.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*a = audience{id}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) isPublic() bool {
+	for _, recipient := range a {
+		if recipient == Public || recipient == "as:Public" || recipient == "Public" {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbeddedObject returns the object which has been created by the activity.
+func (a *Activity) EmbeddedObject() (*Object, error) {
+	var object Object
+	if err := json.Unmarshal(a.Object, &object); err != nil {
+		return nil, fmt.Errorf("error deserialising object of %s: %w", a.ID, err)
+	}
+	if object.ID == "" {
+		return nil, fmt.Errorf("object of %s is not embedded", a.ID)
+	}
+	return &object, nil
+}
+
+// ObjectID returns the ID of the activity's object.
+func (a *Activity) ObjectID() string {
+	return rawID(a.Object)
+}
+
+func parseActivity(data []byte) (*Activity, error) {
+	var activity Activity
+	if err := json.Unmarshal(data, &activity); err != nil {
+		return nil, fmt.Errorf("error deserialising activity: %w", err)
+	}
+	if activity.ID == "" || activity.Type == "" {
+		return nil, fmt.Errorf("activity is missing id or type")
+	}
+	activity.Raw = data
+	return &activity, nil
+}
+
+// rawID returns the ID of a property which can either
+// be a plain ID or an embedded object.
+func rawID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		return obj.ID
+	}
+	return ""
+}
+
+// rawHref returns the first URL of a property which can be a plain
+// URL, a Link object or a list of either.
+func rawHref(raw json.RawMessage) string {
+	var href string
+	if err := json.Unmarshal(raw, &href); err == nil {
+		return href
+	}
+	var link struct {
+		Href string `json:"href"`
+	}
+	if err := json.Unmarshal(raw, &link); err == nil && link.Href != "" {
+		return link.Href
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, elem := range list {
+			if href := rawHref(elem); href != "" {
+				return href
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package micropub
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Properties of a post in the microformats2 JSON format. Values are
+// either strings or objects, e.g. {"html": "..."} for content or
+// {"value": "...", "alt": "..."} for photos.
+type Properties map[string][]any
+
+// Entry holds the properties of an h-entry which toots are made of.
+type Entry struct {
+	// Name is the title of an article.
+	Name string
+
+	// Content is either plain text, which is read as Markdown, or HTML.
+	Content     string
+	ContentHTML string
+
+	// Summary is shown as the content warning of the toot.
+	Summary    string
+	Categories []string
+	Published  time.Time
+	InReplyTo  string
+	Photos     []*Photo
+}
+
+// Photo is an image which has been referenced by its URL.
+type Photo struct {
+	URL string
+	Alt string
+}
+
+// Entry returns the properties which toots are made of.
+func (p Properties) Entry() (*Entry, error) {
+	e := &Entry{
+		Name:       p.text("name"),
+		Summary:    p.text("summary"),
+		Categories: []string{},
+		InReplyTo:  p.text("in-reply-to"),
+		Photos:     []*Photo{},
+	}
+
+	for _, value := range p["content"] {
+		switch v := value.(type) {
+		case string:
+			e.Content += v
+		case map[string]any:
+			if html, ok := v["html"].(string); ok {
+				e.ContentHTML += html
+			} else if text, ok := v["value"].(string); ok {
+				e.Content += text
+			}
+		}
+	}
+
+	for _, value := range p["category"] {
+		if s, ok := value.(string); ok {
+			e.Categories = append(e.Categories, s)
+		}
+	}
+
+	if published := p.text("published"); published != "" {
+		t, err := time.Parse(time.RFC3339, published)
+		if err != nil {
+			return nil, invalidRequest("published is not a valid date: %s", published)
+		}
+		e.Published = t.UTC()
+	}
+
+	for _, value := range p["photo"] {
+		switch v := value.(type) {
+		case string:
+			e.Photos = append(e.Photos, &Photo{URL: v})
+		case map[string]any:
+			url, _ := v["value"].(string)
+			alt, _ := v["alt"].(string)
+			if url == "" {
+				return nil, invalidRequest("photo without a url")
+			}
+			e.Photos = append(e.Photos, &Photo{URL: url, Alt: alt})
+		}
+	}
+
+	if e.Content == "" && e.ContentHTML == "" && len(e.Photos) == 0 {
+		return nil, invalidRequest("a post needs content or a photo")
+	}
+
+	return e, nil
+}
+
+// text returns the first value of a property if it is a string.
+func (p Properties) text(name string) string {
+	for _, value := range p[name] {
+		if s, ok := value.(string); ok {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// Update applies the changes of an update request to a copy of the
+// properties. Replacements are applied first, then additions and
+// finally deletions.
+func (p Properties) Update(req *Request) Properties {
+	result := Properties{}
+	for name, values := range p {
+		result[name] = append([]any{}, values...)
+	}
+
+	for name, values := range req.Replace {
+		result[name] = append([]any{}, values...)
+	}
+	for name, values := range req.Add {
+		result[name] = append(result[name], values...)
+	}
+	for name, values := range req.Delete {
+		kept := []any{}
+		for _, value := range result[name] {
+			if !containsValue(values, value) {
+				kept = append(kept, value)
+			}
+		}
+		result[name] = kept
+	}
+	for _, name := range req.DeleteAll {
+		delete(result, name)
+	}
+
+	for name, values := range result {
+		if len(values) == 0 {
+			delete(result, name)
+		}
+	}
+	return result
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the given properties or all of them, if none are
+// given, in the format of a source query.
+func (p Properties) Select(names []string) map[string]any {
+	properties := p
+	if len(names) > 0 {
+		properties = Properties{}
+		for _, name := range names {
+			if values, ok := p[name]; ok {
+				properties[name] = values
+			}
+		}
+	}
+
+	result := map[string]any{"properties": properties}
+	if len(names) == 0 {
+		result["type"] = []string{"h-entry"}
+	}
+	return result
+}
+
+// DecodeProperties reads the properties which have
+// been stored as the source data of a toot.
+func DecodeProperties(sourceData string) (Properties, error) {
+	p := Properties{}
+	if err := json.Unmarshal([]byte(sourceData), &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
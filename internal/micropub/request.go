@@ -0,0 +1,178 @@
+// Package micropub parses the requests of the W3C Micropub protocol,
+// which clients use to create, update and delete posts, and turns the
+// properties of posts into toots.
+package micropub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// Actions of a request.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionUndelete = "undelete"
+)
+
+// Request is a Micropub request, which has either been
+// form-encoded or sent as JSON.
+type Request struct {
+	Action string
+
+	// URL of the post which is updated or deleted.
+	URL string
+
+	// Type of the created post without the "h-" prefix, e.g. "entry".
+	Type string
+
+	// Properties of the created post.
+	Properties Properties
+
+	// Changes of an update.
+	Replace Properties
+	Add     Properties
+	Delete  Properties
+
+	// DeleteAll lists the properties which an update removes.
+	DeleteAll []string
+
+	// Files of a multipart request by property, e.g. photo.
+	Files map[string][]*multipart.FileHeader
+}
+
+// Error is a request which can't be processed. Code is one
+// of the errors which the Micropub specification defines.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Errors of the Micropub specification.
+const (
+	ErrorInvalidRequest    = "invalid_request"
+	ErrorUnauthorized      = "unauthorized"
+	ErrorForbidden         = "forbidden"
+	ErrorInsufficientScope = "insufficient_scope"
+)
+
+func invalidRequest(format string, args ...any) *Error {
+	return &Error{Code: ErrorInvalidRequest, Description: fmt.Sprintf(format, args...)}
+}
+
+// Parameters of form-encoded requests which aren't properties.
+var formParameters = map[string]bool{
+	"h":            true,
+	"action":       true,
+	"url":          true,
+	"access_token": true,
+}
+
+// ParseForm parses a form-encoded or multipart request.
+func ParseForm(values url.Values, files map[string][]*multipart.FileHeader) (*Request, error) {
+	req := &Request{
+		Action:     values.Get("action"),
+		URL:        values.Get("url"),
+		Type:       values.Get("h"),
+		Properties: Properties{},
+		Files:      make(map[string][]*multipart.FileHeader),
+	}
+
+	for key, list := range values {
+		if formParameters[key] {
+			continue
+		}
+		name := strings.TrimSuffix(key, "[]")
+		for _, value := range list {
+			req.Properties[name] = append(req.Properties[name], value)
+		}
+	}
+	for key, list := range files {
+		name := strings.TrimSuffix(key, "[]")
+		req.Files[name] = append(req.Files[name], list...)
+	}
+
+	if req.Action == ActionUpdate {
+		return nil, invalidRequest("updates have to be sent as JSON")
+	}
+	return req.validate()
+}
+
+// jsonRequest is the body of a JSON request.
+type jsonRequest struct {
+	Type       []string        `json:"type"`
+	Properties Properties      `json:"properties"`
+	Action     string          `json:"action"`
+	URL        string          `json:"url"`
+	Replace    Properties      `json:"replace"`
+	Add        Properties      `json:"add"`
+	Delete     json.RawMessage `json:"delete"`
+}
+
+// ParseJSON parses a request which has been sent as JSON.
+func ParseJSON(r io.Reader) (*Request, error) {
+	var body jsonRequest
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return nil, invalidRequest("the body is not valid: %s", err.Error())
+	}
+
+	req := &Request{
+		Action:     body.Action,
+		URL:        body.URL,
+		Properties: body.Properties,
+		Replace:    body.Replace,
+		Add:        body.Add,
+	}
+	if req.Properties == nil {
+		req.Properties = Properties{}
+	}
+	if len(body.Type) > 0 {
+		req.Type = body.Type[0]
+	}
+
+	// Deletions either name whole properties
+	// or single values of properties.
+	if len(body.Delete) > 0 {
+		if err := json.Unmarshal(body.Delete, &req.DeleteAll); err != nil {
+			if err = json.Unmarshal(body.Delete, &req.Delete); err != nil {
+				return nil, invalidRequest("delete must be a list of properties or an object of values")
+			}
+		}
+	}
+
+	return req.validate()
+}
+
+func (req *Request) validate() (*Request, error) {
+	if req.Action == "" {
+		req.Action = ActionCreate
+	}
+	req.Type = strings.TrimPrefix(req.Type, "h-")
+
+	switch req.Action {
+	case ActionCreate:
+		if req.Type == "" {
+			req.Type = "entry"
+		}
+		if req.Type != "entry" {
+			return nil, invalidRequest("only entries can be created, not %s", req.Type)
+		}
+	case ActionUpdate, ActionDelete, ActionUndelete:
+		if req.URL == "" {
+			return nil, invalidRequest("%s needs the url of a post", req.Action)
+		}
+	default:
+		return nil, invalidRequest("unknown action: %s", req.Action)
+	}
+
+	return req, nil
+}
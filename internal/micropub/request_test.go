@@ -0,0 +1,163 @@
+package micropub
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseForm(t *testing.T) {
+	values := url.Values{
+		"h":            {"entry"},
+		"content":      {"Hello *world*"},
+		"category[]":   {"sabertoot", "indieweb"},
+		"photo":        {"https://example.com/cat.jpg"},
+		"access_token": {"secret"},
+	}
+
+	req, err := ParseForm(values, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Action != ActionCreate || req.Type != "entry" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	expected := Properties{
+		"content":  {"Hello *world*"},
+		"category": {"sabertoot", "indieweb"},
+		"photo":    {"https://example.com/cat.jpg"},
+	}
+	if !reflect.DeepEqual(req.Properties, expected) {
+		t.Errorf("unexpected properties: %+v", req.Properties)
+	}
+
+	for _, values := range []url.Values{
+		{"h": {"event"}, "name": {"Party"}},
+		{"action": {"delete"}},
+		{"action": {"update"}, "url": {"https://example.com/1"}},
+		{"action": {"publish"}},
+	} {
+		if _, err = ParseForm(values, nil); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+}
+
+func Test_ParseJSON(t *testing.T) {
+	req, err := ParseJSON(strings.NewReader(`{
+		"type": ["h-entry"],
+		"properties": {
+			"name": ["Release"],
+			"content": [{"html": "<p>Out <b>now</b></p>"}],
+			"photo": [{"value": "https://example.com/cat.jpg", "alt": "A cat"}],
+			"published": ["2023-01-05T10:00:00+01:00"]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := req.Properties.Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "Release" || entry.ContentHTML != "<p>Out <b>now</b></p>" ||
+		!entry.Published.Equal(time.Date(2023, 1, 5, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if len(entry.Photos) != 1 || entry.Photos[0].URL != "https://example.com/cat.jpg" || entry.Photos[0].Alt != "A cat" {
+		t.Errorf("unexpected photos: %+v", entry.Photos)
+	}
+
+	for _, body := range []string{
+		`{"properties": {"content": "not a list"}}`,
+		`{"action": "update"}`,
+		`{"action": "update", "url": "https://example.com/1", "delete": "category"}`,
+	} {
+		if _, err = ParseJSON(strings.NewReader(body)); err == nil {
+			t.Errorf("expected an error for %s", body)
+		}
+	}
+}
+
+func Test_Properties_Update(t *testing.T) {
+	properties := Properties{
+		"content":  {"Hello"},
+		"category": {"one", "two", "three"},
+		"summary":  {"CW"},
+	}
+
+	testCases := []struct {
+		Name     string
+		Body     string
+		Expected Properties
+	}{
+		{
+			Name:     "replace and add",
+			Body:     `{"action": "update", "url": "u", "replace": {"content": ["Bye"]}, "add": {"category": ["four"]}}`,
+			Expected: Properties{"content": {"Bye"}, "category": {"one", "two", "three", "four"}, "summary": {"CW"}},
+		},
+		{
+			Name:     "delete values",
+			Body:     `{"action": "update", "url": "u", "delete": {"category": ["two", "three"]}}`,
+			Expected: Properties{"content": {"Hello"}, "category": {"one"}, "summary": {"CW"}},
+		},
+		{
+			Name:     "delete properties",
+			Body:     `{"action": "update", "url": "u", "delete": ["summary", "category"]}`,
+			Expected: Properties{"content": {"Hello"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req, err := ParseJSON(strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := properties.Update(req); !reflect.DeepEqual(actual, tc.Expected) {
+				t.Errorf("expected %+v, got %+v", tc.Expected, actual)
+			}
+		})
+	}
+
+	if len(properties["category"]) != 3 {
+		t.Errorf("the original properties have been changed: %+v", properties)
+	}
+}
+
+func Test_Toot(t *testing.T) {
+	properties := Properties{
+		"content":  {"Hello **world** <script>x</script>"},
+		"category": {"Sabertoot", "#sabertoot", "https://example.com/alice"},
+		"summary":  {"Greetings"},
+	}
+
+	toot, _, err := Toot(1, "abc", properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toot.ID != TootID(1, "abc") || toot.SourceName != SourceName || !toot.Sensitive || toot.Summary != "Greetings" {
+		t.Errorf("unexpected toot: %+v", toot)
+	}
+	if toot.TextHTML != "<p>Hello <strong>world</strong> &lt;script&gt;x&lt;/script&gt;</p>" {
+		t.Errorf("unexpected HTML: %s", toot.TextHTML)
+	}
+	if len(toot.Tags) != 1 || toot.Tags[0].Name != "#sabertoot" {
+		t.Errorf("unexpected tags: %+v", toot.Tags)
+	}
+
+	decoded, err := DecodeProperties(toot.SourceData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded["category"]) != 3 {
+		t.Errorf("unexpected source data: %s", toot.SourceData)
+	}
+
+	if _, _, err = Toot(1, "abc", Properties{"name": {"Empty"}}); err == nil {
+		t.Error("expected an error for a post without content")
+	}
+}
@@ -0,0 +1,83 @@
+package micropub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/markdown"
+	"github.com/sabertoot/server/internal/sanitize"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// SourceName is the source of all toots which have been written on
+// Sabertoot. It isn't configured like the sources which get harvested.
+const SourceName = "local"
+
+// NewSourceID returns a random ID for a new post.
+func NewSourceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating source ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TootID derives the ID of the toot from the source ID of a post.
+func TootID(userID uid.UserID, sourceID string) uid.TootID {
+	h := fnv.New64a()
+	h.Write([]byte(sourceID))
+	return uid.New(userID, uid.Local, h.Sum64())
+}
+
+// Toot turns the properties of a post into a toot. The properties are
+// kept as the source data, so that the post can be updated later.
+// Media and the position in a thread are up to the caller.
+func Toot(userID uid.UserID, sourceID string, properties Properties) (*data.Toot, *Entry, error) {
+	entry, err := properties.Entry()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sourceData, err := json.Marshal(properties)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error serializing properties: %w", err)
+	}
+
+	createdAt := entry.Published
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	toot := &data.Toot{
+		ID:         TootID(userID, sourceID),
+		UserID:     userID,
+		CreatedAt:  createdAt,
+		SourceType: uid.Local,
+		SourceID:   sourceID,
+		SourceData: string(sourceData),
+		Summary:    entry.Summary,
+		Sensitive:  entry.Summary != "",
+		Tags:       data.Hashtags(entry.Categories),
+		Kind:       data.KindPost,
+		SourceName: SourceName,
+	}
+
+	if entry.Name != "" {
+		toot.Kind = data.KindArticle
+		toot.Title = entry.Name
+	}
+
+	html := entry.ContentHTML
+	if entry.Content != "" {
+		html += markdown.HTML(entry.Content)
+	}
+	toot.TextHTML = sanitize.HTML(html)
+	toot.TextOriginal = sanitize.Text(toot.TextHTML)
+
+	return toot, entry, nil
+}
@@ -0,0 +1,51 @@
+// Package richtext holds what the sources share for turning the plain
+// text of posts, along with its links and hashtags, into toots.
+package richtext
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/sabertoot/server/internal/data"
+)
+
+// Paragraphs wraps blocks of text separated by blank lines in <p>
+// elements and turns the remaining line breaks into <br>.
+func Paragraphs(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, p := range strings.Split(s, "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(p, "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
+
+// IsWebURL returns true for http and https URLs,
+// which are the only ones that get linked.
+func IsWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// HashtagTags turns hashtags without the leading '#' into toot tags,
+// which link to the hashtag's page on its platform. Hashtags which
+// only differ in case are returned once.
+func HashtagTags(hashtags []string, hashtagURL func(tag string) string) []*data.Tag {
+	seen := make(map[string]bool)
+	tags := []*data.Tag{}
+	for _, hashtag := range hashtags {
+		name := "#" + strings.ToLower(hashtag)
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, &data.Tag{Type: data.TagHashtag, Name: name, Href: hashtagURL(hashtag)})
+		}
+	}
+	return tags
+}
@@ -0,0 +1,44 @@
+package richtext
+
+import (
+	"testing"
+)
+
+func Test_Paragraphs(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Text     string
+		Expected string
+	}{
+		{Name: "Single line", Text: "Hello", Expected: "<p>Hello</p>"},
+		{Name: "Line breaks", Text: "Hello\r\nWorld", Expected: "<p>Hello<br>World</p>"},
+		{Name: "Blank lines", Text: "Hello\n\n\n\nWorld\n", Expected: "<p>Hello</p><p>World</p>"},
+		{Name: "Empty", Text: " \n\n ", Expected: ""},
+	}
+	for _, testCase := range testCases {
+		if actual := Paragraphs(testCase.Text); actual != testCase.Expected {
+			t.Errorf("%s: Expected %q, Actual %q", testCase.Name, testCase.Expected, actual)
+		}
+	}
+}
+
+func Test_IsWebURL(t *testing.T) {
+	for s, expected := range map[string]bool{
+		"https://example.com/":  true,
+		"http://example.com/a":  true,
+		"javascript:alert(1)":   false,
+		"mailto:dustin@example": false,
+		"/relative":             false,
+	} {
+		if actual := IsWebURL(s); actual != expected {
+			t.Errorf("%s: Expected %t, Actual %t", s, expected, actual)
+		}
+	}
+}
+
+func Test_HashtagTags(t *testing.T) {
+	tags := HashtagTags([]string{"Go", "go", "Sabertoot"}, func(tag string) string { return "https://example.com/tags/" + tag })
+	if len(tags) != 2 || tags[0].Name != "#go" || tags[0].Href != "https://example.com/tags/Go" || tags[1].Name != "#sabertoot" {
+		t.Errorf("unexpected tags: %+v", tags)
+	}
+}
@@ -0,0 +1,282 @@
+package sanitize
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Tags which are kept by HTML. Their attributes are dropped,
+// apart from the ones which are listed here.
+var allowedTags = map[string][]string{
+	"a":          {"href", "title"},
+	"abbr":       {"title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"del":        nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// Tags which are written without a closing tag.
+var voidTags = map[string]bool{
+	"br": true,
+	"hr": true,
+}
+
+// Tags whose content is dropped together with the tag.
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"title":    true,
+	"textarea": true,
+	"svg":      true,
+	"math":     true,
+}
+
+// Links may only point to these schemes.
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// HTML removes everything from untrusted HTML which isn't basic text
+// formatting. Tags and attributes which aren't allowed are dropped,
+// text is escaped again and unclosed tags get closed, so that the
+// result can be embedded into our own pages. Links open in a new tab
+// and don't pass on any credit.
+func HTML(s string) string {
+	var b strings.Builder
+	open := []string{}
+
+	for len(s) > 0 {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			b.WriteString(escapeText(s))
+			break
+		}
+		b.WriteString(escapeText(s[:start]))
+		s = s[start:]
+
+		// A '<' which can't start a tag is just text.
+		if len(s) < 2 || !isTagStart(s[1]) {
+			b.WriteString("&lt;")
+			s = s[1:]
+			continue
+		}
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+
+		end := tagEnd(s)
+		if end < 0 {
+			// Unterminated tag, drop the remainder.
+			break
+		}
+		name, closing, attrs := parseTag(s[1:end])
+		s = s[end+1:]
+
+		if name == "" {
+			continue
+		}
+
+		if droppedTags[name] {
+			if !closing {
+				s = skipContent(s, name)
+			}
+			continue
+		}
+
+		allowed, ok := allowedTags[name]
+		if !ok {
+			continue
+		}
+
+		if closing {
+			// Closing tags must match an open tag. Tags
+			// which have been left open inside are closed.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+			continue
+		}
+
+		b.WriteString("<" + name)
+		for _, attr := range allowed {
+			value, ok := attrs[attr]
+			if !ok || (attr == "href" && !isAllowedURL(value)) {
+				continue
+			}
+			b.WriteString(" " + attr + `="` + html.EscapeString(value) + `"`)
+		}
+		if name == "a" {
+			b.WriteString(` rel="nofollow noopener noreferrer" target="_blank"`)
+		}
+		b.WriteString(">")
+
+		if !voidTags[name] {
+			open = append(open, name)
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// escapeText decodes entities and encodes them again,
+// so that stray '<', '>' and '&' characters are escaped.
+func escapeText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+func isTagStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!'
+}
+
+// tagEnd returns the index of the '>' which ends the tag at the start
+// of s. A '>' inside a quoted attribute value doesn't end the tag.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag splits the inside of a tag into its lowercase
+// name and its attributes. Attribute values are decoded.
+func parseTag(s string) (string, bool, map[string]string) {
+	closing := strings.HasPrefix(s, "/")
+	s = strings.TrimPrefix(s, "/")
+
+	nameEnd := strings.IndexAny(s, " \t\n\r\f/")
+	if nameEnd < 0 {
+		nameEnd = len(s)
+	}
+	name := strings.ToLower(s[:nameEnd])
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return "", false, nil
+		}
+	}
+
+	attrs := make(map[string]string)
+	s = s[nameEnd:]
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f/")
+		if s == "" {
+			break
+		}
+
+		keyEnd := strings.IndexAny(s, " \t\n\r\f/=")
+		if keyEnd < 0 {
+			keyEnd = len(s)
+		}
+		key := strings.ToLower(s[:keyEnd])
+		s = strings.TrimLeft(s[keyEnd:], " \t\n\r\f")
+
+		value := ""
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				quote := s[0]
+				end := strings.IndexByte(s[1:], quote)
+				if end < 0 {
+					end = len(s) - 1
+				}
+				value = s[1 : end+1]
+				if end+2 < len(s) {
+					s = s[end+2:]
+				} else {
+					s = ""
+				}
+			} else {
+				end := strings.IndexAny(s, " \t\n\r\f")
+				if end < 0 {
+					end = len(s)
+				}
+				value = s[:end]
+				s = s[end:]
+			}
+		}
+
+		if _, dup := attrs[key]; !dup && key != "" {
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+
+	return name, closing, attrs
+}
+
+// skipContent drops everything up to and including
+// the closing tag of the given name.
+func skipContent(s string, name string) string {
+	end := strings.Index(strings.ToLower(s), "</"+name)
+	if end < 0 {
+		return ""
+	}
+	s = s[end:]
+	if close := strings.IndexByte(s, '>'); close >= 0 {
+		return s[close+1:]
+	}
+	return ""
+}
+
+func isAllowedURL(value string) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	return allowedSchemes[strings.ToLower(u.Scheme)]
+}
@@ -0,0 +1,62 @@
+package sanitize
+
+import "testing"
+
+func Test_HTML(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{
+			"<p>Hello <b>world</b></p>",
+			"<p>Hello <b>world</b></p>",
+		},
+		{
+			`<p class="x" onclick="alert(1)">Hi</p>`,
+			"<p>Hi</p>",
+		},
+		{
+			`<a href="https://example.com/?a=1&amp;b=2" onmouseover="x">link</a>`,
+			`<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer" target="_blank">link</a>`,
+		},
+		{
+			`<a href="javascript:alert(1)">link</a>`,
+			`<a rel="nofollow noopener noreferrer" target="_blank">link</a>`,
+		},
+		{
+			`<p>before<script>alert("</p>")</script>after</p>`,
+			"<p>beforeafter</p>",
+		},
+		{
+			`<div><img src="x.png" alt="a > b">text</div>`,
+			"text",
+		},
+		{
+			"<ul><li>one<li>two</ul>",
+			"<ul><li>one<li>two</li></li></ul>",
+		},
+		{
+			"<p><em>unclosed",
+			"<p><em>unclosed</em></p>",
+		},
+		{
+			"</p>stray close",
+			"stray close",
+		},
+		{
+			"a < b & c <!-- comment --> d",
+			"a &lt; b &amp; c  d",
+		},
+		{
+			"line<br/>break",
+			"line<br>break",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual := HTML(testCase.Input)
+		if actual != testCase.Expected {
+			t.Errorf("HTML(%q): expected %q, actual %q", testCase.Input, testCase.Expected, actual)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// sanitize turns untrusted HTML from remote servers into
+// content which is safe to display on our own pages.
+package sanitize
+
+import (
+	"html"
+	"strings"
+)
+
+// Tags which start a new line when HTML is converted to text.
+var lineBreakTags = map[string]bool{
+	"br":         true,
+	"p":          true,
+	"/p":         true,
+	"div":        true,
+	"/div":       true,
+	"li":         true,
+	"blockquote": true,
+}
+
+// Text converts HTML into plain text. All tags are removed, block
+// elements and line breaks are turned into new lines and entities
+// are decoded. The result must be escaped again when it gets rendered.
+func Text(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:start])
+
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			// Unterminated tag, drop the remainder.
+			break
+		}
+
+		tag := strings.ToLower(strings.Trim(s[start+1:start+end], " /"))
+		if strings.HasPrefix(s[start+1:], "/") {
+			tag = "/" + tag
+		}
+		if name, _, _ := strings.Cut(tag, " "); lineBreakTags[name] {
+			b.WriteString("\n")
+		}
+
+		s = s[start+end+1:]
+	}
+
+	lines := strings.Split(html.UnescapeString(b.String()), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(collapseBlankLines(strings.Join(lines, "\n")))
+}
+
+// Paragraphs splits plain text into paragraphs at blank lines.
+func Paragraphs(text string) []string {
+	paragraphs := []string{}
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+func collapseBlankLines(s string) string {
+	for strings.Contains(s, "\n\n\n") {
+		s = strings.ReplaceAll(s, "\n\n\n", "\n\n")
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+// Package source defines how posts get harvested from other platforms.
+// Every platform implements Source and registers itself under a type
+// name, which users refer to in the sources of their settings.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+)
+
+// Source harvests the posts of a single account on another platform.
+type Source interface {
+	// Fetch returns the posts which have been published since the cursor.
+	// An empty cursor means that the source hasn't been harvested before.
+	Fetch(ctx context.Context, cursor string) (*Page, error)
+
+	// Toot maps a fetched item to a toot. Its media may be listed
+	// without files, so that edits of the media are noticed.
+	Toot(ctx context.Context, item Item) (*data.Toot, error)
+
+	// DownloadMedia downloads the media of a new toot into the media
+	// directory. Media which fails to download is skipped, so that
+	// the toot still gets published.
+	DownloadMedia(ctx context.Context, item Item, toot *data.Toot) []*data.Media
+}
+
+// Item is a post as it has been fetched from its source.
+type Item any
+
+// Page is the result of a fetch. The pages of a harvest are returned
+// from newest to oldest, like the timelines of most platforms, and get
+// saved in reverse once all of them have been fetched.
+type Page struct {
+	// Items are sorted from oldest to newest, so that
+	// threads get saved in order.
+	Items []Item
+
+	// Cursor is where the next fetch continues.
+	// It gets stored once all items have been saved.
+	Cursor string
+
+	// More is true if the next page can be fetched right away.
+	More bool
+}
+
+// Reconciler is implemented by sources which can check posts that have
+// been harvested before for edits and deletions.
+//
+// Updated may hold the current version of every toot which still
+// exists, edited or not. Only toots whose content differs from the
+// stored version are updated and sent to followers again.
+type Reconciler interface {
+	Reconcile(ctx context.Context, toots []*data.Toot) (*Changes, error)
+}
+
+// Changes are the edits and deletions which a Reconciler has found.
+// They are returned together with an error, if the check has been
+// interrupted.
+type Changes struct {
+	// Updated holds the new versions of edited toots.
+	Updated []*data.Toot
+	Deleted []*data.Toot
+}
+
+// Env is what sources get to know about their surroundings.
+type Env struct {
+	Settings    *config.Settings
+	DataService *data.Service
+	User        *config.User
+
+	// Accounts maps usernames on other platforms
+	// to the Fediverse accounts of people who moved.
+	Accounts map[string]*config.FediverseAccount
+}
+
+// Factory creates a source from its configuration.
+type Factory func(env *Env, cfg *config.Source) (Source, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a type of source available under the given name.
+// It panics if the name is registered twice.
+func Register(typeName string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("source: Register factory is nil")
+	}
+	if _, dup := factories[typeName]; dup {
+		panic("source: Register called twice for type " + typeName)
+	}
+	factories[typeName] = factory
+}
+
+// Types returns the names of all registered types of sources.
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for typeName := range factories {
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates a source of a registered type.
+func New(env *Env, cfg *config.Source) (Source, error) {
+	mu.RLock()
+	factory, ok := factories[cfg.Type]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown source type: %s", cfg.Type)
+	}
+	return factory(env, cfg)
+}
+
+// RateLimitError is returned by sources whose platform asks them to
+// come back later. The harvester defers the source until Reset.
+type RateLimitError struct {
+	// Service names what is rate limited, e.g. an API.
+	Service string
+	Reset   time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s is rate limited until %s", e.Service, e.Reset.Format(time.RFC3339))
+}
+
+// RetryAfter returns the time when a source can be fetched again,
+// if the error is a RateLimitError.
+func RetryAfter(err error) (time.Time, bool) {
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.Reset, true
+	}
+	return time.Time{}, false
+}
+
+// ParseUnixReset reads a rate limit header which holds the Unix time
+// of the reset. Missing or past values mean that the reset is in window.
+func ParseUnixReset(value string, window time.Duration) time.Time {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+		if reset := time.Unix(seconds, 0); reset.After(time.Now()) {
+			return reset
+		}
+	}
+	return time.Now().Add(window)
+}
+
+// ParseRetryAfter reads a Retry-After header, which holds either seconds
+// or an HTTP date. Missing or past values mean that the reset is in window.
+func ParseRetryAfter(value string, window time.Duration) time.Time {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(time.Now()) {
+		return t
+	}
+	return time.Now().Add(window)
+}
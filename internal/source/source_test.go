@@ -0,0 +1,53 @@
+package source
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_RetryAfter(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	err := fmt.Errorf("error fetching: %w", &RateLimitError{Service: "Example API", Reset: reset})
+	if actual, ok := RetryAfter(err); !ok || !actual.Equal(reset) {
+		t.Errorf("expected a retry at %s, got %s %t", reset, actual, ok)
+	}
+	if _, ok := RetryAfter(fmt.Errorf("bad status code")); ok {
+		t.Error("expected other errors not to be retried")
+	}
+}
+
+func Test_ParseUnixReset(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	if actual := ParseUnixReset(strconv.FormatInt(reset.Unix(), 10), time.Minute); !actual.Equal(reset) {
+		t.Errorf("expected %s, got %s", reset, actual)
+	}
+
+	// Invalid and past resets fall back to the window.
+	for _, value := range []string{"", "soon", "-1", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)} {
+		if wait := time.Until(ParseUnixReset(value, time.Minute)); wait < 59*time.Second || wait > time.Minute {
+			t.Errorf("expected a reset after the window for %q, got %s", value, wait)
+		}
+	}
+}
+
+func Test_ParseRetryAfter(t *testing.T) {
+	date := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	testCases := []struct {
+		Value    string
+		Expected time.Duration
+	}{
+		{Value: "120", Expected: 2 * time.Minute},
+		{Value: date.Format(http.TimeFormat), Expected: time.Hour},
+		{Value: "", Expected: time.Minute},
+		{Value: "0", Expected: time.Minute},
+		{Value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), Expected: time.Minute},
+	}
+	for _, testCase := range testCases {
+		if wait := time.Until(ParseRetryAfter(testCase.Value, time.Minute)); wait < testCase.Expected-2*time.Second || wait > testCase.Expected {
+			t.Errorf("expected a reset after %s for %q, got %s", testCase.Expected, testCase.Value, wait)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package sourcetest provides the fixtures which the tests of sources share.
+package sourcetest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewEnv returns the environment of a source for the user dustin,
+// whose toots are saved to an in-memory database and whose images
+// are stored in a temporary directory.
+func NewEnv(t *testing.T) *source.Env {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dataService := data.NewService(db)
+	if err = dataService.InitTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &config.Storage{Path: t.TempDir()}
+	for _, dir := range []string{storage.ProfileImageDirectory(), storage.MediaDirectory()} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := &config.User{ID: 1, Username: "dustin", StartDate: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)}
+	return &source.Env{
+		Settings: &config.Settings{
+			Storage: storage,
+			Users:   []*config.User{user},
+			Server:  &config.Server{Domain: "sabertoot.example", PublicBaseURL: "https://sabertoot.example"},
+		},
+		DataService: dataService,
+		User:        user,
+	}
+}
+
+// SaveItems saves the toots of a page in order, like the harvester does,
+// so that replies find the toots which they reply to.
+func SaveItems(t *testing.T, env *source.Env, src source.Source, sourceName string, page *source.Page) []*data.Toot {
+	ctx := context.Background()
+	toots := []*data.Toot{}
+	for _, item := range page.Items {
+		toot, err := src.Toot(ctx, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toot.SourceName = sourceName
+		toot.Media = src.DownloadMedia(ctx, item, toot)
+		if err = env.DataService.SaveToot(ctx, toot); err != nil {
+			t.Fatal(err)
+		}
+		toots = append(toots, toot)
+	}
+	return toots
+}
@@ -0,0 +1,97 @@
+// Package token issues the access tokens which clients, e.g. Micropub
+// apps, use to act on behalf of a user. Tokens are random secrets of
+// which only a hash is stored, so they're shown once when they're issued.
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+// Permissions which can be granted to a token.
+const (
+	ScopeCreate = "create"
+	ScopeUpdate = "update"
+	ScopeDelete = "delete"
+	ScopeMedia  = "media"
+
+	// ScopeProfile lets IndieAuth clients read the name
+	// and photo of a user. It doesn't grant anything else.
+	ScopeProfile = "profile"
+)
+
+// DefaultScope grants everything which Micropub clients may do.
+var DefaultScope = strings.Join([]string{ScopeCreate, ScopeUpdate, ScopeDelete, ScopeMedia}, " ")
+
+const (
+	idBytes     = 6
+	secretBytes = 32
+)
+
+// New creates an access token for a user and returns it together with
+// its secret, which has to be handed to the client. The token still
+// needs to be saved.
+func New(userID uid.UserID, clientID string, scope string) (*data.AccessToken, string, error) {
+	id, err := randomBytes(idBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomBytes(secretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	t := &data.AccessToken{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Hash:      Hash(encoded),
+		ClientID:  clientID,
+		Scope:     strings.Join(strings.Fields(scope), " "),
+		CreatedAt: time.Now().UTC(),
+	}
+	return t, encoded, nil
+}
+
+// Hash returns the hash under which the token with the given secret is stored.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify returns the token with the given secret or nil if it doesn't
+// exist, e.g. because it has been revoked. The time of its use is
+// recorded.
+func Verify(ctx context.Context, dataService *data.Service, secret string) (*data.AccessToken, error) {
+	if secret == "" {
+		return nil, nil
+	}
+
+	t, err := dataService.AccessTokenByHash(ctx, Hash(secret))
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	t.LastUsedAt = time.Now().UTC()
+	if err = dataService.TouchAccessToken(ctx, t.ID, t.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("error generating token: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,33 @@
+package twitter
+
+// Entities are the parsed parts of a tweet's text. Start and end
+// are the positions of the entity in the text in Unicode code points.
+type Entities struct {
+	URLs     []*URLEntity     `json:"urls,omitempty"`
+	Hashtags []*TagEntity     `json:"hashtags,omitempty"`
+	Cashtags []*TagEntity     `json:"cashtags,omitempty"`
+	Mentions []*MentionEntity `json:"mentions,omitempty"`
+}
+
+type URLEntity struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url"`
+	DisplayURL  string `json:"display_url"`
+	UnwoundURL  string `json:"unwound_url,omitempty"`
+	MediaKey    string `json:"media_key,omitempty"`
+}
+
+type TagEntity struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+type MentionEntity struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Username string `json:"username"`
+	ID       string `json:"id,omitempty"`
+}
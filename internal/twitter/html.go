@@ -0,0 +1,233 @@
+package twitter
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/richtext"
+)
+
+const twitterBaseURL = "https://twitter.com"
+
+// Rendered is a tweet's text converted to HTML.
+type Rendered struct {
+	HTML string
+
+	// Fediverse accounts which have been mentioned.
+	Mentions []*config.FediverseAccount
+
+	// Hashtags without the leading '#'.
+	Hashtags []string
+}
+
+// Tags returns the mentions and hashtags of a rendered tweet as toot tags.
+func (r *Rendered) Tags() []*data.Tag {
+	seen := make(map[string]bool)
+	tags := []*data.Tag{}
+	for _, account := range r.Mentions {
+		if !seen[account.ActorURL] {
+			seen[account.ActorURL] = true
+			tags = append(tags, &data.Tag{Type: data.TagMention, Name: account.Handle, Href: account.ActorURL})
+		}
+	}
+	return append(tags, richtext.HashtagTags(r.Hashtags, HashtagURL)...)
+}
+
+// span is an entity which replaces a range of the text.
+type span struct {
+	start   int
+	end     int
+	literal string
+	render  func(r *Rendered) string
+}
+
+// RenderHTML converts the text of a tweet and its entities into safe HTML.
+//
+// Links are expanded from their t.co form, hashtags and cashtags link to
+// Twitter and @mentions link to the mentioned account. Mentions of Twitter
+// accounts which are known in the Fediverse (keyed by lowercase username)
+// link to the Fediverse account instead. Links to attached media are
+// removed, because media gets attached to the toot itself.
+func RenderHTML(
+	text string,
+	entities *Entities,
+	accounts map[string]*config.FediverseAccount,
+) *Rendered {
+	// The API returns text with &, < and > escaped. It gets unescaped
+	// here and every part of the output is escaped again when rendering.
+	runes := []rune(html.UnescapeString(text))
+	rendered := &Rendered{Mentions: []*config.FediverseAccount{}, Hashtags: []string{}}
+
+	spans := []*span{}
+	if entities != nil {
+		spans = collectSpans(entities, accounts)
+	}
+
+	// Entity indices usually match the text, but the API isn't always
+	// consistent about escaping, so each entity gets located by its literal
+	// text, starting at the given index and falling back to a search.
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	located := []*span{}
+	cursor := 0
+	for _, s := range spans {
+		start := locate(runes, s, cursor)
+		if start < 0 {
+			continue
+		}
+		s.end = start + len([]rune(s.literal))
+		s.start = start
+		located = append(located, s)
+		cursor = s.end
+	}
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range located {
+		b.WriteString(escapeText(string(runes[pos:s.start])))
+		b.WriteString(s.render(rendered))
+		pos = s.end
+	}
+	b.WriteString(escapeText(string(runes[pos:])))
+
+	rendered.HTML = richtext.Paragraphs(b.String())
+	return rendered
+}
+
+func collectSpans(entities *Entities, accounts map[string]*config.FediverseAccount) []*span {
+	spans := []*span{}
+
+	for _, e := range entities.URLs {
+		e := e
+		spans = append(spans, &span{
+			start:   e.Start,
+			end:     e.End,
+			literal: e.URL,
+			render: func(r *Rendered) string {
+				if e.MediaKey != "" {
+					return ""
+				}
+				href := e.ExpandedURL
+				if e.UnwoundURL != "" {
+					href = e.UnwoundURL
+				}
+				if !richtext.IsWebURL(href) {
+					href = e.URL
+				}
+				display := e.DisplayURL
+				if display == "" {
+					display = href
+				}
+				return fmt.Sprintf(
+					`<a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a>`,
+					html.EscapeString(href),
+					html.EscapeString(display))
+			},
+		})
+	}
+
+	for _, e := range entities.Hashtags {
+		e := e
+		spans = append(spans, &span{
+			start:   e.Start,
+			end:     e.End,
+			literal: "#" + e.Tag,
+			render: func(r *Rendered) string {
+				r.Hashtags = append(r.Hashtags, e.Tag)
+				return fmt.Sprintf(
+					`<a href="%s" class="mention hashtag" rel="tag nofollow noopener noreferrer" target="_blank">#<span>%s</span></a>`,
+					html.EscapeString(HashtagURL(e.Tag)),
+					html.EscapeString(e.Tag))
+			},
+		})
+	}
+
+	for _, e := range entities.Cashtags {
+		e := e
+		spans = append(spans, &span{
+			start:   e.Start,
+			end:     e.End,
+			literal: "$" + e.Tag,
+			render: func(r *Rendered) string {
+				return fmt.Sprintf(
+					`<a href="%s/search?q=%s" rel="nofollow noopener noreferrer" target="_blank">$%s</a>`,
+					twitterBaseURL,
+					url.QueryEscape("$"+e.Tag),
+					html.EscapeString(e.Tag))
+			},
+		})
+	}
+
+	for _, e := range entities.Mentions {
+		e := e
+		spans = append(spans, &span{
+			start:   e.Start,
+			end:     e.End,
+			literal: "@" + e.Username,
+			render: func(r *Rendered) string {
+				if account, ok := accounts[strings.ToLower(e.Username)]; ok {
+					r.Mentions = append(r.Mentions, account)
+					username := strings.SplitN(strings.TrimPrefix(account.Handle, "@"), "@", 2)[0]
+					return fmt.Sprintf(
+						`<span class="h-card"><a href="%s" class="u-url mention">@<span>%s</span></a></span>`,
+						html.EscapeString(account.ProfileURL),
+						html.EscapeString(username))
+				}
+				return fmt.Sprintf(
+					`<a href="%s/%s" rel="nofollow noopener noreferrer" target="_blank">@%s</a>`,
+					twitterBaseURL,
+					url.PathEscape(e.Username),
+					html.EscapeString(e.Username))
+			},
+		})
+	}
+
+	return spans
+}
+
+// HashtagURL returns the URL of a hashtag's page on Twitter.
+func HashtagURL(tag string) string {
+	return fmt.Sprintf("%s/hashtag/%s", twitterBaseURL, url.PathEscape(tag))
+}
+
+// locate returns the position of an entity in the text or -1 if it
+// can't be found. Entities never overlap, so the search starts at
+// the end of the previous entity.
+func locate(runes []rune, s *span, cursor int) int {
+	literal := []rune(s.literal)
+	if s.start >= cursor && matchesAt(runes, literal, s.start) {
+		return s.start
+	}
+	for i := cursor; i+len(literal) <= len(runes); i++ {
+		if matchesAt(runes, literal, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchesAt compares case-insensitively, as well as the fullwidth
+// forms of '#' and '@' which Twitter recognises as entities too.
+func matchesAt(runes []rune, literal []rune, pos int) bool {
+	if pos < 0 || pos+len(literal) > len(runes) {
+		return false
+	}
+	for i, r := range literal {
+		actual := runes[pos+i]
+		if i == 0 && ((r == '#' && actual == '＃') || (r == '@' && actual == '＠')) {
+			continue
+		}
+		if !strings.EqualFold(string(actual), string(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func escapeText(s string) string {
+	return html.EscapeString(s)
+}
@@ -0,0 +1,89 @@
+package twitter
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabertoot/server/internal/config"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func Test_RenderHTML(t *testing.T) {
+	accounts := map[string]*config.FediverseAccount{
+		"dustin": {
+			Handle:     "@dustin@dusted.codes",
+			ActorURL:   "https://dusted.codes/users/dustin",
+			ProfileURL: "https://dusted.codes/@dustin",
+		},
+	}
+
+	inputs, err := filepath.Glob(filepath.Join("testdata", "render", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test cases found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var tweet struct {
+				Text     string    `json:"text"`
+				Entities *Entities `json:"entities"`
+			}
+			if err = json.Unmarshal(data, &tweet); err != nil {
+				t.Fatal(err)
+			}
+
+			actual := RenderHTML(tweet.Text, tweet.Entities, accounts).HTML + "\n"
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden.html"
+			if *update {
+				if err = os.WriteFile(golden, []byte(actual), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != string(expected) {
+				t.Errorf("Expected %s, Actual %s", expected, actual)
+			}
+		})
+	}
+}
+
+func Test_RenderHTML_Tags(t *testing.T) {
+	accounts := map[string]*config.FediverseAccount{
+		"dustin": {Handle: "@dustin@dusted.codes", ProfileURL: "https://dusted.codes/@dustin"},
+	}
+	entities := &Entities{
+		Hashtags: []*TagEntity{{Start: 0, End: 3, Tag: "go"}},
+		Mentions: []*MentionEntity{
+			{Start: 4, End: 11, Username: "Dustin"},
+			{Start: 12, End: 17, Username: "jack"},
+		},
+	}
+
+	rendered := RenderHTML("#go @Dustin @jack", entities, accounts)
+
+	if len(rendered.Hashtags) != 1 || rendered.Hashtags[0] != "go" {
+		t.Errorf("Expected hashtags [go], Actual %v", rendered.Hashtags)
+	}
+	if len(rendered.Mentions) != 1 || rendered.Mentions[0].Handle != "@dustin@dusted.codes" {
+		t.Errorf("Expected one mention of @dustin@dusted.codes, Actual %v", rendered.Mentions)
+	}
+}
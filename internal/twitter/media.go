@@ -0,0 +1,129 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/download"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// DownloadMedia downloads the photos of a tweet, or the previews of its
+// GIFs and videos, into the media directory.
+func (s *tweetSource) DownloadMedia(ctx context.Context, item source.Item, toot *data.Toot) []*data.Media {
+	result := []*data.Media{}
+
+	i, ok := item.(*tweetItem)
+	if !ok {
+		return result
+	}
+
+	for _, media := range tweetMedia(i.tweet, i.result) {
+		fileName := fmt.Sprintf("%s-%d%s", toot.ID, len(result), mediaExt(media.SourceURL))
+		err := download.File(ctx, media.SourceURL, s.env.Settings.Storage.MediaFullFilePath(fileName))
+		if err != nil {
+			plog.Errorf("Error downloading media %s of toot %s: %s", media.SourceURL, toot.ID, err.Error())
+			continue
+		}
+
+		media.FileName = fileName
+		result = append(result, media)
+		plog.Debugf("Media downloaded for toot %s: %s", toot.ID, fileName)
+	}
+
+	return result
+}
+
+// tweetMedia lists the images of a tweet's media without downloading
+// them, so that edits of the media can be compared to the toot.
+func tweetMedia(tweet *Tweet, result *TweetsResponse) []*data.Media {
+	list := []*data.Media{}
+	if result == nil {
+		return list
+	}
+	mediaByKey := result.MediaByKey()
+
+	for _, key := range tweet.MediaKeys() {
+		media, ok := mediaByKey[key]
+		if !ok {
+			plog.Warningf("Media %s of tweet %s is missing in response", key, tweet.ID)
+			continue
+		}
+
+		sourceURL := media.ImageURL()
+		if sourceURL == "" {
+			plog.Warningf("Media %s of tweet %s has no downloadable image", key, tweet.ID)
+			continue
+		}
+
+		mimeType := mime.TypeByExtension(mediaExt(sourceURL))
+		if mimeType == "" {
+			mimeType = "image/jpeg"
+		}
+
+		list = append(list, &data.Media{
+			Type:      media.Type,
+			MIMEType:  mimeType,
+			Width:     media.Width,
+			Height:    media.Height,
+			AltText:   media.AltText,
+			SourceURL: sourceURL,
+		})
+	}
+	return list
+}
+
+// mediaExt returns the file extension of an image, which is
+// a JPEG unless its URL says otherwise.
+func mediaExt(sourceURL string) string {
+	if parsedURL, err := url.Parse(sourceURL); err == nil && path.Ext(parsedURL.Path) != "" {
+		return path.Ext(parsedURL.Path)
+	}
+	return ".jpg"
+}
+
+// downloadProfileImage downloads the profile image of the harvested
+// account, if it has been included in the response.
+func (s *tweetSource) downloadProfileImage(ctx context.Context, result *TweetsResponse) {
+	user := s.env.User
+	for _, twitterUser := range result.Users() {
+		if !strings.EqualFold(twitterUser.Username, s.account.Username) {
+			continue
+		}
+
+		profileImageURL := twitterUser.ProfileImageURL
+		if len(profileImageURL) == 0 {
+			return
+		}
+
+		if strings.Contains(profileImageURL, "_normal.") {
+			profileImageURL = strings.Replace(profileImageURL, "_normal", "", 1)
+		}
+		plog.Debugf("Profile image found for user %s: %s", user.Username, profileImageURL)
+
+		ext := ".jpg"
+		parsedURL, err := url.Parse(profileImageURL)
+		if err == nil {
+			actualExt := path.Ext(parsedURL.Path)
+			if len(actualExt) > 0 {
+				ext = actualExt
+			}
+		}
+
+		profileImagePath := s.env.Settings.Storage.ProfileImageFullFilePath(user.ID, ext)
+		err = download.File(ctx, profileImageURL, profileImagePath)
+		if err != nil {
+			plog.Error(err.Error())
+			return
+		}
+
+		plog.Infof("Profile image downloaded for user %s: %s", user.Username, profileImagePath)
+		return
+	}
+}
@@ -0,0 +1,87 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+)
+
+// Reconcile checks recently harvested tweets for edits and deletions.
+// Twitter only allows edits within an hour, but tweets can be deleted
+// at any time, so the period is up to the settings of the harvester.
+func (s *tweetSource) Reconcile(ctx context.Context, toots []*data.Toot) (*source.Changes, error) {
+	plog.Debugf("Checking %d tweets of %s for changes", len(toots), s.account.Username)
+
+	changes := &source.Changes{}
+	for start := 0; start < len(toots); start += maxLookupIDs {
+		end := start + maxLookupIDs
+		if end > len(toots) {
+			end = len(toots)
+		}
+		err := s.reconcileBatch(ctx, toots[start:end], changes)
+		if err != nil {
+			// The remaining tweets get checked in the next run.
+			var rateLimitErr *source.RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				return changes, err
+			}
+			plog.Error(err.Error())
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *tweetSource) reconcileBatch(ctx context.Context, toots []*data.Toot, changes *source.Changes) error {
+	tootsBySourceID := make(map[string]*data.Toot)
+	ids := []string{}
+	for _, toot := range toots {
+		tootsBySourceID[toot.SourceID] = toot
+		ids = append(ids, toot.SourceID)
+	}
+
+	result, err := s.client.GetTweetsByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	// Deleted tweets are reported as "Not Found" errors:
+	// ---
+	for _, id := range result.NotFoundIDs() {
+		if toot, ok := tootsBySourceID[id]; ok {
+			changes.Deleted = append(changes.Deleted, toot)
+		}
+	}
+
+	// Edited tweets list a newer version in their edit history:
+	// ---
+	latestIDs := []string{}
+	for _, tweet := range result.Data {
+		if latestID := tweet.LatestID(); latestID != tweet.ID {
+			latestIDs = append(latestIDs, latestID)
+		}
+	}
+
+	if len(latestIDs) == 0 {
+		return nil
+	}
+
+	result, err = s.client.GetTweetsByIDs(ctx, latestIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, tweet := range result.Data {
+		toot, err := parseTweet(s.env.User.ID, tweet, result, s.env.Accounts)
+		if err != nil {
+			plog.Error(err.Error())
+			continue
+		}
+		changes.Updated = append(changes.Updated, toot)
+	}
+
+	return nil
+}
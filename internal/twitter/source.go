@@ -0,0 +1,295 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/uid"
+)
+
+func init() {
+	source.Register(config.SourceTypeTwitter, newSource)
+}
+
+// tweetSource harvests the tweets of a Twitter account.
+type tweetSource struct {
+	env     *source.Env
+	name    string
+	account *config.Twitter
+	client  *Client
+}
+
+func newSource(env *source.Env, cfg *config.Source) (source.Source, error) {
+	var account config.Twitter
+	if err := cfg.DecodeOptions(&account); err != nil {
+		return nil, err
+	}
+	if account.Username == "" || account.Token == "" {
+		return nil, fmt.Errorf("%s source of user %s needs a username and a token", cfg.Key(), env.User.Username)
+	}
+	return &tweetSource{
+		env:     env,
+		name:    cfg.Key(),
+		account: &account,
+		client:  NewClient(account.Token),
+	}, nil
+}
+
+// tweetItem is a fetched tweet together with the
+// response which holds its referenced tweets and media.
+type tweetItem struct {
+	tweet  *Tweet
+	result *TweetsResponse
+}
+
+// cursor is where the harvest of a Twitter account continues.
+type cursor struct {
+	// LatestID is the newest tweet which has been fetched.
+	LatestID string `json:"latestID,omitempty"`
+
+	// The since ID and pagination token of an unfinished harvest.
+	// The since ID must stay the same while paging through results.
+	SinceID   string `json:"sinceID,omitempty"`
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+func (s *tweetSource) decodeCursor(ctx context.Context, value string) (*cursor, error) {
+	c := &cursor{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), c); err != nil {
+			return nil, fmt.Errorf("error deserializing Twitter cursor: %w", err)
+		}
+		return c, nil
+	}
+
+	// Tweets which have been harvested before cursors were
+	// stored must not be fetched again.
+	latestID, err := s.env.DataService.LatestSourceID(ctx, s.env.User.ID, s.name)
+	if err != nil {
+		return nil, err
+	}
+	c.LatestID = latestID
+	return c, nil
+}
+
+func (s *tweetSource) Fetch(ctx context.Context, value string) (*source.Page, error) {
+	c, err := s.decodeCursor(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.NextToken == "" {
+		c.SinceID = c.LatestID
+		plog.Infof("Latest tweet ID: %s", c.SinceID)
+	} else {
+		plog.Infof("Resuming to collect tweets since %s", c.SinceID)
+	}
+
+	result, err := s.client.GetTweetsByUser(
+		ctx,
+		s.account.Username,
+		s.env.User.StartDate,
+		c.SinceID,
+		c.NextToken,
+		SearchOptions{
+			Retweets: s.account.Retweets,
+			Quotes:   s.account.Quotes,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, problem := range result.Errors {
+		plog.Warningf("Partial error from Twitter API: %s", problem.Error())
+	}
+
+	if result.Meta == nil {
+		return nil, errors.New("Twitter API response is missing meta data")
+	}
+
+	plog.Debugf("Result count: %d", result.Meta.ResultCount)
+
+	// Tweets are returned newest first, but they get saved
+	// from oldest to newest, so that threads are saved in order.
+	tweets := []*Tweet{}
+	for _, tweet := range result.Data {
+		if tweet.RepliedToID() != "" && !tweet.IsSelfReply() {
+			continue
+		}
+		tweets = append(tweets, tweet)
+	}
+	sort.SliceStable(tweets, func(i, j int) bool { return isNewerID(tweets[j].ID, tweets[i].ID) })
+
+	page := &source.Page{}
+	for _, tweet := range tweets {
+		page.Items = append(page.Items, &tweetItem{tweet: tweet, result: result})
+	}
+
+	s.downloadProfileImage(ctx, result)
+
+	// The first page holds the newest tweets, but the latest ID
+	// only gets used once all pages have been fetched.
+	if isNewerID(result.Meta.NewestID, c.LatestID) {
+		c.LatestID = result.Meta.NewestID
+	}
+	c.NextToken = ""
+	if result.Meta.ResultCount > 0 {
+		c.NextToken = result.Meta.NextToken
+	}
+	if c.NextToken == "" {
+		plog.Debug("No more tweets to collect.")
+	}
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing Twitter cursor: %w", err)
+	}
+	page.Cursor = string(encoded)
+	page.More = c.NextToken != ""
+
+	return page, nil
+}
+
+// isNewerID returns true if the tweet ID a is newer than b.
+// Tweet IDs grow over time, but they are too long to compare
+// them as strings without looking at their length first.
+func isNewerID(a string, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+func (s *tweetSource) Toot(ctx context.Context, item source.Item) (*data.Toot, error) {
+	i, ok := item.(*tweetItem)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item of Twitter source: %T", item)
+	}
+
+	toot, err := parseTweet(s.env.User.ID, i.tweet, i.result, s.env.Accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	if toot.InReplyToID, err = s.threadParent(ctx, i.tweet); err != nil {
+		return nil, err
+	}
+
+	return toot, nil
+}
+
+func parseTweet(
+	userID uid.UserID,
+	tweet *Tweet,
+	result *TweetsResponse,
+	accounts map[string]*config.FediverseAccount,
+) (*data.Toot, error) {
+	// An edited tweet gets a new ID, but the toot ID is derived from
+	// the original tweet so that all versions map to the same toot.
+	sourceID, err := strconv.ParseUint(tweet.OriginalID(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tweet ID: %w", err)
+	}
+
+	tootID := uid.New(userID, uid.Twitter, sourceID)
+
+	toot := &data.Toot{
+		ID:           tootID,
+		UserID:       userID,
+		CreatedAt:    tweet.CreatedAt.UTC(),
+		TextOriginal: tweet.Text,
+		SourceType:   uid.Twitter,
+		SourceID:     tweet.ID,
+		SourceData:   string(tweet.Raw),
+		Kind:         data.KindPost,
+	}
+
+	if retweetedID := tweet.ReferencedID(ReferenceRetweeted); retweetedID != "" {
+		// A retweet gets announced, but the text of the original tweet
+		// is kept as a link card for the toot's HTML page.
+		original, author := referencedTweet(result, retweetedID)
+		toot.Kind = data.KindRepost
+		toot.SharedURL = TweetURL(author, retweetedID)
+		toot.TextHTML = fmt.Sprintf(`<p>RT <a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a></p>`,
+			html.EscapeString(toot.SharedURL), html.EscapeString(sharedLabel(author, toot.SharedURL)))
+		if original != nil {
+			toot.TextHTML += "<blockquote>" + RenderHTML(original.Text, original.Entities, nil).HTML + "</blockquote>"
+		}
+		toot.Tags = []*data.Tag{}
+		return toot, nil
+	}
+
+	rendered := RenderHTML(tweet.Text, tweet.Entities, accounts)
+	toot.TextHTML = rendered.HTML
+	toot.Tags = rendered.Tags()
+	toot.Media = tweetMedia(tweet, result)
+
+	if quotedID := tweet.ReferencedID(ReferenceQuoted); quotedID != "" {
+		// Servers which don't support quotes show the inline link instead.
+		_, author := referencedTweet(result, quotedID)
+		toot.Kind = data.KindQuote
+		toot.SharedURL = TweetURL(author, quotedID)
+		toot.TextHTML += fmt.Sprintf(`<p class="quote-inline">RE: <a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a></p>`,
+			html.EscapeString(toot.SharedURL), html.EscapeString(toot.SharedURL))
+	}
+
+	return toot, nil
+}
+
+// referencedTweet returns a referenced tweet and the username of its
+// author, if they have been included in the response.
+func referencedTweet(result *TweetsResponse, id string) (*Tweet, string) {
+	if result == nil {
+		return nil, ""
+	}
+	tweet := result.IncludedTweet(id)
+	if tweet == nil {
+		return nil, ""
+	}
+	if author := result.IncludedUser(tweet.AuthorID); author != nil {
+		return tweet, author.Username
+	}
+	return tweet, ""
+}
+
+func sharedLabel(author string, sharedURL string) string {
+	if author == "" {
+		return sharedURL
+	}
+	return "@" + author
+}
+
+// threadParent returns the ID of the toot which a self reply continues.
+// The thread is broken up if the previous tweet hasn't been harvested,
+// e.g. because it's older than the start date.
+func (s *tweetSource) threadParent(ctx context.Context, tweet *Tweet) (uid.TootID, error) {
+	parentID := tweet.RepliedToID()
+	if parentID == "" {
+		return "", nil
+	}
+
+	sourceID, err := strconv.ParseUint(parentID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("error parsing tweet ID: %w", err)
+	}
+
+	userID := s.env.User.ID
+	tootID, err := s.env.DataService.SourceTootID(ctx, uid.New(userID, uid.Twitter, sourceID), userID, uid.Twitter, parentID)
+	if err != nil {
+		return "", err
+	}
+	if tootID == "" {
+		plog.Debugf("Previous tweet %s of thread has not been harvested", parentID)
+	}
+
+	return tootID, nil
+}
@@ -0,0 +1,182 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/config"
+	"github.com/sabertoot/server/internal/data"
+	"github.com/sabertoot/server/internal/source/sourcetest"
+)
+
+// newTestSource returns a source whose client talks to a stand-in for the
+// Twitter API, which also serves the images of the recorded responses.
+func newTestSource(t *testing.T, requests *[]*http.Request) (*tweetSource, *config.Settings) {
+	body, err := os.ReadFile(filepath.Join("testdata", "api", "search_recent.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range []string{"/profile_images/", "/media/", "/ext_tw_video_thumb/"} {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				w.Write([]byte("image"))
+				return
+			}
+		}
+		*requests = append(*requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(string(body), "https://pbs.twimg.com", server.URL)))
+	}))
+	t.Cleanup(server.Close)
+
+	env := sourcetest.NewEnv(t)
+	env.User.StartDate = time.Now().UTC()
+	account := &config.Twitter{Username: "dustinmoris", Token: testToken}
+
+	return &tweetSource{
+		env:     env,
+		name:    config.SourceTypeTwitter,
+		account: account,
+		client:  NewClient(testToken, WithBaseURL(server.URL)),
+	}, env.Settings
+}
+
+func Test_Source_Fetch(t *testing.T) {
+	requests := []*http.Request{}
+	src, settings := newTestSource(t, &requests)
+
+	page, err := src.Fetch(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reply to another account is skipped
+	// and the rest is sorted from oldest to newest.
+	ids := []string{}
+	for _, item := range page.Items {
+		ids = append(ids, item.(*tweetItem).tweet.ID)
+	}
+	if strings.Join(ids, ",") != "1610273004463390721,1610273004463390725,1610273004463390730" {
+		t.Errorf("unexpected items: %v", ids)
+	}
+
+	if !page.More {
+		t.Error("expected more pages")
+	}
+	var c cursor
+	if err = json.Unmarshal([]byte(page.Cursor), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.LatestID != "1610273004463390725" || c.SinceID != "" || c.NextToken == "" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	if _, err = os.Stat(settings.Storage.ProfileImageFullFilePath(1, ".jpg")); err != nil {
+		t.Errorf("profile image has not been downloaded: %v", err)
+	}
+
+	// The next page keeps the since ID of the first one.
+	c.SinceID = "1610273004463390700"
+	resumed, _ := json.Marshal(c)
+	if _, err = src.Fetch(context.Background(), string(resumed)); err != nil {
+		t.Fatal(err)
+	}
+	query := requests[1].URL.Query()
+	if query.Get("since_id") != "1610273004463390700" || query.Get("next_token") != c.NextToken {
+		t.Errorf("unexpected query of resumed harvest: %s", requests[1].URL.RawQuery)
+	}
+}
+
+func Test_Source_Toot(t *testing.T) {
+	requests := []*http.Request{}
+	src, _ := newTestSource(t, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items are saved in order, so the reply finds its parent.
+	toots := make(map[string]*data.Toot)
+	for _, toot := range sourcetest.SaveItems(t, src.env, src, src.name, page) {
+		toots[toot.SourceID] = toot
+	}
+
+	reply := toots["1610273004463390730"]
+	parent := toots["1610273004463390721"]
+	if reply == nil || parent == nil {
+		t.Fatalf("thread is missing: %v", toots)
+	}
+	if reply.InReplyToID != parent.ID {
+		t.Errorf("expected reply to %s, got %q", parent.ID, reply.InReplyToID)
+	}
+
+	latestID, err := src.env.DataService.LatestSourceID(ctx, 1, src.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latestID == "" {
+		t.Error("expected the latest source ID of the saved toots")
+	}
+}
+
+func Test_Source_DownloadMedia(t *testing.T) {
+	requests := []*http.Request{}
+	src, settings := newTestSource(t, &requests)
+	ctx := context.Background()
+
+	page, err := src.Fetch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item *tweetItem
+	for _, i := range page.Items {
+		if len(i.(*tweetItem).tweet.MediaKeys()) > 0 {
+			item = i.(*tweetItem)
+		}
+	}
+	if item == nil {
+		t.Fatal("expected a tweet with media")
+	}
+	toot, err := src.Toot(ctx, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The toot lists its media, which isn't downloaded yet.
+	if len(toot.Media) != 2 || toot.Media[0].FileName != "" || toot.Media[0].AltText != "A saber toothed tiger" {
+		t.Errorf("unexpected listed media: %+v", toot.Media)
+	}
+
+	// Videos are attached as their preview image.
+	media := src.DownloadMedia(ctx, item, toot)
+	if len(media) != 2 {
+		t.Fatalf("expected 2 media, got %d", len(media))
+	}
+	photo, video := media[0], media[1]
+	if photo.Type != "photo" || photo.MIMEType != "image/jpeg" || photo.FileName != toot.ID.String()+"-0.jpg" ||
+		photo.Width != 1200 || photo.Height != 800 || photo.AltText != "A saber toothed tiger" ||
+		!strings.HasSuffix(photo.SourceURL, "/media/FlkzUpHWIAAqD3k.jpg") {
+		t.Errorf("unexpected photo: %+v", photo)
+	}
+	if video.Type != "video" || video.FileName != toot.ID.String()+"-1.jpg" ||
+		!strings.HasSuffix(video.SourceURL, "/ext_tw_video_thumb/1/pu/img/thumb.jpg") {
+		t.Errorf("unexpected video: %+v", video)
+	}
+	for _, m := range media {
+		content, err := os.ReadFile(settings.Storage.MediaFullFilePath(m.FileName))
+		if err != nil || string(content) != "image" {
+			t.Errorf("media %s has not been downloaded: %v", m.FileName, err)
+		}
+	}
+}
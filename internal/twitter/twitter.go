@@ -3,88 +3,297 @@ package twitter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sabertoot/server/internal/plog"
+	"github.com/sabertoot/server/internal/source"
+	"github.com/sabertoot/server/internal/version"
 )
 
 const (
 	v2BaseURL = "https://api.twitter.com/2"
+
+	maxLookupIDs = 100
+
+	// Transient server errors are retried with an exponential backoff.
+	maxRetries        = 3
+	defaultRetryDelay = 2 * time.Second
+
+	// Rate limits are reset every 15 minutes.
+	defaultRateLimitWindow = 15 * time.Minute
+
+	tweetFields = "created_at,author_id,conversation_id,in_reply_to_user_id,referenced_tweets,entities,attachments,edit_history_tweet_ids"
+	expansions  = "author_id,attachments.media_keys,referenced_tweets.id,referenced_tweets.id.author_id"
+	userFields  = "profile_image_url"
+	mediaFields = "type,preview_image_url,url,width,height,alt_text"
 )
 
-func GetTweetsByUser(
+// TweetURL returns the URL of a tweet on Twitter.
+func TweetURL(username string, id string) string {
+	if username == "" {
+		return fmt.Sprintf("%s/i/web/status/%s", twitterBaseURL, id)
+	}
+	return fmt.Sprintf("%s/%s/status/%s", twitterBaseURL, username, id)
+}
+
+// SearchOptions opt in to tweets which are excluded by default.
+type SearchOptions struct {
+	Retweets bool
+	Quotes   bool
+}
+
+// Client is a client of the Twitter API v2 which
+// authenticates with an app's bearer token.
+type Client struct {
+	baseURL     string
+	bearerToken string
+	httpClient  *http.Client
+	retryDelay  time.Duration
+
+	// Endpoints whose rate limit has been exhausted,
+	// mapped to the time when it gets reset.
+	mu        sync.Mutex
+	exhausted map[string]time.Time
+}
+
+type Option func(*Client)
+
+// WithBaseURL replaces the URL of the Twitter API, e.g. for tests.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetryDelay replaces the initial delay before
+// a request which failed with a 5xx error is retried.
+func WithRetryDelay(delay time.Duration) Option {
+	return func(c *Client) {
+		c.retryDelay = delay
+	}
+}
+
+func NewClient(bearerToken string, options ...Option) *Client {
+	c := &Client{
+		baseURL:     v2BaseURL,
+		bearerToken: bearerToken,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		retryDelay:  defaultRetryDelay,
+		exhausted:   make(map[string]time.Time),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// GetTweetsByUser returns a page of the user's most recent tweets,
+// newest first. Retweets and quotes are excluded unless the options
+// include them. Replies are included, because search can't tell replies
+// to the user's own tweets apart from other replies, so callers have to
+// filter them with IsSelfReply.
+func (c *Client) GetTweetsByUser(
 	ctx context.Context,
 	userHandle string,
-	bearerToken string,
 	startDate time.Time,
-	sinceId string,
+	sinceID string,
 	nextToken string,
+	options SearchOptions,
 ) (
-	map[string]any,
+	*TweetsResponse,
 	error,
 ) {
+	search := "from:" + userHandle
+	if !options.Retweets {
+		search += " -is:retweet"
+	}
+	if !options.Quotes {
+		search += " -is:quote"
+	}
 
-	// Build the request URL.
-	query := fmt.Sprintf("from:%s -is:retweet -is:reply -is:quote", userHandle)
-	requestURL :=
-		fmt.Sprintf(
-			"%s/tweets/search/recent?query=%s&max_results=100&sort_order=recency&tweet.fields=created_at,entities&expansions=author_id,attachments.media_keys&user.fields=profile_image_url&media.fields=type,preview_image_url,url,width,height",
-			v2BaseURL,
-			url.QueryEscape(query))
+	query := url.Values{}
+	query.Set("query", search)
+	query.Set("max_results", "100")
+	query.Set("sort_order", "recency")
+	query.Set("tweet.fields", tweetFields)
+	query.Set("expansions", expansions)
+	query.Set("user.fields", userFields)
+	query.Set("media.fields", mediaFields)
 
-	// If we have a sinceId, use that. Otherwise, use the start date.
+	// If we have a sinceID, use that. Otherwise, use the start date.
 	// The Twitter API doesn't allow both parameters at the same time.
-	if sinceId != "" {
-		requestURL = fmt.Sprintf("%s&since_id=%s", requestURL, sinceId)
+	if sinceID != "" {
+		query.Set("since_id", sinceID)
 	} else {
 		// Recent search in Twitter API v2 only allows to go back as far as 7 days.
 		earliestDate := time.Now().UTC().AddDate(0, 0, -7).Add(time.Hour)
 		if startDate.Before(earliestDate) {
 			startDate = earliestDate
 		}
-		requestURL = fmt.Sprintf("%s&start_time=%s", requestURL, startDate.Format(time.RFC3339))
+		query.Set("start_time", startDate.UTC().Format(time.RFC3339))
 	}
 
 	if nextToken != "" {
-		requestURL = fmt.Sprintf("%s&next_token=%s", requestURL, nextToken)
+		query.Set("next_token", nextToken)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	var result TweetsResponse
+	if err := c.get(ctx, "/tweets/search/recent", query, &result); err != nil {
+		return nil, err
 	}
-	req.Header.Set("User-Agent", "Sabertoot/1.0")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
+	return &result, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error executing HTTP request: %w", err)
+// GetTweetsByIDs looks up to 100 tweets by their IDs. Tweets which have
+// been deleted are reported as partial errors of the response.
+func (c *Client) GetTweetsByIDs(
+	ctx context.Context,
+	ids []string,
+) (
+	*TweetsResponse,
+	error,
+) {
+	if len(ids) > maxLookupIDs {
+		return nil, fmt.Errorf("cannot look up more than %d tweets at once", maxLookupIDs)
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad status code from Twitter API: %d", resp.StatusCode)
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	query.Set("tweet.fields", tweetFields)
+	query.Set("expansions", expansions)
+	query.Set("user.fields", userFields)
+	query.Set("media.fields", mediaFields)
+
+	var result TweetsResponse
+	if err := c.get(ctx, "/tweets", query, &result); err != nil {
+		return nil, err
 	}
+	return &result, nil
+}
+
+// get sends a GET request to an endpoint of the API. Requests which fail
+// with a server error are retried with a jittered exponential backoff.
+func (c *Client) get(
+	ctx context.Context,
+	path string,
+	query url.Values,
+	result *TweetsResponse,
+) error {
+	if reset, ok := c.rateLimitReset(path); ok {
+		return &source.RateLimitError{Service: "Twitter API", Reset: reset}
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, path, query, result)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode < 500 || attempt >= maxRetries {
+			return err
+		}
 
-	// ToDo: Check for rate limit exceeded.
-	rateLimitValue := resp.Header.Get("x-rate-limit-remaining")
-	rateLimit, err := strconv.Atoi(rateLimitValue)
-	plog.Debugf("Twitter API rate limit remaining: %d", rateLimit)
+		wait := delay + time.Duration(rand.Int63n(int64(delay)+1))
+		plog.Warningf("Retrying Twitter API request in %s: %s", wait, err.Error())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	path string,
+	query url.Values,
+	result *TweetsResponse,
+) error {
+	requestURL := c.baseURL + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("bad rate limit value '%s': %w", rateLimitValue, err)
+		return fmt.Errorf("error creating HTTP request: %w", err)
 	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
 
-	defer resp.Body.Close()
-	result := map[string]any{}
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&result)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error deserializing HTTP response: %w", err)
+		return fmt.Errorf("error executing HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	remaining := resp.Header.Get("x-rate-limit-remaining")
+	if remaining != "" {
+		plog.Debugf("Twitter API rate limit remaining: %s", remaining)
 	}
 
-	return result, nil
+	if resp.StatusCode == http.StatusTooManyRequests || remaining == "0" {
+		reset := source.ParseUnixReset(resp.Header.Get("x-rate-limit-reset"), defaultRateLimitWindow)
+		c.setRateLimitReset(path, reset)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &source.RateLimitError{Service: "Twitter API", Reset: reset}
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		// The body is a problem document, if anything.
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(apiErr)
+		return apiErr
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error deserializing HTTP response: %w", err)
+	}
+
+	// A successful response can still report errors for some of the
+	// requested resources. If there is no data and an error isn't
+	// about a specific resource, the request has failed as a whole.
+	if len(result.Data) == 0 && len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			if e.ResourceID == "" {
+				return fmt.Errorf("error from Twitter API: %w", e)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) setRateLimitReset(path string, reset time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exhausted[path] = reset
+}
+
+// rateLimitReset returns the time when the exhausted
+// rate limit of an endpoint gets reset.
+func (c *Client) rateLimitReset(path string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reset, ok := c.exhausted[path]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !time.Now().Before(reset) {
+		delete(c.exhausted, path)
+		return time.Time{}, false
+	}
+	return reset, true
 }
@@ -0,0 +1,326 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabertoot/server/internal/source"
+)
+
+const testToken = "test-token"
+
+// newTestServer starts a stand-in for the Twitter API which answers
+// every request with the given status code and recorded response.
+func newTestServer(t *testing.T, statusCode int, fixture string, requests *[]*http.Request) *httptest.Server {
+	body, err := os.ReadFile(filepath.Join("testdata", "api", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			*requests = append(*requests, r)
+		}
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func Test_GetTweetsByUser(t *testing.T) {
+	requests := []*http.Request{}
+	server := newTestServer(t, http.StatusOK, "search_recent.json", &requests)
+	client := NewClient(testToken, WithBaseURL(server.URL))
+
+	result, err := client.GetTweetsByUser(context.Background(), "dustinmoris", time.Time{}, "1610273004463390700", "next", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	req := requests[0]
+	if req.URL.Path != "/tweets/search/recent" {
+		t.Errorf("unexpected path: %s", req.URL.Path)
+	}
+	query := req.URL.Query()
+	if q := query.Get("query"); q != "from:dustinmoris -is:retweet -is:quote" {
+		t.Errorf("unexpected query: %s", q)
+	}
+	if query.Get("since_id") != "1610273004463390700" || query.Get("start_time") != "" {
+		t.Errorf("expected since_id without start_time, got %s", req.URL.RawQuery)
+	}
+	if query.Get("next_token") != "next" {
+		t.Errorf("unexpected next_token: %s", query.Get("next_token"))
+	}
+	if !strings.Contains(query.Get("media.fields"), "alt_text") {
+		t.Errorf("alt_text is missing in media.fields: %s", query.Get("media.fields"))
+	}
+
+	if len(result.Data) != 4 {
+		t.Fatalf("expected 4 tweets, got %d", len(result.Data))
+	}
+	tweet := result.Data[0]
+	if tweet.ID != "1610273004463390721" || tweet.AuthorID != "19380629" {
+		t.Errorf("unexpected tweet: %+v", tweet)
+	}
+	if expected := time.Date(2023, 1, 3, 13, 57, 22, 0, time.UTC); !tweet.CreatedAt.Equal(expected) {
+		t.Errorf("expected created_at %s, got %s", expected, tweet.CreatedAt)
+	}
+	if len(tweet.Entities.URLs) != 2 || tweet.Entities.URLs[1].MediaKey != "3_1610272999999999999" {
+		t.Errorf("unexpected entities: %+v", tweet.Entities)
+	}
+	if !strings.Contains(string(tweet.Raw), `"author_id": "19380629"`) {
+		t.Errorf("raw tweet was not kept: %s", tweet.Raw)
+	}
+
+	edited := result.Data[1]
+	if edited.OriginalID() != "1610273004463390720" || edited.LatestID() != "1610273004463390725" {
+		t.Errorf("unexpected edit history: %s, %s", edited.OriginalID(), edited.LatestID())
+	}
+
+	if tweet.IsSelfReply() || edited.IsSelfReply() {
+		t.Error("tweets which aren't replies are not self replies")
+	}
+	selfReply := result.Data[2]
+	if !selfReply.IsSelfReply() || selfReply.RepliedToID() != tweet.ID {
+		t.Errorf("expected a self reply to %s, got %+v", tweet.ID, selfReply)
+	}
+	if reply := result.Data[3]; reply.IsSelfReply() || reply.RepliedToID() == "" {
+		t.Errorf("expected a reply to someone else, got %+v", reply)
+	}
+
+	media := result.MediaByKey()
+	photo := media[tweet.MediaKeys()[0]]
+	if photo == nil || photo.ImageURL() != "https://pbs.twimg.com/media/FlkzUpHWIAAqD3k.jpg" || photo.AltText != "A saber toothed tiger" {
+		t.Errorf("unexpected photo: %+v", photo)
+	}
+	video := media[tweet.MediaKeys()[1]]
+	if video == nil || video.ImageURL() != "https://pbs.twimg.com/ext_tw_video_thumb/1/pu/img/thumb.jpg" || video.Width != 1280 {
+		t.Errorf("unexpected video: %+v", video)
+	}
+
+	if users := result.Users(); len(users) != 1 || users[0].Username != "dustinmoris" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+	if result.Meta.ResultCount != 4 || result.Meta.NextToken == "" {
+		t.Errorf("unexpected meta: %+v", result.Meta)
+	}
+}
+
+func Test_GetTweetsByUser_StartDate(t *testing.T) {
+	requests := []*http.Request{}
+	server := newTestServer(t, http.StatusOK, "search_recent.json", &requests)
+	client := NewClient(testToken, WithBaseURL(server.URL))
+
+	startDate := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second)
+	if _, err := client.GetTweetsByUser(context.Background(), "dustinmoris", startDate, "", "", SearchOptions{Retweets: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	query := requests[0].URL.Query()
+	if q := query.Get("query"); q != "from:dustinmoris -is:quote" {
+		t.Errorf("unexpected query: %s", q)
+	}
+	if query.Get("start_time") != startDate.Format(time.RFC3339) || query.Has("since_id") || query.Has("next_token") {
+		t.Errorf("unexpected query: %s", requests[0].URL.RawQuery)
+	}
+}
+
+func Test_GetTweetsByIDs_PartialErrors(t *testing.T) {
+	requests := []*http.Request{}
+	server := newTestServer(t, http.StatusOK, "tweets_lookup.json", &requests)
+	client := NewClient(testToken, WithBaseURL(server.URL))
+
+	ids := []string{"1610273004463390721", "1610273004463390722", "1610273004463390723"}
+	result, err := client.GetTweetsByIDs(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query := requests[0].URL.Query().Get("ids"); query != strings.Join(ids, ",") {
+		t.Errorf("unexpected ids: %s", query)
+	}
+	if len(result.Data) != 1 || len(result.Errors) != 2 {
+		t.Fatalf("expected 1 tweet and 2 errors, got %d and %d", len(result.Data), len(result.Errors))
+	}
+
+	// Only deleted tweets count as not found, not protected ones.
+	notFound := result.NotFoundIDs()
+	if len(notFound) != 1 || notFound[0] != "1610273004463390722" {
+		t.Errorf("unexpected not found IDs: %v", notFound)
+	}
+}
+
+func Test_GetTweetsByIDs_TooMany(t *testing.T) {
+	client := NewClient(testToken, WithBaseURL("http://127.0.0.1:0"))
+	ids := make([]string, maxLookupIDs+1)
+	if _, err := client.GetTweetsByIDs(context.Background(), ids); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func Test_Get_Errors(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		StatusCode     int
+		Fixture        string
+		Token          string
+		ExpectedStatus int
+		ExpectedTitle  string
+	}{
+		{"invalid request", http.StatusBadRequest, "invalid_request.json", testToken, http.StatusBadRequest, "Invalid Request"},
+		{"unauthorized", http.StatusOK, "search_recent.json", "wrong-token", http.StatusUnauthorized, ""},
+		{"no data", http.StatusOK, "no_data.json", testToken, 0, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			server := newTestServer(t, testCase.StatusCode, testCase.Fixture, nil)
+			client := NewClient(testCase.Token, WithBaseURL(server.URL))
+
+			_, err := client.GetTweetsByUser(context.Background(), "dustinmoris", time.Time{}, "", "", SearchOptions{})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			var apiErr *APIError
+			if testCase.ExpectedStatus == 0 {
+				var partialErr *Error
+				if !errors.As(err, &partialErr) {
+					t.Errorf("expected a Twitter API error, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an API error, got %v", err)
+			}
+			if apiErr.StatusCode != testCase.ExpectedStatus || apiErr.Title != testCase.ExpectedTitle {
+				t.Errorf("unexpected API error: %+v", apiErr)
+			}
+		})
+	}
+}
+
+func Test_Get_RateLimit(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient(testToken, WithBaseURL(server.URL))
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetTweetsByUser(context.Background(), "dustinmoris", time.Time{}, "", "", SearchOptions{})
+		var rateLimitErr *source.RateLimitError
+		if !errors.As(err, &rateLimitErr) {
+			t.Fatalf("expected a rate limit error, got %v", err)
+		}
+		if !rateLimitErr.Reset.Equal(reset) {
+			t.Errorf("expected reset at %s, got %s", reset, rateLimitErr.Reset)
+		}
+	}
+
+	// The exhausted endpoint is not called again before the reset.
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
+
+func Test_Get_RateLimitExhausted(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "api", "tweets_lookup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient(testToken, WithBaseURL(server.URL))
+
+	// The last request of the window still succeeds.
+	if _, err = client.GetTweetsByIDs(context.Background(), []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetTweetsByIDs(context.Background(), []string{"1"})
+	var rateLimitErr *source.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+
+	// Other endpoints have their own rate limit.
+	if _, err = client.GetTweetsByUser(context.Background(), "dustinmoris", time.Time{}, "", "", SearchOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Get_RetriesServerErrors(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "api", "search_recent.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name             string
+		Failures         int
+		StatusCode       int
+		ExpectedRequests int
+		ExpectedError    bool
+	}{
+		{"recovers", 2, http.StatusServiceUnavailable, 3, false},
+		{"gives up", 10, http.StatusBadGateway, maxRetries + 1, true},
+		{"client errors are not retried", 10, http.StatusForbidden, 1, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= testCase.Failures {
+					w.WriteHeader(testCase.StatusCode)
+					return
+				}
+				w.Write(body)
+			}))
+			t.Cleanup(server.Close)
+			client := NewClient(testToken, WithBaseURL(server.URL), WithRetryDelay(time.Millisecond))
+
+			_, err := client.GetTweetsByUser(context.Background(), "dustinmoris", time.Time{}, "", "", SearchOptions{})
+			if (err != nil) != testCase.ExpectedError {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if requests != testCase.ExpectedRequests {
+				t.Errorf("expected %d requests, got %d", testCase.ExpectedRequests, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package twitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tweet is a tweet as returned by the Twitter API v2.
+type Tweet struct {
+	ID                  string             `json:"id"`
+	Text                string             `json:"text"`
+	CreatedAt           time.Time          `json:"created_at"`
+	AuthorID            string             `json:"author_id,omitempty"`
+	ConversationID      string             `json:"conversation_id,omitempty"`
+	InReplyToUserID     string             `json:"in_reply_to_user_id,omitempty"`
+	Lang                string             `json:"lang,omitempty"`
+	Entities            *Entities          `json:"entities,omitempty"`
+	Attachments         *Attachments       `json:"attachments,omitempty"`
+	ReferencedTweets    []*ReferencedTweet `json:"referenced_tweets,omitempty"`
+	EditHistoryTweetIDs []string           `json:"edit_history_tweet_ids,omitempty"`
+
+	// Raw is the tweet's JSON as it has been received.
+	Raw json.RawMessage `json:"-"`
+}
+
+func (t *Tweet) UnmarshalJSON(data []byte) error {
+	type plain Tweet
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+	t.Raw = append(json.RawMessage{}, data...)
+	return nil
+}
+
+// OriginalID returns the ID of the first version of the tweet. An edited
+// tweet gets a new ID, but its edit history starts with the original one.
+func (t *Tweet) OriginalID() string {
+	if len(t.EditHistoryTweetIDs) > 0 {
+		return t.EditHistoryTweetIDs[0]
+	}
+	return t.ID
+}
+
+// LatestID returns the ID of the latest version of the tweet.
+func (t *Tweet) LatestID() string {
+	if len(t.EditHistoryTweetIDs) > 0 {
+		return t.EditHistoryTweetIDs[len(t.EditHistoryTweetIDs)-1]
+	}
+	return t.ID
+}
+
+// ReferencedID returns the ID of the tweet which is referenced
+// in the given way or an empty string if there is none.
+func (t *Tweet) ReferencedID(referenceType string) string {
+	for _, ref := range t.ReferencedTweets {
+		if ref.Type == referenceType {
+			return ref.ID
+		}
+	}
+	return ""
+}
+
+// RepliedToID returns the ID of the tweet which the
+// tweet replies to or an empty string if it isn't a reply.
+func (t *Tweet) RepliedToID() string {
+	return t.ReferencedID(ReferenceRepliedTo)
+}
+
+// IsSelfReply returns true if the tweet replies to
+// a tweet of its own author, i.e. it continues a thread.
+func (t *Tweet) IsSelfReply() bool {
+	return t.RepliedToID() != "" && t.InReplyToUserID != "" && t.InReplyToUserID == t.AuthorID
+}
+
+// MediaKeys returns the keys of the media attached to the tweet.
+func (t *Tweet) MediaKeys() []string {
+	if t.Attachments == nil {
+		return nil
+	}
+	return t.Attachments.MediaKeys
+}
+
+type Attachments struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+}
+
+// Types of referenced tweets.
+const (
+	ReferenceRetweeted = "retweeted"
+	ReferenceQuoted    = "quoted"
+	ReferenceRepliedTo = "replied_to"
+)
+
+type ReferencedTweet struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type User struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Username        string `json:"username"`
+	ProfileImageURL string `json:"profile_image_url,omitempty"`
+}
+
+// Types of media.
+const (
+	MediaPhoto       = "photo"
+	MediaAnimatedGIF = "animated_gif"
+	MediaVideo       = "video"
+)
+
+type Media struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url,omitempty"`
+	PreviewImageURL string `json:"preview_image_url,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	AltText         string `json:"alt_text,omitempty"`
+}
+
+// ImageURL returns the URL of a photo or the URL of
+// the preview image of an animated GIF or a video.
+func (m *Media) ImageURL() string {
+	if m.Type == MediaPhoto {
+		return m.URL
+	}
+	return m.PreviewImageURL
+}
+
+// Includes are the objects which have been
+// expanded from the tweets in a response.
+type Includes struct {
+	Users  []*User  `json:"users,omitempty"`
+	Media  []*Media `json:"media,omitempty"`
+	Tweets []*Tweet `json:"tweets,omitempty"`
+}
+
+type Meta struct {
+	ResultCount int    `json:"result_count"`
+	NewestID    string `json:"newest_id,omitempty"`
+	OldestID    string `json:"oldest_id,omitempty"`
+	NextToken   string `json:"next_token,omitempty"`
+}
+
+// Error is a partial error of a successful response, e.g. a
+// tweet which couldn't be returned because it has been deleted.
+type Error struct {
+	Title        string `json:"title"`
+	Detail       string `json:"detail"`
+	Type         string `json:"type"`
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	Parameter    string `json:"parameter,omitempty"`
+	Value        string `json:"value,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Title, e.Detail)
+}
+
+// IsNotFound returns true if the error reports a resource which
+// doesn't exist (anymore), e.g. a deleted tweet.
+func (e *Error) IsNotFound() bool {
+	return strings.HasSuffix(e.Type, "/resource-not-found")
+}
+
+// APIError is returned when a request fails as a whole.
+type APIError struct {
+	StatusCode int
+	Title      string `json:"title"`
+	Detail     string `json:"detail"`
+	Type       string `json:"type"`
+}
+
+func (e *APIError) Error() string {
+	if e.Title == "" {
+		return fmt.Sprintf("bad status code from Twitter API: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("bad status code from Twitter API: %d (%s: %s)", e.StatusCode, e.Title, e.Detail)
+}
+
+// TweetsResponse is the response of all endpoints which return a list of tweets.
+type TweetsResponse struct {
+	Data     []*Tweet  `json:"data,omitempty"`
+	Includes *Includes `json:"includes,omitempty"`
+	Meta     *Meta     `json:"meta,omitempty"`
+	Errors   []*Error  `json:"errors,omitempty"`
+}
+
+// MediaByKey indexes the included media by their media key.
+func (r *TweetsResponse) MediaByKey() map[string]*Media {
+	media := make(map[string]*Media)
+	if r.Includes == nil {
+		return media
+	}
+	for _, m := range r.Includes.Media {
+		media[m.MediaKey] = m
+	}
+	return media
+}
+
+// IncludedTweet returns a referenced tweet or nil if it
+// hasn't been included, e.g. because it is protected.
+func (r *TweetsResponse) IncludedTweet(id string) *Tweet {
+	if r.Includes == nil {
+		return nil
+	}
+	for _, t := range r.Includes.Tweets {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// IncludedUser returns an included user by their ID or nil.
+func (r *TweetsResponse) IncludedUser(id string) *User {
+	if r.Includes == nil {
+		return nil
+	}
+	for _, u := range r.Includes.Users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// Users returns the included users.
+func (r *TweetsResponse) Users() []*User {
+	if r.Includes == nil {
+		return nil
+	}
+	return r.Includes.Users
+}
+
+// NotFoundIDs returns the IDs of all requested tweets
+// which don't exist, e.g. because they have been deleted.
+func (r *TweetsResponse) NotFoundIDs() []string {
+	ids := []string{}
+	for _, e := range r.Errors {
+		if e.ResourceType == "tweet" && e.IsNotFound() {
+			ids = append(ids, e.ResourceID)
+		}
+	}
+	return ids
+}
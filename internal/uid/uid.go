@@ -14,12 +14,16 @@ func (s SourceType) Int() int {
 
 const (
 	Twitter SourceType = iota
+	Feed
+	Mastodon
+	Bluesky
+	Directory
+	Local
 
 	// Add more here
 	// Instagram
 	// Facebook
 	// TikTok
-	// RSSFeed
 	// etc.
 )
 
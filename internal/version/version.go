@@ -0,0 +1,20 @@
+// version holds the name and version of the software.
+package version
+
+const (
+	Name       = "sabertoot"
+	Repository = "https://github.com/sabertoot/server"
+)
+
+// Version can be overwritten at build time with:
+// go build -ldflags "-X github.com/sabertoot/server/internal/version.Version=x.y.z"
+var Version = "1.0.0"
+
+// Homepage is the website of the software, which only exists where
+// it has been set at build time just like the version.
+var Homepage = ""
+
+// UserAgent is the User-Agent header sent with outgoing HTTP requests.
+func UserAgent() string {
+	return "Sabertoot/" + Version
+}